@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/containers/common/pkg/retry"
+	"github.com/containers/image/v5/copy"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/types"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// manifestAnnotations returns all annotations in rawManifest, which uses mimeType, keyed by a human-readable location in the manifest
+// (e.g. "manifest", "config", "layer 0", "instance 1").
+// Manifest formats which do not support annotations return an empty map.
+func manifestAnnotations(rawManifest []byte, mimeType string) (map[string]map[string]string, error) {
+	res := map[string]map[string]string{}
+	add := func(location string, annotations map[string]string) {
+		if len(annotations) != 0 {
+			res[location] = annotations
+		}
+	}
+	switch manifest.NormalizedMIMEType(mimeType) {
+	case imgspecv1.MediaTypeImageManifest:
+		m, err := manifest.OCI1FromManifest(rawManifest)
+		if err != nil {
+			return nil, err
+		}
+		add("manifest", m.Annotations)
+		add("config", m.Config.Annotations)
+		for i, l := range m.Layers {
+			add(fmt.Sprintf("layer %d", i), l.Annotations)
+		}
+	case imgspecv1.MediaTypeImageIndex:
+		index, err := manifest.OCI1IndexFromManifest(rawManifest)
+		if err != nil {
+			return nil, err
+		}
+		add("index", index.Annotations)
+		for i, m := range index.Manifests {
+			add(fmt.Sprintf("instance %d", i), m.Annotations)
+		}
+	}
+	return res, nil
+}
+
+// lostAnnotations returns human-readable descriptions of annotations in original which are missing or different in updated,
+// as returned by manifestAnnotations.
+func lostAnnotations(original, updated map[string]map[string]string) []string {
+	res := []string{}
+	for location, annotations := range original {
+		for key, value := range annotations {
+			if v, ok := updated[location][key]; !ok || v != value {
+				res = append(res, fmt.Sprintf("%s: %s", location, key))
+			}
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// sourceManifestAnnotations returns manifestAnnotations of the manifest expected to correspond to the manifest
+// returned by copy.Image when copying from ref using sys and imageListSelection.
+func sourceManifestAnnotations(ctx context.Context, sys *types.SystemContext, ref types.ImageReference, imageListSelection copy.ImageListSelection, retryOpts *retry.Options) (res map[string]map[string]string, retErr error) {
+	var src types.ImageSource
+	if err := retry.IfNecessary(ctx, func() error {
+		var err error
+		src, err = ref.NewImageSource(ctx, sys)
+		return err
+	}, retryOpts); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := src.Close(); err != nil {
+			retErr = noteCloseFailure(retErr, "closing image", err)
+		}
+	}()
+	var rawManifest []byte
+	var mimeType string
+	if err := retry.IfNecessary(ctx, func() error {
+		var err error
+		rawManifest, mimeType, err = src.GetManifest(ctx, nil)
+		return err
+	}, retryOpts); err != nil {
+		return nil, fmt.Errorf("Error retrieving manifest for image: %w", err)
+	}
+	if manifest.MIMETypeIsMultiImage(manifest.NormalizedMIMEType(mimeType)) && imageListSelection == copy.CopySystemImage {
+		list, err := manifest.ListFromBlob(rawManifest, mimeType)
+		if err != nil {
+			return nil, fmt.Errorf("parsing manifest list: %w", err)
+		}
+		instance, err := list.ChooseInstance(sys)
+		if err != nil {
+			return nil, err
+		}
+		if err := retry.IfNecessary(ctx, func() error {
+			var err error
+			rawManifest, mimeType, err = src.GetManifest(ctx, &instance)
+			return err
+		}, retryOpts); err != nil {
+			return nil, fmt.Errorf("Error retrieving manifest for image: %w", err)
+		}
+	}
+	return manifestAnnotations(rawManifest, mimeType)
+}
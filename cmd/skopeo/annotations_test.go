@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/containers/image/v5/manifest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManifestAnnotations(t *testing.T) {
+	ociManifest := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json",` +
+		`"config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef","size":1},` +
+		`"layers":[{"mediaType":"application/vnd.oci.image.layer.v1.tar+gzip","digest":"sha256:1123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef","size":2,"annotations":{"layer-key":"layer-value"}},` +
+		`{"mediaType":"application/vnd.oci.image.layer.v1.tar+gzip","digest":"sha256:2123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef","size":3}],` +
+		`"annotations":{"org.opencontainers.image.title":"test","other":"value"}}`)
+	annotations, err := manifestAnnotations(ociManifest, imgspecv1.MediaTypeImageManifest)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]map[string]string{
+		"manifest": {"org.opencontainers.image.title": "test", "other": "value"},
+		"layer 0":  {"layer-key": "layer-value"},
+	}, annotations)
+
+	// Docker formats have no annotations
+	docker, err := manifestAnnotations([]byte(`{"schemaVersion":2,"mediaType":"application/vnd.docker.distribution.manifest.v2+json"}`), manifest.DockerV2Schema2MediaType)
+	require.NoError(t, err)
+	assert.Empty(t, docker)
+
+	index := testIndex(t, imgspecv1.Platform{OS: "linux", Architecture: "amd64"})
+	indexAnnotations, err := manifestAnnotations(index, imgspecv1.MediaTypeImageIndex)
+	require.NoError(t, err)
+	assert.Empty(t, indexAnnotations)
+
+	_, err = manifestAnnotations([]byte("{"), imgspecv1.MediaTypeImageManifest)
+	assert.Error(t, err)
+
+	assert.Equal(t, []string{"layer 0: layer-key", "manifest: org.opencontainers.image.title", "manifest: other"},
+		lostAnnotations(annotations, docker))
+	assert.Equal(t, []string{}, lostAnnotations(annotations, annotations))
+	assert.Equal(t, []string{"manifest: other"}, lostAnnotations(annotations, map[string]map[string]string{
+		"manifest": {"org.opencontainers.image.title": "test", "other": "changed"},
+		"layer 0":  {"layer-key": "layer-value"},
+	}))
+}
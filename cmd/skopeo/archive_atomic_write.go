@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/containers/image/v5/docker/archive"
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/types"
+)
+
+// atomicArchiveReference is a types.ImageReference wrapper for docker-archive: destinations;
+// image destinations created from it write the archive to a file in a new temporary directory next to path, and only rename it to path
+// after the image is successfully committed, so that a failed or interrupted copy never leaves a truncated archive at path.
+type atomicArchiveReference struct {
+	types.ImageReference
+	path         string      // The path of the archive, as specified by the user
+	existing     fs.FileInfo // The empty file at path, if any, whose permissions and owner are preserved
+	reproducible bool        // Normalize the archive using normalizeArchive before renaming it to path
+}
+
+// newAtomicArchiveReference returns ref wrapped in an atomicArchiveReference, or ref itself if ref can't or should not be
+// written atomically. If reproducible, the archive must be written atomically, and it is normalized.
+func newAtomicArchiveReference(ref types.ImageReference, reproducible bool) (types.ImageReference, error) {
+	path, _, _ := strings.Cut(ref.StringWithinTransport(), ":")
+	fi, err := os.Stat(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return nil, err
+	// Let the docker-archive transport write to devices and pipes directly, and report its usual error for
+	// non-empty files.
+	case !fi.Mode().IsRegular() || fi.Size() != 0:
+		if reproducible {
+			return nil, fmt.Errorf("--reproducible-archive requires a new or empty docker-archive: file, %s is not", path)
+		}
+		return ref, nil
+	}
+	return atomicArchiveReference{ImageReference: ref, path: path, existing: fi, reproducible: reproducible}, nil
+}
+
+// NewImageDestination returns a types.ImageDestination for this reference.
+// The caller must call .Close() on the returned ImageDestination.
+func (ref atomicArchiveReference) NewImageDestination(ctx context.Context, sys *types.SystemContext) (types.ImageDestination, error) {
+	// A unique directory, so that concurrent copies to the same path don't interfere; the docker-archive transport
+	// creates the archive in it as usual, with the usual permissions.
+	tempDir, err := os.MkdirTemp(filepath.Dir(ref.path), "."+filepath.Base(ref.path)+".*.partial")
+	if err != nil {
+		return nil, err
+	}
+	tempPath := filepath.Join(tempDir, filepath.Base(ref.path))
+	var namedTagged reference.NamedTagged
+	if named := ref.ImageReference.DockerReference(); named != nil {
+		nt, ok := named.(reference.NamedTagged)
+		if !ok {
+			_ = os.RemoveAll(tempDir)
+			return nil, fmt.Errorf("unexpected docker-archive destination reference %s", reference.FamiliarString(named))
+		}
+		namedTagged = nt
+	}
+	tempRef, err := archive.NewReference(tempPath, namedTagged)
+	if err != nil {
+		_ = os.RemoveAll(tempDir)
+		return nil, err
+	}
+	dest, err := tempRef.NewImageDestination(ctx, sys)
+	if err != nil {
+		_ = os.RemoveAll(tempDir)
+		return nil, err
+	}
+	return &atomicArchiveDestination{ImageDestination: dest, ref: ref, tempDir: tempDir, tempPath: tempPath}, nil
+}
+
+// atomicArchiveDestination is a types.ImageDestination wrapper which writes a docker-archive: archive to tempPath in tempDir,
+// and renames it to ref.path on commit.
+type atomicArchiveDestination struct {
+	types.ImageDestination
+	ref      atomicArchiveReference
+	tempDir  string
+	tempPath string
+}
+
+// Reference returns the reference used to set up this destination.
+func (d *atomicArchiveDestination) Reference() types.ImageReference {
+	return d.ref
+}
+
+// Commit marks the process of storing the image as successful and asks for the image to be persisted.
+func (d *atomicArchiveDestination) Commit(ctx context.Context, unparsedToplevel types.UnparsedImage) error {
+	// The docker-archive destination finishes writing the archive in Commit.
+	if err := d.ImageDestination.Commit(ctx, unparsedToplevel); err != nil {
+		return err
+	}
+	if d.ref.reproducible {
+		if err := normalizeArchive(d.tempPath); err != nil {
+			return fmt.Errorf("normalizing the archive: %w", err)
+		}
+	}
+	if d.ref.existing != nil {
+		if err := os.Chmod(d.tempPath, d.ref.existing.Mode().Perm()); err != nil {
+			return err
+		}
+		if err := preserveFileOwner(d.tempPath, d.ref.existing); err != nil {
+			return err
+		}
+	}
+	return os.Rename(d.tempPath, d.ref.path)
+}
+
+// Close removes resources associated with an initialized ImageDestination, if any.
+func (d *atomicArchiveDestination) Close() error {
+	err := d.ImageDestination.Close()
+	// After a successful commit, this only contains the empty directory.
+	if err2 := os.RemoveAll(d.tempDir); err2 != nil && err == nil {
+		err = err2
+	}
+	return err
+}
@@ -0,0 +1,26 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"io/fs"
+	"os"
+	"syscall"
+)
+
+// preserveFileOwner changes the owner and group of path to those of the file described by original, if they differ.
+func preserveFileOwner(path string, original fs.FileInfo) error {
+	originalStat, ok := original.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if stat, ok := fi.Sys().(*syscall.Stat_t); ok && stat.Uid == originalStat.Uid && stat.Gid == originalStat.Gid {
+		return nil
+	}
+	return os.Lchown(path, int(originalStat.Uid), int(originalStat.Gid))
+}
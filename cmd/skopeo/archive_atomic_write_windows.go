@@ -0,0 +1,8 @@
+package main
+
+import "io/fs"
+
+// preserveFileOwner does nothing on Windows, where files don't have a Unix owner and group.
+func preserveFileOwner(path string, original fs.FileInfo) error {
+	return nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+
+	"github.com/containers/image/v5/types"
+)
+
+// compressingArchiveReference is a types.ImageReference wrapper for docker-archive: destinations;
+// image destinations created from it ask for layers to be compressed, instead of storing them uncompressed.
+//
+// Each layer is still stored as a separate entry of the archive, and listed in manifest.json; docker load detects
+// the compression of the layer entries on its own.
+type compressingArchiveReference struct {
+	types.ImageReference
+}
+
+// NewImageDestination returns a types.ImageDestination for this reference.
+// The caller must call .Close() on the returned ImageDestination.
+func (ref compressingArchiveReference) NewImageDestination(ctx context.Context, sys *types.SystemContext) (types.ImageDestination, error) {
+	dest, err := ref.ImageReference.NewImageDestination(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	return &compressingArchiveDestination{ImageDestination: dest, ref: ref}, nil
+}
+
+// compressingArchiveDestination is a types.ImageDestination wrapper which asks for layers to be compressed.
+type compressingArchiveDestination struct {
+	types.ImageDestination
+	ref compressingArchiveReference
+}
+
+// Reference returns the reference used to set up this destination.
+func (d *compressingArchiveDestination) Reference() types.ImageReference {
+	return d.ref
+}
+
+// DesiredLayerCompression indicates the kind of compression to apply on layers.
+func (d *compressingArchiveDestination) DesiredLayerCompression() types.LayerCompression {
+	return types.Compress
+}
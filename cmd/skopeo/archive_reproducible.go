@@ -0,0 +1,123 @@
+package main
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// reproducibleArchiveEntry is an entry of an archive being normalized by normalizeArchive.
+type reproducibleArchiveEntry struct {
+	header *tar.Header
+	offset int64 // The offset of the contents of the entry in the original archive
+}
+
+// normalizeArchive rewrites the tar archive at path so that archives with the same entry names, contents and link targets are byte-identical:
+// entries are sorted by name, all timestamps are set to the Unix epoch, owners to root (0:0) without user or group names,
+// regular files are mode 0444, symbolic links 0777 and directories 0755, and extended attributes and PAX records are dropped.
+func normalizeArchive(path string) (retErr error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	srcInfo, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	entries := []reproducibleArchiveEntry{}
+	names := map[string]struct{}{}
+	tr := tar.NewReader(src)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", path, err)
+		}
+		if _, ok := names[hdr.Name]; ok {
+			return fmt.Errorf("%s contains %s more than once", path, hdr.Name)
+		}
+		names[hdr.Name] = struct{}{}
+		// tar.Reader does not read ahead, and skips the contents of entries using Seek, so the current offset is the start of the contents.
+		offset, err := src.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, reproducibleArchiveEntry{header: hdr, offset: offset})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].header.Name < entries[j].header.Name
+	})
+
+	dest, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".normalized")
+	if err != nil {
+		return err
+	}
+	destPath := dest.Name()
+	defer func() {
+		if dest != nil {
+			dest.Close()
+		}
+		if retErr != nil {
+			if err := os.Remove(destPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				retErr = noteCloseFailure(retErr, "removing the normalized archive", err)
+			}
+		}
+	}()
+	tw := tar.NewWriter(dest)
+	for _, entry := range entries {
+		hdr, err := normalizedArchiveHeader(entry.header)
+		if err != nil {
+			return fmt.Errorf("normalizing %s in %s: %w", entry.header.Name, path, err)
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, io.NewSectionReader(src, entry.offset, entry.header.Size)); err != nil {
+			return fmt.Errorf("copying %s in %s: %w", entry.header.Name, path, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := dest.Chmod(srcInfo.Mode().Perm()); err != nil { // os.CreateTemp uses 0600
+		return err
+	}
+	err = dest.Close()
+	dest = nil
+	if err != nil {
+		return err
+	}
+	return os.Rename(destPath, path)
+}
+
+// normalizedArchiveHeader returns a copy of hdr normalized as described in normalizeArchive.
+func normalizedArchiveHeader(hdr *tar.Header) (*tar.Header, error) {
+	res := &tar.Header{
+		Typeflag: hdr.Typeflag,
+		Name:     hdr.Name,
+		Linkname: hdr.Linkname,
+		Size:     hdr.Size,
+		ModTime:  time.Unix(0, 0),
+	}
+	switch hdr.Typeflag {
+	case tar.TypeReg:
+		res.Mode = 0o444
+	case tar.TypeSymlink:
+		res.Mode = 0o777
+	case tar.TypeDir:
+		res.Mode = 0o755
+	default:
+		return nil, fmt.Errorf("unexpected entry type %q", hdr.Typeflag)
+	}
+	return res, nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readTestArchive returns the headers and contents of the entries of the tar archive at path, in order.
+func readTestArchive(t *testing.T, path string) ([]*tar.Header, []string) {
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	headers := []*tar.Header{}
+	contents := []string{}
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		data, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		headers = append(headers, hdr)
+		contents = append(contents, string(data))
+	}
+	return headers, contents
+}
+
+func TestNormalizeArchive(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range []struct {
+		hdr      tar.Header
+		contents string
+	}{
+		{tar.Header{Typeflag: tar.TypeReg, Name: "b", Mode: 0o600, Uid: 1000, Gid: 1000, Uname: "user", Gname: "group", ModTime: time.Now(),
+			PAXRecords: map[string]string{"SCHILY.xattr.user.test": "value"}}, "second"},
+		{tar.Header{Typeflag: tar.TypeDir, Name: "a/", Mode: 0o700, ModTime: time.Now()}, ""},
+		{tar.Header{Typeflag: tar.TypeSymlink, Name: "a/link", Linkname: "../b", ModTime: time.Now()}, ""},
+		{tar.Header{Typeflag: tar.TypeReg, Name: "a/file", Mode: 0o644, ModTime: time.Now()}, "first"},
+	} {
+		hdr := e.hdr
+		hdr.Size = int64(len(e.contents))
+		err := tw.WriteHeader(&hdr)
+		require.NoError(t, err)
+		_, err = tw.Write([]byte(e.contents))
+		require.NoError(t, err)
+	}
+	err := tw.Close()
+	require.NoError(t, err)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "archive.tar")
+	err = os.WriteFile(path, buf.Bytes(), 0o640)
+	require.NoError(t, err)
+
+	err = normalizeArchive(path)
+	require.NoError(t, err)
+	headers, contents := readTestArchive(t, path)
+	names := []string{}
+	for _, hdr := range headers {
+		names = append(names, hdr.Name)
+		assert.Equal(t, int64(0), hdr.ModTime.Unix(), hdr.Name)
+		assert.Equal(t, 0, hdr.Uid, hdr.Name)
+		assert.Equal(t, 0, hdr.Gid, hdr.Name)
+		assert.Empty(t, hdr.Uname, hdr.Name)
+		assert.Empty(t, hdr.PAXRecords, hdr.Name)
+	}
+	assert.Equal(t, []string{"a/", "a/file", "a/link", "b"}, names)
+	assert.Equal(t, []string{"", "first", "", "second"}, contents)
+	assert.Equal(t, []int64{0o755, 0o444, 0o777, 0o444}, []int64{headers[0].Mode, headers[1].Mode, headers[2].Mode, headers[3].Mode})
+	assert.Equal(t, "../b", headers[2].Linkname)
+	fi, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o640), fi.Mode().Perm())
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	// Normalizing is idempotent.
+	normalized, err := os.ReadFile(path)
+	require.NoError(t, err)
+	err = normalizeArchive(path)
+	require.NoError(t, err)
+	renormalized, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, normalized, renormalized)
+
+	// Duplicate entries are rejected.
+	buf.Reset()
+	tw = tar.NewWriter(&buf)
+	for i := 0; i < 2; i++ {
+		err = tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: "dup"})
+		require.NoError(t, err)
+	}
+	err = tw.Close()
+	require.NoError(t, err)
+	err = os.WriteFile(path, buf.Bytes(), 0o644)
+	require.NoError(t, err)
+	err = normalizeArchive(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "contains dup more than once")
+}
+
+func TestCopyReproducibleArchive(t *testing.T) {
+	src := testDirImageWithBlobs(t)
+	archives := [][]byte{}
+	for i := 0; i < 2; i++ {
+		dest := filepath.Join(t.TempDir(), "archive.tar")
+		_, err := runSkopeo("--insecure-policy", "copy", "--reproducible-archive", "dir:"+src, "docker-archive:"+dest+":example.com/test:latest")
+		require.NoError(t, err)
+		headers, _ := readTestArchive(t, dest)
+		for j := 1; j < len(headers); j++ {
+			assert.Less(t, headers[j-1].Name, headers[j].Name)
+		}
+		contents, err := os.ReadFile(dest)
+		require.NoError(t, err)
+		archives = append(archives, contents)
+	}
+	assert.Equal(t, archives[0], archives[1])
+
+	out, err := runSkopeo("--insecure-policy", "copy", "--reproducible-archive", "dir:"+src, "dir:"+t.TempDir())
+	assertTestFailed(t, out, err, "--reproducible-archive requires a docker-archive: destination, not dir:")
+	out, err = runSkopeo("--insecure-policy", "copy", "--reproducible-archive", "dir:"+src, "docker-archive:/dev/null:example.com/test:latest")
+	assertTestFailed(t, out, err, "--reproducible-archive requires a new or empty docker-archive: file")
+}
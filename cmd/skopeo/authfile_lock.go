@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/containers/image/v5/types"
+	"github.com/containers/storage/pkg/homedir"
+	"github.com/containers/storage/pkg/lockfile"
+)
+
+// authFileWritePath returns the path of the credentials file which github.com/containers/common/pkg/auth.Login and Logout modify,
+// given sys and the values of their --authfile and --compat-auth-file options.
+// Keep this in sync with c/common/pkg/auth.systemContextWithOptions and c/image/pkg/docker/config.getPathToAuth.
+func authFileWritePath(sys *types.SystemContext, authFile, dockerCompatAuthFile string) string {
+	switch {
+	case authFile != "":
+		return authFile
+	case dockerCompatAuthFile != "":
+		return dockerCompatAuthFile
+	}
+	if authFileVar := os.Getenv("REGISTRY_AUTH_FILE"); authFileVar != "" {
+		return authFileVar
+	}
+	if dockerConfig := os.Getenv("DOCKER_CONFIG"); dockerConfig != "" {
+		return filepath.Join(dockerConfig, "config.json")
+	}
+	if sys != nil && sys.AuthFilePath != "" {
+		return sys.AuthFilePath
+	}
+	if runtime.GOOS != "linux" {
+		return filepath.Join(homedir.Get(), ".config", "containers", "auth.json")
+	}
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		return filepath.Join(runtimeDir, "containers", "auth.json")
+	}
+	return fmt.Sprintf("/run/containers/%d/auth.json", os.Getuid())
+}
+
+// lockAuthFile takes an exclusive lock protecting updates of the credentials file at path,
+// so that concurrent skopeo login and logout processes don't lose each other's updates.
+// The caller must call .Unlock() on the returned lock.
+func lockAuthFile(path string) (*lockfile.LockFile, error) {
+	// The credentials file is replaced on every update, so it can't hold the lock itself.
+	lock, err := lockfile.GetLockFile(path + ".lock")
+	if err != nil {
+		return nil, fmt.Errorf("locking credentials file %s: %w", path, err)
+	}
+	lock.Lock()
+	return lock, nil
+}
+
+// setDockerCompatAuthFile updates *dockerCompatAuthFile, the value of --compat-auth-file, for --docker-compat:
+// to $DOCKER_CONFIG/config.json if DOCKER_CONFIG is set, or ~/.docker/config.json otherwise, the file used by Docker clients.
+// authFile is the value of --authfile.
+func setDockerCompatAuthFile(authFile string, dockerCompatAuthFile *string) error {
+	if authFile != "" || *dockerCompatAuthFile != "" {
+		return errors.New("--docker-compat can not be used together with --authfile or --compat-auth-file")
+	}
+	if dockerConfig := os.Getenv("DOCKER_CONFIG"); dockerConfig != "" {
+		*dockerCompatAuthFile = filepath.Join(dockerConfig, "config.json")
+	} else {
+		*dockerCompatAuthFile = filepath.Join(homedir.Get(), ".docker", "config.json")
+	}
+	return nil
+}
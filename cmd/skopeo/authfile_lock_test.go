@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/containers/image/v5/types"
+	"github.com/containers/storage/pkg/homedir"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthFileWritePath(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("The default paths are only tested on Linux")
+	}
+	t.Setenv("REGISTRY_AUTH_FILE", "")
+	t.Setenv("DOCKER_CONFIG", "")
+	t.Setenv("XDG_RUNTIME_DIR", "")
+
+	assert.Equal(t, "/auth.json", authFileWritePath(nil, "/auth.json", ""))
+	assert.Equal(t, "/config.json", authFileWritePath(nil, "", "/config.json"))
+	assert.Equal(t, "/sys.json", authFileWritePath(&types.SystemContext{AuthFilePath: "/sys.json"}, "", ""))
+	assert.Equal(t, fmt.Sprintf("/run/containers/%d/auth.json", os.Getuid()), authFileWritePath(nil, "", ""))
+
+	t.Setenv("XDG_RUNTIME_DIR", "/xdg")
+	assert.Equal(t, "/xdg/containers/auth.json", authFileWritePath(nil, "", ""))
+	t.Setenv("DOCKER_CONFIG", "/docker")
+	assert.Equal(t, "/docker/config.json", authFileWritePath(nil, "", ""))
+	t.Setenv("REGISTRY_AUTH_FILE", "/env.json")
+	assert.Equal(t, "/env.json", authFileWritePath(nil, "", ""))
+	assert.Equal(t, "/auth.json", authFileWritePath(nil, "/auth.json", ""))
+}
+
+func TestLockAuthFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "containers", "auth.json")
+	lock, err := lockAuthFile(path)
+	require.NoError(t, err)
+	assert.FileExists(t, path+".lock")
+	assert.NoFileExists(t, path)
+	lock.Unlock()
+}
+
+func TestSetDockerCompatAuthFile(t *testing.T) {
+	t.Setenv("DOCKER_CONFIG", "")
+	path := ""
+	err := setDockerCompatAuthFile("", &path)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(homedir.Get(), ".docker", "config.json"), path)
+
+	t.Setenv("DOCKER_CONFIG", "/docker")
+	path = ""
+	err = setDockerCompatAuthFile("", &path)
+	require.NoError(t, err)
+	assert.Equal(t, "/docker/config.json", path)
+
+	err = setDockerCompatAuthFile("/auth.json", &path)
+	assert.Error(t, err)
+	path = "/config.json"
+	err = setDockerCompatAuthFile("", &path)
+	assert.Error(t, err)
+}
+
+func TestLogoutDockerCompat(t *testing.T) {
+	dockerConfig := t.TempDir()
+	t.Setenv("DOCKER_CONFIG", dockerConfig)
+	configPath := filepath.Join(dockerConfig, "config.json")
+	err := os.WriteFile(configPath, []byte(`{"auths":{"example.com":{"auth":"dXNlcjpwYXNz"},"other.example.com":{"auth":"dXNlcjpwYXNz"}},`+
+		`"credHelpers":{"helper.example.com":"helper"},"psFormat":"table"}`), 0o600)
+	require.NoError(t, err)
+
+	_, err = runSkopeo("logout", "--docker-compat", "example.com")
+	require.NoError(t, err)
+	contents, err := os.ReadFile(configPath)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"auths":{"other.example.com":{"auth":"dXNlcjpwYXNz"}},"credHelpers":{"helper.example.com":"helper"},"psFormat":"table"}`, string(contents))
+
+	out, err := runSkopeo("logout", "--docker-compat", "--authfile", filepath.Join(dockerConfig, "auth.json"), "example.com")
+	assertTestFailed(t, out, err, "--docker-compat can not be used together with --authfile or --compat-auth-file")
+}
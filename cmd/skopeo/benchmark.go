@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/containers/image/v5/copy"
+	"github.com/containers/image/v5/directory"
+	"github.com/containers/image/v5/signature"
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/transports/alltransports"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/spf13/cobra"
+)
+
+type benchmarkOptions struct {
+	global     *globalOptions
+	srcImage   *imageOptions
+	destImage  *imageDestOptions
+	iterations int    // Number of times the image is pulled (and pushed)
+	dest       string // Also measure pushing the pulled image to this destination, if not empty
+}
+
+func benchmarkCmd(global *globalOptions) *cobra.Command {
+	sharedFlags, sharedOpts := sharedImageFlags()
+	srcFlags, srcOpts := imageFlags(global, sharedOpts, nil, "src-", "screds")
+	destFlags, destOpts := imageDestFlags(global, sharedOpts, nil, "dest-", "dcreds")
+	opts := benchmarkOptions{
+		global:    global,
+		srcImage:  srcOpts,
+		destImage: destOpts,
+	}
+	cmd := &cobra.Command{
+		Use:   "benchmark [command options] IMAGE-NAME",
+		Short: "Measure the throughput of pulling, and optionally pushing, IMAGE-NAME",
+		Long: `Pull "IMAGE-NAME" into a temporary directory a number of times, optionally pushing it to --dest,
+and output a JSON report of the total time, throughput and per-blob time to first byte.
+
+See skopeo-benchmark(1) for details.
+`,
+		RunE:              commandAction(opts.run),
+		Example:           `skopeo benchmark --iterations 5 docker://registry.example.com/busybox:latest`,
+		ValidArgsFunction: autocompleteSupportedTransports,
+	}
+	adjustUsage(cmd)
+	flags := cmd.Flags()
+	flags.AddFlagSet(&sharedFlags)
+	flags.AddFlagSet(&srcFlags)
+	flags.AddFlagSet(&destFlags)
+	flags.IntVar(&opts.iterations, "iterations", 3, "pull (and push) the image `N` times")
+	flags.StringVar(&opts.dest, "dest", "", "also push the pulled image to `IMAGE-NAME`, and measure the push")
+	return cmd
+}
+
+// benchmarkReport is the output of (skopeo benchmark).
+// All times are in seconds, and all throughputs in bytes per second.
+type benchmarkReport struct {
+	Image       string
+	Destination string `json:",omitempty"`
+	Iterations  int
+	Pull        benchmarkPhase
+	Push        *benchmarkPhase `json:",omitempty"`
+}
+
+// benchmarkPhase is the part of benchmarkReport about pulling or pushing the image.
+type benchmarkPhase struct {
+	Runs            []benchmarkRun
+	TotalSeconds    benchmarkPercentiles
+	BytesPerSecond  benchmarkPercentiles
+	TimeToFirstByte *benchmarkPercentiles `json:",omitempty"` // Of all blobs in all runs
+}
+
+// benchmarkRun describes a single pull or push of the image.
+type benchmarkRun struct {
+	TotalSeconds   float64
+	Bytes          int64 // Of all blobs read from the source; blobs reused by the destination are not read
+	BytesPerSecond float64
+	Blobs          []benchmarkBlob `json:",omitempty"`
+}
+
+// benchmarkBlob describes reading a single blob from the source.
+type benchmarkBlob struct {
+	Digest          digest.Digest
+	Bytes           int64
+	TimeToFirstByte float64
+	TotalSeconds    float64
+}
+
+// benchmarkPercentiles summarizes a set of values.
+type benchmarkPercentiles struct {
+	Min, P50, P90, P99, Max float64
+}
+
+// newBenchmarkPercentiles returns the percentiles of values, using the nearest-rank method.
+func newBenchmarkPercentiles(values []float64) benchmarkPercentiles {
+	if len(values) == 0 {
+		return benchmarkPercentiles{}
+	}
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+	percentile := func(p float64) float64 {
+		rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+		if rank < 1 {
+			rank = 1
+		}
+		return sorted[rank-1]
+	}
+	return benchmarkPercentiles{
+		Min: sorted[0],
+		P50: percentile(50),
+		P90: percentile(90),
+		P99: percentile(99),
+		Max: sorted[len(sorted)-1],
+	}
+}
+
+// newBenchmarkPhase returns a benchmarkPhase summarizing runs; if ttfb, it includes the time to first byte of their blobs.
+func newBenchmarkPhase(runs []benchmarkRun, ttfb bool) benchmarkPhase {
+	res := benchmarkPhase{Runs: runs}
+	totals, throughputs, firstBytes := []float64{}, []float64{}, []float64{}
+	for _, run := range runs {
+		totals = append(totals, run.TotalSeconds)
+		throughputs = append(throughputs, run.BytesPerSecond)
+		for _, blob := range run.Blobs {
+			firstBytes = append(firstBytes, blob.TimeToFirstByte)
+		}
+	}
+	res.TotalSeconds = newBenchmarkPercentiles(totals)
+	res.BytesPerSecond = newBenchmarkPercentiles(throughputs)
+	if ttfb {
+		p := newBenchmarkPercentiles(firstBytes)
+		res.TimeToFirstByte = &p
+	}
+	return res
+}
+
+func (opts *benchmarkOptions) run(args []string, stdout io.Writer) (retErr error) {
+	if len(args) != 1 {
+		return errorShouldDisplayUsage{errors.New("Exactly one argument expected")}
+	}
+	if opts.iterations < 1 {
+		return fmt.Errorf("--iterations must be at least 1, not %d", opts.iterations)
+	}
+	imageNames := args
+	if opts.dest != "" {
+		imageNames = append(imageNames, opts.dest)
+	}
+	if err := reexecIfNecessaryForImages(imageNames...); err != nil {
+		return err
+	}
+
+	srcRef, err := parseSourceImageName(args[0])
+	if err != nil {
+		return fmt.Errorf("Invalid source name %s: %v", args[0], err)
+	}
+	var destRef types.ImageReference
+	if opts.dest != "" {
+		destRef, err = alltransports.ParseImageName(opts.dest)
+		if err != nil {
+			return fmt.Errorf("Invalid destination name %s: %v", opts.dest, err)
+		}
+	}
+	sourceCtx, err := opts.srcImage.newSystemContext()
+	if err != nil {
+		return err
+	}
+	destinationCtx, err := opts.destImage.newSystemContext()
+	if err != nil {
+		return err
+	}
+
+	policyContext, err := opts.global.getPolicyContext()
+	if err != nil {
+		return fmt.Errorf("Error loading trust policy: %v", err)
+	}
+	defer func() {
+		if err := policyContext.Destroy(); err != nil {
+			retErr = noteCloseFailure(retErr, "tearing down policy context", err)
+		}
+	}()
+	// The pulled image has been verified against the policy while pulling it.
+	pushPolicyContext, err := signature.NewPolicyContext(insecureAcceptAnythingPolicy())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := pushPolicyContext.Destroy(); err != nil {
+			retErr = noteCloseFailure(retErr, "tearing down policy context", err)
+		}
+	}()
+
+	ctx, cancel := opts.global.commandTimeoutContext()
+	defer cancel()
+
+	var pulls, pushes []benchmarkRun
+	for i := 0; i < opts.iterations; i++ {
+		dir, err := opts.global.newTemporaryDir("skopeo-benchmark")
+		if err != nil {
+			return err
+		}
+		stagedRef, err := directory.NewReference(dir)
+		if err != nil {
+			return err
+		}
+		pull, err := benchmarkCopy(ctx, policyContext, stagedRef, srcRef, &copy.Options{SourceCtx: sourceCtx})
+		if err != nil {
+			return fmt.Errorf("Error pulling %s: %w", transports.ImageName(srcRef), err)
+		}
+		pulls = append(pulls, pull)
+		if destRef != nil {
+			push, err := benchmarkCopy(ctx, pushPolicyContext, destRef, stagedRef, &copy.Options{DestinationCtx: destinationCtx})
+			if err != nil {
+				return fmt.Errorf("Error pushing to %s: %w", transports.ImageName(destRef), err)
+			}
+			push.Blobs = nil // Reading the staged blobs is not interesting
+			pushes = append(pushes, push)
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+	}
+
+	report := benchmarkReport{
+		Image:      transports.ImageName(srcRef),
+		Iterations: opts.iterations,
+		Pull:       newBenchmarkPhase(pulls, true),
+	}
+	if destRef != nil {
+		report.Destination = transports.ImageName(destRef)
+		push := newBenchmarkPhase(pushes, false)
+		report.Push = &push
+	}
+	out, err := json.MarshalIndent(report, "", "    ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(stdout, "%s\n", string(out))
+	return err
+}
+
+// benchmarkCopy copies srcRef to destRef using policyContext and options, and returns the measurements.
+func benchmarkCopy(ctx context.Context, policyContext *signature.PolicyContext, destRef, srcRef types.ImageReference, options *copy.Options) (benchmarkRun, error) {
+	stats := &benchmarkStats{}
+	start := time.Now()
+	if _, err := copy.Image(ctx, policyContext, destRef, benchmarkReference{ImageReference: srcRef, stats: stats}, options); err != nil {
+		return benchmarkRun{}, err
+	}
+	total := time.Since(start).Seconds()
+	res := benchmarkRun{TotalSeconds: total, Blobs: stats.blobs}
+	for _, blob := range stats.blobs {
+		res.Bytes += blob.Bytes
+	}
+	if total > 0 {
+		res.BytesPerSecond = float64(res.Bytes) / total
+	}
+	return res, nil
+}
+
+// benchmarkStats collects the blobs read from a benchmarkSource.
+type benchmarkStats struct {
+	mutex sync.Mutex
+	blobs []benchmarkBlob
+}
+
+// benchmarkReference is a types.ImageReference wrapper; image sources created from it
+// record the time to first byte, total time and size of every blob read from them in stats.
+type benchmarkReference struct {
+	types.ImageReference
+	stats *benchmarkStats
+}
+
+// NewImageSource returns a types.ImageSource for this reference.
+// The caller must call .Close() on the returned ImageSource.
+func (ref benchmarkReference) NewImageSource(ctx context.Context, sys *types.SystemContext) (types.ImageSource, error) {
+	src, err := ref.ImageReference.NewImageSource(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	return &benchmarkSource{ImageSource: src, ref: ref}, nil
+}
+
+// benchmarkSource is a types.ImageSource wrapper which updates ref.stats.
+type benchmarkSource struct {
+	types.ImageSource
+	ref benchmarkReference
+}
+
+// Reference returns the reference used to set up this source.
+func (s *benchmarkSource) Reference() types.ImageReference {
+	return s.ref
+}
+
+// GetBlob returns a stream for the specified blob, and the blob’s size (or -1 if unknown).
+// The blob is recorded in s.ref.stats when the stream is closed.
+func (s *benchmarkSource) GetBlob(ctx context.Context, info types.BlobInfo, cache types.BlobInfoCache) (io.ReadCloser, int64, error) {
+	start := time.Now()
+	stream, size, err := s.ImageSource.GetBlob(ctx, info, cache)
+	if err != nil {
+		return nil, -1, err
+	}
+	return &benchmarkReader{source: stream, stats: s.ref.stats, start: start, blob: benchmarkBlob{Digest: info.Digest}}, size, nil
+}
+
+// benchmarkReader is an io.ReadCloser which measures reading a blob from source, and records it in stats on Close.
+type benchmarkReader struct {
+	source io.ReadCloser
+	stats  *benchmarkStats
+	start  time.Time
+	blob   benchmarkBlob
+	done   bool // Data has been read until EOF or an error
+}
+
+func (r *benchmarkReader) Read(p []byte) (int, error) {
+	n, err := r.source.Read(p)
+	if n > 0 && r.blob.Bytes == 0 {
+		r.blob.TimeToFirstByte = time.Since(r.start).Seconds()
+	}
+	r.blob.Bytes += int64(n)
+	if err != nil && !r.done {
+		r.done = true
+		r.blob.TotalSeconds = time.Since(r.start).Seconds()
+	}
+	return n, err
+}
+
+func (r *benchmarkReader) Close() error {
+	if !r.done {
+		r.blob.TotalSeconds = time.Since(r.start).Seconds()
+	}
+	r.stats.mutex.Lock()
+	r.stats.blobs = append(r.stats.blobs, r.blob)
+	r.stats.mutex.Unlock()
+	return r.source.Close()
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewBenchmarkPercentiles(t *testing.T) {
+	assert.Equal(t, benchmarkPercentiles{}, newBenchmarkPercentiles(nil))
+	assert.Equal(t, benchmarkPercentiles{Min: 2, P50: 2, P90: 2, P99: 2, Max: 2}, newBenchmarkPercentiles([]float64{2}))
+	values := []float64{}
+	for i := 100; i >= 1; i-- {
+		values = append(values, float64(i))
+	}
+	assert.Equal(t, benchmarkPercentiles{Min: 1, P50: 50, P90: 90, P99: 99, Max: 100}, newBenchmarkPercentiles(values))
+	assert.Equal(t, float64(100), values[0]) // The input is not modified
+}
+
+func TestBenchmark(t *testing.T) {
+	src := testDirImageWithBlobs(t)
+	out, err := runSkopeo("--insecure-policy", "benchmark", "--iterations", "2", "--dest", "dir:"+t.TempDir(), "dir:"+src)
+	require.NoError(t, err)
+	var report benchmarkReport
+	err = json.Unmarshal([]byte(out), &report)
+	require.NoError(t, err)
+	assert.Equal(t, "dir:"+src, report.Image)
+	assert.Equal(t, 2, report.Iterations)
+	require.Len(t, report.Pull.Runs, 2)
+	for _, run := range report.Pull.Runs {
+		// The config and the layer
+		assert.Len(t, run.Blobs, 2)
+		assert.Equal(t, int64(len(`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers","diff_ids":[]}}`)+len("not really a layer")), run.Bytes)
+	}
+	require.NotNil(t, report.Pull.TimeToFirstByte)
+	require.NotNil(t, report.Push)
+	require.Len(t, report.Push.Runs, 2)
+	assert.Nil(t, report.Push.TimeToFirstByte)
+
+	out, err = runSkopeo("--insecure-policy", "benchmark", "--iterations", "0", "dir:"+src)
+	assertTestFailed(t, out, err, "--iterations must be at least 1")
+}
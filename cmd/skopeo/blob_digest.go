@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/spf13/cobra"
+)
+
+type blobDigestOptions struct {
+	algorithm string // Digest algorithm to use
+}
+
+func blobDigestCmd() *cobra.Command {
+	var opts blobDigestOptions
+	cmd := &cobra.Command{
+		Use:     "blob-digest [command options] FILE",
+		Short:   "Compute a digest of a blob file",
+		RunE:    commandAction(opts.run),
+		Example: "skopeo blob-digest layer.tar.gz",
+	}
+	adjustUsage(cmd)
+	flags := cmd.Flags()
+	flags.StringVar(&opts.algorithm, "algorithm", digest.Canonical.String(), "Digest `ALGORITHM` (sha256, sha384 or sha512)")
+	return cmd
+}
+
+func (opts *blobDigestOptions) run(args []string, stdout io.Writer) error {
+	if len(args) != 1 {
+		return errors.New("Usage: skopeo blob-digest [--algorithm ALGORITHM] file")
+	}
+	blobPath := args[0]
+
+	algorithm := digest.Algorithm(opts.algorithm)
+	if !algorithm.Available() {
+		return fmt.Errorf("Unsupported digest algorithm %q", opts.algorithm)
+	}
+	f, err := os.Open(blobPath)
+	if err != nil {
+		return fmt.Errorf("Error reading blob from %s: %v", blobPath, err)
+	}
+	defer f.Close()
+	d, err := algorithm.FromReader(f)
+	if err != nil {
+		return fmt.Errorf("Error reading blob from %s: %v", blobPath, err)
+	}
+	fmt.Fprintf(stdout, "%s\n", d)
+	return nil
+}
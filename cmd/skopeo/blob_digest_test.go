@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlobDigest(t *testing.T) {
+	// Invalid command-line arguments
+	for _, args := range [][]string{
+		{},
+		{"a1", "a2"},
+	} {
+		out, err := runSkopeo(append([]string{"blob-digest"}, args...)...)
+		assertTestFailed(t, out, err, "Usage")
+	}
+
+	blobPath := filepath.Join(t.TempDir(), "blob")
+	err := os.WriteFile(blobPath, []byte("not really a layer"), 0o644)
+	require.NoError(t, err)
+
+	// Error reading the blob
+	out, err := runSkopeo("blob-digest", "/this/does/not/exist")
+	assertTestFailed(t, out, err, "/this/does/not/exist")
+
+	// Unsupported algorithm
+	out, err = runSkopeo("blob-digest", "--algorithm", "md5", blobPath)
+	assertTestFailed(t, out, err, "Unsupported digest algorithm")
+
+	// Success
+	out, err = runSkopeo("blob-digest", blobPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "sha256:3acc2385b8944a82d4f820493763955e9e84c6e3a28201626155c0fe49792b06\n", out)
+	out, err = runSkopeo("blob-digest", "--algorithm", "sha512", blobPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "sha512:d673f23501b030d4e2669bd4ea103ae2bc58752c47402a5a12faeeddef63df5db89d805ad6f23f95f9d7a206b2f9d20a3aa1290a43c08633b9cd6ca6214d977b\n", out)
+}
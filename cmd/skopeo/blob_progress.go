@@ -0,0 +1,15 @@
+package main
+
+import digest "github.com/opencontainers/go-digest"
+
+// maxQueuedEvents is the number of events which may be waiting to be written to the proxy event stream, or sent to --progress-webhook;
+// if the receiver does not keep up, further events are dropped.
+const maxQueuedEvents = 128
+
+// blobProgressEvent reports the progress of reading a blob, to the proxy event stream while GetBlob is streaming it,
+// or to --progress-webhook while copying it.
+type blobProgressEvent struct {
+	Digest    digest.Digest `json:"digest"`
+	BytesRead int64         `json:"bytesRead"`
+	Total     int64         `json:"total"`
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+)
+
+// sizeCheckingReference is a types.ImageReference wrapper; image sources created from it
+// fail reading a blob as soon as it is larger than the size declared for it,
+// and, if strict, also if it is smaller, or its size was not declared at all.
+// The digest of every blob is always verified by c/image/copy after reading it.
+type sizeCheckingReference struct {
+	types.ImageReference
+	strict bool
+}
+
+// withBlobSizeChecks returns srcRef, wrapped to check blob sizes if --verify-blobs-streaming or --strict-size is used.
+// Signatures of the source in formats other than simple signing are not copied through the wrapper.
+func (opts *copyOptions) withBlobSizeChecks(srcRef types.ImageReference) types.ImageReference {
+	if !opts.verifyBlobsStreaming && !opts.strictSize {
+		return srcRef
+	}
+	return sizeCheckingReference{ImageReference: srcRef, strict: opts.strictSize}
+}
+
+// NewImageSource returns a types.ImageSource for this reference.
+// The caller must call .Close() on the returned ImageSource.
+func (ref sizeCheckingReference) NewImageSource(ctx context.Context, sys *types.SystemContext) (types.ImageSource, error) {
+	src, err := ref.ImageReference.NewImageSource(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	return &sizeCheckingSource{ImageSource: src, ref: ref}, nil
+}
+
+// sizeCheckingSource is a types.ImageSource wrapper which checks blob sizes according to ref.
+type sizeCheckingSource struct {
+	types.ImageSource
+	ref sizeCheckingReference
+}
+
+// Reference returns the reference used to set up this source.
+func (s *sizeCheckingSource) Reference() types.ImageReference {
+	return s.ref
+}
+
+// GetBlob returns a stream for the specified blob, and the blob’s size (or -1 if unknown).
+// The stream fails as soon as more data than info.Size is read.
+func (s *sizeCheckingSource) GetBlob(ctx context.Context, info types.BlobInfo, cache types.BlobInfoCache) (io.ReadCloser, int64, error) {
+	if info.Size < 0 && s.ref.strict {
+		return nil, -1, fmt.Errorf("--strict-size: the size of blob %s is not declared", info.Digest)
+	}
+	stream, size, err := s.ImageSource.GetBlob(ctx, info, cache)
+	if err != nil {
+		return nil, -1, err
+	}
+	if info.Size < 0 {
+		return stream, size, nil
+	}
+	if size >= 0 && (size > info.Size || (s.ref.strict && size != info.Size)) {
+		stream.Close()
+		return nil, -1, fmt.Errorf("blob %s has size %d, but its declared size is %d", info.Digest, size, info.Size)
+	}
+	return &sizeCheckingReader{source: stream, digest: info.Digest, expected: info.Size, strict: s.ref.strict}, size, nil
+}
+
+// sizeCheckingReader is an io.ReadCloser which fails as soon as more than expected bytes are read from source,
+// and, if strict, also if source ends before expected bytes were read.
+type sizeCheckingReader struct {
+	source   io.ReadCloser
+	digest   digest.Digest
+	expected int64
+	strict   bool
+	read     int64
+}
+
+func (r *sizeCheckingReader) Read(p []byte) (int, error) {
+	n, err := r.source.Read(p)
+	r.read += int64(n)
+	if r.read > r.expected {
+		return n, fmt.Errorf("blob %s is larger than its declared size %d, aborting", r.digest, r.expected)
+	}
+	if err == io.EOF && r.strict && r.read != r.expected {
+		return n, fmt.Errorf("--strict-size: blob %s has size %d, but its declared size is %d", r.digest, r.read, r.expected)
+	}
+	return n, err
+}
+
+func (r *sizeCheckingReader) Close() error {
+	return r.source.Close()
+}
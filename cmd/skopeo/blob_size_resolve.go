@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
+)
+
+// resolveSizesConcurrency is the maximum number of blob sizes looked up in parallel by a blobSizeResolver.
+const resolveSizesConcurrency = 8
+
+// blobSizeResolver looks up the sizes of blobs in the repository of a docker:// reference, for inspect --resolve-sizes.
+type blobSizeResolver struct {
+	// dest is only used for TryReusingBlob, which, without a cache and substitutes, only checks whether the blob exists
+	// in the repository using a HEAD request, and returns the size reported by the registry. Nothing is written to it.
+	dest      types.ImageDestination
+	semaphore *semaphore.Weighted // Limits the number of concurrent lookups
+
+	mutex sync.Mutex
+	sizes map[digest.Digest]int64 // Sizes which were already looked up
+}
+
+// newBlobSizeResolver returns a blobSizeResolver for the repository of ref, which must be a docker:// reference.
+// The caller must call .close() on the returned resolver.
+func newBlobSizeResolver(ctx context.Context, sys *types.SystemContext, ref types.ImageReference) (*blobSizeResolver, error) {
+	if ref.Transport() != docker.Transport {
+		return nil, fmt.Errorf("--resolve-sizes requires a %s:// image, not %s:", docker.Transport.Name(), ref.Transport().Name())
+	}
+	dest, err := ref.NewImageDestination(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	return &blobSizeResolver{
+		dest:      dest,
+		semaphore: semaphore.NewWeighted(resolveSizesConcurrency),
+		sizes:     map[digest.Digest]int64{},
+	}, nil
+}
+
+// close releases the resources of r.
+func (r *blobSizeResolver) close() error {
+	return r.dest.Close()
+}
+
+// size returns the size of the blob with blobDigest, as reported by the registry.
+func (r *blobSizeResolver) size(ctx context.Context, blobDigest digest.Digest) (int64, error) {
+	r.mutex.Lock()
+	size, ok := r.sizes[blobDigest]
+	r.mutex.Unlock()
+	if ok {
+		return size, nil
+	}
+
+	if err := r.semaphore.Acquire(ctx, 1); err != nil {
+		return -1, err
+	}
+	defer r.semaphore.Release(1)
+	exists, info, err := r.dest.TryReusingBlob(ctx, types.BlobInfo{Digest: blobDigest, Size: -1}, none.NoCache, false)
+	if err != nil {
+		return -1, fmt.Errorf("looking up the size of blob %s: %w", blobDigest, err)
+	}
+	if !exists {
+		return -1, fmt.Errorf("looking up the size of blob %s: the blob does not exist in the repository", blobDigest)
+	}
+	if info.Size < 0 {
+		return -1, fmt.Errorf("looking up the size of blob %s: the registry did not report it", blobDigest)
+	}
+	r.mutex.Lock()
+	r.sizes[blobDigest] = info.Size
+	r.mutex.Unlock()
+	return info.Size, nil
+}
+
+// resolve returns a copy of blobs, with the sizes of blobs whose size is missing or zero replaced by the size reported by the registry.
+func (r *blobSizeResolver) resolve(ctx context.Context, blobs []types.BlobInfo) ([]types.BlobInfo, error) {
+	res := make([]types.BlobInfo, len(blobs))
+	group, groupCtx := errgroup.WithContext(ctx)
+	for i, blob := range blobs {
+		res[i] = blob
+		if blob.Digest == "" || blob.Size > 0 {
+			continue
+		}
+		i, blobDigest := i, blob.Digest
+		group.Go(func() error { // The number of lookups is limited by r.semaphore.
+			size, err := r.size(groupCtx, blobDigest)
+			if err != nil {
+				return err
+			}
+			res[i].Size = size
+			return nil
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// resolvedManifestBlobsSize is manifestBlobsSize, with the sizes of blobs whose size is missing or zero looked up using resolver, if not nil.
+func resolvedManifestBlobsSize(ctx context.Context, rawManifest []byte, mimeType string, resolver *blobSizeResolver) (int64, error) {
+	blobs, err := manifestBlobs(rawManifest, mimeType)
+	if err != nil {
+		return -1, err
+	}
+	if resolver != nil {
+		blobs, err = resolver.resolve(ctx, blobs)
+		if err != nil {
+			return -1, err
+		}
+	}
+	return blobsSize(blobs), nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/containers/skopeo/cmd/skopeo/inspect"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInspectResolveSizes(t *testing.T) {
+	config := []byte(`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers","diff_ids":[]}}`)
+	layers := [][]byte{[]byte("first layer"), []byte("second layer, with a size")}
+	configDigest := digest.FromBytes(config)
+	registry := &fakeRegistry{manifests: map[digest.Digest][]byte{}, tags: map[string]digest.Digest{}, blobs: map[digest.Digest][]byte{}}
+	registry.blobs[configDigest] = config
+	for _, layer := range layers {
+		registry.blobs[digest.FromBytes(layer)] = layer
+	}
+	server := httptest.NewServer(registry)
+	defer server.Close()
+	repo := strings.TrimPrefix(server.URL, "http://") + "/test"
+	// The config size is zero, the first layer has no size.
+	registry.add(fmt.Sprintf(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json",`+
+		`"config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"%s","size":0},"layers":[`+
+		`{"mediaType":"application/vnd.oci.image.layer.v1.tar","digest":"%s"},`+
+		`{"mediaType":"application/vnd.oci.image.layer.v1.tar","digest":"%s","size":%d}]}`,
+		configDigest, digest.FromBytes(layers[0]), digest.FromBytes(layers[1]), len(layers[1])), "latest")
+
+	out, err := runSkopeo("inspect", "--tls-verify=false", "--no-tags", "docker://"+repo+":latest")
+	require.NoError(t, err)
+	var output inspect.Output
+	err = json.Unmarshal([]byte(out), &output)
+	require.NoError(t, err)
+	require.Len(t, output.LayersData, 2)
+	assert.Equal(t, int64(0), output.LayersData[0].Size)
+	assert.Equal(t, 0, registry.blobHEADs) // No requests by default
+
+	out, err = runSkopeo("inspect", "--tls-verify=false", "--no-tags", "--resolve-sizes", "docker://"+repo+":latest")
+	require.NoError(t, err)
+	output = inspect.Output{}
+	err = json.Unmarshal([]byte(out), &output)
+	require.NoError(t, err)
+	require.Len(t, output.LayersData, 2)
+	assert.Equal(t, int64(len(layers[0])), output.LayersData[0].Size)
+	assert.Equal(t, int64(len(layers[1])), output.LayersData[1].Size)
+	assert.Equal(t, 1, registry.blobHEADs) // Only for the layer without a size
+
+	registry.blobHEADs = 0
+	out, err = runSkopeo("inspect", "--tls-verify=false", "--instance-sizes", "--resolve-sizes", "docker://"+repo+":latest")
+	require.NoError(t, err)
+	assert.Regexp(t, fmt.Sprintf(`^linux/amd64 sha256:[0-9a-f]{64} %d\n$`, len(config)+len(layers[0])+len(layers[1])), out)
+	assert.Equal(t, 2, registry.blobHEADs) // The config and the first layer
+
+	// A blob missing in the registry
+	delete(registry.blobs, digest.FromBytes(layers[0]))
+	out, err = runSkopeo("inspect", "--tls-verify=false", "--instance-sizes", "--resolve-sizes", "docker://"+repo+":latest")
+	assertTestFailed(t, out, err, "the blob does not exist in the repository")
+
+	out, err = runSkopeo("inspect", "--resolve-sizes", "dir:"+testDirImageWithBlobs(t))
+	assertTestFailed(t, out, err, "--resolve-sizes requires a docker:// image, not dir:")
+	out, err = runSkopeo("inspect", "--resolve-sizes", "--raw", "docker://"+repo+":latest")
+	assertTestFailed(t, out, err, "--resolve-sizes can not be used together with")
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSizeCheckingReader(t *testing.T) {
+	data := []byte("0123456789")
+	for _, c := range []struct {
+		expected int64
+		strict   bool
+		errMsg   string
+	}{
+		{10, false, ""},
+		{10, true, ""},
+		{5, false, "is larger than its declared size 5"},
+		{20, false, ""},
+		{20, true, "blob sha256:"},
+	} {
+		r := &sizeCheckingReader{source: io.NopCloser(bytes.NewReader(data)), digest: digest.FromBytes(data), expected: c.expected, strict: c.strict}
+		read, err := io.ReadAll(r)
+		if c.errMsg == "" {
+			assert.NoError(t, err)
+			assert.Equal(t, data, read)
+		} else {
+			assert.ErrorContains(t, err, c.errMsg)
+		}
+	}
+
+	// Reading is aborted as soon as the declared size is exceeded.
+	r := &sizeCheckingReader{source: io.NopCloser(bytes.NewReader(bytes.Repeat(data, 1000))), digest: digest.FromBytes(data), expected: 5}
+	buf := make([]byte, 8)
+	_, err := r.Read(buf)
+	assert.ErrorContains(t, err, "is larger than its declared size 5")
+	assert.Equal(t, int64(8), r.read)
+}
+
+func TestCopyVerifyBlobsStreaming(t *testing.T) {
+	src := testDirImageWithBlobs(t)
+	srcManifest, err := os.ReadFile(filepath.Join(src, "manifest.json"))
+	require.NoError(t, err)
+	layerSize := `"size":` + strconv.Itoa(len("not really a layer")) + `}]`
+	require.Contains(t, string(srcManifest), layerSize)
+	setDeclaredLayerSize := func(size int) {
+		err := os.WriteFile(filepath.Join(src, "manifest.json"), []byte(strings.Replace(string(srcManifest), layerSize, `"size":`+strconv.Itoa(size)+`}]`, 1)), 0o644)
+		require.NoError(t, err)
+	}
+
+	_, err = runSkopeo("--insecure-policy", "copy", "--strict-size", "dir:"+src, "dir:"+t.TempDir())
+	assert.NoError(t, err)
+
+	setDeclaredLayerSize(5)
+	_, err = runSkopeo("--insecure-policy", "copy", "--verify-blobs-streaming", "dir:"+src, "dir:"+t.TempDir())
+	assert.ErrorContains(t, err, "but its declared size is 5")
+
+	// A smaller blob is only rejected with --strict-size
+	setDeclaredLayerSize(100)
+	_, err = runSkopeo("--insecure-policy", "copy", "--verify-blobs-streaming", "dir:"+src, "dir:"+t.TempDir())
+	assert.NoError(t, err)
+	_, err = runSkopeo("--insecure-policy", "copy", "--strict-size", "dir:"+src, "dir:"+t.TempDir())
+	assert.ErrorContains(t, err, "but its declared size is 100")
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/containers/image/v5/directory"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+)
+
+// casLayoutReference is a types.ImageReference wrapper for dir: destinations; image destinations created from it
+// write a content-addressed store instead of the dir: layout: every blob, and every manifest, is stored only as
+// path/blobs/ALGORITHM/XX/ENCODED, where XX are the first two characters of ENCODED. Existing contents are preserved,
+// so that a single store can be shared by many images.
+type casLayoutReference struct {
+	types.ImageReference // dir:path, used for policy decisions and error messages
+	path                 string
+}
+
+// newCASLayoutReference returns a casLayoutReference for ref, which must be a dir: reference.
+func newCASLayoutReference(ref types.ImageReference) (types.ImageReference, error) {
+	if name := ref.Transport().Name(); name != directory.Transport.Name() {
+		return nil, fmt.Errorf("--dest-cas-layout requires a %s: destination, not %s:", directory.Transport.Name(), name)
+	}
+	return casLayoutReference{ImageReference: ref, path: ref.StringWithinTransport()}, nil
+}
+
+// NewImageDestination returns a types.ImageDestination for this reference.
+// The caller must call .Close() on the returned ImageDestination.
+func (ref casLayoutReference) NewImageDestination(ctx context.Context, sys *types.SystemContext) (types.ImageDestination, error) {
+	if err := os.MkdirAll(filepath.Join(ref.path, "blobs"), 0o755); err != nil {
+		return nil, err
+	}
+	return &casLayoutDestination{ref: ref, forceCompress: sys != nil && sys.DirForceCompress}, nil
+}
+
+// casLayoutDestination is a types.ImageDestination writing the content-addressed store of a casLayoutReference.
+type casLayoutDestination struct {
+	ref           casLayoutReference
+	forceCompress bool
+}
+
+// Reference returns the reference used to set up this destination.
+func (d *casLayoutDestination) Reference() types.ImageReference {
+	return d.ref
+}
+
+// Close removes resources associated with an initialized ImageDestination, if any.
+func (d *casLayoutDestination) Close() error {
+	return nil
+}
+
+// SupportedManifestMIMETypes returns nil, meaning that all manifest types are supported.
+func (d *casLayoutDestination) SupportedManifestMIMETypes() []string {
+	return nil
+}
+
+// SupportsSignatures returns an error: the store has no place for signatures.
+func (d *casLayoutDestination) SupportsSignatures(ctx context.Context) error {
+	return errors.New("--dest-cas-layout does not support storing signatures")
+}
+
+// DesiredLayerCompression indicates the kind of compression to apply on layers.
+func (d *casLayoutDestination) DesiredLayerCompression() types.LayerCompression {
+	if d.forceCompress {
+		return types.Compress
+	}
+	return types.PreserveOriginal
+}
+
+// AcceptsForeignLayerURLs returns false, the store contains all layers.
+func (d *casLayoutDestination) AcceptsForeignLayerURLs() bool {
+	return false
+}
+
+// MustMatchRuntimeOS returns false, the store accepts images for any OS.
+func (d *casLayoutDestination) MustMatchRuntimeOS() bool {
+	return false
+}
+
+// IgnoresEmbeddedDockerReference returns true, the store does not record image names.
+func (d *casLayoutDestination) IgnoresEmbeddedDockerReference() bool {
+	return true
+}
+
+// HasThreadSafePutBlob returns true, every blob is written to a separate temporary file.
+func (d *casLayoutDestination) HasThreadSafePutBlob() bool {
+	return true
+}
+
+// blobPath returns the path of blobDigest in the store.
+func (d *casLayoutDestination) blobPath(blobDigest digest.Digest) (string, error) {
+	if err := blobDigest.Validate(); err != nil { // Make sure the digest can't point outside of the store
+		return "", err
+	}
+	encoded := blobDigest.Encoded()
+	return filepath.Join(d.ref.path, "blobs", blobDigest.Algorithm().String(), encoded[:2], encoded), nil
+}
+
+// writeBlob stores the contents of stream, which must match expectedDigest (if not empty) and expectedSize (if not -1),
+// and returns its digest and size.
+func (d *casLayoutDestination) writeBlob(stream io.Reader, expectedDigest digest.Digest, expectedSize int64) (digest.Digest, int64, error) {
+	algorithm := digest.Canonical
+	if expectedDigest != "" {
+		if err := expectedDigest.Validate(); err != nil {
+			return "", -1, err
+		}
+		algorithm = expectedDigest.Algorithm()
+	}
+	f, err := os.CreateTemp(filepath.Join(d.ref.path, "blobs"), ".partial-")
+	if err != nil {
+		return "", -1, err
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	digester := algorithm.Digester()
+	size, err := io.Copy(io.MultiWriter(f, digester.Hash()), stream)
+	if err != nil {
+		return "", -1, err
+	}
+	blobDigest := digester.Digest()
+	if expectedDigest != "" && blobDigest != expectedDigest {
+		return "", -1, fmt.Errorf("blob digest mismatch: expected %s, got %s", expectedDigest, blobDigest)
+	}
+	if expectedSize != -1 && size != expectedSize {
+		return "", -1, fmt.Errorf("blob %s size mismatch: expected %d, got %d", blobDigest, expectedSize, size)
+	}
+	if err := f.Sync(); err != nil {
+		return "", -1, err
+	}
+	if err := f.Close(); err != nil {
+		return "", -1, err
+	}
+	path, err := d.blobPath(blobDigest)
+	if err != nil {
+		return "", -1, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", -1, err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return "", -1, err
+	}
+	committed = true
+	return blobDigest, size, nil
+}
+
+// PutBlob writes contents of stream and returns data representing the result.
+func (d *casLayoutDestination) PutBlob(ctx context.Context, stream io.Reader, inputInfo types.BlobInfo, cache types.BlobInfoCache, isConfig bool) (types.BlobInfo, error) {
+	blobDigest, size, err := d.writeBlob(stream, inputInfo.Digest, inputInfo.Size)
+	if err != nil {
+		return types.BlobInfo{}, err
+	}
+	return types.BlobInfo{Digest: blobDigest, Size: size}, nil
+}
+
+// TryReusingBlob checks whether the transport already contains, or can efficiently reuse, a blob, and if so,
+// returns (true, info about the blob); blobs already in the store, e.g. from other images, are reused.
+func (d *casLayoutDestination) TryReusingBlob(ctx context.Context, info types.BlobInfo, cache types.BlobInfoCache, canSubstitute bool) (bool, types.BlobInfo, error) {
+	if info.Digest == "" {
+		return false, types.BlobInfo{}, errors.New("Can not check for a blob with unknown digest")
+	}
+	path, err := d.blobPath(info.Digest)
+	if err != nil {
+		return false, types.BlobInfo{}, err
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, types.BlobInfo{}, nil
+		}
+		return false, types.BlobInfo{}, err
+	}
+	return true, types.BlobInfo{Digest: info.Digest, Size: fi.Size()}, nil
+}
+
+// PutManifest writes manifest to the store, addressed by its digest; instanceDigest is the digest of manifest
+// if it is an instance of a manifest list.
+func (d *casLayoutDestination) PutManifest(ctx context.Context, m []byte, instanceDigest *digest.Digest) error {
+	if manifest.GuessMIMEType(m) == manifest.DockerV2Schema1SignedMediaType {
+		// The digest of a signed schema1 manifest does not cover the signatures, so it can't be verified by writeBlob.
+		return errors.New("--dest-cas-layout does not support signed schema1 manifests")
+	}
+	var manifestDigest digest.Digest
+	if instanceDigest != nil {
+		manifestDigest = *instanceDigest
+	} else {
+		md, err := manifest.Digest(m)
+		if err != nil {
+			return err
+		}
+		manifestDigest = md
+	}
+	_, _, err := d.writeBlob(bytes.NewReader(m), manifestDigest, int64(len(m)))
+	return err
+}
+
+// PutSignatures fails if any signatures are provided: the store has no place for them.
+func (d *casLayoutDestination) PutSignatures(ctx context.Context, signatures [][]byte, instanceDigest *digest.Digest) error {
+	if len(signatures) != 0 {
+		return errors.New("--dest-cas-layout does not support storing signatures")
+	}
+	return nil
+}
+
+// Commit does nothing; every blob and manifest is complete as soon as it is written.
+func (d *casLayoutDestination) Commit(ctx context.Context, unparsedToplevel types.UnparsedImage) error {
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// casBlobPath returns the path of d in a --dest-cas-layout store at dir.
+func casBlobPath(dir string, d digest.Digest) string {
+	return filepath.Join(dir, "blobs", d.Algorithm().String(), d.Encoded()[:2], d.Encoded())
+}
+
+func TestCopyDestCASLayout(t *testing.T) {
+	src := testDirImageWithBlobs(t)
+	srcManifest, err := os.ReadFile(filepath.Join(src, "manifest.json"))
+	require.NoError(t, err)
+	dest := t.TempDir()
+	unrelated := filepath.Join(dest, "unrelated")
+	err = os.WriteFile(unrelated, []byte("kept"), 0o644)
+	require.NoError(t, err)
+
+	digestFile := filepath.Join(t.TempDir(), "digest")
+	_, err = runSkopeo("--insecure-policy", "copy", "--dest-cas-layout", "--digestfile", digestFile, "dir:"+src, "dir:"+dest)
+	require.NoError(t, err)
+	manifestDigest, err := os.ReadFile(digestFile)
+	require.NoError(t, err)
+	assert.Equal(t, digest.FromBytes(srcManifest).String(), string(manifestDigest))
+	for _, contents := range [][]byte{
+		srcManifest,
+		[]byte(`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers","diff_ids":[]}}`), // As created by testDirImageWithBlobs
+		[]byte("not really a layer"),
+	} {
+		stored, err := os.ReadFile(casBlobPath(dest, digest.FromBytes(contents)))
+		require.NoError(t, err)
+		assert.Equal(t, contents, stored)
+	}
+	assert.NoFileExists(t, filepath.Join(dest, "manifest.json"))
+	assert.FileExists(t, unrelated) // Existing contents are not removed
+
+	// Copying a converted image into the same store keeps the existing blobs
+	_, err = runSkopeo("--insecure-policy", "copy", "--dest-cas-layout", "--format", "v2s2", "--digestfile", digestFile, "dir:"+src, "dir:"+dest)
+	require.NoError(t, err)
+	convertedDigest, err := os.ReadFile(digestFile)
+	require.NoError(t, err)
+	assert.NotEqual(t, manifestDigest, convertedDigest)
+	assert.FileExists(t, casBlobPath(dest, digest.Digest(convertedDigest)))
+	assert.FileExists(t, casBlobPath(dest, digest.Digest(manifestDigest)))
+	entries, err := os.ReadDir(filepath.Join(dest, "blobs"))
+	require.NoError(t, err)
+	require.Len(t, entries, 1) // No leftover temporary files
+	assert.Equal(t, "sha256", entries[0].Name())
+
+	out, err := runSkopeo("--insecure-policy", "copy", "--dest-cas-layout", "dir:"+src, "oci:"+t.TempDir())
+	assertTestFailed(t, out, err, "--dest-cas-layout requires a dir: destination")
+	out, err = runSkopeo("--insecure-policy", "copy", "--dest-cas-layout", "--verify-after-push", "dir:"+src, "dir:"+dest)
+	assertTestFailed(t, out, err, "--dest-cas-layout cannot be used together with --verify-after-push")
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/containers/image/v5/storage"
+	cstorage "github.com/containers/storage"
+)
+
+// findComposefsHelper returns the path of the mkcomposefs helper: helperPath if it is not empty, or mkcomposefs found in $PATH.
+func findComposefsHelper(helperPath string) (string, error) {
+	if helperPath != "" {
+		res, err := exec.LookPath(helperPath)
+		if err != nil {
+			return "", fmt.Errorf("--composefs-helper: %w", err)
+		}
+		return res, nil
+	}
+	res, err := exec.LookPath("mkcomposefs")
+	if err != nil {
+		return "", fmt.Errorf("%w (consider --composefs-helper)", err)
+	}
+	return res, nil
+}
+
+// getStoreWithComposefsHelper returns a store created by cstorage.GetStore(options), whose overlay driver uses helper, a path to mkcomposefs.
+// containers/storage has no option to specify the location of mkcomposefs; it looks for it in $PATH once, when the first overlay driver
+// using composefs is initialized, and keeps using the result. So $PATH is modified to find helper (or a link to it named mkcomposefs) first
+// only while the store is created, and restored afterwards.
+func getStoreWithComposefsHelper(options cstorage.StoreOptions, helper string, global *globalOptions) (cstorage.Store, error) {
+	dir := filepath.Dir(helper)
+	if filepath.Base(helper) != "mkcomposefs" {
+		linkDir, err := global.newTemporaryDir("skopeo-composefs-helper")
+		if err != nil {
+			return nil, err
+		}
+		if err := os.Symlink(helper, filepath.Join(linkDir, "mkcomposefs")); err != nil {
+			return nil, err
+		}
+		dir = linkDir
+	}
+	if found, err := exec.LookPath("mkcomposefs"); err != nil || filepath.Dir(found) != dir {
+		path, hadPath := os.LookupEnv("PATH")
+		if err := os.Setenv("PATH", dir+string(os.PathListSeparator)+path); err != nil {
+			return nil, err
+		}
+		defer func() {
+			if hadPath {
+				os.Setenv("PATH", path)
+			} else {
+				os.Unsetenv("PATH")
+			}
+		}()
+	}
+	return cstorage.GetStore(options)
+}
+
+// setUpVerityStore configures the default store of the containers-storage: transport for --dest-enable-verity:
+// the overlay driver stores layers pulled as partial images (e.g. zstd:chunked) with composefs, which enables fs-verity
+// on the layer files and on the composefs blob, and records the file verity digests in the blob.
+// helperPath is the value of --composefs-helper.
+// If the filesystem does not support fs-verity, containers/storage uses composefs without it.
+// This must be called before parsing any containers-storage: reference which uses the default store.
+func setUpVerityStore(destName, helperPath string, global *globalOptions) error {
+	if strings.HasPrefix(strings.TrimPrefix(destName, storage.Transport.Name()+":"), "[") {
+		return fmt.Errorf("--dest-enable-verity can not be used with a store specification in %s", destName)
+	}
+	helper, err := findComposefsHelper(helperPath)
+	if err != nil {
+		return err
+	}
+	options, err := cstorage.DefaultStoreOptions()
+	if err != nil {
+		return err
+	}
+	if options.GraphDriverName != "" && options.GraphDriverName != "overlay" {
+		return fmt.Errorf("--dest-enable-verity requires the overlay storage driver, not %s", options.GraphDriverName)
+	}
+	options.GraphDriverName = "overlay"
+	options.GraphDriverOptions = append(append([]string{}, options.GraphDriverOptions...), "overlay.use_composefs=true")
+	pullOptions := map[string]string{}
+	for k, v := range options.PullOptions {
+		pullOptions[k] = v
+	}
+	pullOptions["enable_partial_images"] = "true" // composefs blobs are only generated for partial pulls
+	options.PullOptions = pullOptions
+	options.UIDMap = storage.Transport.DefaultUIDMap()
+	options.GIDMap = storage.Transport.DefaultGIDMap()
+	store, err := getStoreWithComposefsHelper(options, helper, global)
+	if err != nil {
+		return fmt.Errorf("--dest-enable-verity: composefs can not be used with the storage at %s: %w", options.GraphRoot, err)
+	}
+	storage.Transport.SetStore(store)
+	return nil
+}
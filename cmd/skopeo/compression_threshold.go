@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/containers/image/v5/types"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/semaphore"
+)
+
+// compressionThreshold tracks the size of the layer being copied, so that the destination can leave small layers uncompressed.
+//
+// The copy pipeline asks the destination whether to compress a layer without identifying the layer; this relies on layers
+// being copied one at a time (using the semaphore returned by setUpCompressionThreshold), so that the blob most recently
+// opened from the source is the one being uploaded.
+type compressionThreshold struct {
+	threshold int64 // Layers smaller than this are not compressed
+
+	mutex           sync.Mutex
+	currentBlobSize int64 // Size of the blob most recently opened from the source, or -1 if unknown
+}
+
+// setUpCompressionThreshold returns references wrapping srcRef and destRef, and a semaphore to use for copying blobs,
+// which cause layers smaller than threshold (in bytes) not to be compressed at the destination.
+func setUpCompressionThreshold(srcRef, destRef types.ImageReference, threshold int64) (types.ImageReference, types.ImageReference, *semaphore.Weighted) {
+	state := &compressionThreshold{threshold: threshold, currentBlobSize: -1}
+	return compressionThresholdSourceReference{ImageReference: srcRef, state: state},
+		compressionThresholdDestinationReference{ImageReference: destRef, state: state},
+		semaphore.NewWeighted(1)
+}
+
+// compressionThresholdSourceReference is a types.ImageReference wrapper; image sources created from it
+// record the size of opened blobs in state.
+type compressionThresholdSourceReference struct {
+	types.ImageReference
+	state *compressionThreshold
+}
+
+// NewImageSource returns a types.ImageSource for this reference.
+// The caller must call .Close() on the returned ImageSource.
+func (ref compressionThresholdSourceReference) NewImageSource(ctx context.Context, sys *types.SystemContext) (types.ImageSource, error) {
+	src, err := ref.ImageReference.NewImageSource(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	return &compressionThresholdSource{ImageSource: src, ref: ref}, nil
+}
+
+// compressionThresholdSource is a types.ImageSource wrapper which records the size of opened blobs.
+type compressionThresholdSource struct {
+	types.ImageSource
+	ref compressionThresholdSourceReference
+}
+
+// Reference returns the reference used to set up this source.
+func (s *compressionThresholdSource) Reference() types.ImageReference {
+	return s.ref
+}
+
+// GetBlob returns a stream for the specified blob, and the blob’s size (or -1 if unknown), recording the size.
+func (s *compressionThresholdSource) GetBlob(ctx context.Context, info types.BlobInfo, cache types.BlobInfoCache) (io.ReadCloser, int64, error) {
+	reader, size, err := s.ImageSource.GetBlob(ctx, info, cache)
+	if err != nil {
+		return nil, 0, err
+	}
+	if size == -1 {
+		size = info.Size
+	}
+	s.ref.state.mutex.Lock()
+	s.ref.state.currentBlobSize = size
+	s.ref.state.mutex.Unlock()
+	return reader, size, nil
+}
+
+// compressionThresholdDestinationReference is a types.ImageReference wrapper; image destinations created from it
+// do not ask for small layers, as recorded in state, to be compressed.
+type compressionThresholdDestinationReference struct {
+	types.ImageReference
+	state *compressionThreshold
+}
+
+// NewImageDestination returns a types.ImageDestination for this reference.
+// The caller must call .Close() on the returned ImageDestination.
+func (ref compressionThresholdDestinationReference) NewImageDestination(ctx context.Context, sys *types.SystemContext) (types.ImageDestination, error) {
+	dest, err := ref.ImageReference.NewImageDestination(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	return &compressionThresholdDestination{ImageDestination: dest, ref: ref}, nil
+}
+
+// compressionThresholdDestination is a types.ImageDestination wrapper which does not ask for small layers to be compressed.
+type compressionThresholdDestination struct {
+	types.ImageDestination
+	ref compressionThresholdDestinationReference
+}
+
+// Reference returns the reference used to set up this destination.
+func (d *compressionThresholdDestination) Reference() types.ImageReference {
+	return d.ref
+}
+
+// DesiredLayerCompression indicates the kind of compression to apply on layers; layers smaller than the threshold are preserved as is.
+func (d *compressionThresholdDestination) DesiredLayerCompression() types.LayerCompression {
+	desired := d.ImageDestination.DesiredLayerCompression()
+	if desired != types.Compress {
+		return desired
+	}
+	d.ref.state.mutex.Lock()
+	size := d.ref.state.currentBlobSize
+	d.ref.state.mutex.Unlock()
+	if size >= 0 && size < d.ref.state.threshold {
+		logrus.Debugf("Not compressing a %d-byte layer, smaller than --dest-compression-threshold", size)
+		return types.PreserveOriginal
+	}
+	return desired
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/containers/common/pkg/retry"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/signature"
+	"github.com/containers/image/v5/types"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sirupsen/logrus"
+)
+
+// decodeJSONValue parses data, which must contain exactly one JSON value, preserving the exact representation of numbers.
+func decodeJSONValue(data []byte) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var res any
+	if err := decoder.Decode(&res); err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, errors.New("unexpected data after the JSON value")
+	}
+	return res, nil
+}
+
+// readConfigPatch reads a JSON merge patch (RFC 7386) for --config-patch from the file at path.
+func readConfigPatch(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	value, err := decodeJSONValue(data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing the config patch %s: %w", path, err)
+	}
+	patch, ok := value.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("the config patch %s must be a JSON object", path)
+	}
+	if _, ok := patch["rootfs"]; ok {
+		return nil, fmt.Errorf("the config patch %s can not change rootfs, which must match the layers of the image", path)
+	}
+	return patch, nil
+}
+
+// jsonMergePatch returns the result of applying patch to target, as defined by RFC 7386.
+// Objects in target may be modified.
+func jsonMergePatch(target, patch any) any {
+	patchObject, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]any)
+	if !ok {
+		targetObject = map[string]any{}
+	}
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+		} else {
+			targetObject[name] = jsonMergePatch(targetObject[name], value)
+		}
+	}
+	return targetObject
+}
+
+// patchConfig returns config, an image config blob, with patch applied as a JSON merge patch.
+// The result must still be a valid image config.
+func patchConfig(config []byte, patch map[string]any) ([]byte, error) {
+	target, err := decodeJSONValue(config)
+	if err != nil {
+		return nil, fmt.Errorf("parsing image config: %w", err)
+	}
+	patched, err := json.Marshal(jsonMergePatch(target, patch))
+	if err != nil {
+		return nil, err
+	}
+	var updated imgspecv1.Image
+	if err := json.Unmarshal(patched, &updated); err != nil {
+		return nil, fmt.Errorf("the patched image config is not valid: %w", err)
+	}
+	return patched, nil
+}
+
+// setUpConfigPatch verifies the image at srcRef (choosing an instance from a manifest list based on sys) against policyContext,
+// and returns a reference to a version of that image with patch applied to its config.
+func setUpConfigPatch(ctx context.Context, sys *types.SystemContext, policyContext *signature.PolicyContext, srcRef types.ImageReference,
+	patch map[string]any, retryOpts *retry.Options) (_ types.ImageReference, retErr error) {
+	var src types.ImageSource
+	if err := retry.IfNecessary(ctx, func() error {
+		var err error
+		src, err = srcRef.NewImageSource(ctx, sys)
+		return err
+	}, retryOpts); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := src.Close(); err != nil {
+			retErr = noteCloseFailure(retErr, "closing image", err)
+		}
+	}()
+
+	img, err := policyVerifiedImage(ctx, sys, policyContext, src, retryOpts)
+	if err != nil {
+		return nil, err
+	}
+	rawManifest, mimeType, err := img.Manifest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if img.ConfigInfo().Digest == "" {
+		return nil, fmt.Errorf("--config-patch does not support %s images", mimeType)
+	}
+	var config []byte
+	if err := retry.IfNecessary(ctx, func() error {
+		var err error
+		config, err = img.ConfigBlob(ctx)
+		return err
+	}, retryOpts); err != nil {
+		return nil, err
+	}
+	m, err := manifest.FromBlob(rawManifest, mimeType)
+	if err != nil {
+		return nil, err
+	}
+	updatedConfig, err := patchConfig(config, patch)
+	if err != nil {
+		return nil, err
+	}
+
+	logrus.Warn("--config-patch changes the digests of the config and of the image, and invalidates any signatures")
+	return newRewrittenImageReference(srcRef, m, mimeType, updatedConfig, nil, "--config-patch")
+}
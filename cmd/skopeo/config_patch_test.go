@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONMergePatch(t *testing.T) {
+	// Examples from RFC 7386, appendix A.
+	for _, c := range []struct{ target, patch, expected string }{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	} {
+		target, err := decodeJSONValue([]byte(c.target))
+		require.NoError(t, err)
+		patch, err := decodeJSONValue([]byte(c.patch))
+		require.NoError(t, err)
+		res, err := json.Marshal(jsonMergePatch(target, patch))
+		require.NoError(t, err)
+		assert.JSONEq(t, c.expected, string(res), "%s + %s", c.target, c.patch)
+	}
+}
+
+func TestReadConfigPatch(t *testing.T) {
+	dir := t.TempDir()
+	for _, c := range []struct{ contents, expectedError string }{
+		{`{"config":{"Env":null}}`, ""},
+		{`["not", "an", "object"]`, "must be a JSON object"},
+		{`{"rootfs":{"diff_ids":[]}}`, "can not change rootfs"},
+		{`{} {}`, "unexpected data after the JSON value"},
+		{`{`, "parsing the config patch"},
+	} {
+		path := filepath.Join(dir, "patch.json")
+		require.NoError(t, os.WriteFile(path, []byte(c.contents), 0o644))
+		_, err := readConfigPatch(path)
+		if c.expectedError == "" {
+			assert.NoError(t, err, c.contents)
+		} else {
+			assert.ErrorContains(t, err, c.expectedError, c.contents)
+		}
+	}
+}
+
+func TestCopyConfigPatch(t *testing.T) {
+	src := testDirImageWithBlobs(t)
+	patchPath := filepath.Join(t.TempDir(), "patch.json")
+	require.NoError(t, os.WriteFile(patchPath, []byte(`{"config":{"Env":["A=1"],"Labels":{"patched":"yes"}},"os":"linux"}`), 0o644))
+	dest := t.TempDir()
+	_, err := runSkopeo("--insecure-policy", "copy", "--config-patch", patchPath, "dir:"+src, "dir:"+dest)
+	require.NoError(t, err)
+
+	destManifestBlob, err := os.ReadFile(filepath.Join(dest, "manifest.json"))
+	require.NoError(t, err)
+	var destManifest imgspecv1.Manifest
+	require.NoError(t, json.Unmarshal(destManifestBlob, &destManifest))
+	destConfigBlob, err := os.ReadFile(filepath.Join(dest, destManifest.Config.Digest.Encoded()))
+	require.NoError(t, err)
+	assert.Equal(t, digest.FromBytes(destConfigBlob), destManifest.Config.Digest)
+	assert.Equal(t, int64(len(destConfigBlob)), destManifest.Config.Size)
+	var destConfig imgspecv1.Image
+	require.NoError(t, json.Unmarshal(destConfigBlob, &destConfig))
+	assert.Equal(t, "amd64", destConfig.Architecture)
+	assert.Equal(t, []string{"A=1"}, destConfig.Config.Env)
+	assert.Equal(t, map[string]string{"patched": "yes"}, destConfig.Config.Labels)
+	require.Len(t, destManifest.Layers, 1)
+	assert.Equal(t, digest.FromString("not really a layer"), destManifest.Layers[0].Digest)
+
+	out, err := runSkopeo("--insecure-policy", "copy", "--config-patch", patchPath, "--preserve-digests", "dir:"+src, "dir:"+t.TempDir())
+	assertTestFailed(t, out, err, "--config-patch cannot be used together with --preserve-digests")
+}
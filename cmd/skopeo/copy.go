@@ -4,21 +4,33 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
 	"strings"
+	"time"
 
 	commonFlag "github.com/containers/common/pkg/flag"
 	"github.com/containers/common/pkg/retry"
 	"github.com/containers/image/v5/copy"
+	"github.com/containers/image/v5/directory"
+	"github.com/containers/image/v5/docker/archive"
+	"github.com/containers/image/v5/docker/daemon"
 	"github.com/containers/image/v5/docker/reference"
 	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/oci/layout"
 	"github.com/containers/image/v5/pkg/cli"
 	"github.com/containers/image/v5/pkg/cli/sigstore"
+	"github.com/containers/image/v5/signature"
 	"github.com/containers/image/v5/signature/signer"
+	"github.com/containers/image/v5/storage"
 	"github.com/containers/image/v5/transports"
 	"github.com/containers/image/v5/transports/alltransports"
+	"github.com/containers/image/v5/types"
 	encconfig "github.com/containers/ocicrypt/config"
 	enchelpers "github.com/containers/ocicrypt/helpers"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
@@ -28,6 +40,7 @@ type copyOptions struct {
 	srcImage                 *imageOptions
 	destImage                *imageDestOptions
 	retryOpts                *retry.Options
+	blobCopyLimiter          *hostBlobCopyLimiter
 	additionalTags           []string                  // For docker-archive: destinations, in addition to the name:tag specified as destination, also add these
 	removeSignatures         bool                      // Do not copy signatures from the source image
 	signByFingerprint        string                    // Sign the image using a GPG key with the specified fingerprint
@@ -39,11 +52,72 @@ type copyOptions struct {
 	format                   commonFlag.OptionalString // Force conversion of the image to a specified format
 	quiet                    bool                      // Suppress output information when copying images
 	all                      bool                      // Copy all of the images if the source is a list
+	recursive                bool                      // Copy all images in the OCI layouts in a directory tree to repositories under a registry namespace
+	listAnnotationFilters    []string                  // With all, only copy instances of the list with these KEY=VALUE annotations
 	multiArch                commonFlag.OptionalString // How to handle multi architecture images
 	preserveDigests          bool                      // Preserve digests during copy
 	encryptLayer             []int                     // The list of layers to encrypt
 	encryptionKeys           []string                  // Keys needed to encrypt the image
 	decryptionKeys           []string                  // Keys needed to decrypt the image
+	requireDigestSource      bool                      // Refuse to copy unless the source reference is pinned by digest
+	keepListWrapper          bool                      // Copy the single image chosen from a list as a list containing only that image
+	deltaFrom                string                    // An image at the destination whose blobs are assumed to exist without checking
+	destSubject              string                    // An image at the destination to set as the subject of the copied manifest
+	preserveAnnotations      bool                      // Warn about annotations which can't be represented in the destination
+	preserveEmptyLayers      bool                      // Fail if the empty_layer history markers of the copied image differ from the source
+	destCASLayout            bool                      // Write a dir: destination as a content-addressed store of blobs and manifests
+	emitPinFile              string                    // Append the resolved source and destination digests to this file
+	compressionThreshold     int64                     // Do not compress layers smaller than this many bytes
+	preferBlobEncoding       string                    // Preferred compression of instances chosen from a list: "zstd" or "gzip"
+	dryRun                   bool                      // Only report an estimate of the data to transfer, don't copy anything
+	rewriteMediaTypes        []string                  // FROM=TO rewrites of config and layer media types
+	createSharedBlobDir      bool                      // Create the --src-shared-blob-dir and --dest-shared-blob-dir directories if missing
+	verifyAfterPush          bool                      // Read back the destination manifest after copying, and compare it with the pushed one
+	verifySampleBlobs        int                       // With verifyAfterPush, also read back and verify this many randomly chosen blobs
+	dedupListBlobs           bool                      // Reuse blobs copied for one image of a list for the other images, without asking the destination
+	srcTransportOptions      []string                  // KEY=VALUE options interpreted by the source transport
+	skipIfListMatches        bool                      // Don't copy anything if the destination already has a manifest matching the source
+	destTransportOptions     []string                  // KEY=VALUE options interpreted by the destination transport
+	verifyCosign             bool                      // Require a cosign signature of the source image, stored in a sha256-<digest>.sig tag
+	cosignKey                string                    // The public key used to verify the cosign signature with verifyCosign
+	destPushTimeout          time.Duration             // Cancel writes to the destination not finished this long after the first one
+	manifestPutRetries       int                       // Retry only the manifest upload this many times
+	retryOnBlobUnknown       bool                      // Retry the manifest upload up to --retry-times times if the registry does not know a referenced blob
+	verifyBlobsStreaming     bool                      // Abort reading a source blob as soon as it exceeds its declared size
+	strictSize               bool                      // Also fail if a source blob is smaller than its declared size, or has none
+	printImageID             bool                      // Print the ID of the image stored in a containers-storage: destination
+	destEnableVerity         bool                      // Store the layers copied to a containers-storage: destination using composefs, with fs-verity
+	verityReport             string                    // With destEnableVerity, write the fs-verity digests of all files in the destination layers to this file
+	verityWorkers            int                       // With verityReport, the number of files to enable fs-verity for concurrently
+	embedVerityAnnotations   bool                      // With destEnableVerity, record the fs-verity digests of the composefs blobs of the destination layers in the manifest
+	composefsHelper          string                    // Path of mkcomposefs, instead of looking for it in $PATH
+	splitByArch              bool                      // Copy each image of a list to a separate per-platform repository, without the list
+	splitByArchSuffix        string                    // The suffix pattern of the per-platform repositories with splitByArch
+	resolveTagsFrom          string                    // Copy the digests recorded in this pin file instead of resolving tags
+	writeBufferSize          int                       // Write blobs to dir: and oci: destinations in chunks of this many bytes
+	noBlobMountHosts         []string                  // Registry hosts for which cross-repository blob mounting is disabled
+	embedCopyRecord          bool                      // Record the source and destination of the copy in the destination OCI layout
+	localPlatform            bool                      // Copy the image from a list for the platform skopeo is running on, rejecting --override-*
+	selectBest               bool                      // Copy the image from a list which is best according to selectPreferences
+	selectPreferences        []string                  // The rules, in order, used to choose an image with selectBest
+	osVersion                string                    // Copy the first Windows image from a list whose os.version matches this prefix
+	flattenIndex             bool                      // When copying all images of an index containing nested indexes, copy a single index of all images instead
+	excludePaths             []string                  // Remove files matching these patterns from the layers of the copied image
+	squash                   bool                      // Merge all layers of the copied image into a single layer
+	maxLayers                int                       // Fail if a copied image has more than this many layers; 0 means unlimited
+	squashOver               bool                      // With maxLayers, merge the lowest layers of an image with too many layers instead of failing
+	summary                  bool                      // Print a summary line after a successful copy
+	daemonMediaTypeCompat    bool                      // Decompress layers copied to docker-daemon:, for compatibility with all daemon versions
+	progressWebhook          string                    // POST progress events to this URL
+	downgradeToV2s1          bool                      // Convert the image to a v2s1 manifest, rejecting manifest lists
+	normalizeToOCI           bool                      // Relabel Docker manifests, configs and layers with OCI media types, without changing any blobs
+	prePushCmd               string                    // A shell command run on a staged copy of the image, which must succeed before the image is copied to the destination
+	compressionWorkers       int                       // Copy, and (re)compress, up to this many layers in parallel
+	tarballConfig            string                    // Use the OCI image config in this file as the base of the config of a tarball: source
+	strictLayerOrder         bool                      // Write blobs to the destination one at a time in manifest order, and check all of them before writing a manifest
+	reproducibleArchive      bool                      // Normalize a docker-archive: destination so that identical images produce identical archives
+	pushStateFile            string                    // Record the blobs confirmed by the destination in this file, to resume an interrupted copy
+	configPatch              string                    // Apply the JSON merge patch in this file to the config of the copied image
 }
 
 func copyCmd(global *globalOptions) *cobra.Command {
@@ -52,11 +126,13 @@ func copyCmd(global *globalOptions) *cobra.Command {
 	srcFlags, srcOpts := imageFlags(global, sharedOpts, deprecatedTLSVerifyOpt, "src-", "screds")
 	destFlags, destOpts := imageDestFlags(global, sharedOpts, deprecatedTLSVerifyOpt, "dest-", "dcreds")
 	retryFlags, retryOpts := retryFlags()
+	blobCopyLimiterFlags, blobCopyLimiter := hostBlobCopyLimiterFlags()
 	opts := copyOptions{global: global,
 		deprecatedTLSVerify: deprecatedTLSVerifyOpt,
 		srcImage:            srcOpts,
 		destImage:           destOpts,
 		retryOpts:           retryOpts,
+		blobCopyLimiter:     blobCopyLimiter,
 	}
 	cmd := &cobra.Command{
 		Use:   "copy [command options] SOURCE-IMAGE DESTINATION-IMAGE",
@@ -79,22 +155,84 @@ See skopeo(1) section "IMAGE NAMES" for the expected format
 	flags.AddFlagSet(&srcFlags)
 	flags.AddFlagSet(&destFlags)
 	flags.AddFlagSet(&retryFlags)
+	flags.AddFlagSet(&blobCopyLimiterFlags)
 	flags.StringSliceVar(&opts.additionalTags, "additional-tag", []string{}, "additional tags (supports docker-archive)")
 	flags.BoolVarP(&opts.quiet, "quiet", "q", false, "Suppress output information when copying images")
+	flags.StringVar(&opts.prePushCmd, "pre-push-cmd", "", "Copy SOURCE-IMAGE to a staging directory and run the shell command `CMD` on it first; if it fails, don't copy the image to DESTINATION-IMAGE")
+	flags.StringVar(&opts.progressWebhook, "progress-webhook", "", "POST JSON progress events of blob copies to `URL`; failures are only logged")
+	flags.BoolVar(&opts.daemonMediaTypeCompat, "daemon-mediatype-compat", false, "When copying to docker-daemon:, decompress layers so that the image uses media types every daemon version accepts")
+	flags.BoolVar(&opts.summary, "summary", false, "After copying the image, print a line with the source and destination digests, the number of copied and reused layers, the number of bytes written and the duration")
+	flags.BoolVar(&opts.dryRun, "dry-run", false, "Report the blobs which would be copied and reused, and the estimated bytes to transfer, without copying anything")
 	flags.BoolVarP(&opts.all, "all", "a", false, "Copy all images if SOURCE-IMAGE is a list")
+	flags.BoolVar(&opts.recursive, "recursive", false, "Copy the named images in all OCI layouts in the directory tree dir:SOURCE to repositories under the docker://DESTINATION namespace")
+	flags.StringArrayVar(&opts.listAnnotationFilters, "list-filter-annotation", []string{}, "With --all, only copy the images of the SOURCE-IMAGE list with the annotation `KEY=VALUE` (can be repeated)")
+	flags.BoolVar(&opts.localPlatform, "local-platform", false, "Copy the image for the OS, architecture and variant of this machine if SOURCE-IMAGE is a list, rejecting --override-* options")
+	flags.BoolVar(&opts.selectBest, "select-best", false, "If SOURCE-IMAGE is a list, copy the image which is best according to --select-prefer out of all images for the OS")
+	flags.StringSliceVar(&opts.selectPreferences, "select-prefer", defaultSelectPreferences, "With --select-best, prefer images by `RULES` (host, variant or size), in order")
+	flags.BoolVar(&opts.flattenIndex, "flatten-index", false, "With --all, if SOURCE-IMAGE is an index containing nested indexes, copy a single index of all images instead of the nested indexes")
+	flags.StringVar(&opts.osVersion, "os-version", "", "With --override-os windows, if SOURCE-IMAGE is a list, copy the first image whose os.version matches `VERSION`")
 	flags.Var(commonFlag.NewOptionalStringValue(&opts.multiArch), "multi-arch", `How to handle multi-architecture images (system, all, or index-only)`)
 	flags.BoolVar(&opts.preserveDigests, "preserve-digests", false, "Preserve digests of images and lists")
+	flags.StringVar(&opts.preferBlobEncoding, "prefer-blob-encoding", "", "If SOURCE-IMAGE is a list, prefer copying an image with layers compressed using `ALGORITHM` (zstd or gzip), if available")
+	flags.BoolVar(&opts.dedupListBlobs, "dedup-list-blobs", false, "When copying several images of a list, reuse blobs already copied for one of them for the others, without checking the destination again")
+	flags.BoolVar(&opts.skipIfListMatches, "skip-if-list-matches", false, "Skip the copy if DESTINATION-IMAGE already has the same top-level manifest (usually a list) as SOURCE-IMAGE")
+	flags.BoolVar(&opts.splitByArch, "split-by-arch", false, "Copy each image of the SOURCE-IMAGE list to a separate repository named after DESTINATION-IMAGE with a per-platform suffix, and don't copy the list")
+	flags.StringVar(&opts.splitByArchSuffix, "split-by-arch-suffix", "-{arch}", "With --split-by-arch, add `PATTERN` to the repository name; {os}, {arch} and {variant} are replaced by the image platform")
+	flags.BoolVar(&opts.keepListWrapper, "keep-list-wrapper", false, "If SOURCE-IMAGE is a list, copy the chosen image inside a list containing only that image")
+	flags.BoolVar(&opts.preserveAnnotations, "preserve-annotations", false, "Carry annotations through a format conversion where possible, and warn about annotations which can't be represented")
+	flags.BoolVar(&opts.preserveEmptyLayers, "preserve-empty-layer-markers", false, "Fail if the empty layer markers in the history of the copied image, or their order, differ from SOURCE-IMAGE")
+	flags.BoolVar(&opts.destCASLayout, "dest-cas-layout", false, "Write the dir: DESTINATION-IMAGE as a content-addressed store, with blobs and manifests stored only by digest, shared by all images copied to it")
 	flags.BoolVar(&opts.removeSignatures, "remove-signatures", false, "Do not copy signatures from SOURCE-IMAGE")
 	flags.StringVar(&opts.signByFingerprint, "sign-by", "", "Sign the image using a GPG key with the specified `FINGERPRINT`")
 	flags.StringVar(&opts.signBySigstoreParamFile, "sign-by-sigstore", "", "Sign the image using a sigstore parameter file at `PATH`")
 	flags.StringVar(&opts.signBySigstorePrivateKey, "sign-by-sigstore-private-key", "", "Sign the image using a sigstore private key at `PATH`")
 	flags.StringVar(&opts.signPassphraseFile, "sign-passphrase-file", "", "Read a passphrase for signing an image from `PATH`")
 	flags.StringVar(&opts.signIdentity, "sign-identity", "", "Identity of signed image, must be a fully specified docker reference. Defaults to the target docker reference.")
+	flags.BoolVar(&opts.verifyAfterPush, "verify-after-push", false, "After copying, read back the manifest from DESTINATION-IMAGE and verify that it matches the copied one")
+	flags.BoolVar(&opts.verifyBlobsStreaming, "verify-blobs-streaming", false, "Abort reading a blob of SOURCE-IMAGE as soon as it exceeds the size declared in its manifest")
+	flags.BoolVar(&opts.strictSize, "strict-size", false, "Like --verify-blobs-streaming, and also fail if a blob of SOURCE-IMAGE is smaller than its declared size, or has no declared size")
+	flags.IntVar(&opts.verifySampleBlobs, "verify-sample-blobs", 0, "With --verify-after-push, also read back and verify `N` randomly chosen blobs")
+	flags.BoolVar(&opts.destEnableVerity, "dest-enable-verity", false, "Store layers copied to a containers-storage: DESTINATION-IMAGE using composefs, enabling fs-verity where supported")
+	flags.StringVar(&opts.verityReport, "verity-report", "", "With --dest-enable-verity, write the fs-verity digests of the files in each layer of DESTINATION-IMAGE to `FILE`, as JSON")
+	flags.IntVar(&opts.verityWorkers, "verity-workers", 1, "With --verity-report, enable fs-verity for up to `N` files concurrently")
+	flags.BoolVar(&opts.embedVerityAnnotations, "embed-verity-annotations", false, "With --dest-enable-verity, record the fs-verity digests of the composefs blobs of the layers of DESTINATION-IMAGE in layer annotations of its manifest")
+	flags.StringVar(&opts.composefsHelper, "composefs-helper", "", "Use the mkcomposefs helper at `PATH` for --dest-enable-verity (default is mkcomposefs in $PATH)")
+	flags.BoolVar(&opts.printImageID, "print-image-id", false, "Print the ID of the image stored in a containers-storage: DESTINATION-IMAGE, even with --quiet")
 	flags.StringVar(&opts.digestFile, "digestfile", "", "Write the digest of the pushed image to the specified file")
+	flags.BoolVar(&opts.embedCopyRecord, "embed-copy-record", false, "Record the source and destination references and digests, and the time of the copy, in the oci: DESTINATION-IMAGE layout")
+	flags.StringVar(&opts.destSubject, "dest-subject", "", "Set the subject of the copied OCI manifest to `IMAGE`, which must exist in the same repository as DESTINATION-IMAGE, making the copy a referrer of IMAGE")
+	flags.StringVar(&opts.emitPinFile, "emit-pin", "", "Append the source reference, source digest and destination digest to `FILE`")
 	flags.VarP(commonFlag.NewOptionalStringValue(&opts.format), "format", "f", `MANIFEST TYPE (oci, v2s1, or v2s2) to use in the destination (default is manifest type of source, with fallbacks)`)
+	flags.BoolVar(&opts.downgradeToV2s1, "downgrade-to-v2s1", false, "Convert a single-image SOURCE-IMAGE to a v2s1 manifest for registries which only accept v2s1, failing if SOURCE-IMAGE is a list")
 	flags.StringSliceVar(&opts.encryptionKeys, "encryption-key", []string{}, "*Experimental* key with the encryption protocol to use needed to encrypt the image (e.g. jwe:/path/to/key.pem)")
+	flags.DurationVar(&opts.destPushTimeout, "dest-push-timeout", 0, "Fail if writing to DESTINATION-IMAGE does not finish within `DURATION` of the first write (default is no timeout)")
+	flags.IntVar(&opts.manifestPutRetries, "manifest-put-retries", 0, "Retry a failed manifest upload to DESTINATION-IMAGE up to `N` times, without copying the blobs again")
+	flags.BoolVar(&opts.retryOnBlobUnknown, "dest-retry-on-manifest-unknown", false, "If the registry rejects the manifest because it does not know a just uploaded blob, check the blobs and retry the manifest upload, up to --retry-times times")
+	flags.StringArrayVar(&opts.noBlobMountHosts, "no-blob-mount-host", []string{}, "Don't mount blobs from other repositories when copying to a registry at `HOST` (can be repeated)")
+	flags.IntVar(&opts.writeBufferSize, "write-buffer-size", 0, "Write blobs to dir: or oci: DESTINATION-IMAGE in chunks of `BYTES` (default is chosen by the destination)")
+	flags.IntVar(&opts.compressionWorkers, "compression-workers", 0, "Copy and (re)compress up to `N` layers in parallel, if the source and destination support it (default is chosen by the destination)")
+	flags.BoolVar(&opts.reproducibleArchive, "reproducible-archive", false, "Normalize the order, timestamps, ownership and permissions of the entries of a docker-archive: DESTINATION-IMAGE, so that identical images produce identical archives")
+	flags.StringVar(&opts.pushStateFile, "push-state-file", "", "Record the blobs confirmed by DESTINATION-IMAGE in `PATH`, and when restarting an interrupted copy, only re-check them and push the other blobs; the file is removed after a successful copy")
+	flags.BoolVar(&opts.strictLayerOrder, "strict-layer-order", false, "Write blobs to DESTINATION-IMAGE one at a time, in manifest order, and only write a manifest after all blobs it references have been confirmed")
+	flags.StringVar(&opts.tarballConfig, "tarball-config", "", "Use the OCI image config in `FILE` as the base of the config of a tarball: SOURCE-IMAGE")
+	flags.Int64Var(&opts.compressionThreshold, "dest-compression-threshold", 0, "Do not compress layers smaller than `BYTES` at the destination")
+	flags.StringArrayVar(&opts.excludePaths, "exclude-path", []string{}, "Remove files and directories matching `PATTERN` from the layers of the copied image (can be repeated)")
+	flags.StringVar(&opts.configPatch, "config-patch", "", "Apply the JSON merge patch (RFC 7386) in `FILE` to the config of the copied image, changing the digests of the image and invalidating its signatures")
+	flags.BoolVar(&opts.squash, "squash", false, "Merge all layers of the copied image into a single layer, changing the digests of the image and dropping its layer history")
+	flags.IntVar(&opts.maxLayers, "max-layers", 0, "Fail before copying anything if the copied image has more than `N` layers (default is unlimited)")
+	flags.BoolVar(&opts.squashOver, "squash-over", false, "With --max-layers, merge the lowest layers of an image with too many layers into one, instead of failing")
+	flags.BoolVar(&opts.normalizeToOCI, "normalize-to-oci", false, "Relabel Docker manifests, lists, configs and layers with the equivalent OCI media types, failing if that would change the contents of any blob")
+	flags.StringArrayVar(&opts.rewriteMediaTypes, "rewrite-media-type", []string{}, "Label config and layer blobs with media type `FROM=TO` in the destination instead, if the blob contents are identical for both types (can be repeated)")
+	flags.BoolVar(&opts.createSharedBlobDir, "create-shared-blob-dir", false, "Create the directories specified by --src-shared-blob-dir and --dest-shared-blob-dir if they don't exist")
+	flags.StringArrayVar(&opts.srcTransportOptions, "src-transport-opt", []string{}, "Set a source transport-specific option `KEY=VALUE` (can be repeated)")
+	flags.StringArrayVar(&opts.destTransportOptions, "dest-transport-opt", []string{}, "Set a destination transport-specific option `KEY=VALUE` (can be repeated)")
+	flags.StringVar(&opts.deltaFrom, "delta-from", "", "*Experimental* assume that blobs of `IMAGE`, which must be stored in the same repository as DESTINATION-IMAGE, exist at the destination")
 	flags.IntSliceVar(&opts.encryptLayer, "encrypt-layer", []int{}, "*Experimental* the 0-indexed layer indices, with support for negative indexing (e.g. 0 is the first layer, -1 is the last layer)")
 	flags.StringSliceVar(&opts.decryptionKeys, "decryption-key", []string{}, "*Experimental* key needed to decrypt the image")
+	flags.BoolVar(&opts.requireDigestSource, "require-digest-source", false, "Fail unless SOURCE-IMAGE is pinned by digest")
+	flags.StringVar(&opts.resolveTagsFrom, "resolve-tags-from", "", "If SOURCE-IMAGE is recorded in `FILE`, in the --emit-pin format, copy the recorded digest instead of resolving the tag")
+	flags.BoolVar(&opts.verifyCosign, "verify-cosign", false, "Before copying, require a cosign signature of SOURCE-IMAGE, stored in its sha256-<digest>.sig tag, made by --cosign-key")
+	flags.StringVar(&opts.cosignKey, "cosign-key", "", "Verify the --verify-cosign signature using the public key at `PATH`")
 	return cmd
 }
 
@@ -119,12 +257,41 @@ func parseMultiArch(multiArch string) (copy.ImageListSelection, error) {
 	}
 }
 
+// intermediatePolicyContext returns a policy context for copying an image which skopeo has built from the source image,
+// after verifying the source image against the policy; the built image can't have valid signatures.
+func intermediatePolicyContext() (*signature.PolicyContext, error) {
+	return signature.NewPolicyContext(insecureAcceptAnythingPolicy())
+}
+
+// checkSourcePinnedByDigest returns an error if ref does not refer to an image by digest.
+func checkSourcePinnedByDigest(ref types.ImageReference) error {
+	dockerRef := ref.DockerReference()
+	if dockerRef == nil {
+		return fmt.Errorf("--require-digest-source: source %s does not use a docker reference and can not be pinned by digest", transports.ImageName(ref))
+	}
+	if _, isDigested := dockerRef.(reference.Canonical); !isDigested {
+		return fmt.Errorf("--require-digest-source: source %s is not pinned by digest, use NAME@sha256:... instead of a tag", transports.ImageName(ref))
+	}
+	return nil
+}
+
+// warnSourceSigstoreSignaturesDropped warns, unless signatures are removed anyway, that option wraps the source image,
+// which hides its sigstore signatures from c/image, so that they are not copied.
+func (opts *copyOptions) warnSourceSigstoreSignaturesDropped(option string) {
+	if !opts.removeSignatures {
+		logrus.Warnf("With %s, sigstore signatures of the source image are not copied", option)
+	}
+}
+
 func (opts *copyOptions) run(args []string, stdout io.Writer) (retErr error) {
 	if len(args) != 2 {
 		return errorShouldDisplayUsage{errors.New("Exactly two arguments expected")}
 	}
 	opts.deprecatedTLSVerify.warnIfUsed([]string{"--src-tls-verify", "--dest-tls-verify"})
 	imageNames := args
+	if opts.recursive {
+		return opts.runRecursive(imageNames, stdout)
+	}
 
 	if err := reexecIfNecessaryForImages(imageNames...); err != nil {
 		return err
@@ -140,15 +307,63 @@ func (opts *copyOptions) run(args []string, stdout io.Writer) (retErr error) {
 		}
 	}()
 
-	srcRef, err := alltransports.ParseImageName(imageNames[0])
+	if opts.composefsHelper != "" && !opts.destEnableVerity {
+		return errors.New("--composefs-helper requires --dest-enable-verity")
+	}
+	if opts.destEnableVerity {
+		// This must happen before any containers-storage: reference is parsed, initializing the default store.
+		if !strings.HasPrefix(imageNames[1], storage.Transport.Name()+":") {
+			return fmt.Errorf("--dest-enable-verity requires a %s: destination", storage.Transport.Name())
+		}
+		if opts.dryRun {
+			return errors.New("--dest-enable-verity can not be used together with --dry-run")
+		}
+		if err := setUpVerityStore(imageNames[1], opts.composefsHelper, opts.global); err != nil {
+			return err
+		}
+	}
+	srcRef, err := parseSourceImageName(imageNames[0])
 	if err != nil {
 		return fmt.Errorf("Invalid source name %s: %v", imageNames[0], err)
 	}
+	if opts.tarballConfig != "" {
+		if err := applyTarballConfig(srcRef, opts.tarballConfig); err != nil {
+			return err
+		}
+	}
+	if opts.resolveTagsFrom != "" {
+		pins, err := readPins(opts.resolveTagsFrom)
+		if err != nil {
+			return err
+		}
+		pinnedRef, err := resolveTagFromPins(srcRef, pins)
+		if err != nil {
+			return err
+		}
+		if pinnedRef != nil {
+			logrus.Debugf("Using %s, pinned in %s, instead of %s", transports.ImageName(pinnedRef), opts.resolveTagsFrom, transports.ImageName(srcRef))
+			srcRef = pinnedRef
+		}
+	}
+	if opts.requireDigestSource {
+		if err := checkSourcePinnedByDigest(srcRef); err != nil {
+			return err
+		}
+	}
 	destRef, err := alltransports.ParseImageName(imageNames[1])
 	if err != nil {
 		return fmt.Errorf("Invalid destination name %s: %v", imageNames[1], err)
 	}
 
+	if opts.createSharedBlobDir {
+		if err := opts.srcImage.createSharedBlobDir(); err != nil {
+			return err
+		}
+		if err := opts.destImage.createSharedBlobDir(); err != nil {
+			return err
+		}
+	}
+
 	sourceCtx, err := opts.srcImage.newSystemContext()
 	if err != nil {
 		return err
@@ -157,6 +372,12 @@ func (opts *copyOptions) run(args []string, stdout io.Writer) (retErr error) {
 	if err != nil {
 		return err
 	}
+	if err := applyTransportOptions(sourceCtx, srcRef.Transport().Name(), opts.srcTransportOptions); err != nil {
+		return fmt.Errorf("Invalid --src-transport-opt: %w", err)
+	}
+	if err := applyTransportOptions(destinationCtx, destRef.Transport().Name(), opts.destTransportOptions); err != nil {
+		return fmt.Errorf("Invalid --dest-transport-opt: %w", err)
+	}
 
 	var manifestType string
 	if opts.format.Present() {
@@ -165,6 +386,9 @@ func (opts *copyOptions) run(args []string, stdout io.Writer) (retErr error) {
 			return err
 		}
 	}
+	if opts.downgradeToV2s1 {
+		manifestType = manifest.DockerV2Schema1SignedMediaType
+	}
 
 	for _, image := range opts.additionalTags {
 		ref, err := reference.ParseNormalizedNamed(image)
@@ -181,6 +405,7 @@ func (opts *copyOptions) run(args []string, stdout io.Writer) (retErr error) {
 	ctx, cancel := opts.global.commandTimeoutContext()
 	defer cancel()
 
+	imageIDOutput := stdout // Not silenced by --quiet
 	if opts.quiet {
 		stdout = nil
 	}
@@ -198,6 +423,155 @@ func (opts *copyOptions) run(args []string, stdout io.Writer) (retErr error) {
 	if opts.all {
 		imageListSelection = copy.CopyAllImages
 	}
+	if err := opts.checkFlagConflicts(imageListSelection, manifestType); err != nil {
+		return err
+	}
+	if opts.localPlatform {
+		if imageListSelection != copy.CopySystemImage || opts.splitByArch {
+			return errors.New("--local-platform can only be used when copying a single image from a list")
+		}
+		if err := checkLocalPlatform(opts.global); err != nil {
+			return err
+		}
+		setLocalPlatform(sourceCtx)
+	}
+	if opts.selectBest {
+		if imageListSelection != copy.CopySystemImage || opts.splitByArch || opts.keepListWrapper {
+			return errors.New("--select-best can only be used when copying a single image from a list")
+		}
+		if err := validateSelectPreferences(opts.selectPreferences); err != nil {
+			return err
+		}
+	}
+	if opts.osVersion != "" {
+		if imageListSelection != copy.CopySystemImage || opts.splitByArch || opts.keepListWrapper {
+			return errors.New("--os-version can only be used when copying a single image from a list")
+		}
+		if err := checkOSVersion(opts.global); err != nil {
+			return err
+		}
+	}
+	if opts.flattenIndex && imageListSelection != copy.CopyAllImages {
+		return errors.New("--flatten-index requires --all or --multi-arch=all")
+	}
+	listAnnotationFilters, err := parseListAnnotationFilters(opts.listAnnotationFilters)
+	if err != nil {
+		return err
+	}
+	if len(listAnnotationFilters) != 0 {
+		if imageListSelection != copy.CopyAllImages || opts.splitByArch {
+			return errors.New("--list-filter-annotation can only be used together with --all")
+		}
+	}
+	preferGzipInstances := types.OptionalBoolUndefined
+	switch opts.preferBlobEncoding {
+	case "":
+	case "zstd":
+		preferGzipInstances = types.OptionalBoolFalse
+	case "gzip":
+		preferGzipInstances = types.OptionalBoolTrue
+	default:
+		return fmt.Errorf("Invalid --prefer-blob-encoding %q, expected zstd or gzip", opts.preferBlobEncoding)
+	}
+	mediaTypeRewrites, err := parseMediaTypeRewrites(opts.rewriteMediaTypes)
+	if err != nil {
+		return err
+	}
+	if opts.compressionThreshold < 0 {
+		return fmt.Errorf("Invalid --dest-compression-threshold %d, must not be negative", opts.compressionThreshold)
+	}
+	if opts.compressionWorkers < 0 {
+		return fmt.Errorf("Invalid --compression-workers %d, must not be negative", opts.compressionWorkers)
+	}
+	if opts.destPushTimeout < 0 {
+		return fmt.Errorf("Invalid --dest-push-timeout %s, must not be negative", opts.destPushTimeout)
+	}
+	if opts.manifestPutRetries < 0 {
+		return fmt.Errorf("Invalid --manifest-put-retries %d, must not be negative", opts.manifestPutRetries)
+	}
+	if opts.retryOnBlobUnknown && opts.retryOpts.MaxRetry <= 0 {
+		return errors.New("--dest-retry-on-manifest-unknown requires --retry-times")
+	}
+	excludePatterns, err := parseExcludePatterns(opts.excludePaths)
+	if err != nil {
+		return err
+	}
+	var configPatch map[string]any
+	if opts.configPatch != "" {
+		configPatch, err = readConfigPatch(opts.configPatch)
+		if err != nil {
+			return err
+		}
+	}
+	if opts.maxLayers < 0 {
+		return fmt.Errorf("Invalid --max-layers %d, must not be negative", opts.maxLayers)
+	}
+	if opts.squashOver {
+		if opts.maxLayers == 0 {
+			return errors.New("--squash-over requires --max-layers")
+		}
+	}
+	if opts.destCASLayout {
+		destRef, err = newCASLayoutReference(destRef)
+		if err != nil {
+			return err
+		}
+	}
+	var progressWebhookURL *url.URL
+	if opts.progressWebhook != "" {
+		progressWebhookURL, err = parseProgressWebhookURL(opts.progressWebhook)
+		if err != nil {
+			return err
+		}
+	}
+	if opts.writeBufferSize < 0 {
+		return fmt.Errorf("Invalid --write-buffer-size %d, must not be negative", opts.writeBufferSize)
+	}
+	if opts.writeBufferSize > 0 {
+		if name := destRef.Transport().Name(); name != directory.Transport.Name() && name != layout.Transport.Name() {
+			return fmt.Errorf("--write-buffer-size is only supported for dir: and oci: destinations, not %s:", name)
+		}
+	}
+	if opts.verityReport != "" && !opts.destEnableVerity {
+		return errors.New("--verity-report requires --dest-enable-verity")
+	}
+	if opts.verityWorkers < 1 {
+		return fmt.Errorf("Invalid --verity-workers value %d, must be at least 1", opts.verityWorkers)
+	}
+	if opts.verityWorkers != 1 && opts.verityReport == "" {
+		return errors.New("--verity-workers requires --verity-report")
+	}
+	if opts.embedVerityAnnotations {
+		if !opts.destEnableVerity {
+			return errors.New("--embed-verity-annotations requires --dest-enable-verity")
+		}
+	}
+	if opts.printImageID {
+		if name := destRef.Transport().Name(); name != storage.Transport.Name() {
+			return fmt.Errorf("--print-image-id requires a %s: destination, not %s:", storage.Transport.Name(), name)
+		}
+	}
+	if opts.reproducibleArchive {
+		if name := destRef.Transport().Name(); name != archive.Transport.Name() {
+			return fmt.Errorf("--reproducible-archive requires a %s: destination, not %s:", archive.Transport.Name(), name)
+		}
+	}
+	if opts.verifyCosign != (opts.cosignKey != "") {
+		return errors.New("--verify-cosign and --cosign-key must be used together")
+	}
+	var copyRecordFilePath string
+	if opts.embedCopyRecord {
+		copyRecordFilePath, err = copyRecordPath(destRef)
+		if err != nil {
+			return err
+		}
+	}
+	if opts.verifySampleBlobs < 0 {
+		return fmt.Errorf("Invalid --verify-sample-blobs %d, must not be negative", opts.verifySampleBlobs)
+	}
+	if opts.verifySampleBlobs > 0 && !opts.verifyAfterPush {
+		return errors.New("--verify-sample-blobs can only be used together with --verify-after-push")
+	}
 
 	if len(opts.encryptionKeys) > 0 && len(opts.decryptionKeys) > 0 {
 		return fmt.Errorf("--encryption-key and --decryption-key cannot be specified together")
@@ -235,6 +609,39 @@ func (opts *copyOptions) run(args []string, stdout io.Writer) (retErr error) {
 		decConfig = cc.DecryptConfig
 	}
 
+	if opts.downgradeToV2s1 {
+		if err := checkDowngradeToV2s1Source(ctx, sourceCtx, srcRef, opts.retryOpts); err != nil {
+			return err
+		}
+	}
+
+	if opts.verifyCosign {
+		srcRef, err = verifyCosignSignature(ctx, sourceCtx, opts.global, srcRef, opts.cosignKey, opts.retryOpts, stdout)
+		if err != nil {
+			return err
+		}
+	}
+
+	var destSubject imgspecv1.Descriptor
+	if opts.destSubject != "" {
+		destSubject, err = destSubjectDescriptor(ctx, destinationCtx, destRef, opts.destSubject, opts.retryOpts)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.dryRun {
+		return copyDryRun(ctx, sourceCtx, destinationCtx, srcRef, destRef, imageListSelection, opts.retryOpts, stdout)
+	}
+
+	var sourceDigest digest.Digest
+	if opts.emitPinFile != "" || opts.embedCopyRecord || (opts.summary && stdout != nil) {
+		sourceDigest, err = sourceManifestDigest(ctx, sourceCtx, srcRef, opts.retryOpts)
+		if err != nil {
+			return err
+		}
+	}
+
 	// c/image/copy.Image does allow creating both simple signing and sigstore signatures simultaneously,
 	// with independent passphrases, but that would make the CLI probably too confusing.
 	// For now, use the passphrase with either, but only one of them.
@@ -282,36 +689,377 @@ func (opts *copyOptions) run(args []string, stdout io.Writer) (retErr error) {
 
 	opts.destImage.warnAboutIneffectiveOptions(destRef.Transport())
 
-	return retry.IfNecessary(ctx, func() error {
-		manifestBytes, err := copy.Image(ctx, policyContext, destRef, srcRef, &copy.Options{
-			RemoveSignatures:                 opts.removeSignatures,
-			Signers:                          signers,
-			SignBy:                           opts.signByFingerprint,
-			SignPassphrase:                   passphrase,
-			SignBySigstorePrivateKeyFile:     opts.signBySigstorePrivateKey,
-			SignSigstorePrivateKeyPassphrase: []byte(passphrase),
-			SignIdentity:                     signIdentity,
-			ReportWriter:                     stdout,
-			SourceCtx:                        sourceCtx,
-			DestinationCtx:                   destinationCtx,
-			ForceManifestMIMEType:            manifestType,
-			ImageListSelection:               imageListSelection,
-			PreserveDigests:                  opts.preserveDigests,
-			OciDecryptConfig:                 decConfig,
-			OciEncryptLayers:                 encLayers,
-			OciEncryptConfig:                 encConfig,
-		})
+	blobCopySemaphore, err := opts.blobCopyLimiter.semaphoreFor(destRef)
+	if err != nil {
+		return err
+	}
+
+	options := copy.Options{
+		RemoveSignatures:                 opts.removeSignatures,
+		Signers:                          signers,
+		SignBy:                           opts.signByFingerprint,
+		SignPassphrase:                   passphrase,
+		SignBySigstorePrivateKeyFile:     opts.signBySigstorePrivateKey,
+		SignSigstorePrivateKeyPassphrase: []byte(passphrase),
+		SignIdentity:                     signIdentity,
+		ReportWriter:                     stdout,
+		SourceCtx:                        sourceCtx,
+		DestinationCtx:                   destinationCtx,
+		ForceManifestMIMEType:            manifestType,
+		ImageListSelection:               imageListSelection,
+		PreserveDigests:                  opts.preserveDigests,
+		PreferGzipInstances:              preferGzipInstances,
+		OciDecryptConfig:                 decConfig,
+		OciEncryptLayers:                 encLayers,
+		OciEncryptConfig:                 encConfig,
+		ConcurrentBlobCopiesSemaphore:    blobCopySemaphore,
+		MaxParallelDownloads:             uint(opts.compressionWorkers),
+	}
+	if progressWebhookURL != nil {
+		webhook := newProgressWebhook(progressWebhookURL)
+		defer webhook.close()
+		options.Progress = webhook.progress
+		options.ProgressInterval = progressWebhookInterval
+	}
+	if opts.splitByArch {
+		return copySplitByArch(ctx, policyContext, srcRef, destRef, opts.splitByArchSuffix, opts.withBlobSizeChecks, &options, opts.retryOpts, stdout)
+	}
+
+	if opts.selectBest {
+		instance, platform, err := selectBestInstanceForReference(ctx, sourceCtx, srcRef, opts.selectPreferences, opts.retryOpts)
 		if err != nil {
 			return err
 		}
-		if opts.digestFile != "" {
+		if instance != "" {
+			if stdout != nil {
+				fmt.Fprintf(stdout, "Selected %s image %s\n", platform, instance)
+			}
+			srcRef, err = listInstanceImageReference(srcRef, instance)
+			if err != nil {
+				return err
+			}
+			if sourceDigest != "" {
+				sourceDigest = instance
+			}
+		}
+	} else if opts.osVersion != "" {
+		instance, platform, err := selectOSVersionInstanceForReference(ctx, sourceCtx, srcRef, opts.osVersion, opts.retryOpts)
+		if err != nil {
+			return err
+		}
+		if instance != "" {
+			if stdout != nil {
+				fmt.Fprintf(stdout, "Selected %s image %s\n", platform, instance)
+			}
+			srcRef, err = listInstanceImageReference(srcRef, instance)
+			if err != nil {
+				return err
+			}
+			if sourceDigest != "" {
+				sourceDigest = instance
+			}
+		}
+	} else if imageListSelection == copy.CopySystemImage && !opts.localPlatform { // --local-platform uses the standard matching rules
+		if err := adjustVariantChoiceForReference(ctx, sourceCtx, srcRef, opts.retryOpts); err != nil {
+			return err
+		}
+	}
+	srcRef = opts.withBlobSizeChecks(srcRef)
+	pushedRef := destRef      // Before wrapping it, for reading the image back
+	var nestedIndexTop []byte // The top-level index written to the destination, if it contains nested indexes which are preserved
+	if imageListSelection == copy.CopyAllImages {
+		srcRef, destRef, nestedIndexTop, err = setUpNestedIndexCopy(ctx, sourceCtx, srcRef, destRef, opts.flattenIndex, opts.retryOpts)
+		if err != nil {
+			return err
+		}
+		if _, ok := srcRef.(flatIndexReference); ok {
+			if opts.flattenIndex {
+				opts.warnSourceSigstoreSignaturesDropped("--flatten-index")
+			} else {
+				opts.warnSourceSigstoreSignaturesDropped("nested indexes")
+			}
+		}
+		if nestedIndexTop != nil {
+			if opts.signByFingerprint != "" || opts.signBySigstoreParamFile != "" || opts.signBySigstorePrivateKey != "" {
+				return errors.New("an index containing nested indexes can not be signed; consider --flatten-index")
+			}
+			options.PreserveDigests = true // The nested indexes refer to the images by digest
+		}
+	}
+	sourceRebuilt := false // Set if the image copied is built from the source image, which has already been verified against policyContext
+	if opts.prePushCmd != "" {
+		srcRef, err = setUpPrePushCmd(ctx, policyContext, srcRef, opts.prePushCmd, &options, opts.global, opts.retryOpts, stdout)
+		if err != nil {
+			return err
+		}
+		// The staged image has been verified against the policy while staging it.
+		sourceRebuilt = true
+	}
+	if len(excludePatterns) != 0 {
+		srcRef, err = setUpExcludePaths(ctx, sourceCtx, policyContext, srcRef, excludePatterns, opts.global, opts.retryOpts)
+		if err != nil {
+			return err
+		}
+		sourceRebuilt = true
+	}
+	if opts.squash {
+		srcRef, err = setUpSquash(ctx, sourceCtx, policyContext, srcRef, 1, "--squash", opts.global, opts.retryOpts)
+		if err != nil {
+			return err
+		}
+		sourceRebuilt = true
+	}
+	if configPatch != nil {
+		srcRef, err = setUpConfigPatch(ctx, sourceCtx, policyContext, srcRef, configPatch, opts.retryOpts)
+		if err != nil {
+			return err
+		}
+		sourceRebuilt = true
+	}
+	if opts.maxLayers > 0 {
+		layers, description, err := maxLayerCount(ctx, sourceCtx, srcRef, imageListSelection, opts.retryOpts)
+		if err != nil {
+			return err
+		}
+		if layers > opts.maxLayers {
+			if !opts.squashOver {
+				return fmt.Errorf("%s has %d layers, more than --max-layers %d; consider using --squash-over", description, layers, opts.maxLayers)
+			}
+			srcRef, err = setUpSquash(ctx, sourceCtx, policyContext, srcRef, opts.maxLayers, "--squash-over", opts.global, opts.retryOpts)
+			if err != nil {
+				return err
+			}
+			sourceRebuilt = true
+		}
+	}
+	copyPolicyContext := policyContext
+	if sourceRebuilt {
+		copyPolicyContext, err = intermediatePolicyContext()
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := copyPolicyContext.Destroy(); err != nil {
+				retErr = noteCloseFailure(retErr, "tearing down policy context", err)
+			}
+		}()
+	}
+	if opts.deltaFrom != "" {
+		destRef, err = setUpDeltaFrom(ctx, destinationCtx, destRef, opts.deltaFrom, opts.retryOpts)
+		if err != nil {
+			return err
+		}
+	}
+	if len(mediaTypeRewrites) != 0 || opts.normalizeToOCI {
+		if len(mediaTypeRewrites) != 0 {
+			opts.warnSourceSigstoreSignaturesDropped("--rewrite-media-type")
+		}
+		if opts.normalizeToOCI {
+			opts.warnSourceSigstoreSignaturesDropped("--normalize-to-oci")
+		}
+		srcRef = mediaTypeRewritingReference{ImageReference: srcRef, rewrites: mediaTypeRewrites, toOCI: opts.normalizeToOCI}
+	}
+	if opts.destSubject != "" {
+		opts.warnSourceSigstoreSignaturesDropped("--dest-subject")
+		srcRef = subjectSettingReference{ImageReference: srcRef, subject: destSubject, copyAll: imageListSelection == copy.CopyAllImages}
+	}
+	if len(listAnnotationFilters) != 0 {
+		opts.warnSourceSigstoreSignaturesDropped("--list-filter-annotation")
+		srcRef = annotationFilteredListReference{ImageReference: srcRef, filters: listAnnotationFilters}
+	}
+	if opts.keepListWrapper {
+		// The list presented by srcRef contains only a single image; copy it, and the list.
+		opts.warnSourceSigstoreSignaturesDropped("--keep-list-wrapper")
+		srcRef = singleInstanceListReference{ImageReference: srcRef}
+		imageListSelection = copy.CopyAllImages
+	}
+	if destRef.Transport().Name() == archive.Transport.Name() {
+		destRef, err = newAtomicArchiveReference(destRef, opts.reproducibleArchive)
+		if err != nil {
+			return err
+		}
+		if opts.destImage.dirForceCompression {
+			destRef = compressingArchiveReference{ImageReference: destRef}
+		}
+	}
+	if opts.daemonMediaTypeCompat {
+		if destRef.Transport().Name() != daemon.Transport.Name() {
+			return fmt.Errorf("--daemon-mediatype-compat requires a %s: destination", daemon.Transport.Name())
+		}
+		if opts.destImage.compressionFormat != "" {
+			return errors.New("--daemon-mediatype-compat can not be used together with --dest-compress-format")
+		}
+		destRef = decompressingDaemonReference{ImageReference: destRef}
+	}
+	if opts.dedupListBlobs {
+		destRef = dedupBlobsReference{ImageReference: destRef}
+	}
+	destRef, err = withoutBlobMountsForHosts(destRef, opts.noBlobMountHosts)
+	if err != nil {
+		return err
+	}
+	if opts.writeBufferSize > 0 {
+		destRef = writeBufferSizeReference{ImageReference: destRef, size: opts.writeBufferSize}
+	}
+	if opts.destPushTimeout > 0 {
+		destRef = pushTimeoutReference{ImageReference: destRef, timeout: opts.destPushTimeout}
+	}
+	if opts.manifestPutRetries > 0 || opts.retryOnBlobUnknown {
+		// Wraps the --dest-push-timeout destination, so that all attempts share its deadline.
+		ref := manifestPutRetryReference{ImageReference: destRef, retries: opts.manifestPutRetries, delay: opts.retryOpts.Delay}
+		if opts.retryOnBlobUnknown {
+			ref.blobUnknownRetries = opts.retryOpts.MaxRetry
+		}
+		destRef = ref
+	}
+	if opts.compressionThreshold > 0 {
+		opts.warnSourceSigstoreSignaturesDropped("--dest-compression-threshold")
+		srcRef, destRef, options.ConcurrentBlobCopiesSemaphore = setUpCompressionThreshold(srcRef, destRef, opts.compressionThreshold)
+	}
+	if opts.strictLayerOrder {
+		// This also copies one blob at a time, as --dest-compression-threshold requires.
+		destRef, options.ConcurrentBlobCopiesSemaphore = setUpStrictLayerOrder(destRef)
+	}
+	var resumeState *pushState
+	if opts.pushStateFile != "" {
+		resumeState, err = loadPushState(opts.pushStateFile, transports.ImageName(pushedRef))
+		if err != nil {
+			return err
+		}
+		destRef = pushStateReference{ImageReference: destRef, state: resumeState}
+	}
+	var summary *copySummary
+	if opts.summary && stdout != nil {
+		summary = &copySummary{}
+		if options.ProgressInterval == 0 {
+			options.ProgressInterval = summaryProgressInterval
+		}
+	}
+	progress := options.Progress // Set up again for every attempt, if --summary needs to watch it
+	var srcAnnotations map[string]map[string]string
+	if opts.preserveAnnotations {
+		srcAnnotations, err = sourceManifestAnnotations(ctx, sourceCtx, srcRef, imageListSelection, opts.retryOpts)
+		if err != nil {
+			return err
+		}
+	}
+
+	var srcEmptyLayers []bool
+	if opts.preserveEmptyLayers {
+		srcEmptyLayers, err = emptyLayerMarkers(ctx, sourceCtx, srcRef, opts.retryOpts)
+		if err != nil {
+			return fmt.Errorf("reading the history of the source image: %w", err)
+		}
+	}
+
+	var matchingManifest []byte
+	if opts.skipIfListMatches {
+		matchingManifest, err = matchingDestinationManifest(ctx, sourceCtx, destinationCtx, srcRef, pushedRef, opts.retryOpts)
+		if err != nil {
+			return err
+		}
+		if matchingManifest != nil && stdout != nil {
+			matchingDigest, err := manifest.Digest(matchingManifest)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, "Destination already contains manifest %s, skipping the copy\n", matchingDigest)
+		}
+	}
+
+	return retry.IfNecessary(ctx, func() error {
+		manifestBytes := matchingManifest
+		var copyDuration time.Duration
+		if manifestBytes == nil {
+			var stopSummary func()
+			if summary != nil {
+				options.Progress, stopSummary = summary.watchProgress(progress)
+			}
+			copyStart := time.Now()
+			var err error
+			manifestBytes, err = copy.Image(ctx, copyPolicyContext, destRef, srcRef, &options)
+			if stopSummary != nil {
+				stopSummary()
+			}
+			if err != nil {
+				return err
+			}
+			if nestedIndexTop != nil {
+				manifestBytes = nestedIndexTop // Not the flattened index copy.Image has seen
+			}
+			if opts.embedVerityAnnotations {
+				manifestBytes, err = embedVerityAnnotations(pushedRef)
+				if err != nil {
+					return err
+				}
+			}
+			copyDuration = time.Since(copyStart)
+		}
+		if resumeState != nil {
+			if err := resumeState.remove(); err != nil {
+				return err
+			}
+		}
+		if opts.preserveAnnotations {
+			destAnnotations, err := manifestAnnotations(manifestBytes, manifest.GuessMIMEType(manifestBytes))
+			if err != nil {
+				return err
+			}
+			for _, lost := range lostAnnotations(srcAnnotations, destAnnotations) {
+				logrus.Warnf("Annotation %s can not be represented in the destination manifest format", lost)
+			}
+		}
+		if opts.preserveEmptyLayers {
+			if err := checkEmptyLayerMarkers(ctx, destinationCtx, pushedRef, srcEmptyLayers, opts.retryOpts); err != nil {
+				return err
+			}
+		}
+		if opts.verifyAfterPush {
+			if err := verifyAfterPush(ctx, destinationCtx, pushedRef, manifestBytes, imageListSelection, opts.verifySampleBlobs, opts.retryOpts, stdout); err != nil {
+				return err
+			}
+		}
+		if opts.digestFile != "" || opts.emitPinFile != "" || opts.embedCopyRecord || (summary != nil && matchingManifest == nil) {
 			manifestDigest, err := manifest.Digest(manifestBytes)
 			if err != nil {
 				return err
 			}
-			if err = os.WriteFile(opts.digestFile, []byte(manifestDigest.String()), 0644); err != nil {
-				return fmt.Errorf("Failed to write digest to file %q: %w", opts.digestFile, err)
+			if opts.digestFile != "" {
+				if err = os.WriteFile(opts.digestFile, []byte(manifestDigest.String()), 0644); err != nil {
+					return fmt.Errorf("Failed to write digest to file %q: %w", opts.digestFile, err)
+				}
+			}
+			if opts.emitPinFile != "" {
+				if err := appendPin(opts.emitPinFile, imageNames[0], sourceDigest, manifestDigest); err != nil {
+					return err
+				}
+			}
+			if opts.embedCopyRecord {
+				if err := appendCopyRecord(copyRecordFilePath, copyRecord{
+					Source:            imageNames[0],
+					SourceDigest:      sourceDigest,
+					Destination:       imageNames[1],
+					DestinationDigest: manifestDigest,
+					Time:              time.Now().UTC(),
+				}); err != nil {
+					return err
+				}
+			}
+			if summary != nil && matchingManifest == nil {
+				fmt.Fprint(stdout, summary.format(sourceDigest, manifestDigest, copyDuration))
+			}
+		}
+		if opts.verityReport != "" {
+			if err := writeVerityReport(pushedRef, opts.verityWorkers, opts.verityReport); err != nil {
+				return err
+			}
+		}
+		if opts.printImageID {
+			imageID, err := storageImageID(pushedRef)
+			if err != nil {
+				return err
 			}
+			fmt.Fprintln(imageIDOutput, imageID)
 		}
 		return nil
 	}, opts.retryOpts)
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/containers/image/v5/copy"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// sourceRebuildingConflicts are the options which can't be used together with the copy options which
+// build a modified single image from the source image, before copying it.
+var sourceRebuildingConflicts = []string{
+	"--all or --multi-arch",
+	"--split-by-arch",
+	"--keep-list-wrapper",
+	"--preserve-digests",
+	"--dry-run",
+	"--skip-if-list-matches",
+	"--rewrite-media-type",
+	"--normalize-to-oci",
+	"--emit-pin",
+	"--embed-copy-record",
+	"--pre-push-cmd",
+}
+
+// withConflicts returns a copy of conflicts, with more appended.
+func withConflicts(conflicts []string, more ...string) []string {
+	return append(append([]string{}, conflicts...), more...)
+}
+
+// copyFlagConflicts lists, in the order they are checked, the copy options which can't be used together with an option.
+// The names are keys of copyOptions.setFlags.
+var copyFlagConflicts = []struct {
+	flag      string
+	conflicts []string
+}{
+	{"--downgrade-to-v2s1", []string{"--format", "--all or --multi-arch", "--split-by-arch", "--keep-list-wrapper", "--preserve-digests", "--encryption-key or --decryption-key"}},
+	{"--dry-run", []string{"--quiet"}},
+	{"--select-best", []string{"--dry-run"}},
+	{"--os-version", []string{"--select-best", "--dry-run"}},
+	{"--keep-list-wrapper", []string{"--all or --multi-arch", "--preserve-digests"}},
+	{"--split-by-arch", []string{"--multi-arch", "--keep-list-wrapper", "--dry-run", "--skip-if-list-matches", "--verify-after-push", "--digestfile",
+		"--emit-pin", "--embed-copy-record", "--delta-from", "--dest-subject", "--dedup-list-blobs", "--preserve-annotations", "--rewrite-media-type",
+		"--normalize-to-oci", "--dest-compression-threshold", "--dest-push-timeout", "--manifest-put-retries", "--dest-retry-on-manifest-unknown",
+		"--write-buffer-size", "--summary", "--no-blob-mount-host", "--pre-push-cmd", "--strict-layer-order", "--push-state-file"}},
+	{"--list-filter-annotation", []string{"--preserve-digests", "--dry-run"}},
+	{"--rewrite-media-type", []string{"--preserve-digests"}},
+	{"--normalize-to-oci", []string{"--rewrite-media-type", "--preserve-digests", "--format", "--downgrade-to-v2s1"}},
+	{"--dest-subject", []string{"--format other than oci", "--downgrade-to-v2s1", "--preserve-digests", "--keep-list-wrapper"}},
+	{"--compression-workers", []string{"--dest-compression-threshold", "--dest-blob-concurrency-per-host"}},
+	{"--strict-layer-order", []string{"--compression-workers", "--dest-blob-concurrency-per-host"}},
+	{"--exclude-path", sourceRebuildingConflicts},
+	{"--squash", withConflicts(sourceRebuildingConflicts, "--exclude-path")},
+	{"--config-patch", withConflicts(sourceRebuildingConflicts, "--exclude-path", "--squash", "--squash-over")},
+	{"--squash-over", withConflicts(sourceRebuildingConflicts, "--exclude-path", "--squash", "--preserve-empty-layer-markers")},
+	{"--preserve-empty-layer-markers", []string{"--all or --multi-arch", "--split-by-arch", "--keep-list-wrapper", "--dry-run", "--squash"}},
+	{"--dest-cas-layout", []string{"--split-by-arch", "--skip-if-list-matches", "--verify-after-push", "--preserve-empty-layer-markers"}},
+	{"--pre-push-cmd", []string{"--dry-run", "--keep-list-wrapper"}},
+	{"--embed-verity-annotations", []string{"--all or --multi-arch", "--preserve-digests", "--sign-by, --sign-by-sigstore or --sign-by-sigstore-private-key"}},
+	{"--print-image-id", []string{"--dry-run"}},
+	{"--reproducible-archive", []string{"--dry-run"}},
+	{"--push-state-file", []string{"--dry-run"}},
+	// These options wrap the destination, which hides its support for sigstore signatures from c/image.
+	{"--sign-by-sigstore or --sign-by-sigstore-private-key", []string{"--dest-compression-threshold", "--delta-from", "--dedup-list-blobs", "--dest-push-timeout", "--write-buffer-size",
+		"--no-blob-mount-host", "--manifest-put-retries", "--dest-retry-on-manifest-unknown", "--strict-layer-order", "--push-state-file"}},
+}
+
+// setFlags returns, for the option names used in copyFlagConflicts, whether the options are set.
+func (opts *copyOptions) setFlags(imageListSelection copy.ImageListSelection, manifestType string) map[string]bool {
+	return map[string]bool{
+		"--all or --multi-arch":                imageListSelection != copy.CopySystemImage,
+		"--compression-workers":                opts.compressionWorkers > 0,
+		"--config-patch":                       opts.configPatch != "",
+		"--dedup-list-blobs":                   opts.dedupListBlobs,
+		"--delta-from":                         opts.deltaFrom != "",
+		"--dest-blob-concurrency-per-host":     opts.blobCopyLimiter.maxPerHost > 0,
+		"--dest-cas-layout":                    opts.destCASLayout,
+		"--dest-compression-threshold":         opts.compressionThreshold > 0,
+		"--dest-push-timeout":                  opts.destPushTimeout != 0,
+		"--dest-retry-on-manifest-unknown":     opts.retryOnBlobUnknown,
+		"--dest-subject":                       opts.destSubject != "",
+		"--digestfile":                         opts.digestFile != "",
+		"--downgrade-to-v2s1":                  opts.downgradeToV2s1,
+		"--dry-run":                            opts.dryRun,
+		"--embed-copy-record":                  opts.embedCopyRecord,
+		"--embed-verity-annotations":           opts.embedVerityAnnotations,
+		"--emit-pin":                           opts.emitPinFile != "",
+		"--encryption-key or --decryption-key": len(opts.encryptionKeys) != 0 || len(opts.decryptionKeys) != 0,
+		"--exclude-path":                       len(opts.excludePaths) != 0,
+		"--format":                             opts.format.Present(),
+		"--format other than oci":              opts.format.Present() && manifestType != imgspecv1.MediaTypeImageManifest,
+		"--keep-list-wrapper":                  opts.keepListWrapper,
+		"--list-filter-annotation":             len(opts.listAnnotationFilters) != 0,
+		"--manifest-put-retries":               opts.manifestPutRetries != 0,
+		"--multi-arch":                         opts.multiArch.Present(),
+		"--no-blob-mount-host":                 len(opts.noBlobMountHosts) != 0,
+		"--normalize-to-oci":                   opts.normalizeToOCI,
+		"--os-version":                         opts.osVersion != "",
+		"--pre-push-cmd":                       opts.prePushCmd != "",
+		"--preserve-annotations":               opts.preserveAnnotations,
+		"--preserve-digests":                   opts.preserveDigests,
+		"--preserve-empty-layer-markers":       opts.preserveEmptyLayers,
+		"--print-image-id":                     opts.printImageID,
+		"--push-state-file":                    opts.pushStateFile != "",
+		"--quiet":                              opts.quiet,
+		"--reproducible-archive":               opts.reproducibleArchive,
+		"--rewrite-media-type":                 len(opts.rewriteMediaTypes) != 0,
+		"--select-best":                        opts.selectBest,
+		"--skip-if-list-matches":               opts.skipIfListMatches,
+		"--split-by-arch":                      opts.splitByArch,
+		"--squash":                             opts.squash,
+		"--squash-over":                        opts.squashOver,
+		"--strict-layer-order":                 opts.strictLayerOrder,
+		"--summary":                            opts.summary,
+		"--verify-after-push":                  opts.verifyAfterPush,
+		"--write-buffer-size":                  opts.writeBufferSize != 0,
+		"--sign-by, --sign-by-sigstore or --sign-by-sigstore-private-key": opts.signByFingerprint != "" || opts.signBySigstoreParamFile != "" || opts.signBySigstorePrivateKey != "",
+		"--sign-by-sigstore or --sign-by-sigstore-private-key":            opts.signBySigstoreParamFile != "" || opts.signBySigstorePrivateKey != "",
+	}
+}
+
+// checkFlagConflicts returns an error if opts contains options which can't be used together, as listed in copyFlagConflicts.
+func (opts *copyOptions) checkFlagConflicts(imageListSelection copy.ImageListSelection, manifestType string) error {
+	set := opts.setFlags(imageListSelection, manifestType)
+	for _, c := range copyFlagConflicts {
+		if !set[c.flag] {
+			continue
+		}
+		for _, conflict := range c.conflicts {
+			if set[conflict] {
+				return fmt.Errorf("%s cannot be used together with %s", c.flag, conflict)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/containers/image/v5/oci/layout"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+)
+
+// copyRecordFileName is the name of the file in an OCI layout directory written by --embed-copy-record.
+// It is not a part of the OCI image layout specification, so other tools ignore it.
+const copyRecordFileName = "skopeo-copy-records.json"
+
+// copyRecord describes a single image copy into an OCI layout.
+type copyRecord struct {
+	Source            string        `json:"source"`
+	SourceDigest      digest.Digest `json:"sourceDigest,omitempty"`
+	Destination       string        `json:"destination"`
+	DestinationDigest digest.Digest `json:"destinationDigest"`
+	Time              time.Time     `json:"time"`
+}
+
+// copyRecordFile is the contents of copyRecordFileName.
+type copyRecordFile struct {
+	Records []copyRecord `json:"records"`
+}
+
+// copyRecordPath returns the path of the copy record file for destRef, which must be an oci: reference.
+func copyRecordPath(destRef types.ImageReference) (string, error) {
+	if destRef.Transport().Name() != layout.Transport.Name() {
+		return "", fmt.Errorf("--embed-copy-record requires an %s: destination, not %s:", layout.Transport.Name(), destRef.Transport().Name())
+	}
+	dir, _, _ := strings.Cut(destRef.StringWithinTransport(), ":")
+	return filepath.Join(dir, copyRecordFileName), nil
+}
+
+// appendCopyRecord adds record to the copy record file at path, creating it if necessary.
+func appendCopyRecord(path string, record copyRecord) error {
+	var contents copyRecordFile
+	existing, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(existing, &contents); err != nil {
+			return fmt.Errorf("parsing copy record file %q: %w", path, err)
+		}
+	case errors.Is(err, fs.ErrNotExist):
+	default:
+		return fmt.Errorf("reading copy record file %q: %w", path, err)
+	}
+	contents.Records = append(contents.Records, record)
+	res, err := json.MarshalIndent(contents, "", "    ")
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file and rename it, so that a failure doesn't lose earlier records.
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, append(res, '\n'), 0o644); err != nil {
+		return fmt.Errorf("writing copy record file %q: %w", path, err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("writing copy record file %q: %w", path, err)
+	}
+	return nil
+}
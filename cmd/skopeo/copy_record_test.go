@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopyEmbedCopyRecord(t *testing.T) {
+	src := testDirImageWithBlobs(t)
+	srcManifest, err := os.ReadFile(filepath.Join(src, "manifest.json"))
+	require.NoError(t, err)
+	srcDigest := digest.FromBytes(srcManifest)
+	layoutDir := t.TempDir()
+
+	before := time.Now()
+	_, err = runSkopeo("--insecure-policy", "copy", "--embed-copy-record", "dir:"+src, "oci:"+layoutDir+":first")
+	require.NoError(t, err)
+	_, err = runSkopeo("--insecure-policy", "copy", "--embed-copy-record", "--format", "v2s2", "dir:"+src, "oci:"+layoutDir+":second")
+	require.NoError(t, err)
+
+	contents, err := os.ReadFile(filepath.Join(layoutDir, copyRecordFileName))
+	require.NoError(t, err)
+	var records copyRecordFile
+	err = json.Unmarshal(contents, &records)
+	require.NoError(t, err)
+	require.Len(t, records.Records, 2)
+	for i, name := range []string{"first", "second"} {
+		record := records.Records[i]
+		assert.Equal(t, "dir:"+src, record.Source)
+		assert.Equal(t, srcDigest, record.SourceDigest)
+		assert.Equal(t, "oci:"+layoutDir+":"+name, record.Destination)
+		assert.False(t, record.Time.Before(before.Truncate(time.Second)))
+	}
+	var index imgspecv1.Index
+	indexContents, err := os.ReadFile(filepath.Join(layoutDir, "index.json"))
+	require.NoError(t, err)
+	err = json.Unmarshal(indexContents, &index)
+	require.NoError(t, err)
+	require.Len(t, index.Manifests, 2)
+	assert.Equal(t, index.Manifests[0].Digest, records.Records[0].DestinationDigest)
+	assert.Equal(t, index.Manifests[1].Digest, records.Records[1].DestinationDigest)
+
+	out, err := runSkopeo("--insecure-policy", "copy", "--embed-copy-record", "dir:"+src, "dir:"+t.TempDir())
+	assertTestFailed(t, out, err, "--embed-copy-record requires an oci: destination")
+}
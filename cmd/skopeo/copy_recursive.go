@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/containers/image/v5/directory"
+	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/oci/layout"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sirupsen/logrus"
+)
+
+// ociLayoutTreeImage is an image in an OCI layout found by --recursive, and its destination.
+type ociLayoutTreeImage struct {
+	source string // The source image name, using the oci: transport
+	dest   string // The destination image name, using the docker: transport
+}
+
+// ociLayoutTreeImages returns the images with a ref name in the OCI layouts in the directory tree at root, in lexical order of the layout paths,
+// and their destinations: the repository destPrefix, extended by the path of the layout relative to root, tagged with the ref name.
+// Layouts are not searched for further layouts.
+func ociLayoutTreeImages(root string, destPrefix reference.Named) ([]ociLayoutTreeImage, error) {
+	res := []ociLayoutTreeImage{}
+	if err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if _, err := os.Stat(filepath.Join(path, imgspecv1.ImageLayoutFile)); err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		repo := destPrefix.Name()
+		if rel != "." {
+			repo += "/" + filepath.ToSlash(rel)
+		}
+		named, err := reference.WithName(repo)
+		if err != nil {
+			return fmt.Errorf("the OCI layout at %s can not be copied to %s: %w", path, repo, err)
+		}
+		images, err := ociLayoutImages(path, named)
+		if err != nil {
+			return err
+		}
+		res = append(res, images...)
+		return fs.SkipDir // The rest of the layout are blobs
+	}); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// ociLayoutImages returns the images with a ref name in the OCI layout at path, and their destinations, tags of repo.
+func ociLayoutImages(path string, repo reference.Named) ([]ociLayoutTreeImage, error) {
+	indexJSON, err := os.ReadFile(filepath.Join(path, "index.json"))
+	if err != nil {
+		return nil, err
+	}
+	var index imgspecv1.Index
+	if err := json.Unmarshal(indexJSON, &index); err != nil {
+		return nil, fmt.Errorf("parsing the index of the OCI layout at %s: %w", path, err)
+	}
+	res := []ociLayoutTreeImage{}
+	for _, desc := range index.Manifests {
+		name, ok := desc.Annotations[imgspecv1.AnnotationRefName]
+		if !ok {
+			logrus.Warnf("Skipping image %s without a ref name in the OCI layout at %s", desc.Digest, path)
+			continue
+		}
+		tagged, err := reference.WithTag(repo, name)
+		if err != nil {
+			logrus.Warnf("Skipping image %q in the OCI layout at %s, its ref name is not a valid tag", name, path)
+			continue
+		}
+		srcRef, err := layout.NewReference(path, name)
+		if err != nil {
+			return nil, err
+		}
+		destRef, err := docker.NewReference(tagged)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, ociLayoutTreeImage{
+			source: layout.Transport.Name() + ":" + srcRef.StringWithinTransport(),
+			dest:   docker.Transport.Name() + ":" + destRef.StringWithinTransport(),
+		})
+	}
+	return res, nil
+}
+
+// runRecursive copies all images in the OCI layouts in the directory tree specified by imageNames[0], a dir: name,
+// to repositories in the registry namespace specified by imageNames[1], a docker: name without a tag, as described by ociLayoutTreeImages.
+func (opts *copyOptions) runRecursive(imageNames []string, stdout io.Writer) error {
+	if !strings.HasPrefix(imageNames[0], directory.Transport.Name()+":") {
+		return fmt.Errorf("--recursive requires a %s: source, not %s", directory.Transport.Name(), imageNames[0])
+	}
+	root := strings.TrimPrefix(imageNames[0], directory.Transport.Name()+":")
+	if !strings.HasPrefix(imageNames[1], docker.Transport.Name()+"://") {
+		return fmt.Errorf("--recursive requires a %s:// destination, not %s", docker.Transport.Name(), imageNames[1])
+	}
+	destPrefix, err := reference.ParseNormalizedNamed(strings.TrimPrefix(imageNames[1], docker.Transport.Name()+"://"))
+	if err != nil {
+		return fmt.Errorf("Invalid destination name %s: %w", imageNames[1], err)
+	}
+	if !reference.IsNameOnly(destPrefix) {
+		return fmt.Errorf("--recursive requires a destination without a tag or digest, not %s", imageNames[1])
+	}
+	for _, o := range []struct {
+		set  bool
+		name string
+	}{
+		{opts.digestFile != "", "--digestfile"},
+		{opts.splitByArch, "--split-by-arch"},
+		{opts.resolveTagsFrom != "", "--resolve-tags-from"},
+		{len(opts.additionalTags) != 0, "--additional-tag"},
+		{opts.signIdentity != "", "--sign-identity"},
+		{opts.pushStateFile != "", "--push-state-file"},
+	} {
+		if o.set {
+			return fmt.Errorf("--recursive cannot be used together with %s", o.name)
+		}
+	}
+
+	images, err := ociLayoutTreeImages(root, destPrefix)
+	if err != nil {
+		return err
+	}
+	if len(images) == 0 {
+		return fmt.Errorf("no images with a ref name found in OCI layouts in %s", root)
+	}
+	for _, image := range images {
+		if stdout != nil {
+			fmt.Fprintf(stdout, "Copying %s to %s\n", image.source, image.dest)
+		}
+		imageOpts := *opts
+		imageOpts.recursive = false
+		if err := imageOpts.run([]string{image.source, image.dest}, stdout); err != nil {
+			return fmt.Errorf("copying %s to %s: %w", image.source, image.dest, err)
+		}
+	}
+	return nil
+}
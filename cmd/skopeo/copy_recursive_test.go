@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOCILayoutTreeImages(t *testing.T) {
+	src := testDirImageWithBlobs(t)
+	root := t.TempDir()
+	err := os.MkdirAll(filepath.Join(root, "team"), 0o755)
+	require.NoError(t, err)
+	for _, dest := range []string{"base:latest", "base:2", "team/app:1.0"} {
+		out, err := runSkopeo("--insecure-policy", "copy", "dir:"+src, "oci:"+filepath.Join(root, dest))
+		require.NoError(t, err, out)
+	}
+	err = os.MkdirAll(filepath.Join(root, "empty", "dir"), 0o755)
+	require.NoError(t, err)
+
+	prefix, err := reference.ParseNormalizedNamed("registry.example.com/imports")
+	require.NoError(t, err)
+	images, err := ociLayoutTreeImages(root, prefix)
+	require.NoError(t, err)
+	assert.Equal(t, []ociLayoutTreeImage{
+		{source: "oci:" + filepath.Join(root, "base") + ":latest", dest: "docker://registry.example.com/imports/base:latest"},
+		{source: "oci:" + filepath.Join(root, "base") + ":2", dest: "docker://registry.example.com/imports/base:2"},
+		{source: "oci:" + filepath.Join(root, "team/app") + ":1.0", dest: "docker://registry.example.com/imports/team/app:1.0"},
+	}, images)
+
+	// A layout at the root is copied to the prefix itself.
+	images, err = ociLayoutTreeImages(filepath.Join(root, "team", "app"), prefix)
+	require.NoError(t, err)
+	assert.Equal(t, []ociLayoutTreeImage{
+		{source: "oci:" + filepath.Join(root, "team/app") + ":1.0", dest: "docker://registry.example.com/imports:1.0"},
+	}, images)
+
+	for _, c := range []struct{ src, dest, expected string }{
+		{"oci:" + root, "docker://registry.example.com/imports", "--recursive requires a dir: source"},
+		{"dir:" + root, "oci:" + t.TempDir(), "--recursive requires a docker:// destination"},
+		{"dir:" + root, "docker://registry.example.com/imports:latest", "without a tag or digest"},
+		{"dir:" + filepath.Join(root, "empty"), "docker://registry.example.com/imports", "no images with a ref name found"},
+	} {
+		out, err := runSkopeo("--insecure-policy", "copy", "--recursive", c.src, c.dest)
+		assertTestFailed(t, out, err, c.expected)
+	}
+	out, err := runSkopeo("--insecure-policy", "copy", "--recursive", "--digestfile", filepath.Join(t.TempDir(), "digest"),
+		"dir:"+root, "docker://registry.example.com/imports")
+	assertTestFailed(t, out, err, "--recursive cannot be used together with --digestfile")
+}
@@ -0,0 +1,535 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/containers/image/v5/copy"
+	"github.com/containers/image/v5/signature/sigstore"
+	"github.com/containers/image/v5/transports/alltransports"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecspecs "github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckSourcePinnedByDigest(t *testing.T) {
+	dir := t.TempDir()
+	for _, c := range []struct {
+		input   string
+		success bool
+	}{
+		{"docker://quay.io/skopeo/stable@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef", true},
+		{"docker://quay.io/skopeo/stable:latest", false},
+		{"docker://quay.io/skopeo/stable", false},
+		{"dir:" + dir, false},
+	} {
+		ref, err := alltransports.ParseImageName(c.input)
+		require.NoError(t, err, c.input)
+		err = checkSourcePinnedByDigest(ref)
+		if c.success {
+			assert.NoError(t, err, c.input)
+		} else {
+			assert.Error(t, err, c.input)
+		}
+	}
+
+	// The check happens before any other work.
+	out, err := runSkopeo("--insecure-policy", "copy", "--require-digest-source", "docker://quay.io/skopeo/stable:latest", "dir:"+dir)
+	assertTestFailed(t, out, err, "not pinned by digest")
+}
+
+func TestCopyCompressionThreshold(t *testing.T) {
+	src := testDirImageWithBlobs(t)
+	layer := []byte("not really a layer") // As created by testDirImageWithBlobs
+	layerFile := digest.FromBytes(layer).Encoded()
+
+	// Without a threshold, the layer is compressed
+	dest := t.TempDir()
+	_, err := runSkopeo("--insecure-policy", "copy", "--dest-compress", "dir:"+src, "dir:"+dest)
+	require.NoError(t, err)
+	assert.NoFileExists(t, filepath.Join(dest, layerFile))
+
+	// Layers smaller than the threshold are not compressed
+	dest = t.TempDir()
+	_, err = runSkopeo("--insecure-policy", "copy", "--dest-compress", "--dest-compression-threshold", "100", "dir:"+src, "dir:"+dest)
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(dest, layerFile))
+
+	// Layers at least as large as the threshold are compressed
+	dest = t.TempDir()
+	_, err = runSkopeo("--insecure-policy", "copy", "--dest-compress", "--dest-compression-threshold", strconv.Itoa(len(layer)), "dir:"+src, "dir:"+dest)
+	require.NoError(t, err)
+	assert.NoFileExists(t, filepath.Join(dest, layerFile))
+
+	out, err := runSkopeo("--insecure-policy", "copy", "--dest-compression-threshold", "-1", "dir:"+src, "dir:"+dest)
+	assertTestFailed(t, out, err, "must not be negative")
+}
+
+func TestCopyPreferBlobEncoding(t *testing.T) {
+	src := testDirImageWithBlobs(t)
+	gzipManifest, err := os.ReadFile(filepath.Join(src, "manifest.json"))
+	require.NoError(t, err)
+	// The blobs don't really use zstd, but only the annotation in the index matters for choosing an instance.
+	zstdManifest := bytes.Replace(gzipManifest, []byte(`"schemaVersion":2,`), []byte(`"schemaVersion":2,"annotations":{"variant":"zstd"},`), 1)
+	gzipDigest, zstdDigest := digest.FromBytes(gzipManifest), digest.FromBytes(zstdManifest)
+	platform := &imgspecv1.Platform{OS: "linux", Architecture: "amd64"}
+	index, err := json.Marshal(imgspecv1.Index{
+		Versioned: imgspecspecs.Versioned{SchemaVersion: 2},
+		MediaType: imgspecv1.MediaTypeImageIndex,
+		Manifests: []imgspecv1.Descriptor{
+			{MediaType: imgspecv1.MediaTypeImageManifest, Digest: gzipDigest, Size: int64(len(gzipManifest)), Platform: platform},
+			{MediaType: imgspecv1.MediaTypeImageManifest, Digest: zstdDigest, Size: int64(len(zstdManifest)), Platform: platform,
+				Annotations: map[string]string{"io.github.containers.compression.zstd": "true"}},
+		},
+	})
+	require.NoError(t, err)
+	for d, m := range map[digest.Digest][]byte{gzipDigest: gzipManifest, zstdDigest: zstdManifest} {
+		err := os.WriteFile(filepath.Join(src, d.Encoded()+".manifest.json"), m, 0o644)
+		require.NoError(t, err)
+	}
+	err = os.WriteFile(filepath.Join(src, "manifest.json"), index, 0o644)
+	require.NoError(t, err)
+
+	for _, c := range []struct {
+		encoding string
+		expected []byte
+	}{
+		{"gzip", gzipManifest},
+		{"zstd", zstdManifest},
+	} {
+		dest := t.TempDir()
+		_, err := runSkopeo("--insecure-policy", "--override-os", "linux", "--override-arch", "amd64", "copy",
+			"--prefer-blob-encoding", c.encoding, "dir:"+src, "dir:"+dest)
+		require.NoError(t, err, c.encoding)
+		copied, err := os.ReadFile(filepath.Join(dest, "manifest.json"))
+		require.NoError(t, err)
+		assert.Equal(t, string(c.expected), string(copied), c.encoding)
+	}
+
+	out, err := runSkopeo("--insecure-policy", "copy", "--prefer-blob-encoding", "brotli", "dir:"+src, "dir:"+t.TempDir())
+	assertTestFailed(t, out, err, "Invalid --prefer-blob-encoding")
+}
+
+func TestCopyDryRun(t *testing.T) {
+	src := testDirImageWithBlobs(t)
+	dest := t.TempDir()
+	out, err := runSkopeo("--insecure-policy", "copy", "--dry-run", "dir:"+src, "dir:"+dest)
+	require.NoError(t, err)
+	assert.Regexp(t, "^Reused blobs:\nBlobs to transfer:\n  sha256:[0-9a-f]{64} \\(78 bytes\\)\n  sha256:[0-9a-f]{64} \\(18 bytes\\)\nEstimated bytes to transfer: 96\n$", out)
+	entries, err := os.ReadDir(dest)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	out, err = runSkopeo("--insecure-policy", "copy", "--dry-run", "--quiet", "dir:"+src, "dir:"+dest)
+	assertTestFailed(t, out, err, "cannot be used together with --quiet")
+}
+
+func TestCopyCreateSharedBlobDir(t *testing.T) {
+	src := testDirImageWithBlobs(t)
+	tmp := t.TempDir()
+	blobDir := filepath.Join(tmp, "cache", "blobs")
+
+	_, err := runSkopeo("--insecure-policy", "copy", "--create-shared-blob-dir", "--dest-shared-blob-dir", blobDir,
+		"dir:"+src, "oci:"+filepath.Join(tmp, "layout")+":latest")
+	require.NoError(t, err)
+	assert.DirExists(t, blobDir)
+	entries, err := os.ReadDir(filepath.Join(blobDir, "sha256"))
+	require.NoError(t, err)
+	assert.NotEmpty(t, entries)
+
+	// The source directory is created as well; nothing can be read from it, so the copy then fails.
+	missingDir := filepath.Join(tmp, "missing")
+	out, err := runSkopeo("--insecure-policy", "copy", "--create-shared-blob-dir", "--src-shared-blob-dir", missingDir,
+		"oci:"+filepath.Join(tmp, "layout")+":latest", "dir:"+t.TempDir())
+	assert.Error(t, err, out)
+	assert.DirExists(t, missingDir)
+}
+
+func TestCopyCompressDockerArchive(t *testing.T) {
+	src := testDirImageWithBlobs(t)
+	layer := []byte("not really a layer") // As created by testDirImageWithBlobs
+
+	for _, c := range []struct {
+		args       []string
+		compressed bool
+	}{
+		{nil, false},
+		{[]string{"--dest-compress"}, true},
+	} {
+		dest := filepath.Join(t.TempDir(), "archive.tar")
+		args := append([]string{"--insecure-policy", "copy"}, c.args...)
+		args = append(args, "dir:"+src, "docker-archive:"+dest+":example.com/test:latest")
+		_, err := runSkopeo(args...)
+		require.NoError(t, err)
+
+		f, err := os.Open(dest)
+		require.NoError(t, err)
+		defer f.Close()
+		var manifestItems []struct {
+			Layers []string
+		}
+		entries := map[string][]byte{}
+		tr := tar.NewReader(f)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			contents, err := io.ReadAll(tr)
+			require.NoError(t, err)
+			entries[hdr.Name] = contents
+		}
+		assert.Contains(t, entries, "repositories")
+		require.Contains(t, entries, "manifest.json")
+		err = json.Unmarshal(entries["manifest.json"], &manifestItems)
+		require.NoError(t, err)
+		require.Len(t, manifestItems, 1)
+		require.Len(t, manifestItems[0].Layers, 1)
+		layerEntry := entries[manifestItems[0].Layers[0]]
+		if c.compressed {
+			assert.True(t, bytes.HasPrefix(layerEntry, []byte{0x1f, 0x8b}), "layer is not gzip-compressed")
+		} else {
+			assert.Equal(t, layer, layerEntry)
+		}
+	}
+}
+
+func TestCopyDockerArchiveAtomicWrite(t *testing.T) {
+	src := testDirImageWithBlobs(t)
+	destDir := t.TempDir()
+	dest := filepath.Join(destDir, "archive.tar")
+
+	// A failure halfway through the copy leaves nothing behind.
+	brokenSrc := testDirImageWithBlobs(t)
+	err := os.Remove(filepath.Join(brokenSrc, digest.FromString("not really a layer").Encoded()))
+	require.NoError(t, err)
+	_, err = runSkopeo("--insecure-policy", "copy", "dir:"+brokenSrc, "docker-archive:"+dest+":example.com/test:latest")
+	assert.Error(t, err)
+	entries, err := os.ReadDir(destDir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	// An existing empty file is replaced, keeping its permissions.
+	err = os.WriteFile(dest, nil, 0o600)
+	require.NoError(t, err)
+	_, err = runSkopeo("--insecure-policy", "copy", "dir:"+src, "docker-archive:"+dest+":example.com/test:latest")
+	require.NoError(t, err)
+	entries, err = os.ReadDir(destDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "archive.tar", entries[0].Name())
+	fi, err := os.Stat(dest)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), fi.Mode().Perm())
+	assert.NotZero(t, fi.Size())
+
+	// Existing archives are still not modified.
+	out, err := runSkopeo("--insecure-policy", "copy", "dir:"+src, "docker-archive:"+dest+":example.com/test:latest")
+	assertTestFailed(t, out, err, "doesn't support modifying existing images")
+}
+
+func TestCopySkipIfListMatches(t *testing.T) {
+	src := testDirImageWithBlobs(t)
+	srcManifest, err := os.ReadFile(filepath.Join(src, "manifest.json"))
+	require.NoError(t, err)
+	srcDigest := digest.FromBytes(srcManifest)
+
+	// A missing destination is copied normally
+	dest := t.TempDir()
+	out, err := runSkopeo("--insecure-policy", "copy", "--skip-if-list-matches", "dir:"+src, "dir:"+dest)
+	require.NoError(t, err)
+	assert.Contains(t, out, "Writing manifest to image destination")
+
+	// A matching destination is not copied again, but other options still work
+	digestFile := filepath.Join(t.TempDir(), "digest")
+	out, err = runSkopeo("--insecure-policy", "copy", "--skip-if-list-matches", "--digestfile", digestFile, "dir:"+src, "dir:"+dest)
+	require.NoError(t, err)
+	assert.Equal(t, "Destination already contains manifest "+srcDigest.String()+", skipping the copy\n", out)
+	digestContents, err := os.ReadFile(digestFile)
+	require.NoError(t, err)
+	assert.Equal(t, srcDigest.String(), string(digestContents))
+
+	// A different destination is copied
+	_, err = runSkopeo("--insecure-policy", "copy", "--format", "v2s2", "dir:"+src, "dir:"+dest)
+	require.NoError(t, err)
+	out, err = runSkopeo("--insecure-policy", "copy", "--skip-if-list-matches", "dir:"+src, "dir:"+dest)
+	require.NoError(t, err)
+	assert.Contains(t, out, "Writing manifest to image destination")
+}
+
+func TestCopyDaemonMediaTypeCompat(t *testing.T) {
+	src := testDirImageWithBlobs(t)
+
+	out, err := runSkopeo("--insecure-policy", "copy", "--daemon-mediatype-compat", "dir:"+src, "dir:"+t.TempDir())
+	assertTestFailed(t, out, err, "--daemon-mediatype-compat requires a docker-daemon: destination")
+
+	out, err = runSkopeo("--insecure-policy", "copy", "--daemon-mediatype-compat", "--dest-compress-format", "zstd", "dir:"+src, "docker-daemon:example.com/test:latest")
+	assertTestFailed(t, out, err, "--daemon-mediatype-compat can not be used together with --dest-compress-format")
+
+	// There is no daemon to test against; check that the wrapper asks for decompression.
+	ref, err := alltransports.ParseImageName("dir:" + t.TempDir())
+	require.NoError(t, err)
+	dest, err := decompressingDaemonReference{ImageReference: ref}.NewImageDestination(context.Background(), nil)
+	require.NoError(t, err)
+	defer dest.Close()
+	assert.Equal(t, types.Decompress, dest.DesiredLayerCompression())
+	assert.Equal(t, decompressingDaemonReference{ImageReference: ref}, dest.Reference())
+}
+
+func TestCopyDowngradeToV2s1(t *testing.T) {
+	// Conversion to v2s1 requires a history entry for every layer.
+	layer := []byte("not really a layer")
+	layerDigest := digest.FromBytes(layer)
+	config := []byte(`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers","diff_ids":["` + layerDigest.String() + `"]},` +
+		`"history":[{"created_by":"test"}]}`)
+	configDigest := digest.FromBytes(config)
+	srcManifest := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json",` +
+		`"config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"` + configDigest.String() + `","size":` + strconv.Itoa(len(config)) + `},` +
+		`"layers":[{"mediaType":"application/vnd.oci.image.layer.v1.tar+gzip","digest":"` + layerDigest.String() + `","size":` + strconv.Itoa(len(layer)) + `}]}`)
+	src := testDirImage(t, srcManifest)
+	err := os.WriteFile(filepath.Join(src, configDigest.Encoded()), config, 0o644)
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(src, layerDigest.Encoded()), layer, 0o644)
+	require.NoError(t, err)
+
+	dest := t.TempDir()
+	_, err = runSkopeo("--insecure-policy", "copy", "--downgrade-to-v2s1", "dir:"+src, "dir:"+dest)
+	require.NoError(t, err)
+	destManifest, err := os.ReadFile(filepath.Join(dest, "manifest.json"))
+	require.NoError(t, err)
+	var parsed struct {
+		SchemaVersion int `json:"schemaVersion"`
+		FSLayers      []struct {
+			BlobSum digest.Digest `json:"blobSum"`
+		} `json:"fsLayers"`
+	}
+	err = json.Unmarshal(destManifest, &parsed)
+	require.NoError(t, err)
+	assert.Equal(t, 1, parsed.SchemaVersion)
+	require.Len(t, parsed.FSLayers, 1)
+	assert.Equal(t, layerDigest, parsed.FSLayers[0].BlobSum)
+
+	out, err := runSkopeo("--insecure-policy", "copy", "--downgrade-to-v2s1", "--format", "v2s2", "dir:"+src, "dir:"+t.TempDir())
+	assertTestFailed(t, out, err, "--downgrade-to-v2s1 cannot be used together with --format")
+
+	index, err := json.Marshal(imgspecv1.Index{
+		Versioned: imgspecspecs.Versioned{SchemaVersion: 2},
+		MediaType: imgspecv1.MediaTypeImageIndex,
+		Manifests: []imgspecv1.Descriptor{
+			{MediaType: imgspecv1.MediaTypeImageManifest, Digest: digest.FromBytes(srcManifest), Size: int64(len(srcManifest))},
+		},
+	})
+	require.NoError(t, err)
+	listSrc := testDirImage(t, index)
+	out, err = runSkopeo("--insecure-policy", "copy", "--downgrade-to-v2s1", "dir:"+listSrc, "dir:"+t.TempDir())
+	assertTestFailed(t, out, err, "is a manifest list")
+}
+
+func TestCopyPrePushCmd(t *testing.T) {
+	src := testDirImageWithBlobs(t)
+	srcManifest, err := os.ReadFile(filepath.Join(src, "manifest.json"))
+	require.NoError(t, err)
+	srcDigest := digest.FromBytes(srcManifest)
+
+	// The command sees the staged image, and the image is copied if it succeeds
+	envFile := filepath.Join(t.TempDir(), "env")
+	dest := t.TempDir()
+	_, err = runSkopeo("--insecure-policy", "copy",
+		"--pre-push-cmd", `echo "$SKOPEO_IMAGE_DIGEST $SKOPEO_IMAGE_REF" > `+envFile+` && test -f "$SKOPEO_IMAGE_PATH/manifest.json"`,
+		"dir:"+src, "dir:"+dest)
+	require.NoError(t, err)
+	env, err := os.ReadFile(envFile)
+	require.NoError(t, err)
+	assert.Regexp(t, "^"+srcDigest.String()+" dir:/.*skopeo-pre-push.*\n$", string(env))
+	destManifest, err := os.ReadFile(filepath.Join(dest, "manifest.json"))
+	require.NoError(t, err)
+	assert.Equal(t, srcManifest, destManifest)
+
+	// A failing command prevents the copy
+	dest = t.TempDir()
+	_, err = runSkopeo("--insecure-policy", "copy", "--pre-push-cmd", "exit 1", "dir:"+src, "dir:"+dest)
+	assert.ErrorContains(t, err, "--pre-push-cmd rejected image "+srcDigest.String())
+	_, err = os.Stat(filepath.Join(dest, "manifest.json"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	out, err := runSkopeo("--insecure-policy", "copy", "--pre-push-cmd", "true", "--dry-run", "dir:"+src, "dir:"+t.TempDir())
+	assertTestFailed(t, out, err, "--pre-push-cmd cannot be used together with --dry-run")
+}
+
+func TestCopyCompressionWorkers(t *testing.T) {
+	layers := [][]byte{}
+	for i := 0; i < 4; i++ {
+		layers = append(layers, testLayerTar(t, tar.Header{Name: "file" + strconv.Itoa(i), Typeflag: tar.TypeReg, Mode: 0o644}))
+	}
+	config := []byte(`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers","diff_ids":[]}}`)
+	configDigest := digest.FromBytes(config)
+	layerDescriptors := []string{}
+	for _, layer := range layers {
+		layerDescriptors = append(layerDescriptors, `{"mediaType":"application/vnd.oci.image.layer.v1.tar","digest":"`+digest.FromBytes(layer).String()+`","size":`+strconv.Itoa(len(layer))+`}`)
+	}
+	manifest := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json",` +
+		`"config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"` + configDigest.String() + `","size":` + strconv.Itoa(len(config)) + `},` +
+		`"layers":[` + strings.Join(layerDescriptors, ",") + `]}`)
+	src := testDirImage(t, manifest)
+	for _, blob := range append(layers, config) {
+		err := os.WriteFile(filepath.Join(src, digest.FromBytes(blob).Encoded()), blob, 0o644)
+		require.NoError(t, err)
+	}
+
+	// The output does not depend on the number of workers.
+	copied := []string{}
+	for _, workers := range []string{"1", "4"} {
+		dest := t.TempDir()
+		_, err := runSkopeo("--insecure-policy", "copy", "--dest-compress", "--compression-workers", workers, "dir:"+src, "dir:"+dest)
+		require.NoError(t, err, workers)
+		destManifest, err := os.ReadFile(filepath.Join(dest, "manifest.json"))
+		require.NoError(t, err, workers)
+		copied = append(copied, string(destManifest))
+	}
+	assert.Equal(t, copied[0], copied[1])
+	assert.Contains(t, copied[0], "application/vnd.oci.image.layer.v1.tar+gzip")
+
+	out, err := runSkopeo("--insecure-policy", "copy", "--compression-workers", "-1", "dir:"+src, "dir:"+t.TempDir())
+	assertTestFailed(t, out, err, "Invalid --compression-workers")
+	out, err = runSkopeo("--insecure-policy", "copy", "--compression-workers", "2", "--dest-blob-concurrency-per-host", "2", "dir:"+src, "dir:"+t.TempDir())
+	assertTestFailed(t, out, err, "cannot be used together with --dest-blob-concurrency-per-host")
+}
+
+func TestCopyPrintImageID(t *testing.T) {
+	src := testDirImageWithBlobs(t)
+	out, err := runSkopeo("--insecure-policy", "copy", "--print-image-id", "dir:"+src, "dir:"+t.TempDir())
+	assertTestFailed(t, out, err, "--print-image-id requires a containers-storage: destination")
+	out, err = runSkopeo("--insecure-policy", "copy", "--print-image-id", "--dry-run", "dir:"+src, "containers-storage:example.com/test:latest")
+	assertTestFailed(t, out, err, "--print-image-id cannot be used together with --dry-run")
+}
+
+func TestCopyDestEnableVerity(t *testing.T) {
+	src := testDirImageWithBlobs(t)
+	out, err := runSkopeo("--insecure-policy", "copy", "--dest-enable-verity", "dir:"+src, "dir:"+t.TempDir())
+	assertTestFailed(t, out, err, "--dest-enable-verity requires a containers-storage: destination")
+	out, err = runSkopeo("--insecure-policy", "copy", "--dest-enable-verity", "--dry-run", "dir:"+src, "containers-storage:example.com/test:latest")
+	assertTestFailed(t, out, err, "--dest-enable-verity can not be used together with --dry-run")
+	out, err = runSkopeo("--insecure-policy", "copy", "--dest-enable-verity", "dir:"+src, "containers-storage:[vfs@"+t.TempDir()+"]example.com/test:latest")
+	assertTestFailed(t, out, err, "--dest-enable-verity can not be used with a store specification")
+}
+
+func TestCopyVerityReport(t *testing.T) {
+	src := testDirImageWithBlobs(t)
+	report := filepath.Join(t.TempDir(), "report.json")
+	out, err := runSkopeo("--insecure-policy", "copy", "--verity-report", report, "dir:"+src, "containers-storage:example.com/test:latest")
+	assertTestFailed(t, out, err, "--verity-report requires --dest-enable-verity")
+	assert.NoFileExists(t, report)
+	out, err = runSkopeo("--insecure-policy", "copy", "--verity-workers", "4", "dir:"+src, "dir:"+t.TempDir())
+	assertTestFailed(t, out, err, "--verity-workers requires --verity-report")
+	out, err = runSkopeo("--insecure-policy", "copy", "--verity-workers", "0", "dir:"+src, "dir:"+t.TempDir())
+	assertTestFailed(t, out, err, "Invalid --verity-workers value 0")
+}
+
+func TestCopyEmbedVerityAnnotations(t *testing.T) {
+	src := testDirImageWithBlobs(t)
+	out, err := runSkopeo("--insecure-policy", "copy", "--embed-verity-annotations", "dir:"+src, "containers-storage:example.com/test:latest")
+	assertTestFailed(t, out, err, "--embed-verity-annotations requires --dest-enable-verity")
+}
+
+func TestCopyTarballConfig(t *testing.T) {
+	dir := t.TempDir()
+	layerPath := filepath.Join(dir, "layer.tar")
+	err := os.WriteFile(layerPath, make([]byte, 1024), 0o644) // An empty tar archive
+	require.NoError(t, err)
+	configPath := filepath.Join(dir, "config.json")
+	err = os.WriteFile(configPath, []byte(`{"config":{"Env":["A=B"]}}`), 0o644)
+	require.NoError(t, err)
+
+	dest := t.TempDir()
+	out, err := runSkopeo("--insecure-policy", "copy", "--tarball-config", configPath, "tarball:"+layerPath, "dir:"+dest)
+	require.NoError(t, err, out)
+	out, err = runSkopeo("inspect", "--config", "dir:"+dest)
+	require.NoError(t, err)
+	var config imgspecv1.Image
+	err = json.Unmarshal([]byte(out), &config)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"A=B"}, config.Config.Env)
+
+	src := testDirImageWithBlobs(t)
+	out, err = runSkopeo("--insecure-policy", "copy", "--tarball-config", configPath, "dir:"+src, "dir:"+t.TempDir())
+	assertTestFailed(t, out, err, "--tarball-config requires a tarball: image")
+	err = os.WriteFile(configPath, []byte("not JSON"), 0o644)
+	require.NoError(t, err)
+	out, err = runSkopeo("--insecure-policy", "copy", "--tarball-config", configPath, "tarball:"+layerPath, "dir:"+t.TempDir())
+	assertTestFailed(t, out, err, "parsing the image config in "+configPath)
+}
+
+func TestCopyVerifyCosign(t *testing.T) {
+	registry := &fakeRegistry{manifests: map[digest.Digest][]byte{}, tags: map[string]digest.Digest{}}
+	server := httptest.NewServer(registry)
+	defer server.Close()
+	repo := strings.TrimPrefix(server.URL, "http://") + "/test"
+	registry.add(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{"mediaType":"application/vnd.oci.image.config.v1+json",`+
+		`"digest":"sha256:0000000000000000000000000000000000000000000000000000000000000000","size":2},"layers":[]}`, "latest")
+	keys, err := sigstore.GenerateKeyPair([]byte("passphrase"))
+	require.NoError(t, err)
+	keyPath := filepath.Join(t.TempDir(), "cosign.pub")
+	err = os.WriteFile(keyPath, keys.PublicKey, 0o644)
+	require.NoError(t, err)
+
+	// There is no sha256-<digest>.sig tag.
+	out, err := runSkopeo("--insecure-policy", "copy", "--src-tls-verify=false", "--verify-cosign", "--cosign-key", keyPath,
+		"docker://"+repo+":latest", "dir:"+t.TempDir())
+	assertTestFailed(t, out, err, "Cosign signature verification of docker://"+repo+":latest failed")
+
+	src := testDirImageWithBlobs(t)
+	out, err = runSkopeo("--insecure-policy", "copy", "--verify-cosign", "--cosign-key", keyPath, "dir:"+src, "dir:"+t.TempDir())
+	assertTestFailed(t, out, err, "--verify-cosign requires a docker: source")
+	out, err = runSkopeo("--insecure-policy", "copy", "--verify-cosign", "dir:"+src, "dir:"+t.TempDir())
+	assertTestFailed(t, out, err, "--verify-cosign and --cosign-key must be used together")
+	out, err = runSkopeo("--insecure-policy", "copy", "--cosign-key", keyPath, "dir:"+src, "dir:"+t.TempDir())
+	assertTestFailed(t, out, err, "--verify-cosign and --cosign-key must be used together")
+}
+
+func TestCopyDestinationWrappersWithSigstoreSigning(t *testing.T) {
+	src := testDirImageWithBlobs(t)
+	for _, c := range []struct {
+		flags []string
+		name  string
+	}{
+		{[]string{"--dest-compression-threshold", "1024"}, "--dest-compression-threshold"},
+		{[]string{"--delta-from", "dir:" + src}, "--delta-from"},
+		{[]string{"--dedup-list-blobs"}, "--dedup-list-blobs"},
+		{[]string{"--dest-push-timeout", "10m"}, "--dest-push-timeout"},
+		{[]string{"--write-buffer-size", "65536"}, "--write-buffer-size"},
+		{[]string{"--no-blob-mount-host", "registry.example.com"}, "--no-blob-mount-host"},
+		{[]string{"--manifest-put-retries", "2"}, "--manifest-put-retries"},
+		{[]string{"--retry-times", "2", "--dest-retry-on-manifest-unknown"}, "--dest-retry-on-manifest-unknown"},
+		{[]string{"--strict-layer-order"}, "--strict-layer-order"},
+		{[]string{"--push-state-file", "/dev/null"}, "--push-state-file"},
+	} {
+		for _, signFlag := range []string{"--sign-by-sigstore", "--sign-by-sigstore-private-key"} {
+			args := append([]string{"--insecure-policy", "copy", signFlag, "/dev/null"}, c.flags...)
+			out, err := runSkopeo(append(args, "dir:"+src, "dir:"+t.TempDir())...)
+			assertTestFailed(t, out, err, "--sign-by-sigstore or --sign-by-sigstore-private-key cannot be used together with "+c.name)
+		}
+	}
+}
+
+func TestCopyFlagConflictsNames(t *testing.T) {
+	set := (&copyOptions{blobCopyLimiter: &hostBlobCopyLimiter{}}).setFlags(copy.CopySystemImage, "")
+	for _, c := range copyFlagConflicts {
+		assert.Contains(t, set, c.flag)
+		for _, conflict := range c.conflicts {
+			assert.Contains(t, set, conflict, c.flag)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/containers/common/pkg/retry"
+	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/image"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/signature"
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/types"
+)
+
+// cosignRegistriesConfig is a registries.d configuration which reads sigstore signatures from the
+// cosign-compatible sha256-<digest>.sig tags of every repository.
+const cosignRegistriesConfig = "default-docker:\n  use-sigstore-attachments: true\n"
+
+// verifyCosignSignature verifies that the image at srcRef, a docker:// reference, has a cosign signature made by the
+// public key at keyPath, stored in the sha256-<digest>.sig tag of its repository, and writes the result to stdout if not nil.
+// It returns a reference to the verified image pinned by digest, so that the copied image is the verified one.
+// For a manifest list, only the signature of the list itself is verified.
+func verifyCosignSignature(ctx context.Context, sys *types.SystemContext, global *globalOptions, srcRef types.ImageReference, keyPath string,
+	retryOpts *retry.Options, stdout io.Writer) (_ types.ImageReference, retErr error) {
+	if srcRef.Transport().Name() != docker.Transport.Name() {
+		return nil, fmt.Errorf("--verify-cosign requires a %s: source, not %s", docker.Transport.Name(), transports.ImageName(srcRef))
+	}
+	requirement, err := signature.NewPRSigstoreSignedKeyPath(keyPath, signature.NewPRMMatchRepository())
+	if err != nil {
+		return nil, fmt.Errorf("Invalid --cosign-key %s: %w", keyPath, err)
+	}
+	policyContext, err := signature.NewPolicyContext(&signature.Policy{Default: signature.PolicyRequirements{requirement}})
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := policyContext.Destroy(); err != nil {
+			retErr = noteCloseFailure(retErr, "tearing down policy context", err)
+		}
+	}()
+
+	// The user’s registries.d configuration does not necessarily enable reading signatures from tags, so use a private one.
+	dir, err := global.newTemporaryDir("skopeo-cosign")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "cosign.yaml"), []byte(cosignRegistriesConfig), 0o600); err != nil {
+		return nil, err
+	}
+	verifySys := *sys
+	verifySys.RegistriesDirPath = dir
+
+	var src types.ImageSource
+	if err := retry.IfNecessary(ctx, func() error {
+		src, err = srcRef.NewImageSource(ctx, &verifySys)
+		return err
+	}, retryOpts); err != nil {
+		return nil, fmt.Errorf("Error initializing %s: %w", transports.ImageName(srcRef), err)
+	}
+	defer func() {
+		if err := src.Close(); err != nil {
+			retErr = noteCloseFailure(retErr, "closing image", err)
+		}
+	}()
+	var rawManifest []byte
+	if err := retry.IfNecessary(ctx, func() error {
+		rawManifest, _, err = src.GetManifest(ctx, nil)
+		return err
+	}, retryOpts); err != nil {
+		return nil, fmt.Errorf("Error retrieving manifest for image: %w", err)
+	}
+	manifestDigest, err := manifest.Digest(rawManifest)
+	if err != nil {
+		return nil, err
+	}
+	// The source caches the manifest read above, so the signatures are verified against manifestDigest.
+	if _, err := policyContext.IsRunningImageAllowed(ctx, image.UnparsedInstance(src, nil)); err != nil {
+		return nil, fmt.Errorf("Cosign signature verification of %s failed: %w", transports.ImageName(srcRef), err)
+	}
+	if stdout != nil {
+		if _, err := fmt.Fprintf(stdout, "Verified cosign signature of %s (%s) with key %s\n", transports.ImageName(srcRef), manifestDigest, keyPath); err != nil {
+			return nil, err
+		}
+	}
+
+	named := srcRef.DockerReference()
+	if named == nil {
+		return nil, errors.New("internal error: docker reference without a Docker reference")
+	}
+	pinned, err := reference.WithDigest(reference.TrimNamed(named), manifestDigest)
+	if err != nil {
+		return nil, err
+	}
+	return docker.NewReference(pinned)
+}
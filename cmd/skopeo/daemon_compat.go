@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+
+	"github.com/containers/image/v5/types"
+)
+
+// decompressingDaemonReference is a types.ImageReference wrapper for docker-daemon: destinations;
+// image destinations created from it ask for layers to be decompressed, instead of sending them to the daemon as they are.
+//
+// Layers compressed using zstd can't be represented in the Docker schema2 manifest the docker-daemon: destination requires,
+// so copying them fails, and older daemons can't load them anyway; uncompressed layers are accepted by every daemon version.
+type decompressingDaemonReference struct {
+	types.ImageReference
+}
+
+// NewImageDestination returns a types.ImageDestination for this reference.
+// The caller must call .Close() on the returned ImageDestination.
+func (ref decompressingDaemonReference) NewImageDestination(ctx context.Context, sys *types.SystemContext) (types.ImageDestination, error) {
+	dest, err := ref.ImageReference.NewImageDestination(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	return &decompressingDaemonDestination{ImageDestination: dest, ref: ref}, nil
+}
+
+// decompressingDaemonDestination is a types.ImageDestination wrapper which asks for layers to be decompressed.
+type decompressingDaemonDestination struct {
+	types.ImageDestination
+	ref decompressingDaemonReference
+}
+
+// Reference returns the reference used to set up this destination.
+func (d *decompressingDaemonDestination) Reference() types.ImageReference {
+	return d.ref
+}
+
+// DesiredLayerCompression indicates the kind of compression to apply on layers.
+func (d *decompressingDaemonDestination) DesiredLayerCompression() types.LayerCompression {
+	return types.Decompress
+}
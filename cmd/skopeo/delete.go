@@ -7,6 +7,9 @@ import (
 	"strings"
 
 	"github.com/containers/common/pkg/retry"
+	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/manifest"
 	"github.com/containers/image/v5/transports"
 	"github.com/containers/image/v5/transports/alltransports"
 	"github.com/spf13/cobra"
@@ -16,6 +19,7 @@ type deleteOptions struct {
 	global    *globalOptions
 	image     *imageOptions
 	retryOpts *retry.Options
+	referrers bool // Also delete the referrers of the image
 }
 
 func deleteCmd(global *globalOptions) *cobra.Command {
@@ -41,6 +45,7 @@ See skopeo(1) section "IMAGE NAMES" for the expected format
 	}
 	adjustUsage(cmd)
 	flags := cmd.Flags()
+	flags.BoolVar(&opts.referrers, "with-referrers", false, "Before deleting the image, delete its signatures, SBOMs and other referrers found using the referrers tag schema (docker: only)")
 	flags.AddFlagSet(&sharedFlags)
 	flags.AddFlagSet(&imageFlags)
 	flags.AddFlagSet(&retryFlags)
@@ -70,7 +75,30 @@ func (opts *deleteOptions) run(args []string, stdout io.Writer) error {
 	ctx, cancel := opts.global.commandTimeoutContext()
 	defer cancel()
 
-	return retry.IfNecessary(ctx, func() error {
-		return ref.DeleteImage(ctx, sys)
-	}, opts.retryOpts)
+	if !opts.referrers {
+		return retry.IfNecessary(ctx, func() error {
+			return ref.DeleteImage(ctx, sys)
+		}, opts.retryOpts)
+	}
+
+	if ref.Transport().Name() != docker.Transport.Name() {
+		return fmt.Errorf("--with-referrers requires a %s: reference, not %s:", docker.Transport.Name(), ref.Transport().Name())
+	}
+	named := ref.DockerReference()
+	if named == nil {
+		return fmt.Errorf("internal error: %s reference without a Docker reference", docker.Transport.Name())
+	}
+	subjectManifest, err := topLevelManifest(ctx, sys, ref, opts.retryOpts)
+	if err != nil {
+		return fmt.Errorf("reading manifest of %s: %w", imageName, err)
+	}
+	subjectDigest, err := manifest.Digest(subjectManifest)
+	if err != nil {
+		return err
+	}
+	// Delete the referrers first: if that fails, the image still exists, and the deletion can be retried.
+	if err := deleteReferrers(ctx, sys, reference.TrimNamed(named), subjectDigest, opts.retryOpts, stdout); err != nil {
+		return err
+	}
+	return deleteAndReport(ctx, sys, ref, opts.retryOpts, stdout)
 }
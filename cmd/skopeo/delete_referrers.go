@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/containers/common/pkg/retry"
+	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+)
+
+// cosignReferrerTagSuffixes are appended by cosign to the referrers tag of an image (see referrersTag)
+// for tags with signatures, attestations and SBOMs of the image.
+var cosignReferrerTagSuffixes = []string{".sig", ".att", ".sbom"}
+
+// referrersTag returns the tag used for the referrers of the manifest with subjectDigest
+// by the OCI distribution specification referrers tag schema.
+func referrersTag(subjectDigest digest.Digest) string {
+	return subjectDigest.Algorithm().String() + "-" + subjectDigest.Encoded()
+}
+
+// deleteReferrers deletes the referrers of the manifest with subjectDigest in repo, which are found using
+// the OCI referrers tag schema and the tags used by cosign, and reports the deleted images to stdout.
+func deleteReferrers(ctx context.Context, sys *types.SystemContext, repo reference.Named, subjectDigest digest.Digest,
+	retryOpts *retry.Options, stdout io.Writer) error {
+	tag := referrersTag(subjectDigest)
+	indexRef, err := dockerTagReference(repo, tag)
+	if err != nil {
+		return err
+	}
+	indexBytes, err := topLevelManifest(ctx, sys, indexRef, retryOpts)
+	switch {
+	case err == nil:
+		index, err := manifest.OCI1IndexFromManifest(indexBytes)
+		if err != nil {
+			return fmt.Errorf("parsing referrers index %s: %w", transports.ImageName(indexRef), err)
+		}
+		for _, desc := range index.Manifests {
+			referrer, err := reference.WithDigest(repo, desc.Digest)
+			if err != nil {
+				return err
+			}
+			referrerRef, err := docker.NewReference(referrer)
+			if err != nil {
+				return err
+			}
+			if err := deleteAndReport(ctx, sys, referrerRef, retryOpts, stdout); err != nil {
+				return err
+			}
+		}
+		if err := deleteAndReport(ctx, sys, indexRef, retryOpts, stdout); err != nil {
+			return err
+		}
+	case classifyError(err) == errorCategoryNotFound:
+	default:
+		return fmt.Errorf("reading referrers index %s: %w", transports.ImageName(indexRef), err)
+	}
+
+	for _, suffix := range cosignReferrerTagSuffixes {
+		ref, err := dockerTagReference(repo, tag+suffix)
+		if err != nil {
+			return err
+		}
+		// Deleting a tag deletes the manifest it points to; make sure the tag exists first.
+		if _, err := topLevelManifest(ctx, sys, ref, retryOpts); err != nil {
+			if classifyError(err) == errorCategoryNotFound {
+				continue
+			}
+			return fmt.Errorf("reading %s: %w", transports.ImageName(ref), err)
+		}
+		if err := deleteAndReport(ctx, sys, ref, retryOpts, stdout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dockerTagReference returns a docker: reference to tag in repo.
+func dockerTagReference(repo reference.Named, tag string) (types.ImageReference, error) {
+	tagged, err := reference.WithTag(repo, tag)
+	if err != nil {
+		return nil, err
+	}
+	return docker.NewReference(tagged)
+}
+
+// deleteAndReport deletes ref, and reports it to stdout.
+func deleteAndReport(ctx context.Context, sys *types.SystemContext, ref types.ImageReference, retryOpts *retry.Options, stdout io.Writer) error {
+	if err := retry.IfNecessary(ctx, func() error {
+		return ref.DeleteImage(ctx, sys)
+	}, retryOpts); err != nil {
+		return fmt.Errorf("deleting %s: %w", transports.ImageName(ref), err)
+	}
+	_, err := fmt.Fprintf(stdout, "Deleted %s\n", transports.ImageName(ref))
+	return err
+}
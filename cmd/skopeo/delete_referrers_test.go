@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRegistry is a minimal registry serving manifests, and blobs if any, of a single repository, "test", and allowing deleting manifests.
+type fakeRegistry struct {
+	lock      sync.Mutex
+	manifests map[digest.Digest][]byte
+	tags      map[string]digest.Digest
+	blobs     map[digest.Digest][]byte // May be nil
+	blobHEADs int                      // The number of HEAD requests for blobs
+}
+
+// add stores m, tagged with tag if not empty, and returns its digest.
+func (r *fakeRegistry) add(m, tag string) digest.Digest {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	d := digest.FromString(m)
+	r.manifests[d] = []byte(m)
+	if tag != "" {
+		r.tags[tag] = d
+	}
+	return d
+}
+
+func (r *fakeRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if req.URL.Path == "/v2/" {
+		w.Header().Set("Docker-Distribution-API-Version", "registry/2.0")
+		return
+	}
+	if strings.HasPrefix(req.URL.Path, "/v2/test/blobs/") {
+		r.serveBlob(w, req, digest.Digest(strings.TrimPrefix(req.URL.Path, "/v2/test/blobs/")))
+		return
+	}
+	if !strings.HasPrefix(req.URL.Path, "/v2/test/manifests/") {
+		http.NotFound(w, req)
+		return
+	}
+	tagOrDigest := strings.TrimPrefix(req.URL.Path, "/v2/test/manifests/")
+	d, ok := r.tags[tagOrDigest]
+	if !ok {
+		d = digest.Digest(tagOrDigest)
+	}
+	m, ok := r.manifests[d]
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"errors":[{"code":"MANIFEST_UNKNOWN","message":"manifest unknown"}]}`))
+		return
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		var mediaType struct {
+			MediaType string `json:"mediaType"`
+		}
+		_ = json.Unmarshal(m, &mediaType)
+		w.Header().Set("Content-Type", mediaType.MediaType)
+		w.Header().Set("Docker-Content-Digest", d.String())
+		if req.Method == http.MethodGet {
+			_, _ = w.Write(m)
+		}
+	case http.MethodDelete:
+		delete(r.manifests, d)
+		for tag, tagDigest := range r.tags {
+			if tagDigest == d {
+				delete(r.tags, tag)
+			}
+		}
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestDeleteWithReferrers(t *testing.T) {
+	registry := &fakeRegistry{manifests: map[digest.Digest][]byte{}, tags: map[string]digest.Digest{}}
+	server := httptest.NewServer(registry)
+	defer server.Close()
+	repo := strings.TrimPrefix(server.URL, "http://") + "/test"
+
+	const configDescriptor = `"config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"sha256:0000000000000000000000000000000000000000000000000000000000000000","size":2}`
+	subject := registry.add(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json",`+configDescriptor+`,"layers":[]}`, "latest")
+	referrerManifest := `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","artifactType":"application/example.sbom",` +
+		configDescriptor + `,"layers":[],"subject":{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"` + subject.String() + `","size":1}}`
+	referrer := registry.add(referrerManifest, "")
+	index := registry.add(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[`+
+		`{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"`+referrer.String()+`","size":`+
+		`1,"artifactType":"application/example.sbom"}]}`, referrersTag(subject))
+	signature := registry.add(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json",`+configDescriptor+`,"layers":[],"annotations":{"sig":"1"}}`,
+		referrersTag(subject)+".sig")
+	unrelated := registry.add(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json",`+configDescriptor+`,"layers":[],"annotations":{"other":"1"}}`,
+		"other")
+
+	out, err := runSkopeo("delete", "--tls-verify=false", "--with-referrers", "docker://"+repo+":latest")
+	require.NoError(t, err)
+	assert.Equal(t, "Deleted docker://"+repo+"@"+referrer.String()+"\n"+
+		"Deleted docker://"+repo+":"+referrersTag(subject)+"\n"+
+		"Deleted docker://"+repo+":"+referrersTag(subject)+".sig\n"+
+		"Deleted docker://"+repo+":latest\n", out)
+	for _, d := range []digest.Digest{subject, referrer, index, signature} {
+		assert.NotContains(t, registry.manifests, d)
+	}
+	assert.Contains(t, registry.manifests, unrelated)
+	assert.Equal(t, map[string]digest.Digest{"other": unrelated}, registry.tags)
+
+	// Without referrers, only the image is deleted.
+	registry.add(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json",`+configDescriptor+`,"layers":[]}`, "latest")
+	out, err = runSkopeo("delete", "--tls-verify=false", "--with-referrers", "docker://"+repo+":latest")
+	require.NoError(t, err)
+	assert.Equal(t, "Deleted docker://"+repo+":latest\n", out)
+
+	out, err = runSkopeo("delete", "--with-referrers", "dir:"+t.TempDir())
+	assertTestFailed(t, out, err, "--with-referrers requires a docker: reference")
+}
+
+// serveBlob serves the blob with blobDigest, if it exists.
+func (r *fakeRegistry) serveBlob(w http.ResponseWriter, req *http.Request, blobDigest digest.Digest) {
+	blob, ok := r.blobs[blobDigest]
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"errors":[{"code":"BLOB_UNKNOWN","message":"blob unknown"}]}`))
+		return
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		if req.Method == http.MethodHead {
+			r.blobHEADs++
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(blob)))
+		w.Header().Set("Docker-Content-Digest", blobDigest.String())
+		if req.Method == http.MethodGet {
+			_, _ = w.Write(blob)
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/containers/common/pkg/retry"
+	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/image"
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/transports/alltransports"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+// knownBlobsReference is a types.ImageReference wrapper; image destinations created from it
+// assume that blobs in knownBlobs already exist at the destination, without checking.
+type knownBlobsReference struct {
+	types.ImageReference
+	knownBlobs map[digest.Digest]int64 // Digest -> size
+}
+
+// NewImageDestination returns a types.ImageDestination for this reference.
+// The caller must call .Close() on the returned ImageDestination.
+func (ref knownBlobsReference) NewImageDestination(ctx context.Context, sys *types.SystemContext) (types.ImageDestination, error) {
+	dest, err := ref.ImageReference.NewImageDestination(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	return &knownBlobsDestination{ImageDestination: dest, ref: ref}, nil
+}
+
+// knownBlobsDestination is a types.ImageDestination wrapper which reuses blobs in ref.knownBlobs without checking for their presence.
+type knownBlobsDestination struct {
+	types.ImageDestination
+	ref knownBlobsReference
+}
+
+// Reference returns the reference used to set up this destination.
+func (d *knownBlobsDestination) Reference() types.ImageReference {
+	return d.ref
+}
+
+// TryReusingBlob checks whether the transport already contains, or can efficiently reuse, a blob, and if so, applies it to the current destination.
+// Blobs in d.ref.knownBlobs are reused without accessing the destination.
+func (d *knownBlobsDestination) TryReusingBlob(ctx context.Context, info types.BlobInfo, cache types.BlobInfoCache, canSubstitute bool) (bool, types.BlobInfo, error) {
+	if size, ok := d.ref.knownBlobs[info.Digest]; ok {
+		logrus.Debugf("Blob %s exists in the --delta-from image, not checking the destination", info.Digest.String())
+		return true, types.BlobInfo{Digest: info.Digest, Size: size}, nil
+	}
+	return d.ImageDestination.TryReusingBlob(ctx, info, cache, canSubstitute)
+}
+
+// blobsOfImage returns the digests and sizes of the config and layer blobs of the image at imageName,
+// choosing the instance to use from a manifest list based on sys.
+func blobsOfImage(ctx context.Context, sys *types.SystemContext, imageName string, retryOpts *retry.Options) (res map[digest.Digest]int64, retErr error) {
+	ref, err := alltransports.ParseImageName(imageName)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid image name %s: %v", imageName, err)
+	}
+	var src types.ImageSource
+	if err := retry.IfNecessary(ctx, func() error {
+		src, err = ref.NewImageSource(ctx, sys)
+		return err
+	}, retryOpts); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := src.Close(); err != nil {
+			retErr = noteCloseFailure(retErr, "closing image", err)
+		}
+	}()
+	var img types.Image
+	if err := retry.IfNecessary(ctx, func() error {
+		img, err = image.FromUnparsedImage(ctx, sys, image.UnparsedInstance(src, nil))
+		return err
+	}, retryOpts); err != nil {
+		return nil, fmt.Errorf("Error parsing manifest for image: %w", err)
+	}
+	res = map[digest.Digest]int64{}
+	config := img.ConfigInfo()
+	if config.Digest != "" {
+		res[config.Digest] = config.Size
+	}
+	for _, layer := range img.LayerInfos() {
+		res[layer.Digest] = layer.Size
+	}
+	return res, nil
+}
+
+// setUpDeltaFrom returns destRef wrapped to reuse blobs of the image at baseName, which must be stored in the same location as destRef.
+func setUpDeltaFrom(ctx context.Context, sys *types.SystemContext, destRef types.ImageReference, baseName string, retryOpts *retry.Options) (types.ImageReference, error) {
+	baseRef, err := alltransports.ParseImageName(baseName)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid --delta-from name %s: %v", baseName, err)
+	}
+	if baseRef.Transport().Name() != destRef.Transport().Name() {
+		return nil, fmt.Errorf("--delta-from image %s must use the same transport as the destination", transports.ImageName(baseRef))
+	}
+	if destRef.Transport().Name() == docker.Transport.Name() &&
+		baseRef.DockerReference().Name() != destRef.DockerReference().Name() {
+		return nil, errors.New("--delta-from image must be in the same repository as the destination")
+	}
+	blobs, err := blobsOfImage(ctx, sys, baseName, retryOpts)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading --delta-from image %s: %w", baseName, err)
+	}
+	return knownBlobsReference{ImageReference: destRef, knownBlobs: blobs}, nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
+	"github.com/containers/image/v5/transports/alltransports"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKnownBlobsDestination(t *testing.T) {
+	known := digest.FromString("known")
+	unknown := digest.FromString("unknown")
+	ref, err := alltransports.ParseImageName("dir:" + t.TempDir())
+	require.NoError(t, err)
+	wrapped := knownBlobsReference{ImageReference: ref, knownBlobs: map[digest.Digest]int64{known: 42}}
+	dest, err := wrapped.NewImageDestination(context.Background(), nil)
+	require.NoError(t, err)
+	defer dest.Close()
+	assert.Equal(t, wrapped, dest.Reference())
+
+	reused, info, err := dest.TryReusingBlob(context.Background(), types.BlobInfo{Digest: known, Size: -1}, none.NoCache, false)
+	require.NoError(t, err)
+	assert.True(t, reused)
+	assert.Equal(t, types.BlobInfo{Digest: known, Size: 42}, info)
+
+	reused, _, err = dest.TryReusingBlob(context.Background(), types.BlobInfo{Digest: unknown, Size: -1}, none.NoCache, false)
+	require.NoError(t, err)
+	assert.False(t, reused)
+}
+
+func TestSetUpDeltaFrom(t *testing.T) {
+	destRef, err := alltransports.ParseImageName("docker://registry.example.com/repo:new")
+	require.NoError(t, err)
+	for _, base := range []string{
+		"this is invalid",
+		"dir:/this/does/not/exist",                // Different transport
+		"docker://registry.example.com/other:old", // Different repository
+	} {
+		_, err := setUpDeltaFrom(context.Background(), nil, destRef, base, nil)
+		assert.Error(t, err, base)
+	}
+}
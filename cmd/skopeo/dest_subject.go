@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/containers/common/pkg/retry"
+	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/transports/alltransports"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sirupsen/logrus"
+)
+
+// destSubjectDescriptor returns a descriptor of the image at subjectName, which must be stored in the same location as destRef,
+// for use as the subject of the copied manifest.
+func destSubjectDescriptor(ctx context.Context, sys *types.SystemContext, destRef types.ImageReference, subjectName string, retryOpts *retry.Options) (imgspecv1.Descriptor, error) {
+	subjectRef, err := alltransports.ParseImageName(subjectName)
+	if err != nil {
+		return imgspecv1.Descriptor{}, fmt.Errorf("Invalid --dest-subject name %s: %v", subjectName, err)
+	}
+	if subjectRef.Transport().Name() != destRef.Transport().Name() {
+		return imgspecv1.Descriptor{}, fmt.Errorf("--dest-subject image %s must use the same transport as the destination", transports.ImageName(subjectRef))
+	}
+	// Referrers are looked up in the repository of their subject.
+	if destRef.Transport().Name() == docker.Transport.Name() &&
+		subjectRef.DockerReference().Name() != destRef.DockerReference().Name() {
+		return imgspecv1.Descriptor{}, errors.New("--dest-subject image must be in the same repository as the destination")
+	}
+	rawManifest, err := topLevelManifest(ctx, sys, subjectRef, retryOpts)
+	if err != nil {
+		return imgspecv1.Descriptor{}, fmt.Errorf("Error reading --dest-subject image %s: %w", subjectName, err)
+	}
+	manifestDigest, err := manifest.Digest(rawManifest)
+	if err != nil {
+		return imgspecv1.Descriptor{}, err
+	}
+	return imgspecv1.Descriptor{
+		MediaType: manifest.NormalizedMIMEType(manifest.GuessMIMEType(rawManifest)),
+		Digest:    manifestDigest,
+		Size:      int64(len(rawManifest)),
+	}, nil
+}
+
+// setManifestSubject returns rawManifest, an OCI image manifest or index with mimeType, with its subject set to subject.
+func setManifestSubject(rawManifest []byte, mimeType string, subject imgspecv1.Descriptor) ([]byte, error) {
+	mimeType = manifest.NormalizedMIMEType(mimeType)
+	if mimeType != imgspecv1.MediaTypeImageManifest && mimeType != imgspecv1.MediaTypeImageIndex {
+		return nil, fmt.Errorf("--dest-subject: %s manifests can not have a subject; only OCI manifests and indexes can (consider --normalize-to-oci)", mimeType)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(rawManifest, &fields); err != nil {
+		return nil, fmt.Errorf("parsing manifest: %w", err)
+	}
+	rawSubject, err := json.Marshal(subject)
+	if err != nil {
+		return nil, err
+	}
+	if existing, ok := fields["subject"]; ok {
+		var existingSubject imgspecv1.Descriptor
+		if err := json.Unmarshal(existing, &existingSubject); err != nil {
+			return nil, fmt.Errorf("parsing manifest subject: %w", err)
+		}
+		if existingSubject.Digest != subject.Digest {
+			return nil, fmt.Errorf("--dest-subject: the manifest already has a different subject %s", existingSubject.Digest)
+		}
+		if bytes.Equal(existing, rawSubject) {
+			return rawManifest, nil
+		}
+	}
+	fields["subject"] = rawSubject
+	return json.Marshal(fields)
+}
+
+// subjectSettingReference is a types.ImageReference wrapper; image sources created from it
+// present the top-level manifest with its subject set to subject.
+type subjectSettingReference struct {
+	types.ImageReference
+	subject  imgspecv1.Descriptor
+	copyAll  bool // All instances of a manifest list are copied, so the subject can be set on the list itself
+	modified bool // The top-level manifest presented by the source differs from the original
+}
+
+// DockerReference returns a Docker reference associated with this reference.
+// If the top-level manifest was modified, any digest is dropped, because it applies to the original manifest.
+func (ref subjectSettingReference) DockerReference() reference.Named {
+	res := ref.ImageReference.DockerReference()
+	if res == nil || !ref.modified {
+		return res
+	}
+	if _, ok := res.(reference.Digested); ok {
+		return reference.TrimNamed(res)
+	}
+	return res
+}
+
+// NewImageSource returns a types.ImageSource for this reference.
+// The caller must call .Close() on the returned ImageSource.
+func (ref subjectSettingReference) NewImageSource(ctx context.Context, sys *types.SystemContext) (types.ImageSource, error) {
+	src, err := ref.ImageReference.NewImageSource(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	rawManifest, mimeType, err := src.GetManifest(ctx, nil)
+	if err != nil {
+		src.Close()
+		return nil, fmt.Errorf("Error retrieving manifest for image: %w", err)
+	}
+	if manifest.MIMETypeIsMultiImage(manifest.NormalizedMIMEType(mimeType)) && !ref.copyAll {
+		src.Close()
+		return nil, errors.New("--dest-subject: the source is a manifest list, use --all to copy it with a subject, or choose a single image by digest")
+	}
+	withSubject, err := setManifestSubject(rawManifest, mimeType, ref.subject)
+	if err != nil {
+		src.Close()
+		return nil, err
+	}
+	ref.modified = !bytes.Equal(withSubject, rawManifest)
+	return &subjectSettingSource{ImageSource: src, ref: ref, manifest: withSubject, mimeType: mimeType}, nil
+}
+
+// subjectSettingSource is a types.ImageSource wrapper which presents a top-level manifest with a subject.
+type subjectSettingSource struct {
+	types.ImageSource
+	ref      subjectSettingReference
+	manifest []byte
+	mimeType string
+}
+
+// Reference returns the reference used to set up this source.
+func (s *subjectSettingSource) Reference() types.ImageReference {
+	return s.ref
+}
+
+// GetManifest returns the image's manifest along with its MIME type, with the subject set on the top-level manifest.
+func (s *subjectSettingSource) GetManifest(ctx context.Context, instanceDigest *digest.Digest) ([]byte, string, error) {
+	if instanceDigest == nil {
+		return s.manifest, s.mimeType, nil
+	}
+	return s.ImageSource.GetManifest(ctx, instanceDigest)
+}
+
+// GetSignatures returns the image's signatures; signatures of a modified top-level manifest, which no longer apply, are dropped.
+func (s *subjectSettingSource) GetSignatures(ctx context.Context, instanceDigest *digest.Digest) ([][]byte, error) {
+	sigs, err := s.ImageSource.GetSignatures(ctx, instanceDigest)
+	if err != nil || instanceDigest != nil || !s.ref.modified {
+		return sigs, err
+	}
+	if len(sigs) != 0 {
+		logrus.Warnf("Not copying %d signature(s) of a manifest with a newly set subject", len(sigs))
+	}
+	return nil, nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/containers/image/v5/manifest"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopyDestSubject(t *testing.T) {
+	src := testDirImageWithBlobs(t)
+	subject := testDirImageWithBlobs(t)
+	subjectManifest, err := os.ReadFile(filepath.Join(subject, "manifest.json"))
+	require.NoError(t, err)
+
+	dest := t.TempDir()
+	_, err = runSkopeo("--insecure-policy", "copy", "--dest-subject", "dir:"+subject, "dir:"+src, "dir:"+dest)
+	require.NoError(t, err)
+	destManifest, err := os.ReadFile(filepath.Join(dest, "manifest.json"))
+	require.NoError(t, err)
+	m, err := manifest.OCI1FromManifest(destManifest)
+	require.NoError(t, err)
+	require.NotNil(t, m.Subject)
+	assert.Equal(t, imgspecv1.Descriptor{
+		MediaType: imgspecv1.MediaTypeImageManifest,
+		Digest:    digest.FromBytes(subjectManifest),
+		Size:      int64(len(subjectManifest)),
+	}, *m.Subject)
+	// The blobs are not modified.
+	srcManifest, err := os.ReadFile(filepath.Join(src, "manifest.json"))
+	require.NoError(t, err)
+	orig, err := manifest.OCI1FromManifest(srcManifest)
+	require.NoError(t, err)
+	assert.Equal(t, orig.Config, m.Config)
+	assert.Equal(t, orig.Layers, m.Layers)
+
+	// The subject must exist, using the destination's transport
+	_, err = runSkopeo("--insecure-policy", "copy", "--dest-subject", "dir:"+filepath.Join(t.TempDir(), "missing"), "dir:"+src, "dir:"+t.TempDir())
+	assert.ErrorContains(t, err, "Error reading --dest-subject image")
+	_, err = runSkopeo("--insecure-policy", "copy", "--dest-subject", "oci:"+t.TempDir(), "dir:"+src, "dir:"+t.TempDir())
+	assert.ErrorContains(t, err, "must use the same transport as the destination")
+
+	// Docker manifests can't have a subject
+	dockerManifest := strings.NewReplacer(imgspecv1.MediaTypeImageManifest, manifest.DockerV2Schema2MediaType,
+		imgspecv1.MediaTypeImageConfig, manifest.DockerV2Schema2ConfigMediaType,
+		imgspecv1.MediaTypeImageLayer, manifest.DockerV2SchemaLayerMediaTypeUncompressed).Replace(string(srcManifest))
+	err = os.WriteFile(filepath.Join(src, "manifest.json"), []byte(dockerManifest), 0o644)
+	require.NoError(t, err)
+	_, err = runSkopeo("--insecure-policy", "copy", "--dest-subject", "dir:"+subject, "dir:"+src, "dir:"+t.TempDir())
+	assert.ErrorContains(t, err, "can not have a subject")
+	// … unless converted to OCI first.
+	dest = t.TempDir()
+	_, err = runSkopeo("--insecure-policy", "copy", "--normalize-to-oci", "--dest-subject", "dir:"+subject, "dir:"+src, "dir:"+dest)
+	require.NoError(t, err)
+	destManifest, err = os.ReadFile(filepath.Join(dest, "manifest.json"))
+	require.NoError(t, err)
+	m, err = manifest.OCI1FromManifest(destManifest)
+	require.NoError(t, err)
+	require.NotNil(t, m.Subject)
+	assert.Equal(t, digest.FromBytes(subjectManifest), m.Subject.Digest)
+
+	_, err = runSkopeo("--insecure-policy", "copy", "--dest-subject", "dir:"+subject, "--format", "v2s2", "dir:"+src, "dir:"+t.TempDir())
+	assert.ErrorContains(t, err, "--dest-subject cannot be used together with --format other than oci")
+}
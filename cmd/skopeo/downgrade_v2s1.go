@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/containers/common/pkg/retry"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/types"
+	"github.com/sirupsen/logrus"
+)
+
+// checkDowngradeToV2s1Source returns an error if srcRef can not be copied with --downgrade-to-v2s1,
+// and warns about the consequences of the conversion otherwise.
+func checkDowngradeToV2s1Source(ctx context.Context, sys *types.SystemContext, srcRef types.ImageReference, retryOpts *retry.Options) error {
+	rawManifest, err := topLevelManifest(ctx, sys, srcRef, retryOpts)
+	if err != nil {
+		return err
+	}
+	mimeType := manifest.NormalizedMIMEType(manifest.GuessMIMEType(rawManifest))
+	if manifest.MIMETypeIsMultiImage(mimeType) {
+		return fmt.Errorf("--downgrade-to-v2s1: %s is a manifest list (%s), which can not be represented in a v2s1 manifest; choose a single image by digest",
+			transports.ImageName(srcRef), mimeType)
+	}
+	if mimeType != manifest.DockerV2Schema1MediaType && mimeType != manifest.DockerV2Schema1SignedMediaType {
+		logrus.Warnf("--downgrade-to-v2s1: converting %s to a v2s1 manifest; the destination digest will differ from the source, "+
+			"and annotations, layer media types and config fields without a v2s1 equivalent are lost", mimeType)
+	}
+	return nil
+}
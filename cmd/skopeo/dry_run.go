@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/containers/common/pkg/retry"
+	"github.com/containers/image/v5/copy"
+	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/image"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+// copyDryRun writes to stdout an estimate of the blobs which copying srcRef to destRef would transfer, and which it would reuse,
+// without copying anything.
+func copyDryRun(ctx context.Context, sourceCtx, destinationCtx *types.SystemContext, srcRef, destRef types.ImageReference,
+	imageListSelection copy.ImageListSelection, retryOpts *retry.Options, stdout io.Writer) error {
+	blobs, err := blobsToCopy(ctx, sourceCtx, srcRef, imageListSelection, retryOpts)
+	if err != nil {
+		return err
+	}
+	present, err := blobsPresentAtDestination(ctx, destinationCtx, destRef, blobs, retryOpts)
+	if err != nil {
+		return err
+	}
+
+	var transferSize int64
+	fmt.Fprintln(stdout, "Reused blobs:")
+	for _, blob := range blobs {
+		if present[blob.Digest] {
+			fmt.Fprintf(stdout, "  %s (%d bytes)\n", blob.Digest, blob.Size)
+		}
+	}
+	fmt.Fprintln(stdout, "Blobs to transfer:")
+	for _, blob := range blobs {
+		if !present[blob.Digest] {
+			fmt.Fprintf(stdout, "  %s (%d bytes)\n", blob.Digest, blob.Size)
+			if blob.Size > 0 {
+				transferSize += blob.Size
+			}
+		}
+	}
+	_, err = fmt.Fprintf(stdout, "Estimated bytes to transfer: %d\n", transferSize)
+	return err
+}
+
+// blobsToCopy returns the unique config and layer blobs of the images copied from srcRef with imageListSelection.
+func blobsToCopy(ctx context.Context, sys *types.SystemContext, srcRef types.ImageReference, imageListSelection copy.ImageListSelection,
+	retryOpts *retry.Options) (res []types.BlobInfo, retErr error) {
+	var src types.ImageSource
+	if err := retry.IfNecessary(ctx, func() error {
+		var err error
+		src, err = srcRef.NewImageSource(ctx, sys)
+		return err
+	}, retryOpts); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := src.Close(); err != nil {
+			retErr = noteCloseFailure(retErr, "closing image", err)
+		}
+	}()
+	var rawManifest []byte
+	var mimeType string
+	if err := retry.IfNecessary(ctx, func() error {
+		var err error
+		rawManifest, mimeType, err = src.GetManifest(ctx, nil)
+		return err
+	}, retryOpts); err != nil {
+		return nil, fmt.Errorf("Error retrieving manifest for image: %w", err)
+	}
+
+	instances := []*digest.Digest{nil}
+	if manifest.MIMETypeIsMultiImage(manifest.NormalizedMIMEType(mimeType)) {
+		list, err := manifest.ListFromBlob(rawManifest, mimeType)
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing manifest list: %w", err)
+		}
+		switch imageListSelection {
+		case copy.CopySystemImage:
+			instance, err := list.ChooseInstance(sys)
+			if err != nil {
+				return nil, err
+			}
+			instances = []*digest.Digest{&instance}
+		case copy.CopyAllImages:
+			instances = []*digest.Digest{}
+			for _, instance := range list.Instances() {
+				instance := instance
+				instances = append(instances, &instance)
+			}
+		default: // Only the list itself is copied
+			instances = []*digest.Digest{}
+		}
+	}
+
+	return uniqueImageBlobs(ctx, sys, src, instances, retryOpts)
+}
+
+// uniqueImageBlobs returns the unique config and layer blobs of the specified instances (nil for a single image) of src.
+func uniqueImageBlobs(ctx context.Context, sys *types.SystemContext, src types.ImageSource, instances []*digest.Digest,
+	retryOpts *retry.Options) ([]types.BlobInfo, error) {
+	res := []types.BlobInfo{}
+	seen := map[digest.Digest]struct{}{}
+	for _, instance := range instances {
+		var img types.Image
+		if err := retry.IfNecessary(ctx, func() error {
+			var err error
+			img, err = image.FromUnparsedImage(ctx, sys, image.UnparsedInstance(src, instance))
+			return err
+		}, retryOpts); err != nil {
+			return nil, fmt.Errorf("Error parsing manifest for image: %w", err)
+		}
+		for _, blob := range append([]types.BlobInfo{img.ConfigInfo()}, img.LayerInfos()...) {
+			if _, ok := seen[blob.Digest]; ok || blob.Digest == "" {
+				continue
+			}
+			seen[blob.Digest] = struct{}{}
+			res = append(res, blob)
+		}
+	}
+	return res, nil
+}
+
+// blobsPresentAtDestination returns the subset of blobs which already exist at destRef.
+// The check is only done for registries; other destinations might be modified just by opening them, so all blobs are assumed to be missing.
+func blobsPresentAtDestination(ctx context.Context, sys *types.SystemContext, destRef types.ImageReference, blobs []types.BlobInfo,
+	retryOpts *retry.Options) (res map[digest.Digest]bool, retErr error) {
+	res = map[digest.Digest]bool{}
+	if destRef.Transport() != docker.Transport {
+		logrus.Warnf("--dry-run can not check for blobs existing in %s destinations, assuming that all blobs need to be copied", destRef.Transport().Name())
+		return res, nil
+	}
+
+	var dest types.ImageDestination
+	if err := retry.IfNecessary(ctx, func() error {
+		var err error
+		dest, err = destRef.NewImageDestination(ctx, sys)
+		return err
+	}, retryOpts); err != nil {
+		return nil, err
+	}
+	defer func() { // The destination is never committed, so nothing is written.
+		if err := dest.Close(); err != nil {
+			retErr = noteCloseFailure(retErr, "closing destination", err)
+		}
+	}()
+	for _, blob := range blobs {
+		var present bool
+		if err := retry.IfNecessary(ctx, func() error {
+			var err error
+			// With no cache and no substitution, this only checks for the blob in the destination repository, without mounting any blobs.
+			present, _, err = dest.TryReusingBlob(ctx, blob, none.NoCache, false)
+			return err
+		}, retryOpts); err != nil {
+			return nil, fmt.Errorf("checking for blob %s at destination: %w", blob.Digest, err)
+		}
+		if present {
+			res[blob.Digest] = true
+		}
+	}
+	return res, nil
+}
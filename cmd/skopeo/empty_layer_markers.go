@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/containers/common/pkg/retry"
+	"github.com/containers/image/v5/image"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// emptyLayerMarkers returns the empty_layer flags of the history entries in the config of the image at ref, in order;
+// if ref is a manifest list, the instance matching sys is used.
+func emptyLayerMarkers(ctx context.Context, sys *types.SystemContext, ref types.ImageReference, retryOpts *retry.Options) (_ []bool, retErr error) {
+	var src types.ImageSource
+	if err := retry.IfNecessary(ctx, func() error {
+		var err error
+		src, err = ref.NewImageSource(ctx, sys)
+		return err
+	}, retryOpts); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := src.Close(); err != nil {
+			retErr = noteCloseFailure(retErr, "closing image", err)
+		}
+	}()
+	var rawManifest []byte
+	var mimeType string
+	if err := retry.IfNecessary(ctx, func() error {
+		var err error
+		rawManifest, mimeType, err = src.GetManifest(ctx, nil)
+		return err
+	}, retryOpts); err != nil {
+		return nil, fmt.Errorf("Error retrieving manifest for image: %w", err)
+	}
+	var instance *digest.Digest
+	if manifest.MIMETypeIsMultiImage(manifest.NormalizedMIMEType(mimeType)) {
+		list, err := manifest.ListFromBlob(rawManifest, mimeType)
+		if err != nil {
+			return nil, err
+		}
+		d, err := list.ChooseInstance(sys)
+		if err != nil {
+			return nil, err
+		}
+		instance = &d
+	}
+	img, err := image.FromUnparsedImage(ctx, sys, image.UnparsedInstance(src, instance))
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing manifest for image: %w", err)
+	}
+	var config *imgspecv1.Image
+	if err := retry.IfNecessary(ctx, func() error {
+		config, err = img.OCIConfig(ctx)
+		return err
+	}, retryOpts); err != nil {
+		return nil, fmt.Errorf("Error reading OCI-formatted configuration data: %w", err)
+	}
+	res := make([]bool, 0, len(config.History))
+	for _, h := range config.History {
+		res = append(res, h.EmptyLayer)
+	}
+	return res, nil
+}
+
+// checkEmptyLayerMarkers returns an error if the empty_layer history flags of the image at destRef differ from srcMarkers,
+// as returned by emptyLayerMarkers.
+func checkEmptyLayerMarkers(ctx context.Context, sys *types.SystemContext, destRef types.ImageReference, srcMarkers []bool, retryOpts *retry.Options) error {
+	destMarkers, err := emptyLayerMarkers(ctx, sys, destRef, retryOpts)
+	if err != nil {
+		return fmt.Errorf("reading the history of %s: %w", transports.ImageName(destRef), err)
+	}
+	if len(destMarkers) != len(srcMarkers) {
+		return fmt.Errorf("--preserve-empty-layer-markers: %s has %d history entries, but the source has %d",
+			transports.ImageName(destRef), len(destMarkers), len(srcMarkers))
+	}
+	for i := range srcMarkers {
+		if destMarkers[i] != srcMarkers[i] {
+			return fmt.Errorf("--preserve-empty-layer-markers: history entry %d of %s has empty_layer %t, but the source has %t",
+				i, transports.ImageName(destRef), destMarkers[i], srcMarkers[i])
+		}
+	}
+	return nil
+}
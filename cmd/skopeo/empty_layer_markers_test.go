@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/containers/common/pkg/retry"
+	"github.com/containers/image/v5/transports/alltransports"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testDirImageWithHistory returns a dir: image with a single layer, and a config with history.
+func testDirImageWithHistory(t *testing.T, history string) string {
+	config := []byte(`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers","diff_ids":[]},"history":` + history + `}`)
+	layer := []byte("not really a layer")
+	configDigest := digest.FromBytes(config)
+	layerDigest := digest.FromBytes(layer)
+	dir := testDirImage(t, []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json",`+
+		`"config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"`+configDigest.String()+`","size":`+strconv.Itoa(len(config))+`},`+
+		`"layers":[{"mediaType":"application/vnd.oci.image.layer.v1.tar","digest":"`+layerDigest.String()+`","size":`+strconv.Itoa(len(layer))+`}]}`))
+	err := os.WriteFile(filepath.Join(dir, configDigest.Encoded()), config, 0o644)
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(dir, layerDigest.Encoded()), layer, 0o644)
+	require.NoError(t, err)
+	return dir
+}
+
+func TestEmptyLayerMarkers(t *testing.T) {
+	ctx := context.Background()
+	src := testDirImageWithHistory(t, `[{"created_by":"ENV A=1","empty_layer":true},{"created_by":"COPY a /"},{"created_by":"CMD [\"a\"]","empty_layer":true}]`)
+	srcRef, err := alltransports.ParseImageName("dir:" + src)
+	require.NoError(t, err)
+	markers, err := emptyLayerMarkers(ctx, &types.SystemContext{}, srcRef, &retry.Options{})
+	require.NoError(t, err)
+	assert.Equal(t, []bool{true, false, true}, markers)
+
+	err = checkEmptyLayerMarkers(ctx, &types.SystemContext{}, srcRef, markers, &retry.Options{})
+	assert.NoError(t, err)
+	err = checkEmptyLayerMarkers(ctx, &types.SystemContext{}, srcRef, []bool{false, false, true}, &retry.Options{})
+	assert.ErrorContains(t, err, "history entry 0")
+	err = checkEmptyLayerMarkers(ctx, &types.SystemContext{}, srcRef, []bool{true, false}, &retry.Options{})
+	assert.ErrorContains(t, err, "has 3 history entries, but the source has 2")
+}
+
+func TestCopyPreserveEmptyLayerMarkers(t *testing.T) {
+	src := testDirImageWithHistory(t, `[{"created_by":"ENV A=1","empty_layer":true},{"created_by":"COPY a /"}]`)
+	_, err := runSkopeo("--insecure-policy", "copy", "--preserve-empty-layer-markers", "--format", "v2s2", "dir:"+src, "dir:"+t.TempDir())
+	require.NoError(t, err)
+
+	out, err := runSkopeo("--insecure-policy", "copy", "--preserve-empty-layer-markers", "--squash", "dir:"+src, "dir:"+t.TempDir())
+	assertTestFailed(t, out, err, "--preserve-empty-layer-markers cannot be used together with --squash")
+}
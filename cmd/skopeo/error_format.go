@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/signature"
+	"github.com/containers/image/v5/transports/alltransports"
+	"github.com/docker/distribution/registry/api/errcode"
+)
+
+// Categories of errors reported by --error-format json, and the corresponding exit codes.
+const (
+	errorCategoryOther    = "other"
+	errorCategoryAuth     = "auth"
+	errorCategoryNetwork  = "network"
+	errorCategoryNotFound = "notfound"
+	errorCategoryPolicy   = "policy"
+)
+
+var errorCategoryExitCodes = map[string]int{
+	errorCategoryOther:    1,
+	errorCategoryAuth:     2,
+	errorCategoryNetwork:  3,
+	errorCategoryNotFound: 4,
+	errorCategoryPolicy:   5,
+}
+
+// structuredError is the format of errors reported by --error-format json.
+type structuredError struct {
+	Category  string `json:"category"`
+	Message   string `json:"message"`
+	Reference string `json:"reference,omitempty"`
+}
+
+// classifyError returns the category of err.
+func classifyError(err error) string {
+	var unauthorized docker.ErrUnauthorizedForCredentials
+	var policyRequirement signature.PolicyRequirementError
+	var invalidSignature signature.InvalidSignatureError
+	var netErr net.Error
+	var ec errcode.ErrorCoder
+	switch {
+	case errors.As(err, &unauthorized):
+		return errorCategoryAuth
+	case errors.As(err, &policyRequirement), errors.As(err, &invalidSignature):
+		return errorCategoryPolicy
+	case errors.As(err, &ec):
+		switch ec.ErrorCode().Descriptor().HTTPStatusCode {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return errorCategoryAuth
+		case http.StatusNotFound:
+			return errorCategoryNotFound
+		case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+			return errorCategoryNetwork
+		}
+	case errors.Is(err, docker.ErrTooManyRequests), errors.As(err, &netErr):
+		return errorCategoryNetwork
+	case errors.Is(err, fs.ErrNotExist):
+		return errorCategoryNotFound
+	}
+	return errorCategoryOther
+}
+
+// errorReference returns the image reference, out of the positional arguments args, which err seems to be about, or "" if unknown.
+func errorReference(err error, args []string) string {
+	message := err.Error()
+	for _, arg := range args {
+		// Error messages usually don't include the transport name, or the complete reference; look for parts of it as well.
+		candidates := []string{arg}
+		if ref, err := alltransports.ParseImageName(arg); err == nil {
+			candidates = append(candidates, strings.TrimPrefix(ref.StringWithinTransport(), "//"))
+			if dockerRef := ref.DockerReference(); dockerRef != nil {
+				candidates = append(candidates, dockerRef.Name())
+			}
+		}
+		for _, candidate := range candidates {
+			if strings.Contains(message, candidate) {
+				return arg
+			}
+		}
+	}
+	if len(args) == 1 {
+		return args[0]
+	}
+	return ""
+}
+
+// reportJSONError writes err to stderr as a structuredError, and returns the exit code to use.
+func (opts *globalOptions) reportJSONError(stderr io.Writer, err error) int {
+	category := classifyError(err)
+	out, jsonErr := json.Marshal(structuredError{
+		Category:  category,
+		Message:   err.Error(),
+		Reference: errorReference(err, opts.commandArgs),
+	})
+	if jsonErr != nil { // Should never happen
+		fmt.Fprintln(stderr, err.Error())
+		return 1
+	}
+	fmt.Fprintf(stderr, "%s\n", out)
+	return errorCategoryExitCodes[category]
+}
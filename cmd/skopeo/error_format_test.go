@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"testing"
+
+	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/signature"
+	"github.com/docker/distribution/registry/api/errcode"
+	v2 "github.com/docker/distribution/registry/api/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyError(t *testing.T) {
+	for _, c := range []struct {
+		err      error
+		expected string
+	}{
+		{errors.New("something failed"), errorCategoryOther},
+		{fmt.Errorf("reading manifest: %w", docker.ErrUnauthorizedForCredentials{Err: errors.New("401")}), errorCategoryAuth},
+		{fmt.Errorf("reading manifest: %w", errcode.ErrorCodeDenied), errorCategoryAuth},
+		{fmt.Errorf("reading manifest: %w", v2.ErrorCodeManifestUnknown.WithMessage("manifest unknown")), errorCategoryNotFound},
+		{fmt.Errorf("reading manifest: %w", errcode.ErrorCodeTooManyRequests), errorCategoryNetwork},
+		{fmt.Errorf("pinging registry: %w", &net.OpError{Op: "dial", Err: errors.New("connection refused")}), errorCategoryNetwork},
+		{fmt.Errorf("Source image rejected: %w", signature.PolicyRequirementError("Running image is rejected by policy.")), errorCategoryPolicy},
+		{fmt.Errorf("opening: %w", fs.ErrNotExist), errorCategoryNotFound},
+	} {
+		assert.Equal(t, c.expected, classifyError(c.err), c.err.Error())
+	}
+}
+
+func TestErrorReference(t *testing.T) {
+	args := []string{"docker://registry.example.com/src:latest", "dir:/tmp/dest"}
+	assert.Equal(t, args[0], errorReference(errors.New("reading manifest latest in registry.example.com/src: manifest unknown"), args))
+	assert.Equal(t, args[1], errorReference(errors.New("open /tmp/dest/manifest.json: permission denied"), args))
+	assert.Equal(t, "", errorReference(errors.New("something failed"), args))
+	assert.Equal(t, "dir:/tmp/dest", errorReference(errors.New("something failed"), []string{"dir:/tmp/dest"}))
+}
+
+func TestReportJSONError(t *testing.T) {
+	opts, _ := fakeGlobalOptions(t, []string{"--error-format", "json"})
+	opts.commandArgs = []string{"docker://registry.example.com/repo:tag"}
+	stderr := bytes.Buffer{}
+	code := opts.reportJSONError(&stderr, fmt.Errorf("reading manifest: %w", docker.ErrUnauthorizedForCredentials{Err: errors.New("denied")}))
+	assert.Equal(t, 2, code)
+	assert.Equal(t, `{"category":"auth","message":"reading manifest: unable to retrieve auth token: invalid username/password: denied","reference":"docker://registry.example.com/repo:tag"}`+"\n", stderr.String())
+
+	out, err := runSkopeo("--error-format", "yaml", "inspect", "dir:/")
+	assertTestFailed(t, out, err, "Invalid --error-format")
+}
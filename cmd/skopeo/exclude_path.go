@@ -0,0 +1,420 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/containers/common/pkg/retry"
+	"github.com/containers/image/v5/image"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
+	"github.com/containers/image/v5/pkg/compression"
+	"github.com/containers/image/v5/signature"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+// whiteoutPrefix and whiteoutOpaqueDir are the names used in layer tar files to mark deleted files and directories.
+const (
+	whiteoutPrefix    = ".wh."
+	whiteoutOpaqueDir = ".wh..wh..opq"
+)
+
+// parseExcludePatterns validates values of --exclude-path, and returns them as patterns relative to the root directory.
+func parseExcludePatterns(values []string) ([]string, error) {
+	res := []string{}
+	for _, value := range values {
+		pattern := strings.TrimPrefix(path.Clean("/"+value), "/")
+		if pattern == "" {
+			return nil, fmt.Errorf("Invalid --exclude-path %q: excluding the root directory is not supported", value)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("Invalid --exclude-path %q: %w", value, err)
+		}
+		res = append(res, pattern)
+	}
+	return res, nil
+}
+
+// pathIsExcluded returns true if name, a path relative to the root directory, or any of its parent directories, matches one of patterns.
+func pathIsExcluded(name string, patterns []string) bool {
+	for p := name; p != "." && p != "/" && p != ""; p = path.Dir(p) {
+		for _, pattern := range patterns {
+			if matched, _ := path.Match(pattern, p); matched { // The patterns were validated by parseExcludePatterns
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// tarEntryPath returns the path of a tar entry name relative to the root directory.
+func tarEntryPath(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// whiteoutTarget returns the path deleted by the whiteout entry at name (relative to the root directory),
+// or "" if name is not a whiteout entry.
+func whiteoutTarget(name string) string {
+	dir, base := path.Split(name)
+	switch {
+	case base == whiteoutOpaqueDir:
+		return path.Clean(dir)
+	case strings.HasPrefix(base, whiteoutPrefix):
+		return path.Join(dir, strings.TrimPrefix(base, whiteoutPrefix))
+	default:
+		return ""
+	}
+}
+
+// filterLayer copies the uncompressed layer tar stream from src to dest, omitting entries matching patterns,
+// and whiteouts of such entries. It returns the number of omitted entries.
+func filterLayer(dest io.Writer, src io.Reader, patterns []string) (int, error) {
+	tr := tar.NewReader(src)
+	tw := tar.NewWriter(dest)
+	omitted := 0
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("reading layer: %w", err)
+		}
+		name := tarEntryPath(hdr.Name)
+		excluded := pathIsExcluded(name, patterns)
+		if !excluded {
+			if target := whiteoutTarget(name); target != "" {
+				excluded = pathIsExcluded(target, patterns)
+			}
+		}
+		if excluded {
+			omitted++
+			continue
+		}
+		if hdr.Typeflag == tar.TypeLink && pathIsExcluded(tarEntryPath(hdr.Linkname), patterns) {
+			return 0, fmt.Errorf("%q is a hard link to excluded %q", hdr.Name, hdr.Linkname)
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return 0, err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return 0, fmt.Errorf("reading layer: %w", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return 0, err
+	}
+	return omitted, nil
+}
+
+// rewrittenLayer is a layer created by --exclude-path or --squash.
+type rewrittenLayer struct {
+	path string // A file containing the uncompressed layer
+	size int64
+}
+
+// rewrittenImageReference is a types.ImageReference wrapper; image sources created from it
+// present an image with the specified manifest, config and layer blobs replaced by versions from --exclude-path or --squash.
+type rewrittenImageReference struct {
+	types.ImageReference
+	manifest         []byte
+	manifestMIMEType string
+	configDigest     digest.Digest
+	config           []byte
+	layers           map[digest.Digest]rewrittenLayer
+}
+
+// NewImageSource returns a types.ImageSource for this reference.
+// The caller must call .Close() on the returned ImageSource.
+func (ref rewrittenImageReference) NewImageSource(ctx context.Context, sys *types.SystemContext) (types.ImageSource, error) {
+	src, err := ref.ImageReference.NewImageSource(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	return &rewrittenImageSource{ImageSource: src, ref: ref}, nil
+}
+
+// rewrittenImageSource is a types.ImageSource wrapper which presents the image prepared by setUpExcludePaths or setUpSquash.
+type rewrittenImageSource struct {
+	types.ImageSource
+	ref rewrittenImageReference
+}
+
+// Reference returns the reference used to set up this source.
+func (s *rewrittenImageSource) Reference() types.ImageReference {
+	return s.ref
+}
+
+// GetManifest returns the image's manifest along with its MIME type.
+func (s *rewrittenImageSource) GetManifest(ctx context.Context, instanceDigest *digest.Digest) ([]byte, string, error) {
+	if instanceDigest != nil {
+		return nil, "", errors.New("internal error: rewritten images are not manifest lists")
+	}
+	return s.ref.manifest, s.ref.manifestMIMEType, nil
+}
+
+// GetBlob returns a stream for the specified blob, and the blob’s size (or -1 if unknown).
+func (s *rewrittenImageSource) GetBlob(ctx context.Context, info types.BlobInfo, cache types.BlobInfoCache) (io.ReadCloser, int64, error) {
+	if info.Digest == s.ref.configDigest {
+		return io.NopCloser(bytes.NewReader(s.ref.config)), int64(len(s.ref.config)), nil
+	}
+	if layer, ok := s.ref.layers[info.Digest]; ok {
+		f, err := os.Open(layer.path)
+		if err != nil {
+			return nil, -1, err
+		}
+		return f, layer.size, nil
+	}
+	return s.ImageSource.GetBlob(ctx, info, cache)
+}
+
+// GetSignatures returns the image's signatures; the modified image has none.
+func (s *rewrittenImageSource) GetSignatures(ctx context.Context, instanceDigest *digest.Digest) ([][]byte, error) {
+	return nil, nil
+}
+
+// LayerInfosForCopy returns either nil (meaning the values in the manifest are fine), or updated values for the layer blobsums that are listed in the image's manifest.
+func (s *rewrittenImageSource) LayerInfosForCopy(ctx context.Context, instanceDigest *digest.Digest) ([]types.BlobInfo, error) {
+	return nil, nil
+}
+
+// setUpExcludePaths verifies the image at srcRef (choosing an instance from a manifest list based on sys) against policyContext,
+// and returns a reference to a version of that image without files matching patterns.
+// The layers are rewritten into a temporary directory created using global.
+func setUpExcludePaths(ctx context.Context, sys *types.SystemContext, policyContext *signature.PolicyContext, srcRef types.ImageReference,
+	patterns []string, global *globalOptions, retryOpts *retry.Options) (_ types.ImageReference, retErr error) {
+	var src types.ImageSource
+	if err := retry.IfNecessary(ctx, func() error {
+		var err error
+		src, err = srcRef.NewImageSource(ctx, sys)
+		return err
+	}, retryOpts); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := src.Close(); err != nil {
+			retErr = noteCloseFailure(retErr, "closing image", err)
+		}
+	}()
+
+	img, err := policyVerifiedImage(ctx, sys, policyContext, src, retryOpts)
+	if err != nil {
+		return nil, err
+	}
+	rawManifest, mimeType, err := img.Manifest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if img.ConfigInfo().Digest == "" {
+		return nil, fmt.Errorf("--exclude-path does not support %s images", mimeType)
+	}
+	config, err := img.ConfigBlob(ctx)
+	if err != nil {
+		return nil, err
+	}
+	m, err := manifest.FromBlob(rawManifest, mimeType)
+	if err != nil {
+		return nil, err
+	}
+
+	logrus.Warn("--exclude-path changes the digests of the image and its layers, and invalidates any signatures")
+	dir, err := global.newTemporaryDir("skopeo-exclude-path")
+	if err != nil {
+		return nil, err
+	}
+	layers := map[digest.Digest]rewrittenLayer{}
+	layerInfos := m.LayerInfos()
+	updatedInfos := make([]types.BlobInfo, 0, len(layerInfos))
+	diffIDs := make([]digest.Digest, 0, len(layerInfos))
+	for i, layer := range layerInfos {
+		if layer.CryptoOperation != types.PreserveOriginalCrypto || strings.Contains(layer.MediaType, "encrypted") {
+			return nil, fmt.Errorf("--exclude-path does not support encrypted layer %s", layer.Digest)
+		}
+		layerPath := filepath.Join(dir, fmt.Sprintf("layer-%d", i))
+		filtered, omitted, err := filterLayerBlob(ctx, src, layer.BlobInfo, layerPath, patterns, retryOpts)
+		if err != nil {
+			return nil, fmt.Errorf("filtering layer %s: %w", layer.Digest, err)
+		}
+		logrus.Debugf("Omitted %d entries from layer %s, now %s", omitted, layer.Digest, filtered.Digest)
+		layers[filtered.Digest] = rewrittenLayer{path: layerPath, size: filtered.Size}
+		updatedInfos = append(updatedInfos, filtered)
+		diffIDs = append(diffIDs, filtered.Digest)
+	}
+	if err := m.UpdateLayerInfos(updatedInfos); err != nil {
+		return nil, err
+	}
+
+	updatedConfig, err := replaceConfigDiffIDs(config, diffIDs)
+	if err != nil {
+		return nil, err
+	}
+	return newRewrittenImageReference(srcRef, m, mimeType, updatedConfig, layers, "--exclude-path")
+}
+
+// policyVerifiedImage verifies the image in src (choosing an instance from a manifest list based on sys) against policyContext,
+// and returns it.
+func policyVerifiedImage(ctx context.Context, sys *types.SystemContext, policyContext *signature.PolicyContext, src types.ImageSource,
+	retryOpts *retry.Options) (types.Image, error) {
+	unparsed := image.UnparsedInstance(src, nil)
+	allowed, err := policyContext.IsRunningImageAllowed(ctx, unparsed)
+	if !allowed || err != nil { // Be paranoid and fail if either return value indicates so.
+		if err == nil {
+			err = errors.New("the image is not allowed by policy")
+		}
+		return nil, fmt.Errorf("Source image rejected: %w", err)
+	}
+	var img types.Image
+	if err := retry.IfNecessary(ctx, func() error {
+		var err error
+		img, err = image.FromUnparsedImage(ctx, sys, unparsed)
+		return err
+	}, retryOpts); err != nil {
+		return nil, fmt.Errorf("Error parsing manifest for image: %w", err)
+	}
+	return img, nil
+}
+
+// newRewrittenImageReference returns a reference to srcRef presenting m (of type mimeType), with its config replaced by config,
+// and with layers. optionName is used in error messages.
+func newRewrittenImageReference(srcRef types.ImageReference, m manifest.Manifest, mimeType string, config []byte,
+	layers map[digest.Digest]rewrittenLayer, optionName string) (types.ImageReference, error) {
+	configDigest := digest.FromBytes(config)
+	switch m := m.(type) {
+	case *manifest.OCI1:
+		m.Config.Digest = configDigest
+		m.Config.Size = int64(len(config))
+	case *manifest.Schema2:
+		m.ConfigDescriptor.Digest = configDigest
+		m.ConfigDescriptor.Size = int64(len(config))
+	default:
+		return nil, fmt.Errorf("%s does not support %s images", optionName, mimeType)
+	}
+	updatedManifest, err := m.Serialize()
+	if err != nil {
+		return nil, err
+	}
+	return rewrittenImageReference{
+		ImageReference:   srcRef,
+		manifest:         updatedManifest,
+		manifestMIMEType: mimeType,
+		configDigest:     configDigest,
+		config:           config,
+		layers:           layers,
+	}, nil
+}
+
+// filterLayerBlob reads layer from src, and writes an uncompressed version without entries matching patterns to dest.
+// It returns the blob info of the result, and the number of omitted entries.
+func filterLayerBlob(ctx context.Context, src types.ImageSource, layer types.BlobInfo, dest string, patterns []string,
+	retryOpts *retry.Options) (types.BlobInfo, int, error) {
+	var res types.BlobInfo
+	var omitted int
+	err := retry.IfNecessary(ctx, func() (retErr error) {
+		stream, _, err := src.GetBlob(ctx, layer, none.NoCache)
+		if err != nil {
+			return err
+		}
+		defer stream.Close()
+		verifier := layer.Digest.Verifier()
+		verifiedStream := io.TeeReader(stream, verifier)
+		uncompressed, _, err := compression.AutoDecompress(verifiedStream)
+		if err != nil {
+			return err
+		}
+		defer uncompressed.Close()
+
+		f, err := os.Create(dest)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := f.Close(); err != nil && retErr == nil {
+				retErr = err
+			}
+		}()
+		digester := digest.Canonical.Digester()
+		counter := &byteCounter{}
+		omitted, err = filterLayer(io.MultiWriter(f, digester.Hash(), counter), uncompressed, patterns)
+		if err != nil {
+			return err
+		}
+		// Read any trailing data, e.g. tar padding, so that the whole blob is verified.
+		// (Hide the WriteTo method of uncompressed, the pgzip implementation does not handle being called after a partial read.)
+		if _, err := io.Copy(io.Discard, struct{ io.Reader }{uncompressed}); err != nil {
+			return err
+		}
+		if _, err := io.Copy(io.Discard, verifiedStream); err != nil {
+			return err
+		}
+		if !verifier.Verified() {
+			return fmt.Errorf("layer contents do not match digest %s", layer.Digest)
+		}
+		res = types.BlobInfo{
+			Digest:               digester.Digest(),
+			Size:                 counter.count,
+			Annotations:          layer.Annotations,
+			CompressionOperation: types.Decompress,
+		}
+		return nil
+	}, retryOpts)
+	return res, omitted, err
+}
+
+// byteCounter is an io.Writer which counts the bytes written to it.
+type byteCounter struct {
+	count int64
+}
+
+func (c *byteCounter) Write(p []byte) (int, error) {
+	c.count += int64(len(p))
+	return len(p), nil
+}
+
+// replaceConfigDiffIDs returns config, an image config blob, with rootfs.diff_ids set to diffIDs.
+// Other members of config are preserved.
+func replaceConfigDiffIDs(config []byte, diffIDs []digest.Digest) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(config, &fields); err != nil {
+		return nil, fmt.Errorf("parsing image config: %w", err)
+	}
+	var rootFS map[string]json.RawMessage
+	if raw, ok := fields["rootfs"]; ok {
+		if err := json.Unmarshal(raw, &rootFS); err != nil {
+			return nil, fmt.Errorf("parsing image config rootfs: %w", err)
+		}
+	}
+	if rootFS == nil {
+		rootFS = map[string]json.RawMessage{"type": json.RawMessage(`"layers"`)}
+	}
+	var oldDiffIDs []digest.Digest
+	if raw, ok := rootFS["diff_ids"]; ok {
+		if err := json.Unmarshal(raw, &oldDiffIDs); err != nil {
+			return nil, fmt.Errorf("parsing image config diff_ids: %w", err)
+		}
+	}
+	if len(oldDiffIDs) != len(diffIDs) {
+		return nil, fmt.Errorf("image config lists %d layer diff IDs, but the manifest has %d layers", len(oldDiffIDs), len(diffIDs))
+	}
+	rawDiffIDs, err := json.Marshal(diffIDs)
+	if err != nil {
+		return nil, err
+	}
+	rootFS["diff_ids"] = rawDiffIDs
+	rawRootFS, err := json.Marshal(rootFS)
+	if err != nil {
+		return nil, err
+	}
+	fields["rootfs"] = rawRootFS
+	return json.Marshal(fields)
+}
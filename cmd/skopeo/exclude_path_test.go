@@ -0,0 +1,199 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testLayerTar returns an uncompressed layer tar file containing entries, with files containing their names.
+func testLayerTar(t *testing.T, entries ...tar.Header) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for i := range entries {
+		hdr := entries[i]
+		var contents []byte
+		if hdr.Typeflag == tar.TypeReg {
+			contents = []byte(hdr.Name)
+			hdr.Size = int64(len(contents))
+		}
+		err := tw.WriteHeader(&hdr)
+		require.NoError(t, err)
+		_, err = tw.Write(contents)
+		require.NoError(t, err)
+	}
+	err := tw.Close()
+	require.NoError(t, err)
+	return buf.Bytes()
+}
+
+// layerTarNames returns the names of entries in layer, an uncompressed layer tar file.
+func layerTarNames(t *testing.T, layer []byte) []string {
+	res := []string{}
+	tr := tar.NewReader(bytes.NewReader(layer))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		res = append(res, hdr.Name)
+	}
+	return res
+}
+
+func TestParseExcludePatterns(t *testing.T) {
+	res, err := parseExcludePatterns([]string{"/usr/share/doc", "usr/share/man/", "./var/cache/*"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"usr/share/doc", "usr/share/man", "var/cache/*"}, res)
+
+	for _, invalid := range []string{"/", ".", "usr/[", "../.."} {
+		_, err := parseExcludePatterns([]string{invalid})
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestPathIsExcluded(t *testing.T) {
+	patterns := []string{"usr/share/doc", "var/cache/*.bin"}
+	for _, c := range []struct {
+		name     string
+		excluded bool
+	}{
+		{"usr/share/doc", true},
+		{"usr/share/doc/README", true},
+		{"usr/share/doc/pkg/README", true},
+		{"usr/share/docs", false},
+		{"usr/share", false},
+		{"usr", false},
+		{"var/cache/a.bin", true},
+		{"var/cache/a.bin/inner", true},
+		{"var/cache/a.txt", false},
+		{"", false},
+	} {
+		assert.Equal(t, c.excluded, pathIsExcluded(c.name, patterns), c.name)
+	}
+}
+
+func TestFilterLayer(t *testing.T) {
+	layer := testLayerTar(t,
+		tar.Header{Name: "./", Typeflag: tar.TypeDir, Mode: 0o755},
+		tar.Header{Name: "./usr/", Typeflag: tar.TypeDir, Mode: 0o755},
+		tar.Header{Name: "./usr/.wh..wh..opq", Typeflag: tar.TypeReg, Mode: 0o644},
+		tar.Header{Name: "./usr/bin/", Typeflag: tar.TypeDir, Mode: 0o755},
+		tar.Header{Name: "./usr/bin/tool", Typeflag: tar.TypeReg, Mode: 0o755},
+		tar.Header{Name: "./usr/share/", Typeflag: tar.TypeDir, Mode: 0o755},
+		tar.Header{Name: "./usr/share/.wh.doc", Typeflag: tar.TypeReg, Mode: 0o644},
+		tar.Header{Name: "./usr/share/doc/", Typeflag: tar.TypeDir, Mode: 0o755},
+		tar.Header{Name: "./usr/share/doc/.wh..wh..opq", Typeflag: tar.TypeReg, Mode: 0o644},
+		tar.Header{Name: "./usr/share/doc/README", Typeflag: tar.TypeReg, Mode: 0o644},
+		tar.Header{Name: "./usr/share/.wh.other", Typeflag: tar.TypeReg, Mode: 0o644},
+		tar.Header{Name: "./usr/share/doc-link", Typeflag: tar.TypeSymlink, Linkname: "doc/README"},
+	)
+	var filtered bytes.Buffer
+	omitted, err := filterLayer(&filtered, bytes.NewReader(layer), []string{"usr/share/doc"})
+	require.NoError(t, err)
+	assert.Equal(t, 4, omitted)
+	assert.Equal(t, []string{"./", "./usr/", "./usr/.wh..wh..opq", "./usr/bin/", "./usr/bin/tool", "./usr/share/",
+		"./usr/share/.wh.other", "./usr/share/doc-link"}, layerTarNames(t, filtered.Bytes()))
+
+	// Contents of the remaining files are preserved.
+	tr := tar.NewReader(bytes.NewReader(filtered.Bytes()))
+	for {
+		hdr, err := tr.Next()
+		require.NoError(t, err)
+		if hdr.Name == "./usr/bin/tool" {
+			contents, err := io.ReadAll(tr)
+			require.NoError(t, err)
+			assert.Equal(t, "./usr/bin/tool", string(contents))
+			break
+		}
+	}
+
+	// Hard links to excluded files can't be preserved.
+	layer = testLayerTar(t,
+		tar.Header{Name: "usr/share/doc/README", Typeflag: tar.TypeReg, Mode: 0o644},
+		tar.Header{Name: "usr/README", Typeflag: tar.TypeLink, Linkname: "usr/share/doc/README"},
+	)
+	_, err = filterLayer(io.Discard, bytes.NewReader(layer), []string{"usr/share/doc"})
+	assert.ErrorContains(t, err, "hard link")
+}
+
+func TestReplaceConfigDiffIDs(t *testing.T) {
+	d1, d2 := digest.FromString("1"), digest.FromString("2")
+	res, err := replaceConfigDiffIDs([]byte(`{"architecture":"amd64","rootfs":{"type":"layers","diff_ids":["`+digest.FromString("old").String()+`"]},"unknown":{"a":1}}`),
+		[]digest.Digest{d1})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"architecture":"amd64","rootfs":{"type":"layers","diff_ids":["`+d1.String()+`"]},"unknown":{"a":1}}`, string(res))
+
+	_, err = replaceConfigDiffIDs([]byte(`{"rootfs":{"type":"layers","diff_ids":[]}}`), []digest.Digest{d1, d2})
+	assert.Error(t, err)
+	_, err = replaceConfigDiffIDs([]byte(`not JSON`), nil)
+	assert.Error(t, err)
+}
+
+func TestCopyExcludePath(t *testing.T) {
+	layer := testLayerTar(t,
+		tar.Header{Name: "usr/", Typeflag: tar.TypeDir, Mode: 0o755},
+		tar.Header{Name: "usr/bin/tool", Typeflag: tar.TypeReg, Mode: 0o755},
+		tar.Header{Name: "usr/share/doc/README", Typeflag: tar.TypeReg, Mode: 0o644},
+	)
+	layerDiffID := digest.FromBytes(layer)
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	_, err := gz.Write(layer)
+	require.NoError(t, err)
+	err = gz.Close()
+	require.NoError(t, err)
+	layerDigest := digest.FromBytes(compressed.Bytes())
+	config := []byte(`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers","diff_ids":["` + layerDiffID.String() + `"]}}`)
+	configDigest := digest.FromBytes(config)
+	src := testDirImage(t, []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json",`+
+		`"config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"`+configDigest.String()+`","size":`+strconv.Itoa(len(config))+`},`+
+		`"layers":[{"mediaType":"application/vnd.oci.image.layer.v1.tar+gzip","digest":"`+layerDigest.String()+`","size":`+strconv.Itoa(compressed.Len())+`}]}`))
+	err = os.WriteFile(filepath.Join(src, configDigest.Encoded()), config, 0o644)
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(src, layerDigest.Encoded()), compressed.Bytes(), 0o644)
+	require.NoError(t, err)
+
+	dest := t.TempDir()
+	_, err = runSkopeo("--insecure-policy", "copy", "--exclude-path", "/usr/share/doc", "dir:"+src, "dir:"+dest)
+	require.NoError(t, err)
+
+	destManifestBlob, err := os.ReadFile(filepath.Join(dest, "manifest.json"))
+	require.NoError(t, err)
+	var destManifest imgspecv1.Manifest
+	err = json.Unmarshal(destManifestBlob, &destManifest)
+	require.NoError(t, err)
+	require.Len(t, destManifest.Layers, 1)
+	assert.Equal(t, imgspecv1.MediaTypeImageLayer, destManifest.Layers[0].MediaType)
+	destLayer, err := os.ReadFile(filepath.Join(dest, destManifest.Layers[0].Digest.Encoded()))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"usr/", "usr/bin/tool"}, layerTarNames(t, destLayer))
+
+	destConfigBlob, err := os.ReadFile(filepath.Join(dest, destManifest.Config.Digest.Encoded()))
+	require.NoError(t, err)
+	var destConfig imgspecv1.Image
+	err = json.Unmarshal(destConfigBlob, &destConfig)
+	require.NoError(t, err)
+	assert.Equal(t, []digest.Digest{destManifest.Layers[0].Digest}, destConfig.RootFS.DiffIDs)
+	assert.Equal(t, "amd64", destConfig.Architecture)
+
+	policy := filepath.Join(t.TempDir(), "policy.json")
+	err = os.WriteFile(policy, []byte(`{"default":[{"type":"reject"}]}`), 0o644)
+	require.NoError(t, err)
+	out, err := runSkopeo("--policy", policy, "copy", "--exclude-path", "/usr/share/doc", "dir:"+src, "dir:"+t.TempDir())
+	assertTestFailed(t, out, err, "rejected")
+	out, err = runSkopeo("--insecure-policy", "copy", "--exclude-path", "/usr/share/doc", "--all", "dir:"+src, "dir:"+t.TempDir())
+	assertTestFailed(t, out, err, "--exclude-path cannot be used together with --all or --multi-arch")
+}
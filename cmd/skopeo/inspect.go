@@ -1,21 +1,34 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"io"
+	"os"
+	"path"
+	"reflect"
 	"strings"
+	"time"
 
 	"github.com/containers/common/pkg/report"
 	"github.com/containers/common/pkg/retry"
 	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/docker/reference"
 	"github.com/containers/image/v5/image"
 	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
+	"github.com/containers/image/v5/signature"
+	"github.com/containers/image/v5/tarball"
 	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/transports/alltransports"
 	"github.com/containers/image/v5/types"
 	"github.com/containers/skopeo/cmd/skopeo/inspect"
 	"github.com/docker/distribution/registry/api/errcode"
+	digest "github.com/opencontainers/go-digest"
 	v1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -26,9 +39,37 @@ type inspectOptions struct {
 	image         *imageOptions
 	retryOpts     *retry.Options
 	format        string
-	raw           bool // Output the raw manifest instead of parsing information about the image
-	config        bool // Output the raw config blob instead of parsing information about the image
-	doNotListTags bool // Do not list all tags available in the same repository
+	raw           bool          // Output the raw manifest instead of parsing information about the image
+	config        bool          // Output the raw config blob instead of parsing information about the image
+	manifestOnly  bool          // Output the raw manifest, guaranteeing that nothing but the manifest is read
+	doNotListTags bool          // Do not list all tags available in the same repository
+	pretty        bool          // Pretty-print raw JSON output
+	archList      bool          // Output only the list of available architectures
+	instanceSizes bool          // Output only the total blob size of each image
+	normalize     bool          // Normalize the reported platform values
+	selectBest    bool          // Choose the image from lists which is best according to selectPrefer
+	selectPrefer  []string      // The rules, in order, used to choose an image with selectBest
+	osVersion     string        // Choose the first Windows image from lists whose os.version matches this prefix
+	localPlatform bool          // Choose images from lists for the platform skopeo is running on, rejecting --override-*
+	verifyKey     string        // Only verify that the image is signed by this public key
+	verifyID      string        // The identity signatures verified using verifyKey must match
+	fetchBlob     string        // Only write the blob with this digest
+	blobOutput    string        // Write the blob specified by fetchBlob to this file instead of stdout
+	anyBlob       bool          // Don't require the blob specified by fetchBlob to be referenced by the image
+	cacheDir      string        // Serve manifests and config blobs from, and store them in, this directory
+	cacheTTL      time.Duration // How long the cached manifest of a reference without a digest is used
+	countLayers   bool          // Output only the number of layers
+	countFiles    bool          // Output only the number of files and their total size, reading all layers
+	rawCount      bool          // With countFiles, count the entries of each layer, ignoring whiteouts
+	jsonSchema    bool          // Output the JSON Schema of the default output, without inspecting any image
+	applyPolicy   bool          // Evaluate the signature verification policy, and include the result in the output
+	runtimeConfig bool          // Output only the normalized runtime configuration of the image
+	storageInfo   bool          // Include a description of how a containers-storage: image is stored in the output
+	tarballConfig string        // Use the OCI image config in this file as the base of the config of a tarball: image
+	resolveSizes  bool          // Look up the sizes of blobs whose size is missing or zero in the manifest in the registry
+	stat          string        // Only output the metadata of this file in the root filesystem of a containers-storage: image
+	cat           bool          // With stat, output the contents of the file instead of its metadata
+	fetchMetadata bool          // Include the time the manifest was retrieved, and the digest reported by the registry, in the output
 }
 
 func inspectCmd(global *globalOptions) *cobra.Command {
@@ -59,6 +100,34 @@ skopeo inspect --format "Name: {{.Name}} Digest: {{.Digest}}" docker://registry.
 	flags := cmd.Flags()
 	flags.BoolVar(&opts.raw, "raw", false, "output raw manifest or configuration")
 	flags.BoolVar(&opts.config, "config", false, "output configuration")
+	flags.BoolVar(&opts.manifestOnly, "manifest-only", false, "output only the raw manifest, making a single manifest request and reading nothing else")
+	flags.BoolVar(&opts.pretty, "pretty", false, "pretty-print the output of --raw (which then does not match the original digest)")
+	flags.BoolVar(&opts.archList, "arch-list", false, "output only the architectures available in the image or manifest list")
+	flags.BoolVar(&opts.normalize, "normalize-platform", false, "report normalized OS, architecture and variant values, filling in implied variants and missing values from the image config")
+	flags.BoolVar(&opts.selectBest, "select-best", false, "choose the image from manifest lists which is best according to --select-prefer out of all images for the OS")
+	flags.StringSliceVar(&opts.selectPrefer, "select-prefer", defaultSelectPreferences, "with --select-best, prefer images by `RULES` (host, variant or size), in order")
+	flags.StringVar(&opts.osVersion, "os-version", "", "with --override-os windows, choose the first image from manifest lists whose os.version matches `VERSION`")
+	flags.BoolVar(&opts.localPlatform, "local-platform", false, "choose images from manifest lists for the OS, architecture and variant of this machine, rejecting --override-* options")
+	flags.BoolVar(&opts.resolveSizes, "resolve-sizes", false, "look up the sizes of blobs whose size is missing or zero in the manifest using HEAD requests to the registry, for LayersData and --instance-sizes")
+	flags.BoolVar(&opts.instanceSizes, "instance-sizes", false, "output only the platform, digest and total compressed size of the image, or of every image in the manifest list")
+	flags.StringVar(&opts.verifyKey, "verify-with-key", "", "only verify that the image has a signature made by the public key at `PATH`, without using a policy")
+	flags.StringVar(&opts.verifyID, "verify-identity", "", "require signatures verified with --verify-with-key to claim `IDENTITY` (a repository, or a reference with a tag or digest)")
+	flags.StringVar(&opts.fetchBlob, "fetch-blob", "", "only output the blob with `DIGEST`, after verifying its contents")
+	flags.StringVar(&opts.blobOutput, "output", "", "write the blob specified by --fetch-blob to `FILE` instead of standard output")
+	flags.BoolVar(&opts.anyBlob, "any-blob", false, "allow --fetch-blob to fetch blobs not referenced by the image")
+	flags.StringVar(&opts.cacheDir, "cache-dir", "", "cache manifests and config blobs in `DIRECTORY`, and use them in later calls")
+	flags.DurationVar(&opts.cacheTTL, "cache-ttl", 5*time.Minute, "with --cache-dir, use the cached manifest of a reference without a digest for `DURATION`")
+	flags.BoolVar(&opts.countLayers, "count-layers", false, "output only the number of layers of the image")
+	flags.BoolVar(&opts.countFiles, "count-files", false, "output only the number of files and their total uncompressed size in the image filesystem, reading all layers")
+	flags.BoolVar(&opts.rawCount, "raw-count", false, "with --count-files, count the files of each layer, without applying whiteouts")
+	flags.BoolVar(&opts.applyPolicy, "apply-policy", false, "evaluate the signature verification policy (see --policy) for the image, and include the result as PolicyResult in the output")
+	flags.BoolVar(&opts.fetchMetadata, "fetch-metadata", false, "include the time the manifest was retrieved (Fetched) and, for docker:// references, the manifest digest reported by the registry using an extra request (RegistryDigest) in the output")
+	flags.BoolVar(&opts.storageInfo, "storage-info", false, "include the storage driver, composefs usage and layer disk usage of a containers-storage: image as StorageInfo in the output")
+	flags.StringVar(&opts.stat, "stat", "", "mount the root filesystem of a containers-storage: image, and output only the metadata of the file at `PATH` in it")
+	flags.BoolVar(&opts.cat, "cat", false, "with --stat, output the contents of the file instead of its metadata")
+	flags.StringVar(&opts.tarballConfig, "tarball-config", "", "use the OCI image config in `FILE` as the base of the config of a tarball: image")
+	flags.BoolVar(&opts.runtimeConfig, "runtime-config", false, "output only the normalized runtime configuration of the image (entrypoint, command, environment, user, working directory and exposed ports)")
+	flags.BoolVar(&opts.jsonSchema, "json-schema", false, "output the JSON Schema of the default output format, without inspecting any image")
 	flags.StringVarP(&opts.format, "format", "f", "", "Format the output to a Go template")
 	flags.BoolVarP(&opts.doNotListTags, "no-tags", "n", false, "Do not list the available tags from the repository in the output")
 	flags.AddFlagSet(&sharedFlags)
@@ -76,24 +145,189 @@ func (opts *inspectOptions) run(args []string, stdout io.Writer) (retErr error)
 	ctx, cancel := opts.global.commandTimeoutContext()
 	defer cancel()
 
+	if opts.jsonSchema {
+		if len(args) != 0 {
+			return errors.New("--json-schema does not accept an image argument")
+		}
+		schema, err := jsonSchema(reflect.TypeOf(inspect.Output{}), "skopeo inspect output")
+		if err != nil {
+			return err
+		}
+		out, err := json.MarshalIndent(schema, "", "    ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(stdout, "%s\n", string(out))
+		return err
+	}
 	if len(args) != 1 {
 		return errors.New("Exactly one argument expected")
 	}
+	if opts.localPlatform {
+		if err := checkLocalPlatform(opts.global); err != nil {
+			return err
+		}
+	}
+	if opts.manifestOnly {
+		if opts.config || opts.archList || opts.instanceSizes || opts.format != "" || opts.verifyKey != "" || opts.fetchBlob != "" {
+			return errors.New("--manifest-only can not be used together with --config, --arch-list, --instance-sizes, --format, --verify-with-key or --fetch-blob")
+		}
+		opts.raw = true // The --raw code path only reads the manifest.
+	}
 	if opts.raw && opts.format != "" {
 		return errors.New("raw output does not support format option")
 	}
+	if opts.normalize && (opts.raw || opts.config) {
+		return errors.New("--normalize-platform can not be used together with --raw or --config")
+	}
+	if opts.archList {
+		if opts.raw || opts.config {
+			return errors.New("--arch-list can not be used together with --raw or --config")
+		}
+		if opts.format != "" && !report.IsJSON(opts.format) {
+			return errors.New("--arch-list only supports --format json")
+		}
+	}
+	if opts.instanceSizes {
+		if opts.raw || opts.config || opts.archList {
+			return errors.New("--instance-sizes can not be used together with --raw, --config or --arch-list")
+		}
+		if opts.format != "" && !report.IsJSON(opts.format) {
+			return errors.New("--instance-sizes only supports --format json")
+		}
+	}
+	var verifyPolicy *signature.Policy
+	if opts.verifyKey != "" {
+		if opts.raw || opts.config || opts.archList || opts.instanceSizes || opts.format != "" {
+			return errors.New("--verify-with-key can not be used together with --raw, --config, --arch-list, --instance-sizes or --format")
+		}
+		p, err := signatureVerificationPolicy(opts.verifyKey, opts.verifyID)
+		if err != nil {
+			return err
+		}
+		verifyPolicy = p
+	} else if opts.verifyID != "" {
+		return errors.New("--verify-identity requires --verify-with-key")
+	}
+	var blobDigest digest.Digest
+	if opts.fetchBlob != "" {
+		if opts.raw || opts.config || opts.archList || opts.instanceSizes || opts.format != "" || opts.verifyKey != "" {
+			return errors.New("--fetch-blob can not be used together with --raw, --config, --arch-list, --instance-sizes, --format or --verify-with-key")
+		}
+		d, err := digest.Parse(opts.fetchBlob)
+		if err != nil {
+			return fmt.Errorf("Invalid --fetch-blob value %q: %w", opts.fetchBlob, err)
+		}
+		blobDigest = d
+	} else if opts.blobOutput != "" || opts.anyBlob {
+		return errors.New("--output and --any-blob require --fetch-blob")
+	}
+	if opts.countLayers || opts.countFiles {
+		if opts.countLayers && opts.countFiles {
+			return errors.New("--count-layers can not be used together with --count-files")
+		}
+		if opts.raw || opts.config || opts.archList || opts.instanceSizes || opts.verifyKey != "" || opts.fetchBlob != "" {
+			return errors.New("--count-layers and --count-files can not be used together with --raw, --config, --arch-list, --instance-sizes, --verify-with-key or --fetch-blob")
+		}
+	}
+	if opts.selectBest {
+		if (opts.raw && !opts.config) || opts.archList || opts.instanceSizes || opts.verifyKey != "" || opts.fetchBlob != "" {
+			return errors.New("--select-best can not be used together with --raw, --arch-list, --instance-sizes, --verify-with-key or --fetch-blob")
+		}
+		if err := validateSelectPreferences(opts.selectPrefer); err != nil {
+			return err
+		}
+	}
+	if opts.osVersion != "" {
+		if opts.selectBest || (opts.raw && !opts.config) || opts.archList || opts.instanceSizes || opts.verifyKey != "" || opts.fetchBlob != "" {
+			return errors.New("--os-version can not be used together with --select-best, --raw, --arch-list, --instance-sizes, --verify-with-key or --fetch-blob")
+		}
+		if err := checkOSVersion(opts.global); err != nil {
+			return err
+		}
+	}
+	if opts.applyPolicy && (opts.raw || opts.config || opts.archList || opts.instanceSizes || opts.countLayers || opts.countFiles || opts.verifyKey != "" || opts.fetchBlob != "") {
+		return errors.New("--apply-policy can not be used together with --raw, --config, --arch-list, --instance-sizes, --count-layers, --count-files, --verify-with-key or --fetch-blob")
+	}
+	if opts.runtimeConfig && (opts.raw || opts.config || opts.archList || opts.instanceSizes || opts.countLayers || opts.countFiles || opts.verifyKey != "" || opts.fetchBlob != "" || opts.applyPolicy) {
+		return errors.New("--runtime-config can not be used together with --raw, --config, --arch-list, --instance-sizes, --count-layers, --count-files, --verify-with-key, --fetch-blob or --apply-policy")
+	}
+	if opts.storageInfo {
+		if opts.raw || opts.config || opts.archList || opts.instanceSizes || opts.countLayers || opts.countFiles || opts.verifyKey != "" || opts.fetchBlob != "" || opts.runtimeConfig {
+			return errors.New("--storage-info can not be used together with --raw, --config, --arch-list, --instance-sizes, --count-layers, --count-files, --verify-with-key, --fetch-blob or --runtime-config")
+		}
+		if err := validateDefaultStoreImageName("--storage-info", args[0]); err != nil {
+			return err
+		}
+	}
+	if opts.resolveSizes && (opts.raw || opts.config || opts.archList || opts.countLayers || opts.countFiles || opts.verifyKey != "" || opts.fetchBlob != "" || opts.runtimeConfig) {
+		return errors.New("--resolve-sizes can not be used together with --raw, --config, --arch-list, --count-layers, --count-files, --verify-with-key, --fetch-blob or --runtime-config")
+	}
+	if opts.stat != "" {
+		if opts.raw || opts.config || opts.archList || opts.instanceSizes || opts.countLayers || opts.countFiles || opts.verifyKey != "" || opts.fetchBlob != "" ||
+			opts.runtimeConfig || opts.storageInfo || opts.applyPolicy || opts.resolveSizes || opts.selectBest || opts.osVersion != "" || opts.cacheDir != "" || opts.tarballConfig != "" {
+			return errors.New("--stat can not be used together with --raw, --config, --arch-list, --instance-sizes, --count-layers, --count-files, --verify-with-key, --fetch-blob, " +
+				"--runtime-config, --storage-info, --apply-policy, --resolve-sizes, --select-best, --os-version, --cache-dir or --tarball-config")
+		}
+		if !path.IsAbs(opts.stat) {
+			return fmt.Errorf("--stat requires an absolute path, not %q", opts.stat)
+		}
+		if opts.cat && opts.format != "" {
+			return errors.New("--cat can not be used together with --format")
+		}
+		if err := validateDefaultStoreImageName("--stat", args[0]); err != nil {
+			return err
+		}
+	} else if opts.cat {
+		return errors.New("--cat requires --stat")
+	}
+	if opts.tarballConfig != "" && opts.cacheDir != "" {
+		return errors.New("--tarball-config can not be used together with --cache-dir")
+	}
+	if opts.rawCount && !opts.countFiles {
+		return errors.New("--raw-count requires --count-files")
+	}
+	if opts.cacheTTL < 0 {
+		return fmt.Errorf("Invalid --cache-ttl value %s: must not be negative", opts.cacheTTL)
+	}
 	imageName := args[0]
 
 	if err := reexecIfNecessaryForImages(imageName); err != nil {
 		return err
 	}
+	if opts.stat != "" {
+		return opts.writeFileStat(imageName, stdout)
+	}
 
 	sys, err := opts.image.newSystemContext()
 	if err != nil {
 		return err
 	}
+	if opts.localPlatform {
+		setLocalPlatform(sys)
+	}
 
-	if err := retry.IfNecessary(ctx, func() error {
+	if opts.cacheDir != "" {
+		// The image source is only opened if the cache does not contain the necessary data.
+		ref, err := alltransports.ParseImageName(imageName)
+		if err != nil {
+			return fmt.Errorf("Error parsing image name %q: %w", imageName, err)
+		}
+		src = newInspectCacheSource(ref, sys, opts.cacheDir, opts.cacheTTL)
+	} else if opts.tarballConfig != "" {
+		// The tarball: transport only reads local files, so there is nothing to retry.
+		ref, err := alltransports.ParseImageName(imageName)
+		if err != nil {
+			return fmt.Errorf("Error parsing image name %q: %w", imageName, err)
+		}
+		if err := applyTarballConfig(ref, opts.tarballConfig); err != nil {
+			return err
+		}
+		src, err = ref.NewImageSource(ctx, sys)
+		if err != nil {
+			return fmt.Errorf("Error parsing image name %q: %w", imageName, err)
+		}
+	} else if err := retry.IfNecessary(ctx, func() error {
 		src, err = parseImageSource(ctx, opts.image, imageName)
 		return err
 	}, opts.retryOpts); err != nil {
@@ -106,15 +340,43 @@ func (opts *inspectOptions) run(args []string, stdout io.Writer) (retErr error)
 		}
 	}()
 
+	if verifyPolicy != nil {
+		return verifySignatures(ctx, verifyPolicy, src, stdout)
+	}
+
+	var sizeResolver *blobSizeResolver
+	if opts.resolveSizes {
+		sizeResolver, err = newBlobSizeResolver(ctx, sys, src.Reference())
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := sizeResolver.close(); err != nil {
+				retErr = noteCloseFailure(retErr, "closing the blob size lookup", err)
+			}
+		}()
+	}
+
+	var mimeType string
 	if err := retry.IfNecessary(ctx, func() error {
-		rawManifest, _, err = src.GetManifest(ctx, nil)
+		rawManifest, mimeType, err = src.GetManifest(ctx, nil)
 		return err
 	}, opts.retryOpts); err != nil {
 		return fmt.Errorf("Error retrieving manifest for image: %w", err)
 	}
+	fetched := time.Now().UTC()
+	manifestFromCache := false
+	if cacheSrc, ok := src.(*inspectCacheSource); ok {
+		fetched = cacheSrc.manifestFetched.UTC() // The time recorded in the cache, if the manifest was served from it
+		manifestFromCache = cacheSrc.manifestFromCache
+	}
+
+	if blobDigest != "" {
+		return opts.writeBlob(ctx, sys, src, rawManifest, mimeType, blobDigest, stdout)
+	}
 
 	if opts.raw && !opts.config {
-		_, err := stdout.Write(rawManifest)
+		err := opts.writeRawOutput(stdout, rawManifest)
 		if err != nil {
 			return fmt.Errorf("Error writing manifest to standard output: %w", err)
 		}
@@ -122,11 +384,91 @@ func (opts *inspectOptions) run(args []string, stdout io.Writer) (retErr error)
 		return nil
 	}
 
+	if opts.archList {
+		archs, err := architectures(ctx, sys, src, rawManifest, mimeType, opts.normalize, opts.retryOpts)
+		if err != nil {
+			return err
+		}
+		if opts.format != "" {
+			return opts.writeOutput(stdout, archs)
+		}
+		_, err = fmt.Fprintln(stdout, strings.Join(archs, ","))
+		return err
+	}
+
+	if opts.instanceSizes {
+		sizes, err := instanceSizes(ctx, sys, src, rawManifest, mimeType, opts.normalize, sizeResolver, opts.retryOpts)
+		if err != nil {
+			return err
+		}
+		if opts.format != "" {
+			return opts.writeOutput(stdout, sizes)
+		}
+		for _, size := range sizes {
+			line := fmt.Sprintf("%s %s %d", size.Platform, size.Digest, size.Size)
+			if size.OSVersion != "" {
+				line += " os.version=" + size.OSVersion
+			}
+			if len(size.OSFeatures) != 0 {
+				line += " os.features=" + strings.Join(size.OSFeatures, ",")
+			}
+			if _, err := fmt.Fprintln(stdout, line); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if opts.selectBest {
+		instance, _, err := selectBestInstance(ctx, sys, src, rawManifest, mimeType, opts.selectPrefer, opts.retryOpts)
+		if err != nil {
+			return err
+		}
+		if instance != "" {
+			src = &listInstanceSource{ImageSource: src, ref: listInstanceReference{ImageReference: src.Reference(), instance: instance}}
+			if err := retry.IfNecessary(ctx, func() error {
+				rawManifest, mimeType, err = src.GetManifest(ctx, nil)
+				return err
+			}, opts.retryOpts); err != nil {
+				return fmt.Errorf("Error retrieving manifest for image %s: %w", instance, err)
+			}
+		}
+	} else if opts.osVersion != "" {
+		instance, _, err := selectOSVersionInstance(sys, rawManifest, mimeType, opts.osVersion)
+		if err != nil {
+			return err
+		}
+		if instance != "" {
+			src = &listInstanceSource{ImageSource: src, ref: listInstanceReference{ImageReference: src.Reference(), instance: instance}}
+			if err := retry.IfNecessary(ctx, func() error {
+				rawManifest, mimeType, err = src.GetManifest(ctx, nil)
+				return err
+			}, opts.retryOpts); err != nil {
+				return fmt.Errorf("Error retrieving manifest for image %s: %w", instance, err)
+			}
+		}
+	} else if !opts.localPlatform { // --local-platform uses the standard matching rules
+		if err := adjustVariantChoice(sys, rawManifest, mimeType); err != nil {
+			return err
+		}
+	}
 	img, err := image.FromUnparsedImage(ctx, sys, image.UnparsedInstance(src, nil))
 	if err != nil {
 		return fmt.Errorf("Error parsing manifest for image: %w", err)
 	}
 
+	if opts.countLayers {
+		count := len(img.LayerInfos())
+		if opts.format != "" {
+			return opts.writeOutput(stdout, count)
+		}
+		_, err := fmt.Fprintln(stdout, count)
+		return err
+	}
+	if opts.countFiles {
+		return opts.writeFileCount(ctx, stdout, src, img)
+	}
+
 	if opts.config && opts.raw {
 		var configBlob []byte
 		if err := retry.IfNecessary(ctx, func() error {
@@ -135,12 +477,12 @@ func (opts *inspectOptions) run(args []string, stdout io.Writer) (retErr error)
 		}, opts.retryOpts); err != nil {
 			return fmt.Errorf("Error reading configuration blob: %w", err)
 		}
-		_, err = stdout.Write(configBlob)
+		err = opts.writeRawOutput(stdout, configBlob)
 		if err != nil {
 			return fmt.Errorf("Error writing configuration blob to standard output: %w", err)
 		}
 		return nil
-	} else if opts.config {
+	} else if opts.config || opts.runtimeConfig {
 		var config *v1.Image
 		if err := retry.IfNecessary(ctx, func() error {
 			config, err = img.OCIConfig(ctx)
@@ -148,6 +490,9 @@ func (opts *inspectOptions) run(args []string, stdout io.Writer) (retErr error)
 		}, opts.retryOpts); err != nil {
 			return fmt.Errorf("Error reading OCI-formatted configuration data: %w", err)
 		}
+		if opts.runtimeConfig {
+			return opts.writeOutput(stdout, runtimeConfig(config))
+		}
 		if err := opts.writeOutput(stdout, config); err != nil {
 			return fmt.Errorf("Error writing OCI-formatted configuration data to standard output: %w", err)
 		}
@@ -175,6 +520,26 @@ func (opts *inspectOptions) run(args []string, stdout io.Writer) (retErr error)
 		LayersData:    imgInspect.LayersData,
 		Env:           imgInspect.Env,
 	}
+	if opts.fetchMetadata {
+		outputData.Fetched = &fetched
+	}
+	if sizeResolver != nil {
+		blobs := make([]types.BlobInfo, len(outputData.LayersData))
+		for i, layer := range outputData.LayersData {
+			blobs[i] = types.BlobInfo{Digest: layer.Digest, Size: layer.Size}
+		}
+		blobs, err = sizeResolver.resolve(ctx, blobs)
+		if err != nil {
+			return err
+		}
+		for i := range outputData.LayersData {
+			outputData.LayersData[i].Size = blobs[i].Size
+		}
+	}
+	if opts.normalize {
+		platform := normalizePlatform(v1.Platform{OS: imgInspect.Os, Architecture: imgInspect.Architecture, Variant: imgInspect.Variant})
+		outputData.Os, outputData.Architecture, outputData.Variant = platform.OS, platform.Architecture, platform.Variant
+	}
 	outputData.Digest, err = manifest.Digest(rawManifest)
 	if err != nil {
 		return fmt.Errorf("Error computing manifest digest: %w", err)
@@ -182,6 +547,23 @@ func (opts *inspectOptions) run(args []string, stdout io.Writer) (retErr error)
 	if dockerRef := img.Reference().DockerReference(); dockerRef != nil {
 		outputData.Name = dockerRef.Name()
 	}
+	if img.Reference().Transport() == tarball.Transport {
+		// The layers may be compressed, so report the digests of the uncompressed layers the transport has computed as well.
+		config, err := img.OCIConfig(ctx)
+		if err != nil {
+			return fmt.Errorf("Error reading OCI-formatted configuration data: %w", err)
+		}
+		outputData.DiffIDs = config.RootFS.DiffIDs
+	}
+	if opts.fetchMetadata && img.Reference().Transport() == docker.Transport && !manifestFromCache {
+		// This is an extra request, so only try once, and don't fail the inspect if the registry does not cooperate.
+		registryDigest, err := docker.GetDigest(ctx, sys, img.Reference())
+		if err != nil {
+			logrus.Debugf("Error reading the manifest digest reported by the registry: %v", err)
+		} else {
+			outputData.RegistryDigest = registryDigest
+		}
+	}
 	if !opts.doNotListTags && img.Reference().Transport() == docker.Transport {
 		sys, err := opts.image.newSystemContext()
 		if err != nil {
@@ -214,9 +596,220 @@ func (opts *inspectOptions) run(args []string, stdout io.Writer) (retErr error)
 			logrus.Warnf("Registry disallows tag list retrieval; skipping")
 		}
 	}
+	if opts.applyPolicy {
+		outputData.PolicyResult, err = evaluatePolicy(ctx, opts.global, src)
+		if err != nil {
+			return err
+		}
+	}
+	if opts.storageInfo {
+		outputData.StorageInfo, err = storageInfo(imageName)
+		if err != nil {
+			return err
+		}
+	}
 	return opts.writeOutput(stdout, outputData)
 }
 
+// evaluatePolicy evaluates the signature verification policy specified by global for the image in src, as skopeo copy would.
+func evaluatePolicy(ctx context.Context, global *globalOptions, src types.ImageSource) (_ *inspect.PolicyResult, retErr error) {
+	policyContext, err := global.getPolicyContext()
+	if err != nil {
+		return nil, fmt.Errorf("Error loading trust policy: %w", err)
+	}
+	defer func() {
+		if err := policyContext.Destroy(); err != nil {
+			retErr = noteCloseFailure(retErr, "tearing down policy context", err)
+		}
+	}()
+	allowed, err := policyContext.IsRunningImageAllowed(ctx, image.UnparsedInstance(src, nil))
+	if !allowed || err != nil { // Be paranoid and fail if either return value indicates so.
+		if err == nil {
+			err = errors.New("the image is not allowed by policy")
+		}
+		return &inspect.PolicyResult{Result: "fail", Reasons: []string{err.Error()}}, nil
+	}
+	return &inspect.PolicyResult{Result: "pass"}, nil
+}
+
+// architectures returns the unique architectures of the image, or of the images in the manifest list, in rawManifest read from src,
+// in the order they first appear. If normalize, the architectures are normalized using normalizePlatform.
+func architectures(ctx context.Context, sys *types.SystemContext, src types.ImageSource, rawManifest []byte, mimeType string,
+	normalize bool, retryOpts *retry.Options) ([]string, error) {
+	res := []string{}
+	seen := map[string]struct{}{}
+	add := func(arch string) {
+		if normalize && arch != "" {
+			arch = normalizePlatform(v1.Platform{Architecture: arch}).Architecture
+		}
+		if _, ok := seen[arch]; !ok && arch != "" {
+			seen[arch] = struct{}{}
+			res = append(res, arch)
+		}
+	}
+
+	if manifest.MIMETypeIsMultiImage(manifest.NormalizedMIMEType(mimeType)) {
+		list, err := manifest.ListFromBlob(rawManifest, mimeType)
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing manifest list: %w", err)
+		}
+		for _, instanceDigest := range list.Instances() {
+			instance, err := list.Instance(instanceDigest)
+			if err != nil {
+				return nil, err
+			}
+			if instance.ReadOnly.Platform != nil {
+				add(instance.ReadOnly.Platform.Architecture)
+			}
+		}
+		return res, nil
+	}
+
+	img, err := image.FromUnparsedImage(ctx, sys, image.UnparsedInstance(src, nil))
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing manifest for image: %w", err)
+	}
+	var config *v1.Image
+	if err := retry.IfNecessary(ctx, func() error {
+		config, err = img.OCIConfig(ctx)
+		return err
+	}, retryOpts); err != nil {
+		return nil, fmt.Errorf("Error reading OCI-formatted configuration data: %w", err)
+	}
+	add(config.Architecture)
+	return res, nil
+}
+
+// signatureVerificationPolicy returns a policy which requires a signature made by the public key at keyPath,
+// claiming identity if not empty, or the identity of the verified image otherwise.
+func signatureVerificationPolicy(keyPath, identity string) (*signature.Policy, error) {
+	keyData, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading public key: %w", err)
+	}
+	signedIdentity := signature.NewPRMMatchRepoDigestOrExact()
+	if identity != "" {
+		named, err := reference.ParseNormalizedNamed(identity)
+		if err != nil {
+			return nil, fmt.Errorf("parsing --verify-identity %q: %w", identity, err)
+		}
+		if reference.IsNameOnly(named) {
+			signedIdentity, err = signature.NewPRMExactRepository(named.String())
+		} else {
+			signedIdentity, err = signature.NewPRMExactReference(named.String())
+		}
+		if err != nil {
+			return nil, fmt.Errorf("using --verify-identity %q: %w", identity, err)
+		}
+	}
+
+	var requirement signature.PolicyRequirement
+	if block, _ := pem.Decode(keyData); block != nil && block.Type == "PUBLIC KEY" {
+		requirement, err = signature.NewPRSigstoreSignedKeyData(keyData, signedIdentity)
+	} else { // Assume a GPG keyring
+		requirement, err = signature.NewPRSignedByKeyData(signature.SBKeyTypeGPGKeys, keyData, signedIdentity)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &signature.Policy{Default: signature.PolicyRequirements{requirement}}, nil
+}
+
+// verifySignatures verifies that src, the top-level manifest of it if it is a list, is accepted by policy,
+// and writes the result to stdout.
+func verifySignatures(ctx context.Context, policy *signature.Policy, src types.ImageSource, stdout io.Writer) (retErr error) {
+	policyContext, err := signature.NewPolicyContext(policy)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := policyContext.Destroy(); err != nil {
+			retErr = noteCloseFailure(retErr, "tearing down policy context", err)
+		}
+	}()
+	if _, err := policyContext.IsRunningImageAllowed(ctx, image.UnparsedInstance(src, nil)); err != nil {
+		return fmt.Errorf("Signature verification failed: %w", err)
+	}
+	_, err = fmt.Fprintln(stdout, "Signature verification succeeded")
+	return err
+}
+
+// writeBlob writes the blob with blobDigest from src, which has rawManifest with mimeType, to opts.blobOutput or stdout,
+// verifying its contents.
+// Unless opts.anyBlob, the blob must be a config or layer of the image, or of any image in the list.
+func (opts *inspectOptions) writeBlob(ctx context.Context, sys *types.SystemContext, src types.ImageSource, rawManifest []byte, mimeType string,
+	blobDigest digest.Digest, stdout io.Writer) (retErr error) {
+	info := types.BlobInfo{Digest: blobDigest, Size: -1}
+	if !opts.anyBlob {
+		instances := []*digest.Digest{nil}
+		if manifest.MIMETypeIsMultiImage(manifest.NormalizedMIMEType(mimeType)) {
+			list, err := manifest.ListFromBlob(rawManifest, mimeType)
+			if err != nil {
+				return fmt.Errorf("Error parsing manifest list: %w", err)
+			}
+			instances = []*digest.Digest{}
+			for _, instance := range list.Instances() {
+				instance := instance
+				instances = append(instances, &instance)
+			}
+		}
+		blobs, err := uniqueImageBlobs(ctx, sys, src, instances, opts.retryOpts)
+		if err != nil {
+			return err
+		}
+		found := false
+		for _, blob := range blobs {
+			if blob.Digest == blobDigest {
+				info = blob
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("Blob %s is not referenced by the image, use --any-blob to fetch it anyway", blobDigest)
+		}
+	}
+
+	var reader io.ReadCloser
+	if err := retry.IfNecessary(ctx, func() error {
+		var err error
+		reader, _, err = src.GetBlob(ctx, info, none.NoCache)
+		return err
+	}, opts.retryOpts); err != nil {
+		return fmt.Errorf("Error fetching blob %s: %w", blobDigest, err)
+	}
+	defer reader.Close()
+
+	output := stdout
+	if opts.blobOutput != "" {
+		file, err := os.Create(opts.blobOutput)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := file.Close(); err != nil {
+				retErr = noteCloseFailure(retErr, "closing output file", err)
+			}
+			if retErr != nil {
+				os.Remove(opts.blobOutput)
+			}
+		}()
+		output = file
+	}
+	verifier := blobDigest.Verifier()
+	size, err := io.Copy(output, io.TeeReader(reader, verifier))
+	if err != nil {
+		return fmt.Errorf("Error writing blob %s: %w", blobDigest, err)
+	}
+	if info.Size != -1 && size != info.Size {
+		return fmt.Errorf("Blob %s has %d bytes, expected %d", blobDigest, size, info.Size)
+	}
+	if !verifier.Verified() {
+		return fmt.Errorf("Blob %s does not match its digest", blobDigest)
+	}
+	return nil
+}
+
 // writeOutput writes data depending on opts.format to stdout
 func (opts *inspectOptions) writeOutput(stdout io.Writer, data any) error {
 	if report.IsJSON(opts.format) || opts.format == "" {
@@ -234,3 +827,47 @@ func (opts *inspectOptions) writeOutput(stdout io.Writer, data any) error {
 	defer rpt.Flush()
 	return rpt.Execute([]any{data})
 }
+
+// writeFileCount reads all layers of img from src, and writes the --count-files output to stdout.
+func (opts *inspectOptions) writeFileCount(ctx context.Context, stdout io.Writer, src types.ImageSource, img types.Image) error {
+	if opts.rawCount {
+		count, err := countFilesRaw(ctx, src, img, opts.retryOpts)
+		if err != nil {
+			return err
+		}
+		if opts.format != "" {
+			return opts.writeOutput(stdout, count)
+		}
+		for _, layer := range count.Layers {
+			if _, err := fmt.Fprintf(stdout, "%s %d files, %d bytes\n", layer.Digest, layer.Files, layer.Size); err != nil {
+				return err
+			}
+		}
+		_, err = fmt.Fprintf(stdout, "total %d files, %d bytes\n", count.Total.Files, count.Total.Size)
+		return err
+	}
+	count, err := countFiles(ctx, src, img, opts.retryOpts)
+	if err != nil {
+		return err
+	}
+	if opts.format != "" {
+		return opts.writeOutput(stdout, count)
+	}
+	_, err = fmt.Fprintf(stdout, "%d files, %d bytes\n", count.Files, count.Size)
+	return err
+}
+
+// writeRawOutput writes data, a raw manifest or config blob, to stdout; it is reformatted if opts.pretty.
+func (opts *inspectOptions) writeRawOutput(stdout io.Writer, data []byte) error {
+	if !opts.pretty {
+		_, err := stdout.Write(data)
+		return err
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, data, "", "    "); err != nil {
+		return fmt.Errorf("pretty-printing JSON: %w", err)
+	}
+	buf.WriteByte('\n')
+	_, err := buf.WriteTo(stdout)
+	return err
+}
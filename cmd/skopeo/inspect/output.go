@@ -19,7 +19,69 @@ type Output struct {
 	Labels        map[string]string
 	Architecture  string
 	Os            string
-	Layers        []string
-	LayersData    []types.ImageInspectLayer
-	Env           []string
+	// Variant is only set with (skopeo inspect --normalize-platform).
+	Variant    string `json:",omitempty"`
+	Layers     []string
+	LayersData []types.ImageInspectLayer
+	// DiffIDs are the digests of the uncompressed layers, for tarball: images only.
+	DiffIDs []digest.Digest `json:",omitempty"`
+	Env     []string
+	// Fetched is the time the manifest was retrieved; only set with (skopeo inspect --fetch-metadata).
+	Fetched *time.Time `json:",omitempty"`
+	// RegistryDigest is the manifest digest reported by the registry for the reference (Docker-Content-Digest), for docker:// references only;
+	// only set with (skopeo inspect --fetch-metadata).
+	RegistryDigest digest.Digest `json:",omitempty"`
+	// PolicyResult is the result of evaluating the signature verification policy; only set with (skopeo inspect --apply-policy).
+	PolicyResult *PolicyResult `json:",omitempty"`
+	// StorageInfo describes how the image is stored; only set with (skopeo inspect --storage-info).
+	StorageInfo *StorageInfo `json:",omitempty"`
+}
+
+// StorageInfo describes how an image is stored in containers-storage.
+type StorageInfo struct {
+	Driver     string             // The storage driver, e.g. "overlay"
+	Composefs  bool               // At least one layer is stored using composefs
+	ImageID    string             // The ID of the image in the store
+	LayerCount int                // The number of layers of the image in the store
+	DiskSize   int64              // The sum of DiskSize of all layers
+	Layers     []StorageLayerInfo // Base layer first
+}
+
+// StorageLayerInfo describes how a layer is stored in containers-storage.
+type StorageLayerInfo struct {
+	ID        string
+	Digest    digest.Digest `json:",omitempty"` // The digest of the uncompressed layer, if known
+	DiskSize  int64         // The disk usage of the layer files, or the size recorded by containers-storage if the driver does not expose them
+	Composefs bool          // The layer is stored using composefs; DiskSize includes the composefs blob
+}
+
+// PolicyResult is the result of evaluating the signature verification policy for an image.
+type PolicyResult struct {
+	Result  string   // "pass" or "fail"
+	Reasons []string `json:",omitempty"` // Why the image was rejected, if Result is "fail"
+}
+
+// RuntimeConfig is the output format of (skopeo inspect --runtime-config): the configuration of a container
+// started from the image, normalized from the image config.
+type RuntimeConfig struct {
+	Entrypoint   []string
+	Cmd          []string
+	Command      []string // The process started by default: Entrypoint followed by Cmd
+	ShellForm    bool     // Command runs a shell with a command string, as created by the shell form of a Dockerfile instruction
+	Env          []string
+	User         string   // Empty if the default user is used
+	WorkingDir   string   // "/" if not set in the image config
+	ExposedPorts []string // Sorted, in PORT/PROTOCOL form
+}
+
+// FileStat is the output format of (skopeo inspect --stat): the metadata of a file in the root filesystem of a containers-storage image.
+type FileStat struct {
+	Path       string
+	Type       string // "file", "directory", "symlink", "char-device", "block-device", "fifo" or "socket"
+	Mode       string // The permission bits, including the setuid, setgid and sticky bits, in octal
+	Size       int64
+	UID        uint32
+	GID        uint32
+	ModTime    time.Time
+	LinkTarget string `json:",omitempty"` // The target of a symbolic link
 }
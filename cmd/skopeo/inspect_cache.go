@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sirupsen/logrus"
+)
+
+// inspectCacheSource is a types.ImageSource which serves manifests and config blobs from the --cache-dir of inspect
+// when possible, and only opens the image source of ref when it needs data which is not in the cache.
+//
+// The cache contains:
+//   - blobs/<algorithm>/<encoded>: manifests and config blobs, by digest; they are verified on every use, and never expire.
+//   - references/<hash>.json: the digest of the top-level manifest of a reference without a digest, valid for ttl.
+type inspectCacheSource struct {
+	ref types.ImageReference
+	sys *types.SystemContext
+	dir string
+	ttl time.Duration
+
+	src types.ImageSource // The image source of ref, or nil if it has not been needed yet
+
+	// Set by GetManifest(…, nil):
+	manifestFetched   time.Time // When the top-level manifest was read from ref
+	manifestFromCache bool      // The top-level manifest was served from the cache
+}
+
+// inspectCacheReferenceEntry is the contents of references/<hash>.json.
+type inspectCacheReferenceEntry struct {
+	Reference string        `json:"reference"`
+	Digest    digest.Digest `json:"digest"`
+	Fetched   time.Time     `json:"fetched"`
+}
+
+// newInspectCacheSource returns an inspectCacheSource for ref, using the cache in dir, and sys to open the image source if necessary.
+// The caller must call .Close() on the returned ImageSource.
+func newInspectCacheSource(ref types.ImageReference, sys *types.SystemContext, dir string, ttl time.Duration) *inspectCacheSource {
+	return &inspectCacheSource{ref: ref, sys: sys, dir: dir, ttl: ttl}
+}
+
+// Reference returns the reference used to set up this source, _as specified by the user_
+// (not as the image itself, or its underlying storage, claims).  This can be used e.g. to determine which public keys are trusted for this image.
+func (s *inspectCacheSource) Reference() types.ImageReference {
+	return s.ref
+}
+
+// Close removes resources associated with an initialized ImageSource, if any.
+func (s *inspectCacheSource) Close() error {
+	if s.src == nil {
+		return nil
+	}
+	return s.src.Close()
+}
+
+// underlyingSource returns the image source of ref, opening it if necessary.
+func (s *inspectCacheSource) underlyingSource(ctx context.Context) (types.ImageSource, error) {
+	if s.src == nil {
+		src, err := s.ref.NewImageSource(ctx, s.sys)
+		if err != nil {
+			return nil, err
+		}
+		s.src = src
+	}
+	return s.src, nil
+}
+
+// GetManifest returns the image's manifest along with its MIME type (which may be empty when it can't be determined but the manifest is available).
+// It may use a remote (= slow) service.
+// If instanceDigest is not nil, it contains a digest of the specific manifest instance to retrieve (when the primary manifest is a manifest list);
+// this never happens if the primary manifest is not a manifest list (e.g. if the source never returns manifest lists).
+func (s *inspectCacheSource) GetManifest(ctx context.Context, instanceDigest *digest.Digest) ([]byte, string, error) {
+	if instanceDigest != nil {
+		if res, _, ok := s.cachedBlob(*instanceDigest); ok {
+			return res, manifest.GuessMIMEType(res), nil
+		}
+		return s.fetchManifest(ctx, instanceDigest, *instanceDigest)
+	}
+
+	var expectedDigest digest.Digest // Only set if the reference contains the digest
+	if canonical, ok := s.ref.DockerReference().(reference.Canonical); ok {
+		expectedDigest = canonical.Digest()
+		if res, fetched, ok := s.cachedBlob(expectedDigest); ok {
+			s.manifestFetched, s.manifestFromCache = fetched, true
+			return res, manifest.GuessMIMEType(res), nil
+		}
+	} else if entry, ok := s.cachedReference(); ok {
+		if res, _, ok := s.cachedBlob(entry.Digest); ok {
+			s.manifestFetched, s.manifestFromCache = entry.Fetched, true
+			return res, manifest.GuessMIMEType(res), nil
+		}
+	}
+
+	fetched := time.Now()
+	res, mimeType, err := s.fetchManifest(ctx, nil, expectedDigest)
+	if err != nil {
+		return nil, "", err
+	}
+	s.manifestFetched, s.manifestFromCache = fetched, false
+	if expectedDigest == "" {
+		manifestDigest, err := manifest.Digest(res)
+		if err != nil {
+			return nil, "", err
+		}
+		s.storeReference(inspectCacheReferenceEntry{
+			Reference: transportReferenceString(s.ref),
+			Digest:    manifestDigest,
+			Fetched:   fetched.UTC(),
+		})
+	}
+	return res, mimeType, nil
+}
+
+// fetchManifest reads the manifest specified by instanceDigest from the underlying source, and stores it in the cache.
+// If expectedDigest is set, the manifest must match it.
+func (s *inspectCacheSource) fetchManifest(ctx context.Context, instanceDigest *digest.Digest, expectedDigest digest.Digest) ([]byte, string, error) {
+	src, err := s.underlyingSource(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	res, mimeType, err := src.GetManifest(ctx, instanceDigest)
+	if err != nil {
+		return nil, "", err
+	}
+	manifestDigest := expectedDigest
+	if manifestDigest != "" {
+		matches, err := manifest.MatchesDigest(res, manifestDigest)
+		if err != nil {
+			return nil, "", err
+		}
+		if !matches {
+			return nil, "", fmt.Errorf("manifest does not match expected digest %s", manifestDigest)
+		}
+	} else {
+		manifestDigest, err = manifest.Digest(res)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	s.storeBlob(manifestDigest, res)
+	return res, mimeType, nil
+}
+
+// HasThreadSafeGetBlob indicates whether GetBlob can be executed concurrently.
+func (s *inspectCacheSource) HasThreadSafeGetBlob() bool {
+	return false
+}
+
+// GetBlob returns a stream for the specified blob, and the blob’s size (or -1 if unknown).
+// The Digest field in BlobInfo is guaranteed to be provided, Size may be -1 and MediaType may be optionally provided.
+// May update BlobInfoCache, preferably after it knows for certain that a blob truly exists at a specific location.
+//
+// Config blobs are served from, and stored in, the cache; other blobs are always read from the underlying source.
+func (s *inspectCacheSource) GetBlob(ctx context.Context, info types.BlobInfo, cache types.BlobInfoCache) (io.ReadCloser, int64, error) {
+	isConfig := info.MediaType == manifest.DockerV2Schema2ConfigMediaType || info.MediaType == imgspecv1.MediaTypeImageConfig
+	if isConfig {
+		if res, _, ok := s.cachedBlob(info.Digest); ok {
+			return io.NopCloser(bytes.NewReader(res)), int64(len(res)), nil
+		}
+	}
+	src, err := s.underlyingSource(ctx)
+	if err != nil {
+		return nil, -1, err
+	}
+	stream, size, err := src.GetBlob(ctx, info, cache)
+	if err != nil || !isConfig {
+		return stream, size, err
+	}
+	defer stream.Close()
+	res, err := io.ReadAll(stream)
+	if err != nil {
+		return nil, -1, err
+	}
+	if info.Digest.Validate() == nil && info.Digest.Algorithm().FromBytes(res) == info.Digest {
+		s.storeBlob(info.Digest, res)
+	}
+	// If the blob does not match, it is not cached; the consumer detects the mismatch.
+	return io.NopCloser(bytes.NewReader(res)), int64(len(res)), nil
+}
+
+// GetSignatures returns the image's signatures.  It may use a remote (= slow) service.
+// If instanceDigest is not nil, it contains a digest of the specific manifest instance to retrieve signatures for
+// (when the primary manifest is a manifest list); this never happens if the primary manifest is not a manifest list
+// (e.g. if the source never returns manifest lists).
+func (s *inspectCacheSource) GetSignatures(ctx context.Context, instanceDigest *digest.Digest) ([][]byte, error) {
+	src, err := s.underlyingSource(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return src.GetSignatures(ctx, instanceDigest)
+}
+
+// LayerInfosForCopy returns either nil (meaning the values in the manifest are fine), or updated values for the layer
+// blobsums that are listed in the image's manifest.
+func (s *inspectCacheSource) LayerInfosForCopy(ctx context.Context, instanceDigest *digest.Digest) ([]types.BlobInfo, error) {
+	src, err := s.underlyingSource(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return src.LayerInfosForCopy(ctx, instanceDigest)
+}
+
+// transportReferenceString returns a string identifying ref, including its transport.
+func transportReferenceString(ref types.ImageReference) string {
+	return ref.Transport().Name() + ":" + ref.StringWithinTransport()
+}
+
+// blobPath returns the path of the cache file for blobDigest.
+func (s *inspectCacheSource) blobPath(blobDigest digest.Digest) string {
+	return filepath.Join(s.dir, "blobs", blobDigest.Algorithm().String(), blobDigest.Encoded())
+}
+
+// referencePath returns the path of the cache file for s.ref.
+func (s *inspectCacheSource) referencePath() string {
+	hash := sha256.Sum256([]byte(transportReferenceString(s.ref)))
+	return filepath.Join(s.dir, "references", hex.EncodeToString(hash[:])+".json")
+}
+
+// cachedBlob returns the contents of the cached blob with blobDigest, and the time it was stored, if it exists and matches the digest.
+func (s *inspectCacheSource) cachedBlob(blobDigest digest.Digest) ([]byte, time.Time, bool) {
+	if err := blobDigest.Validate(); err != nil {
+		return nil, time.Time{}, false
+	}
+	path := s.blobPath(blobDigest)
+	res, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			logrus.Debugf("Ignoring inspect cache file %q: %v", path, err)
+		}
+		return nil, time.Time{}, false
+	}
+	if blobDigest.Algorithm().FromBytes(res) != blobDigest {
+		logrus.Debugf("Ignoring inspect cache file %q: contents do not match the digest", path)
+		return nil, time.Time{}, false
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, time.Time{}, false
+	}
+	logrus.Debugf("Using %s from the inspect cache", blobDigest)
+	return res, fi.ModTime(), true
+}
+
+// cachedReference returns the cache entry for s.ref, if it exists and has not expired.
+func (s *inspectCacheSource) cachedReference() (inspectCacheReferenceEntry, bool) {
+	path := s.referencePath()
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			logrus.Debugf("Ignoring inspect cache file %q: %v", path, err)
+		}
+		return inspectCacheReferenceEntry{}, false
+	}
+	var entry inspectCacheReferenceEntry
+	if err := json.Unmarshal(contents, &entry); err != nil {
+		logrus.Debugf("Ignoring inspect cache file %q: %v", path, err)
+		return inspectCacheReferenceEntry{}, false
+	}
+	if entry.Reference != transportReferenceString(s.ref) { // A hash collision is very unlikely, but make sure anyway.
+		return inspectCacheReferenceEntry{}, false
+	}
+	if age := time.Since(entry.Fetched); age < 0 || age >= s.ttl {
+		logrus.Debugf("Inspect cache entry for %s has expired", entry.Reference)
+		return inspectCacheReferenceEntry{}, false
+	}
+	return entry, true
+}
+
+// storeBlob stores contents as the blob with blobDigest in the cache.
+// Failures are only logged; they don't prevent inspecting the image.
+func (s *inspectCacheSource) storeBlob(blobDigest digest.Digest, contents []byte) {
+	if err := writeInspectCacheFile(s.blobPath(blobDigest), contents); err != nil {
+		logrus.Warnf("Error writing to the inspect cache: %v", err)
+	}
+}
+
+// storeReference stores entry as the cache entry for s.ref.
+// Failures are only logged; they don't prevent inspecting the image.
+func (s *inspectCacheSource) storeReference(entry inspectCacheReferenceEntry) {
+	contents, err := json.Marshal(entry)
+	if err == nil {
+		err = writeInspectCacheFile(s.referencePath(), contents)
+	}
+	if err != nil {
+		logrus.Warnf("Error writing to the inspect cache: %v", err)
+	}
+}
+
+// writeInspectCacheFile atomically replaces the file at path with contents, creating parent directories as necessary.
+// The cache may contain data of private images, so it is only accessible to the current user.
+func writeInspectCacheFile(path string, contents []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-"+filepath.Base(path)+"-")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	_, err = tmp.Write(contents)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("writing %q: %w", path, err)
+	}
+	return nil
+}
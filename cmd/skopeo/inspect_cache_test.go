@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/skopeo/cmd/skopeo/inspect"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInspectCacheDir(t *testing.T) {
+	imageDir := testDirImageWithBlobs(t)
+	cacheDir := t.TempDir()
+
+	out, err := runSkopeo("inspect", "--cache-dir", cacheDir, "--fetch-metadata", "dir:"+imageDir)
+	require.NoError(t, err)
+	var output inspect.Output
+	err = json.Unmarshal([]byte(out), &output)
+	require.NoError(t, err)
+	config, err := runSkopeo("inspect", "--cache-dir", cacheDir, "--config", "--raw", "dir:"+imageDir)
+	require.NoError(t, err)
+
+	// Remove the image; everything inspect needs is served from the cache.
+	err = os.RemoveAll(imageDir)
+	require.NoError(t, err)
+	out2, err := runSkopeo("inspect", "--cache-dir", cacheDir, "--fetch-metadata", "dir:"+imageDir)
+	require.NoError(t, err)
+	var output2 inspect.Output
+	err = json.Unmarshal([]byte(out2), &output2)
+	require.NoError(t, err)
+	assert.Equal(t, output, output2) // Including Fetched, the time the manifest was originally read
+	config2, err := runSkopeo("inspect", "--cache-dir", cacheDir, "--config", "--raw", "dir:"+imageDir)
+	require.NoError(t, err)
+	assert.Equal(t, config, config2)
+
+	// An expired entry is not used.
+	out, err = runSkopeo("inspect", "--cache-dir", cacheDir, "--cache-ttl", "0s", "dir:"+imageDir)
+	assertTestFailed(t, out, err, "no such file or directory")
+
+	// A corrupt blob is not used.
+	blobsDir := filepath.Join(cacheDir, "blobs", "sha256")
+	err = os.WriteFile(filepath.Join(blobsDir, output.Digest.Encoded()), []byte("corrupt"), 0o600)
+	require.NoError(t, err)
+	out, err = runSkopeo("inspect", "--cache-dir", cacheDir, "dir:"+imageDir)
+	assertTestFailed(t, out, err, "no such file or directory")
+
+	out, err = runSkopeo("inspect", "--cache-dir", cacheDir, "--cache-ttl", "-1s", "dir:"+imageDir)
+	assertTestFailed(t, out, err, "must not be negative")
+}
+
+func TestInspectCacheDirLayersNotCached(t *testing.T) {
+	imageDir := testDirImageWithBlobs(t)
+	cacheDir := t.TempDir()
+	layerDigest := digest.FromString("not really a layer")
+
+	out, err := runSkopeo("inspect", "--cache-dir", cacheDir, "--fetch-blob", layerDigest.String(), "dir:"+imageDir)
+	require.NoError(t, err)
+	assert.Equal(t, "not really a layer", out)
+	_, err = os.Stat(filepath.Join(cacheDir, "blobs", "sha256", layerDigest.Encoded()))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
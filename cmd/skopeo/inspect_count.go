@@ -0,0 +1,179 @@
+package main
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/containers/common/pkg/retry"
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
+	"github.com/containers/image/v5/pkg/compression"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+)
+
+// fileCount is the output of inspect --count-files.
+type fileCount struct {
+	Files int64 // Number of entries (files, directories, links, …)
+	Size  int64 // Total uncompressed size of regular files
+}
+
+// layerFileCount is the file count of a single layer, as a part of the output of inspect --count-files --raw-count.
+type layerFileCount struct {
+	Digest digest.Digest
+	fileCount
+}
+
+// rawFileCount is the output of inspect --count-files --raw-count.
+type rawFileCount struct {
+	Layers []layerFileCount
+	Total  fileCount
+}
+
+// layerEntry is a tar entry in a layer, as a part of a merged filesystem.
+type layerEntry struct {
+	isDir bool
+	size  int64
+}
+
+// mergedFilesystem tracks the entries of a filesystem created by applying layers in order.
+type mergedFilesystem map[string]layerEntry
+
+// removeChildren removes all entries below dir.
+func (fs mergedFilesystem) removeChildren(dir string) {
+	prefix := dir + "/"
+	if dir == "." {
+		prefix = ""
+	}
+	for p := range fs {
+		if strings.HasPrefix(p, prefix) && p != "." {
+			delete(fs, p)
+		}
+	}
+}
+
+// remove removes the entry at p, and all entries below it.
+func (fs mergedFilesystem) remove(p string) {
+	if e, ok := fs[p]; ok {
+		delete(fs, p)
+		if e.isDir {
+			fs.removeChildren(p)
+		}
+	}
+}
+
+// applyLayer applies the entries of a layer, including whiteouts, to fs.
+// Whiteouts only hide entries of lower layers, so they are applied before the layer's other entries.
+func (fs mergedFilesystem) applyLayer(entries map[string]layerEntry, whiteouts, opaqueDirs []string) {
+	for _, dir := range opaqueDirs {
+		fs.removeChildren(dir)
+	}
+	for _, p := range whiteouts {
+		fs.remove(p)
+	}
+	for p, e := range entries {
+		if old, ok := fs[p]; ok && old.isDir && !e.isDir {
+			fs.removeChildren(p)
+		}
+		fs[p] = e
+	}
+}
+
+// count returns the number of entries in fs, and the total size of regular files.
+func (fs mergedFilesystem) count() fileCount {
+	res := fileCount{}
+	for _, e := range fs {
+		res.Files++
+		res.Size += e.size
+	}
+	return res
+}
+
+// countFiles reads all layers of img, and returns the number of entries and the total size of regular files in the
+// filesystem created by applying the layers.
+func countFiles(ctx context.Context, src types.ImageSource, img types.Image, retryOpts *retry.Options) (fileCount, error) {
+	fs := mergedFilesystem{}
+	for _, layer := range img.LayerInfos() {
+		var entries map[string]layerEntry
+		var whiteouts, opaqueDirs []string
+		if err := retry.IfNecessary(ctx, func() error {
+			entries, whiteouts, opaqueDirs = map[string]layerEntry{}, nil, nil
+			return readLayerEntries(ctx, src, layer, func(hdr *tar.Header) {
+				p := path.Clean("/" + hdr.Name)[1:]
+				if p == "" {
+					p = "."
+				}
+				dir, base := path.Split(p)
+				dir = path.Clean(dir)
+				switch {
+				case base == whiteoutOpaqueDir:
+					opaqueDirs = append(opaqueDirs, dir)
+				case strings.HasPrefix(base, whiteoutPrefix):
+					whiteouts = append(whiteouts, path.Join(dir, strings.TrimPrefix(base, whiteoutPrefix)))
+				default:
+					e := layerEntry{isDir: hdr.Typeflag == tar.TypeDir}
+					if hdr.Typeflag == tar.TypeReg {
+						e.size = hdr.Size
+					}
+					entries[p] = e
+				}
+			})
+		}, retryOpts); err != nil {
+			return fileCount{}, err
+		}
+		fs.applyLayer(entries, whiteouts, opaqueDirs)
+	}
+	return fs.count(), nil
+}
+
+// countFilesRaw reads all layers of img, and returns the number of entries and the total size of regular files
+// in each layer, ignoring whiteouts.
+func countFilesRaw(ctx context.Context, src types.ImageSource, img types.Image, retryOpts *retry.Options) (rawFileCount, error) {
+	res := rawFileCount{Layers: []layerFileCount{}}
+	for _, layer := range img.LayerInfos() {
+		var count fileCount
+		if err := retry.IfNecessary(ctx, func() error {
+			count = fileCount{}
+			return readLayerEntries(ctx, src, layer, func(hdr *tar.Header) {
+				count.Files++
+				if hdr.Typeflag == tar.TypeReg {
+					count.Size += hdr.Size
+				}
+			})
+		}, retryOpts); err != nil {
+			return rawFileCount{}, err
+		}
+		res.Layers = append(res.Layers, layerFileCount{Digest: layer.Digest, fileCount: count})
+		res.Total.Files += count.Files
+		res.Total.Size += count.Size
+	}
+	return res, nil
+}
+
+// readLayerEntries streams the layer from src, and calls fn for each tar header in it.
+func readLayerEntries(ctx context.Context, src types.ImageSource, layer types.BlobInfo, fn func(hdr *tar.Header)) error {
+	stream, _, err := src.GetBlob(ctx, layer, none.NoCache)
+	if err != nil {
+		return fmt.Errorf("Error reading layer %s: %w", layer.Digest, err)
+	}
+	defer stream.Close()
+	uncompressed, _, err := compression.AutoDecompress(stream)
+	if err != nil {
+		return fmt.Errorf("Error decompressing layer %s: %w", layer.Digest, err)
+	}
+	defer uncompressed.Close()
+	tr := tar.NewReader(uncompressed)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Error reading layer %s: %w", layer.Digest, err)
+		}
+		fn(hdr)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"archive/tar"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInspectCountFiles(t *testing.T) {
+	layer1 := testLayerTar(t,
+		tar.Header{Name: "./", Typeflag: tar.TypeDir, Mode: 0o755},
+		tar.Header{Name: "./usr/", Typeflag: tar.TypeDir, Mode: 0o755},
+		tar.Header{Name: "./usr/a", Typeflag: tar.TypeReg, Mode: 0o644},
+		tar.Header{Name: "./usr/b", Typeflag: tar.TypeReg, Mode: 0o644},
+		tar.Header{Name: "./etc/", Typeflag: tar.TypeDir, Mode: 0o755},
+		tar.Header{Name: "./etc/x", Typeflag: tar.TypeReg, Mode: 0o644},
+	)
+	layer2 := testLayerTar(t,
+		tar.Header{Name: "./usr/.wh.a", Typeflag: tar.TypeReg, Mode: 0o644},
+		tar.Header{Name: "./etc/y", Typeflag: tar.TypeReg, Mode: 0o644},
+		tar.Header{Name: "./etc/.wh..wh..opq", Typeflag: tar.TypeReg, Mode: 0o644},
+	)
+	config := []byte(`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers","diff_ids":[]}}`)
+	configDigest := digest.FromBytes(config)
+	layer1Digest, layer2Digest := digest.FromBytes(layer1), digest.FromBytes(layer2)
+	manifest := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json",` +
+		`"config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"` + configDigest.String() + `","size":` + strconv.Itoa(len(config)) + `},` +
+		`"layers":[{"mediaType":"application/vnd.oci.image.layer.v1.tar","digest":"` + layer1Digest.String() + `","size":` + strconv.Itoa(len(layer1)) + `},` +
+		`{"mediaType":"application/vnd.oci.image.layer.v1.tar","digest":"` + layer2Digest.String() + `","size":` + strconv.Itoa(len(layer2)) + `}]}`)
+	dir := testDirImage(t, manifest)
+	for d, contents := range map[digest.Digest][]byte{configDigest: config, layer1Digest: layer1, layer2Digest: layer2} {
+		err := os.WriteFile(filepath.Join(dir, d.Encoded()), contents, 0o644)
+		require.NoError(t, err)
+	}
+
+	out, err := runSkopeo("inspect", "--count-layers", "dir:"+dir)
+	require.NoError(t, err)
+	assert.Equal(t, "2\n", out)
+
+	// usr/a is deleted, and etc/x hidden by the opaque directory; ., usr, usr/b, etc and etc/y remain.
+	out, err = runSkopeo("inspect", "--count-files", "dir:"+dir)
+	require.NoError(t, err)
+	assert.Equal(t, "5 files, 14 bytes\n", out)
+
+	out, err = runSkopeo("inspect", "--count-files", "--format", "{{.Files}}", "dir:"+dir)
+	require.NoError(t, err)
+	assert.Equal(t, "5\n", out)
+
+	out, err = runSkopeo("inspect", "--count-files", "--raw-count", "dir:"+dir)
+	require.NoError(t, err)
+	assert.Equal(t, layer1Digest.String()+" 6 files, 21 bytes\n"+
+		layer2Digest.String()+" 3 files, 36 bytes\n"+
+		"total 9 files, 57 bytes\n", out)
+
+	out, err = runSkopeo("inspect", "--raw-count", "dir:"+dir)
+	assertTestFailed(t, out, err, "--raw-count requires --count-files")
+	out, err = runSkopeo("inspect", "--count-files", "--raw", "dir:"+dir)
+	assertTestFailed(t, out, err, "can not be used together with --raw")
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/containers/skopeo/cmd/skopeo/inspect"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"golang.org/x/exp/slices"
+)
+
+// shellFormPrefixes are the commands used by the shell form of Dockerfile instructions, by default.
+var shellFormPrefixes = [][]string{
+	{"/bin/sh", "-c"},
+	{"cmd", "/S", "/C"}, // Windows
+}
+
+// runtimeConfig returns the normalized runtime configuration of config.
+// All slices are non-nil, so that the JSON output always has the same structure.
+func runtimeConfig(config *v1.Image) inspect.RuntimeConfig {
+	c := config.Config
+	res := inspect.RuntimeConfig{
+		Entrypoint:   append([]string{}, c.Entrypoint...),
+		Cmd:          append([]string{}, c.Cmd...),
+		Env:          append([]string{}, c.Env...),
+		User:         c.User,
+		WorkingDir:   c.WorkingDir,
+		ExposedPorts: []string{},
+	}
+	res.Command = append(append([]string{}, res.Entrypoint...), res.Cmd...)
+	for _, prefix := range shellFormPrefixes {
+		if len(res.Command) > len(prefix) && slices.Equal(res.Command[:len(prefix)], prefix) {
+			res.ShellForm = true
+			break
+		}
+	}
+	if res.WorkingDir == "" {
+		res.WorkingDir = "/"
+	}
+	for port := range c.ExposedPorts {
+		if !strings.Contains(port, "/") {
+			port += "/tcp" // The default protocol, as in Dockerfile EXPOSE
+		}
+		res.ExposedPorts = append(res.ExposedPorts, port)
+	}
+	slices.Sort(res.ExposedPorts)
+	return res
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/containers/skopeo/cmd/skopeo/inspect"
+	digest "github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRuntimeConfig(t *testing.T) {
+	res := runtimeConfig(&v1.Image{Config: v1.ImageConfig{
+		Entrypoint:   []string{"/bin/sh", "-c", "exec server"},
+		Cmd:          []string{"--verbose"},
+		Env:          []string{"PATH=/usr/bin", "A=1"},
+		User:         "1000:1000",
+		WorkingDir:   "/srv",
+		ExposedPorts: map[string]struct{}{"8080/tcp": {}, "53/udp": {}, "443": {}},
+	}})
+	assert.Equal(t, inspect.RuntimeConfig{
+		Entrypoint:   []string{"/bin/sh", "-c", "exec server"},
+		Cmd:          []string{"--verbose"},
+		Command:      []string{"/bin/sh", "-c", "exec server", "--verbose"},
+		ShellForm:    true,
+		Env:          []string{"PATH=/usr/bin", "A=1"},
+		User:         "1000:1000",
+		WorkingDir:   "/srv",
+		ExposedPorts: []string{"443/tcp", "53/udp", "8080/tcp"},
+	}, res)
+
+	res = runtimeConfig(&v1.Image{Config: v1.ImageConfig{Cmd: []string{"/app", "-c"}}})
+	assert.Equal(t, inspect.RuntimeConfig{
+		Entrypoint:   []string{},
+		Cmd:          []string{"/app", "-c"},
+		Command:      []string{"/app", "-c"},
+		Env:          []string{},
+		WorkingDir:   "/",
+		ExposedPorts: []string{},
+	}, res)
+}
+
+func TestInspectRuntimeConfig(t *testing.T) {
+	config := []byte(`{"architecture":"amd64","os":"linux","config":{"Entrypoint":["/app"],"Cmd":["serve"],"ExposedPorts":{"80/tcp":{}}},` +
+		`"rootfs":{"type":"layers","diff_ids":[]}}`)
+	configDigest := digest.FromBytes(config)
+	dir := testDirImage(t, []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json",`+
+		`"config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"`+configDigest.String()+`","size":`+strconv.Itoa(len(config))+`},"layers":[]}`))
+	err := os.WriteFile(filepath.Join(dir, configDigest.Encoded()), config, 0o644)
+	require.NoError(t, err)
+
+	out, err := runSkopeo("inspect", "--runtime-config", "dir:"+dir)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"Entrypoint":["/app"],"Cmd":["serve"],"Command":["/app","serve"],"ShellForm":false,"Env":[],`+
+		`"User":"","WorkingDir":"/","ExposedPorts":["80/tcp"]}`, out)
+
+	out, err = runSkopeo("inspect", "--runtime-config", "--format", "{{.WorkingDir}}", "dir:"+dir)
+	require.NoError(t, err)
+	assert.Equal(t, "/\n", out)
+
+	out, err = runSkopeo("inspect", "--runtime-config", "--config", "dir:"+dir)
+	assertTestFailed(t, out, err, "can not be used together")
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path"
+	"strings"
+	"syscall"
+
+	"github.com/containers/image/v5/storage"
+	"github.com/containers/image/v5/transports"
+	securejoin "github.com/cyphar/filepath-securejoin"
+	"github.com/sirupsen/logrus"
+)
+
+// withMountedStorageImage mounts the root filesystem of imageName, a containers-storage: image in the default store, read-only,
+// and calls fn with the mount point; the image is unmounted before returning, also if fn fails.
+// If skopeo receives SIGINT or SIGTERM while the image is mounted, interrupted is closed, and the signal is otherwise ignored
+// until the image is unmounted, so that fn can stop, and the image is not left mounted.
+func withMountedStorageImage(imageName string, fn func(root string, interrupted <-chan struct{}) error) (retErr error) {
+	ref, err := storage.Transport.ParseReference(strings.TrimPrefix(imageName, storage.Transport.Name()+":"))
+	if err != nil {
+		return fmt.Errorf("Error parsing image name %q: %w", imageName, err)
+	}
+	_, img, err := storage.ResolveReference(ref)
+	if err != nil {
+		return fmt.Errorf("Error looking up %s: %w", transports.ImageName(ref), err)
+	}
+	store := storage.Transport.GetStoreIfSet() // --stat does not allow a store specification, so ref uses the default store
+	if store == nil {
+		return errors.New("internal error: the containers-storage: store is not initialized")
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	interrupted := make(chan struct{})
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case sig := <-signals:
+			logrus.Debugf("Received %s, stopping before unmounting the image", sig)
+			close(interrupted)
+		case <-done:
+		}
+	}()
+
+	root, err := store.MountImage(img.ID, nil, "")
+	if err != nil {
+		return fmt.Errorf("mounting image %s: %w", img.ID, err)
+	}
+	defer func() {
+		if _, err := store.UnmountImage(img.ID, false); err != nil {
+			retErr = noteCloseFailure(retErr, "unmounting image "+img.ID, err)
+		}
+	}()
+	return fn(root, interrupted)
+}
+
+// writeFileStat writes the metadata of opts.stat in the root filesystem of imageName, or its contents if opts.cat, to stdout.
+func (opts *inspectOptions) writeFileStat(imageName string, stdout io.Writer) error {
+	filePath := path.Clean(opts.stat)
+	return withMountedStorageImage(imageName, func(root string, interrupted <-chan struct{}) error {
+		if opts.cat {
+			return catImageFile(root, filePath, interrupted, stdout)
+		}
+		stat, err := statImageFile(root, filePath)
+		if err != nil {
+			return err
+		}
+		if opts.format != "" {
+			return opts.writeOutput(stdout, stat)
+		}
+		lines := []string{
+			"Path: " + stat.Path,
+			"Type: " + stat.Type,
+			"Mode: " + stat.Mode,
+			fmt.Sprintf("Size: %d", stat.Size),
+			fmt.Sprintf("UID: %d", stat.UID),
+			fmt.Sprintf("GID: %d", stat.GID),
+			"Modified: " + stat.ModTime.Format("2006-01-02 15:04:05 -0700 MST"),
+		}
+		if stat.Type == "symlink" {
+			lines = append(lines, "Target: "+stat.LinkTarget)
+		}
+		_, err = fmt.Fprintln(stdout, strings.Join(lines, "\n"))
+		return err
+	})
+}
+
+// catImageFile writes the contents of the regular file at filePath in root to stdout, following symbolic links within root.
+// If interrupted is closed, the file is closed, stopping the copy.
+func catImageFile(root, filePath string, interrupted <-chan struct{}, stdout io.Writer) error {
+	fullPath, err := securejoin.SecureJoin(root, filePath)
+	if err != nil {
+		return fmt.Errorf("resolving %s in the image: %w", filePath, err)
+	}
+	file, err := os.Open(fullPath)
+	if err != nil {
+		return fmt.Errorf("opening %s in the image: %w", filePath, err)
+	}
+	defer file.Close()
+	fi, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return fmt.Errorf("%s in the image is not a regular file", filePath)
+	}
+	copied := make(chan struct{})
+	defer close(copied)
+	go func() {
+		select {
+		case <-interrupted:
+			file.Close()
+		case <-copied:
+		}
+	}()
+	if _, err := io.Copy(stdout, file); err != nil {
+		select {
+		case <-interrupted:
+			return errors.New("interrupted")
+		default:
+			return fmt.Errorf("reading %s in the image: %w", filePath, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/containers/skopeo/cmd/skopeo/inspect"
+	securejoin "github.com/cyphar/filepath-securejoin"
+	"golang.org/x/sys/unix"
+)
+
+// statImageFile returns the metadata of the file at filePath, an absolute clean path, in root, the mounted root filesystem of an image.
+// Symbolic links in the parent directories of filePath are followed within root; filePath itself is not followed.
+func statImageFile(root, filePath string) (*inspect.FileStat, error) {
+	fullPath := root
+	if filePath != "/" {
+		parent, err := securejoin.SecureJoin(root, path.Dir(filePath))
+		if err != nil {
+			return nil, fmt.Errorf("resolving %s in the image: %w", path.Dir(filePath), err)
+		}
+		fullPath = filepath.Join(parent, path.Base(filePath))
+	}
+	var st unix.Stat_t
+	if err := unix.Lstat(fullPath, &st); err != nil {
+		return nil, fmt.Errorf("reading the metadata of %s in the image: %w", filePath, err)
+	}
+	res := inspect.FileStat{
+		Path:    filePath,
+		Mode:    fmt.Sprintf("%04o", st.Mode&0o7777),
+		Size:    st.Size,
+		UID:     st.Uid,
+		GID:     st.Gid,
+		ModTime: time.Unix(st.Mtim.Unix()).UTC(),
+	}
+	switch st.Mode & unix.S_IFMT {
+	case unix.S_IFREG:
+		res.Type = "file"
+	case unix.S_IFDIR:
+		res.Type = "directory"
+	case unix.S_IFLNK:
+		res.Type = "symlink"
+		target, err := os.Readlink(fullPath)
+		if err != nil {
+			return nil, err
+		}
+		res.LinkTarget = target
+	case unix.S_IFCHR:
+		res.Type = "char-device"
+	case unix.S_IFBLK:
+		res.Type = "block-device"
+	case unix.S_IFIFO:
+		res.Type = "fifo"
+	case unix.S_IFSOCK:
+		res.Type = "socket"
+	default:
+		return nil, fmt.Errorf("%s in the image has an unknown file type %#o", filePath, st.Mode&unix.S_IFMT)
+	}
+	return &res, nil
+}
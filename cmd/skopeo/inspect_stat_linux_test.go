@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatImageFile(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "usr/lib"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "usr/lib/os-release"), []byte("ID=test\n"), 0o644))
+	require.NoError(t, os.Chmod(filepath.Join(root, "usr/lib/os-release"), 0o644))
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.NoError(t, os.Chtimes(filepath.Join(root, "usr/lib/os-release"), modTime, modTime))
+	require.NoError(t, os.Mkdir(filepath.Join(root, "etc"), 0o755))
+	require.NoError(t, os.Symlink("../usr/lib/os-release", filepath.Join(root, "etc/os-release")))
+	// An absolute symlink is resolved within root, not on the host.
+	require.NoError(t, os.Symlink("/usr/lib", filepath.Join(root, "lib")))
+
+	stat, err := statImageFile(root, "/usr/lib/os-release")
+	require.NoError(t, err)
+	assert.Equal(t, "/usr/lib/os-release", stat.Path)
+	assert.Equal(t, "file", stat.Type)
+	assert.Equal(t, "0644", stat.Mode)
+	assert.Equal(t, int64(8), stat.Size)
+	assert.Equal(t, uint32(os.Getuid()), stat.UID)
+	assert.Equal(t, modTime, stat.ModTime)
+
+	stat, err = statImageFile(root, "/etc/os-release")
+	require.NoError(t, err)
+	assert.Equal(t, "symlink", stat.Type)
+	assert.Equal(t, "../usr/lib/os-release", stat.LinkTarget)
+
+	stat, err = statImageFile(root, "/lib/os-release")
+	require.NoError(t, err)
+	assert.Equal(t, "file", stat.Type)
+
+	stat, err = statImageFile(root, "/")
+	require.NoError(t, err)
+	assert.Equal(t, "directory", stat.Type)
+
+	_, err = statImageFile(root, "/missing")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	var out bytes.Buffer
+	err = catImageFile(root, "/etc/os-release", nil, &out)
+	require.NoError(t, err)
+	assert.Equal(t, "ID=test\n", out.String())
+	err = catImageFile(root, "/etc", nil, &out)
+	assert.ErrorContains(t, err, "/etc in the image is not a regular file")
+}
+
+func TestInspectStatOptions(t *testing.T) {
+	for _, c := range []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"--stat", "/etc/os-release", "docker://busybox"}, "--stat requires a containers-storage: image, not docker://busybox"},
+		{[]string{"--stat", "/etc/os-release", "containers-storage:[vfs@/tmp/root+/tmp/run]busybox"}, "--stat can not be used with a store specification"},
+		{[]string{"--stat", "etc/os-release", "containers-storage:busybox"}, `--stat requires an absolute path, not "etc/os-release"`},
+		{[]string{"--stat", "/etc/os-release", "--raw", "containers-storage:busybox"}, "--stat can not be used together with"},
+		{[]string{"--stat", "/etc/os-release", "--cat", "--format", "json", "containers-storage:busybox"}, "--cat can not be used together with --format"},
+		{[]string{"--cat", "containers-storage:busybox"}, "--cat requires --stat"},
+	} {
+		out, err := runSkopeo(append([]string{"inspect"}, c.args...)...)
+		assertTestFailed(t, out, err, c.expected)
+	}
+}
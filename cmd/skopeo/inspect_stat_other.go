@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"errors"
+
+	"github.com/containers/skopeo/cmd/skopeo/inspect"
+)
+
+// statImageFile returns the metadata of the file at filePath, an absolute clean path, in root, the mounted root filesystem of an image.
+func statImageFile(root, filePath string) (*inspect.FileStat, error) {
+	return nil, errors.New("--stat is only supported on Linux")
+}
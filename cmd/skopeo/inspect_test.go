@@ -0,0 +1,477 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/containers/skopeo/cmd/skopeo/inspect"
+	digest "github.com/opencontainers/go-digest"
+	imgspecspecs "github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testDirImage creates a dir: image containing only manifest, and returns its path.
+func testDirImage(t *testing.T, manifest []byte) string {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "manifest.json"), manifest, 0o644)
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(dir, "version"), []byte("Directory Transport Version: 1.1\n"), 0o644)
+	require.NoError(t, err)
+	return dir
+}
+
+func TestInspectRawPretty(t *testing.T) {
+	compact := `{"schemaVersion":2,"config":{"digest":"sha256:0000000000000000000000000000000000000000000000000000000000000000"}}`
+	dir := testDirImage(t, []byte(compact))
+
+	out, err := runSkopeo("inspect", "--raw", "dir:"+dir)
+	require.NoError(t, err)
+	assert.Equal(t, compact, out)
+
+	out, err = runSkopeo("inspect", "--raw", "--pretty", "dir:"+dir)
+	require.NoError(t, err)
+	assert.Equal(t, `{
+    "schemaVersion": 2,
+    "config": {
+        "digest": "sha256:0000000000000000000000000000000000000000000000000000000000000000"
+    }
+}
+`, out)
+}
+
+func TestInspectManifestOnly(t *testing.T) {
+	// The config referenced by the manifest does not exist, so any attempt to read it would fail.
+	compact := `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"sha256:0000000000000000000000000000000000000000000000000000000000000000","size":1},"layers":[]}`
+	dir := testDirImage(t, []byte(compact))
+
+	out, err := runSkopeo("inspect", "--manifest-only", "dir:"+dir)
+	require.NoError(t, err)
+	assert.Equal(t, compact, out)
+	out, err = runSkopeo("inspect", "--raw", "dir:"+dir)
+	require.NoError(t, err)
+	assert.Equal(t, compact, out)
+	out, err = runSkopeo("inspect", "dir:"+dir)
+	assert.Error(t, err, out)
+
+	for _, args := range [][]string{
+		{"--config"},
+		{"--arch-list"},
+		{"--format", "{{.Digest}}"},
+		{"--fetch-blob", "sha256:0000000000000000000000000000000000000000000000000000000000000000"},
+	} {
+		out, err := runSkopeo(append(append([]string{"inspect", "--manifest-only"}, args...), "dir:"+dir)...)
+		assertTestFailed(t, out, err, "--manifest-only can not be used together with")
+	}
+}
+
+func TestInspectArchList(t *testing.T) {
+	index := testIndex(t,
+		imgspecv1.Platform{OS: "linux", Architecture: "amd64"},
+		imgspecv1.Platform{OS: "linux", Architecture: "arm", Variant: "v7"},
+		imgspecv1.Platform{OS: "linux", Architecture: "arm", Variant: "v6"},
+		imgspecv1.Platform{OS: "linux", Architecture: "arm64"},
+	)
+	listDir := testDirImage(t, index)
+	out, err := runSkopeo("inspect", "--arch-list", "dir:"+listDir)
+	require.NoError(t, err)
+	assert.Equal(t, "amd64,arm,arm64\n", out)
+	out, err = runSkopeo("inspect", "--arch-list", "--format", "json", "dir:"+listDir)
+	require.NoError(t, err)
+	assert.Equal(t, "[\n    \"amd64\",\n    \"arm\",\n    \"arm64\"\n]\n", out)
+
+	imageDir := testDirImageWithBlobs(t)
+	out, err = runSkopeo("inspect", "--arch-list", "dir:"+imageDir)
+	require.NoError(t, err)
+	assert.Equal(t, "amd64\n", out)
+
+	out, err = runSkopeo("inspect", "--arch-list", "--raw", "dir:"+imageDir)
+	assertTestFailed(t, out, err, "can not be used together")
+	out, err = runSkopeo("inspect", "--arch-list", "--format", "{{.Architecture}}", "dir:"+imageDir)
+	assertTestFailed(t, out, err, "only supports --format json")
+}
+
+func TestInspectInstanceSizes(t *testing.T) {
+	imageDir := testDirImageWithBlobs(t)
+	imageManifest, err := os.ReadFile(filepath.Join(imageDir, "manifest.json"))
+	require.NoError(t, err)
+	imageDigest := digest.FromBytes(imageManifest)
+	// The config and layer created by testDirImageWithBlobs
+	expectedSize := len(`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers","diff_ids":[]}}`) + len("not really a layer")
+
+	out, err := runSkopeo("inspect", "--instance-sizes", "dir:"+imageDir)
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("linux/amd64 %s %d\n", imageDigest, expectedSize), out)
+
+	index, err := json.Marshal(imgspecv1.Index{
+		Versioned: imgspecspecs.Versioned{SchemaVersion: 2},
+		MediaType: imgspecv1.MediaTypeImageIndex,
+		Manifests: []imgspecv1.Descriptor{{
+			MediaType: imgspecv1.MediaTypeImageManifest,
+			Digest:    imageDigest,
+			Size:      int64(len(imageManifest)),
+			Platform:  &imgspecv1.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"},
+		}},
+	})
+	require.NoError(t, err)
+	listDir := testDirImage(t, index)
+	err = os.WriteFile(filepath.Join(listDir, imageDigest.Encoded()+".manifest.json"), imageManifest, 0o644)
+	require.NoError(t, err)
+	out, err = runSkopeo("inspect", "--instance-sizes", "dir:"+listDir)
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("linux/arm64/v8 %s %d\n", imageDigest, expectedSize), out)
+	out, err = runSkopeo("inspect", "--instance-sizes", "--format", "json", "dir:"+listDir)
+	require.NoError(t, err)
+	var sizes []instanceSize
+	err = json.Unmarshal([]byte(out), &sizes)
+	require.NoError(t, err)
+	assert.Equal(t, []instanceSize{{Platform: "linux/arm64/v8", Variant: "v8", Digest: imageDigest, Size: int64(expectedSize)}}, sizes)
+
+	// os.version and os.features of list entries are included, e.g. for Windows images.
+	index, err = json.Marshal(imgspecv1.Index{
+		Versioned: imgspecspecs.Versioned{SchemaVersion: 2},
+		MediaType: imgspecv1.MediaTypeImageIndex,
+		Manifests: []imgspecv1.Descriptor{{
+			MediaType: imgspecv1.MediaTypeImageManifest,
+			Digest:    imageDigest,
+			Size:      int64(len(imageManifest)),
+			Platform:  &imgspecv1.Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.20348.2227", OSFeatures: []string{"win32k"}},
+		}},
+	})
+	require.NoError(t, err)
+	listDir = testDirImage(t, index)
+	err = os.WriteFile(filepath.Join(listDir, imageDigest.Encoded()+".manifest.json"), imageManifest, 0o644)
+	require.NoError(t, err)
+	out, err = runSkopeo("inspect", "--instance-sizes", "dir:"+listDir)
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("windows/amd64 %s %d os.version=10.0.20348.2227 os.features=win32k\n", imageDigest, expectedSize), out)
+	out, err = runSkopeo("inspect", "--instance-sizes", "--format", "json", "dir:"+listDir)
+	require.NoError(t, err)
+	sizes = nil
+	err = json.Unmarshal([]byte(out), &sizes)
+	require.NoError(t, err)
+	assert.Equal(t, []instanceSize{{Platform: "windows/amd64", OSVersion: "10.0.20348.2227", OSFeatures: []string{"win32k"},
+		Digest: imageDigest, Size: int64(expectedSize)}}, sizes)
+
+	out, err = runSkopeo("inspect", "--instance-sizes", "--raw", "dir:"+imageDir)
+	assertTestFailed(t, out, err, "can not be used together")
+	out, err = runSkopeo("inspect", "--instance-sizes", "--format", "{{.Size}}", "dir:"+imageDir)
+	assertTestFailed(t, out, err, "only supports --format json")
+}
+
+func TestInspectVerifyWithKey(t *testing.T) {
+	manifest, err := os.ReadFile("fixtures/image.manifest.json")
+	require.NoError(t, err)
+	dir := testDirImage(t, manifest)
+	sig, err := os.ReadFile("fixtures/image.signature")
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(dir, "signature-1"), sig, 0o644)
+	require.NoError(t, err)
+
+	out, err := runSkopeo("inspect", "--verify-with-key", "fixtures/pubring.gpg", "--verify-identity", "testing/manifest", "dir:"+dir)
+	require.NoError(t, err)
+	assert.Equal(t, "Signature verification succeeded\n", out)
+
+	out, err = runSkopeo("inspect", "--verify-with-key", "fixtures/pubring.gpg", "--verify-identity", "testing/other", "dir:"+dir)
+	assertTestFailed(t, out, err, "Signature verification failed")
+
+	unsigned := testDirImage(t, manifest)
+	out, err = runSkopeo("inspect", "--verify-with-key", "fixtures/pubring.gpg", "--verify-identity", "testing/manifest", "dir:"+unsigned)
+	assertTestFailed(t, out, err, "Signature verification failed")
+
+	out, err = runSkopeo("inspect", "--verify-identity", "testing/manifest", "dir:"+dir)
+	assertTestFailed(t, out, err, "requires --verify-with-key")
+	out, err = runSkopeo("inspect", "--verify-with-key", "fixtures/pubring.gpg", "--raw", "dir:"+dir)
+	assertTestFailed(t, out, err, "can not be used together")
+	out, err = runSkopeo("inspect", "--verify-with-key", "/this/does/not/exist", "dir:"+dir)
+	assertTestFailed(t, out, err, "reading public key")
+}
+
+func TestInspectApplyPolicy(t *testing.T) {
+	dir := testDirImageWithBlobs(t)
+	policyDir := t.TempDir()
+	acceptPolicy := filepath.Join(policyDir, "accept.json")
+	err := os.WriteFile(acceptPolicy, []byte(`{"default":[{"type":"insecureAcceptAnything"}]}`), 0o644)
+	require.NoError(t, err)
+	rejectPolicy := filepath.Join(policyDir, "reject.json")
+	err = os.WriteFile(rejectPolicy, []byte(`{"default":[{"type":"reject"}]}`), 0o644)
+	require.NoError(t, err)
+
+	out, err := runSkopeo("inspect", "--apply-policy", "--policy", acceptPolicy, "dir:"+dir)
+	require.NoError(t, err)
+	var output inspect.Output
+	err = json.Unmarshal([]byte(out), &output)
+	require.NoError(t, err)
+	require.NotNil(t, output.PolicyResult)
+	assert.Equal(t, inspect.PolicyResult{Result: "pass"}, *output.PolicyResult)
+
+	// A rejected image is reported, but inspect does not fail
+	out, err = runSkopeo("inspect", "--apply-policy", "--policy", rejectPolicy, "dir:"+dir)
+	require.NoError(t, err)
+	output = inspect.Output{}
+	err = json.Unmarshal([]byte(out), &output)
+	require.NoError(t, err)
+	require.NotNil(t, output.PolicyResult)
+	assert.Equal(t, "fail", output.PolicyResult.Result)
+	require.Len(t, output.PolicyResult.Reasons, 1)
+	assert.Contains(t, output.PolicyResult.Reasons[0], "rejected")
+
+	out, err = runSkopeo("inspect", "--apply-policy", "--policy", rejectPolicy, "--format", "{{.PolicyResult.Result}}", "dir:"+dir)
+	require.NoError(t, err)
+	assert.Equal(t, "fail\n", out)
+
+	out, err = runSkopeo("inspect", "--policy", acceptPolicy, "dir:"+dir)
+	require.NoError(t, err)
+	assert.NotContains(t, out, "PolicyResult")
+
+	out, err = runSkopeo("inspect", "--apply-policy", "--policy", filepath.Join(policyDir, "missing.json"), "dir:"+dir)
+	assertTestFailed(t, out, err, "Error loading trust policy")
+	out, err = runSkopeo("inspect", "--apply-policy", "--raw", "dir:"+dir)
+	assertTestFailed(t, out, err, "can not be used together")
+}
+
+func TestInspectStorageInfo(t *testing.T) {
+	dir := testDirImageWithBlobs(t)
+	out, err := runSkopeo("inspect", "--storage-info", "dir:"+dir)
+	assertTestFailed(t, out, err, "--storage-info requires a containers-storage: image")
+	out, err = runSkopeo("inspect", "--storage-info", "containers-storage:[vfs@"+t.TempDir()+"]example.com/test:latest")
+	assertTestFailed(t, out, err, "can not be used with a store specification")
+	out, err = runSkopeo("inspect", "--storage-info", "--raw", "containers-storage:example.com/test:latest")
+	assertTestFailed(t, out, err, "can not be used together")
+
+	out, err = runSkopeo("inspect", "dir:"+dir)
+	require.NoError(t, err)
+	assert.NotContains(t, out, "StorageInfo")
+}
+
+func TestInspectFetchBlob(t *testing.T) {
+	imageDir := testDirImageWithBlobs(t)
+	layer := []byte("not really a layer") // As created by testDirImageWithBlobs
+	layerDigest := digest.FromBytes(layer)
+
+	out, err := runSkopeo("inspect", "--fetch-blob", layerDigest.String(), "dir:"+imageDir)
+	require.NoError(t, err)
+	assert.Equal(t, string(layer), out)
+
+	outputFile := filepath.Join(t.TempDir(), "blob")
+	out, err = runSkopeo("inspect", "--fetch-blob", layerDigest.String(), "--output", outputFile, "dir:"+imageDir)
+	require.NoError(t, err)
+	assert.Empty(t, out)
+	contents, err := os.ReadFile(outputFile)
+	require.NoError(t, err)
+	assert.Equal(t, layer, contents)
+
+	// Blobs not referenced by the image are only fetched with --any-blob
+	unreferenced := []byte("unreferenced")
+	unreferencedDigest := digest.FromBytes(unreferenced)
+	err = os.WriteFile(filepath.Join(imageDir, unreferencedDigest.Encoded()), unreferenced, 0o644)
+	require.NoError(t, err)
+	out, err = runSkopeo("inspect", "--fetch-blob", unreferencedDigest.String(), "dir:"+imageDir)
+	assertTestFailed(t, out, err, "is not referenced by the image")
+	out, err = runSkopeo("inspect", "--fetch-blob", unreferencedDigest.String(), "--any-blob", "dir:"+imageDir)
+	require.NoError(t, err)
+	assert.Equal(t, string(unreferenced), out)
+
+	// Corrupted blobs are rejected, and the output file is removed
+	err = os.WriteFile(filepath.Join(imageDir, layerDigest.Encoded()), []byte("corrupted"), 0o644)
+	require.NoError(t, err)
+	out, err = runSkopeo("inspect", "--fetch-blob", layerDigest.String(), "--output", outputFile, "dir:"+imageDir)
+	assertTestFailed(t, out, err, "expected 18")
+	assert.NoFileExists(t, outputFile)
+
+	out, err = runSkopeo("inspect", "--fetch-blob", "invalid", "dir:"+imageDir)
+	assertTestFailed(t, out, err, "Invalid --fetch-blob value")
+	out, err = runSkopeo("inspect", "--fetch-blob", layerDigest.String(), "--raw", "dir:"+imageDir)
+	assertTestFailed(t, out, err, "can not be used together")
+	out, err = runSkopeo("inspect", "--any-blob", "dir:"+imageDir)
+	assertTestFailed(t, out, err, "require --fetch-blob")
+}
+
+func TestInspectFetched(t *testing.T) {
+	imageDir := testDirImageWithBlobs(t)
+	// Not included by default, so that the output is deterministic.
+	out, err := runSkopeo("inspect", "dir:"+imageDir)
+	require.NoError(t, err)
+	assert.NotContains(t, out, "Fetched")
+
+	before := time.Now()
+	out, err = runSkopeo("inspect", "--fetch-metadata", "dir:"+imageDir)
+	require.NoError(t, err)
+	var output inspect.Output
+	err = json.Unmarshal([]byte(out), &output)
+	require.NoError(t, err)
+	require.NotNil(t, output.Fetched)
+	assert.False(t, output.Fetched.Before(before.Truncate(time.Second)))
+	assert.Empty(t, output.RegistryDigest) // Only set for docker:// references
+	assert.NotContains(t, out, "RegistryDigest")
+}
+
+func TestInspectTarball(t *testing.T) {
+	dir := t.TempDir()
+	var uncompressed bytes.Buffer
+	tw := tar.NewWriter(&uncompressed)
+	contents := []byte("hello\n")
+	err := tw.WriteHeader(&tar.Header{Name: "hello", Mode: 0o644, Size: int64(len(contents)), Typeflag: tar.TypeReg})
+	require.NoError(t, err)
+	_, err = tw.Write(contents)
+	require.NoError(t, err)
+	err = tw.Close()
+	require.NoError(t, err)
+	var compressed bytes.Buffer
+	gw := gzip.NewWriter(&compressed)
+	_, err = gw.Write(uncompressed.Bytes())
+	require.NoError(t, err)
+	err = gw.Close()
+	require.NoError(t, err)
+	layerPath := filepath.Join(dir, "layer.tar.gz")
+	err = os.WriteFile(layerPath, compressed.Bytes(), 0o644)
+	require.NoError(t, err)
+
+	out, err := runSkopeo("inspect", "tarball:"+layerPath)
+	require.NoError(t, err)
+	var output inspect.Output
+	err = json.Unmarshal([]byte(out), &output)
+	require.NoError(t, err)
+	assert.Equal(t, []string{digest.FromBytes(compressed.Bytes()).String()}, output.Layers)
+	assert.Equal(t, []digest.Digest{digest.FromBytes(uncompressed.Bytes())}, output.DiffIDs)
+
+	configPath := filepath.Join(dir, "config.json")
+	err = os.WriteFile(configPath, []byte(`{"architecture":"arm64","os":"linux","config":{"Env":["A=B"],"Labels":{"l":"v"}}}`), 0o644)
+	require.NoError(t, err)
+	out, err = runSkopeo("inspect", "--tarball-config", configPath, "tarball:"+layerPath)
+	require.NoError(t, err)
+	output = inspect.Output{}
+	err = json.Unmarshal([]byte(out), &output)
+	require.NoError(t, err)
+	assert.Equal(t, "arm64", output.Architecture)
+	assert.Equal(t, []string{"A=B"}, output.Env)
+	assert.Equal(t, map[string]string{"l": "v"}, output.Labels)
+	assert.Equal(t, []digest.Digest{digest.FromBytes(uncompressed.Bytes())}, output.DiffIDs)
+
+	out, err = runSkopeo("inspect", "--config", "--tarball-config", configPath, "tarball:"+layerPath)
+	require.NoError(t, err)
+	var config imgspecv1.Image
+	err = json.Unmarshal([]byte(out), &config)
+	require.NoError(t, err)
+	assert.Equal(t, []digest.Digest{digest.FromBytes(uncompressed.Bytes())}, config.RootFS.DiffIDs)
+
+	imageDir := testDirImageWithBlobs(t)
+	out, err = runSkopeo("inspect", "--tarball-config", configPath, "dir:"+imageDir)
+	assertTestFailed(t, out, err, "--tarball-config requires a tarball: image")
+	out, err = runSkopeo("inspect", "--tarball-config", configPath, "--cache-dir", t.TempDir(), "tarball:"+layerPath)
+	assertTestFailed(t, out, err, "--tarball-config can not be used together with --cache-dir")
+	out, err = runSkopeo("inspect", "dir:"+imageDir)
+	require.NoError(t, err)
+	assert.NotContains(t, out, "DiffIDs")
+}
+
+func TestInspectJSONSchema(t *testing.T) {
+	out, err := runSkopeo("inspect", "--json-schema")
+	require.NoError(t, err)
+	var schema struct {
+		Schema     string                     `json:"$schema"`
+		Type       string                     `json:"type"`
+		Properties map[string]json.RawMessage `json:"properties"`
+		Required   []string                   `json:"required"`
+	}
+	err = json.Unmarshal([]byte(out), &schema)
+	require.NoError(t, err)
+	assert.Equal(t, jsonSchemaDialect, schema.Schema)
+	assert.Equal(t, "object", schema.Type)
+	assert.Contains(t, schema.Required, "Digest")
+	assert.NotContains(t, schema.Required, "Name") // omitempty
+	assert.JSONEq(t, `{"type":["string","null"],"format":"date-time"}`, string(schema.Properties["Created"]))
+	assert.JSONEq(t, `{"type":["array","null"],"items":{"type":"object","properties":{`+
+		`"MIMEType":{"type":"string"},"Digest":{"type":"string"},"Size":{"type":"integer"},`+
+		`"Annotations":{"type":["object","null"],"additionalProperties":{"type":"string"}}},`+
+		`"required":["MIMEType","Digest","Size","Annotations"],"additionalProperties":false}}`, string(schema.Properties["LayersData"]))
+
+	// Every field of the actual output is described
+	dir := testDirImageWithBlobs(t)
+	out, err = runSkopeo("inspect", "dir:"+dir)
+	require.NoError(t, err)
+	var fields map[string]json.RawMessage
+	err = json.Unmarshal([]byte(out), &fields)
+	require.NoError(t, err)
+	for field := range fields {
+		assert.Contains(t, schema.Properties, field)
+	}
+
+	out, err = runSkopeo("inspect", "--json-schema", "dir:"+dir)
+	assertTestFailed(t, out, err, "--json-schema does not accept an image argument")
+}
+
+func TestInspectNormalizePlatform(t *testing.T) {
+	index := testIndex(t,
+		imgspecv1.Platform{OS: "linux", Architecture: "x86_64"},
+		imgspecv1.Platform{OS: "linux", Architecture: "aarch64"},
+		imgspecv1.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"},
+	)
+	listDir := testDirImage(t, index)
+	out, err := runSkopeo("inspect", "--arch-list", "dir:"+listDir)
+	require.NoError(t, err)
+	assert.Equal(t, "x86_64,aarch64,arm64\n", out)
+	out, err = runSkopeo("inspect", "--arch-list", "--normalize-platform", "dir:"+listDir)
+	require.NoError(t, err)
+	assert.Equal(t, "amd64,arm64\n", out)
+
+	imageDir := testDirImageWithBlobs(t)
+	imageManifest, err := os.ReadFile(filepath.Join(imageDir, "manifest.json"))
+	require.NoError(t, err)
+	imageDigest := digest.FromBytes(imageManifest)
+	// The platform of list entries without an architecture is read from the image config.
+	index, err = json.Marshal(imgspecv1.Index{
+		Versioned: imgspecspecs.Versioned{SchemaVersion: 2},
+		MediaType: imgspecv1.MediaTypeImageIndex,
+		Manifests: []imgspecv1.Descriptor{{
+			MediaType: imgspecv1.MediaTypeImageManifest,
+			Digest:    imageDigest,
+			Size:      int64(len(imageManifest)),
+		}},
+	})
+	require.NoError(t, err)
+	listDir = testDirImage(t, index)
+	err = os.WriteFile(filepath.Join(listDir, imageDigest.Encoded()+".manifest.json"), imageManifest, 0o644)
+	require.NoError(t, err)
+	blobs, err := filepath.Glob(filepath.Join(imageDir, "[0-9a-f]*"))
+	require.NoError(t, err)
+	for _, blob := range blobs {
+		contents, err := os.ReadFile(blob)
+		require.NoError(t, err)
+		err = os.WriteFile(filepath.Join(listDir, filepath.Base(blob)), contents, 0o644)
+		require.NoError(t, err)
+	}
+	out, err = runSkopeo("inspect", "--instance-sizes", "--format", "json", "dir:"+listDir)
+	require.NoError(t, err)
+	var sizes []instanceSize
+	err = json.Unmarshal([]byte(out), &sizes)
+	require.NoError(t, err)
+	require.Len(t, sizes, 1)
+	assert.Equal(t, "unknown", sizes[0].Platform)
+	out, err = runSkopeo("inspect", "--instance-sizes", "--normalize-platform", "dir:"+listDir)
+	require.NoError(t, err)
+	assert.Regexp(t, "^linux/amd64 ", out)
+
+	// The default output only includes a variant with --normalize-platform.
+	out, err = runSkopeo("inspect", "--format", "{{.Os}}/{{.Architecture}}/{{.Variant}}", "dir:"+imageDir)
+	require.NoError(t, err)
+	assert.Equal(t, "linux/amd64/\n", out)
+	out, err = runSkopeo("inspect", "--normalize-platform", "dir:"+imageDir)
+	require.NoError(t, err)
+	var output inspect.Output
+	err = json.Unmarshal([]byte(out), &output)
+	require.NoError(t, err)
+	assert.Equal(t, "linux", output.Os)
+	assert.Equal(t, "amd64", output.Architecture)
+
+	out, err = runSkopeo("inspect", "--normalize-platform", "--raw", "dir:"+imageDir)
+	assertTestFailed(t, out, err, "--normalize-platform can not be used together with")
+}
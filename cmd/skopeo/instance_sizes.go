@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/containers/common/pkg/retry"
+	"github.com/containers/image/v5/image"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"golang.org/x/sync/errgroup"
+)
+
+// instanceSizesConcurrency is the number of instance manifests fetched in parallel by instanceSizes.
+const instanceSizesConcurrency = 4
+
+// instanceSize is the output of inspect --instance-sizes for a single image.
+type instanceSize struct {
+	Platform   string        // os/architecture[/variant], or "unknown"
+	Variant    string        `json:",omitempty"` // The variant included in Platform
+	OSVersion  string        `json:",omitempty"` // os.version, e.g. the Windows build of the image
+	OSFeatures []string      `json:",omitempty"` // os.features, e.g. "win32k" for Windows images
+	Digest     digest.Digest // Digest of the image manifest
+	Size       int64         // Total size of the config and layer blobs, as referenced by the manifest; -1 if unknown
+}
+
+// setPlatform sets the platform fields of s from p, which may be nil.
+func (s *instanceSize) setPlatform(p *v1.Platform) {
+	s.Platform = platformString(p)
+	s.Variant, s.OSVersion, s.OSFeatures = "", "", nil
+	if p != nil {
+		if s.Platform != "unknown" {
+			s.Variant = p.Variant
+		}
+		s.OSVersion = p.OSVersion
+		s.OSFeatures = p.OSFeatures
+	}
+}
+
+// platformString returns p in the os/architecture[/variant] format, or "unknown".
+func platformString(p *v1.Platform) string {
+	if p == nil || p.OS == "" || p.Architecture == "" {
+		return "unknown"
+	}
+	res := p.OS + "/" + p.Architecture
+	if p.Variant != "" {
+		res += "/" + p.Variant
+	}
+	return res
+}
+
+// mergePlatforms returns p, with empty OS, architecture and variant values set from fallback.
+func mergePlatforms(p, fallback v1.Platform) v1.Platform {
+	if p.OS == "" {
+		p.OS = fallback.OS
+	}
+	if p.Architecture == "" {
+		p.Architecture = fallback.Architecture
+		if p.Variant == "" {
+			p.Variant = fallback.Variant
+		}
+	}
+	return p
+}
+
+// manifestBlobs returns the config and layer blobs referenced by rawManifest (of type mimeType).
+// The config of schema1 manifests, which don't have one, has an empty digest.
+func manifestBlobs(rawManifest []byte, mimeType string) ([]types.BlobInfo, error) {
+	m, err := manifest.FromBlob(rawManifest, manifest.NormalizedMIMEType(mimeType))
+	if err != nil {
+		return nil, err
+	}
+	blobs := []types.BlobInfo{m.ConfigInfo()}
+	for _, layer := range m.LayerInfos() {
+		blobs = append(blobs, layer.BlobInfo)
+	}
+	return blobs, nil
+}
+
+// blobsSize returns the total size of blobs, ignoring blobs without a digest, or -1 if unknown.
+func blobsSize(blobs []types.BlobInfo) int64 {
+	var total int64
+	for _, blob := range blobs {
+		if blob.Digest == "" { // No config in schema1 manifests
+			continue
+		}
+		if blob.Size == -1 {
+			return -1
+		}
+		total += blob.Size
+	}
+	return total
+}
+
+// manifestBlobsSize returns the total size of the config and layer blobs referenced by rawManifest (of type mimeType), or -1 if unknown.
+func manifestBlobsSize(rawManifest []byte, mimeType string) (int64, error) {
+	blobs, err := manifestBlobs(rawManifest, mimeType)
+	if err != nil {
+		return -1, err
+	}
+	return blobsSize(blobs), nil
+}
+
+// imageConfigPlatform returns the platform recorded in the config of the image with instanceDigest (or the top-level image if nil) in src.
+func imageConfigPlatform(ctx context.Context, sys *types.SystemContext, src types.ImageSource, instanceDigest *digest.Digest, retryOpts *retry.Options) (v1.Platform, error) {
+	img, err := image.FromUnparsedImage(ctx, sys, image.UnparsedInstance(src, instanceDigest))
+	if err != nil {
+		return v1.Platform{}, fmt.Errorf("Error parsing manifest for image: %w", err)
+	}
+	var config *v1.Image
+	if err := retry.IfNecessary(ctx, func() error {
+		config, err = img.OCIConfig(ctx)
+		return err
+	}, retryOpts); err != nil {
+		return v1.Platform{}, fmt.Errorf("Error reading OCI-formatted configuration data: %w", err)
+	}
+	return config.Platform, nil
+}
+
+// instanceSizes returns the total blob size of the image, or of each image in the manifest list, in rawManifest read from src.
+// For manifest lists, only the per-image manifests are fetched; for single images, the config is read to determine the platform.
+// If normalize, platforms are normalized using normalizePlatform, and the platform of list entries without an OS or architecture
+// is read from their config.
+// If resolver is not nil, it is used to look up the sizes of blobs whose size is missing or zero in the manifests.
+func instanceSizes(ctx context.Context, sys *types.SystemContext, src types.ImageSource, rawManifest []byte, mimeType string,
+	normalize bool, resolver *blobSizeResolver, retryOpts *retry.Options) ([]instanceSize, error) {
+	if !manifest.MIMETypeIsMultiImage(manifest.NormalizedMIMEType(mimeType)) {
+		size, err := resolvedManifestBlobsSize(ctx, rawManifest, mimeType, resolver)
+		if err != nil {
+			return nil, err
+		}
+		manifestDigest, err := manifest.Digest(rawManifest)
+		if err != nil {
+			return nil, err
+		}
+		platform, err := imageConfigPlatform(ctx, sys, src, nil, retryOpts)
+		if err != nil {
+			return nil, err
+		}
+		if normalize {
+			platform = normalizePlatform(platform)
+		}
+		res := instanceSize{Digest: manifestDigest, Size: size}
+		res.setPlatform(&platform)
+		return []instanceSize{res}, nil
+	}
+
+	list, err := manifest.ListFromBlob(rawManifest, mimeType)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing manifest list: %w", err)
+	}
+	instances := list.Instances()
+	res := make([]instanceSize, len(instances))
+	group, groupCtx := errgroup.WithContext(ctx)
+	group.SetLimit(instanceSizesConcurrency)
+	for i, instanceDigest := range instances {
+		i, instanceDigest := i, instanceDigest
+		instance, err := list.Instance(instanceDigest)
+		if err != nil {
+			return nil, err
+		}
+		platform := instance.ReadOnly.Platform
+		res[i] = instanceSize{Digest: instanceDigest}
+		res[i].setPlatform(platform)
+		group.Go(func() error {
+			var instanceManifest []byte
+			var instanceMIMEType string
+			if err := retry.IfNecessary(groupCtx, func() error {
+				var err error
+				instanceManifest, instanceMIMEType, err = src.GetManifest(groupCtx, &instanceDigest)
+				return err
+			}, retryOpts); err != nil {
+				return fmt.Errorf("Error retrieving manifest %s: %w", instanceDigest, err)
+			}
+			size, err := resolvedManifestBlobsSize(groupCtx, instanceManifest, instanceMIMEType, resolver)
+			if err != nil {
+				return fmt.Errorf("Error determining the size of image %s: %w", instanceDigest, err)
+			}
+			res[i].Size = size
+			if normalize {
+				if platform == nil || platform.OS == "" || platform.Architecture == "" {
+					configPlatform, err := imageConfigPlatform(groupCtx, sys, src, &instanceDigest, retryOpts)
+					if err != nil {
+						return fmt.Errorf("Error reading the platform of image %s: %w", instanceDigest, err)
+					}
+					if platform != nil {
+						configPlatform = mergePlatforms(*platform, configPlatform)
+					}
+					platform = &configPlatform
+				}
+				normalized := normalizePlatform(*platform)
+				res[i].setPlatform(&normalized)
+			}
+			return nil
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// jsonSchemaDialect is the JSON Schema version of documents created by jsonSchema.
+const jsonSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// jsonSchema returns a JSON Schema document, with title, describing the encoding/json representation of values of t.
+// The schema is derived using reflection, so that it can't get out of sync with the Go type.
+func jsonSchema(t reflect.Type, title string) (map[string]any, error) {
+	res, err := jsonSchemaForType(t)
+	if err != nil {
+		return nil, err
+	}
+	res["$schema"] = jsonSchemaDialect
+	res["title"] = title
+	return res, nil
+}
+
+// jsonSchemaForType returns a JSON Schema describing the encoding/json representation of values of t.
+func jsonSchemaForType(t reflect.Type) (map[string]any, error) {
+	if t == timeType {
+		return map[string]any{"type": "string", "format": "date-time"}, nil
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		elem, err := jsonSchemaForType(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return nullable(elem), nil
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}, nil
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}, nil
+	case reflect.String:
+		return map[string]any{"type": "string"}, nil
+	case reflect.Slice:
+		items, err := jsonSchemaForType(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		// A nil slice is encoded as null.
+		return nullable(map[string]any{"type": "array", "items": items}), nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("unsupported map key type %s", t.Key())
+		}
+		values, err := jsonSchemaForType(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		// A nil map is encoded as null.
+		return nullable(map[string]any{"type": "object", "additionalProperties": values}), nil
+	case reflect.Struct:
+		properties := map[string]any{}
+		required := []string{}
+		if err := addStructFields(t, properties, &required); err != nil {
+			return nil, err
+		}
+		return map[string]any{
+			"type":                 "object",
+			"properties":           properties,
+			"required":             required,
+			"additionalProperties": false,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported type %s", t)
+	}
+}
+
+// addStructFields adds the JSON properties of the fields of t, a struct type, to properties, and the names of properties
+// which are always present to required.
+func addStructFields(t reflect.Type, properties map[string]any, required *[]string) error {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() && !field.Anonymous {
+			continue
+		}
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			if err := addStructFields(field.Type, properties, required); err != nil {
+				return err
+			}
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		schema, err := jsonSchemaForType(field.Type)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		properties[name] = schema
+		if !strings.Contains(","+options+",", ",omitempty,") {
+			*required = append(*required, name)
+		}
+	}
+	return nil
+}
+
+// nullable returns schema modified to also allow null values.
+func nullable(schema map[string]any) map[string]any {
+	if s, ok := schema["type"].(string); ok {
+		schema["type"] = []string{s, "null"}
+	}
+	return schema
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// kubernetesSecret is the subset of a Kubernetes Secret object relevant for image pull secrets.
+type kubernetesSecret struct {
+	Kind       string            `yaml:"kind"`
+	Data       map[string]string `yaml:"data"`       // base64-encoded values
+	StringData map[string]string `yaml:"stringData"` // Plain-text values
+}
+
+// isAuthsJSON returns true if contents is a JSON object with an "auths" member, i.e. an auth.json or .dockerconfigjson file.
+func isAuthsJSON(contents []byte) bool {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(contents, &obj); err != nil {
+		return false
+	}
+	_, ok := obj["auths"]
+	return ok
+}
+
+// authFileFromKubernetesSecret returns the contents of an auth.json file equivalent to the Kubernetes image pull secret in contents,
+// which may be a Secret object, or the base64-encoded value of its .dockerconfigjson member.
+// It returns nil if contents is not in any of those formats.
+func authFileFromKubernetesSecret(contents []byte) ([]byte, error) {
+	var secret kubernetesSecret
+	if err := yaml.Unmarshal(contents, &secret); err == nil && secret.Kind == "Secret" {
+		if value, ok := secret.StringData[".dockerconfigjson"]; ok {
+			return []byte(value), nil
+		}
+		if value, ok := secret.Data[".dockerconfigjson"]; ok {
+			decoded, err := base64.StdEncoding.DecodeString(value)
+			if err != nil {
+				return nil, fmt.Errorf("decoding .dockerconfigjson in Kubernetes secret: %w", err)
+			}
+			return decoded, nil
+		}
+		// The legacy kubernetes.io/dockercfg format is the contents of "auths" only.
+		legacy, ok := secret.StringData[".dockercfg"]
+		if !ok {
+			value, ok := secret.Data[".dockercfg"]
+			if !ok {
+				return nil, fmt.Errorf("Kubernetes secret does not contain .dockerconfigjson or .dockercfg")
+			}
+			decoded, err := base64.StdEncoding.DecodeString(value)
+			if err != nil {
+				return nil, fmt.Errorf("decoding .dockercfg in Kubernetes secret: %w", err)
+			}
+			legacy = string(decoded)
+		}
+		return json.Marshal(map[string]json.RawMessage{"auths": json.RawMessage(legacy)})
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(contents)))
+	if err == nil && isAuthsJSON(decoded) {
+		return decoded, nil
+	}
+	return nil, nil
+}
+
+// authFilePathForKubernetesSecret returns a path to use as types.SystemContext.AuthFilePath instead of path,
+// which might contain a Kubernetes image pull secret instead of an auth.json file.
+func (opts *globalOptions) authFilePathForKubernetesSecret(path string) (string, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil || isAuthsJSON(contents) {
+		// Leave reporting any errors, including a missing file, to the consumers of the file.
+		return path, nil
+	}
+	authFile, err := authFileFromKubernetesSecret(contents)
+	if err != nil {
+		return "", fmt.Errorf("reading authentication file %s: %w", path, err)
+	}
+	if authFile == nil {
+		return path, nil
+	}
+	dir, err := opts.newTemporaryDir("skopeo-auth")
+	if err != nil {
+		return "", err
+	}
+	res := filepath.Join(dir, "auth.json")
+	if err := os.WriteFile(res, authFile, 0o600); err != nil {
+		return "", err
+	}
+	return res, nil
+}
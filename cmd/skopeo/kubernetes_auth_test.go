@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthFileFromKubernetesSecret(t *testing.T) {
+	authJSON := `{"auths":{"registry.example.com":{"auth":"dXNlcjpwYXNz"}}}`
+	encoded := base64.StdEncoding.EncodeToString([]byte(authJSON))
+	legacyEncoded := base64.StdEncoding.EncodeToString([]byte(`{"registry.example.com":{"auth":"dXNlcjpwYXNz"}}`))
+
+	for _, c := range []struct {
+		name, input, expected string
+	}{
+		{"base64", encoded + "\n", authJSON},
+		{"YAML secret", "apiVersion: v1\nkind: Secret\ntype: kubernetes.io/dockerconfigjson\ndata:\n  .dockerconfigjson: " + encoded + "\n", authJSON},
+		{"JSON secret", `{"apiVersion":"v1","kind":"Secret","data":{".dockerconfigjson":"` + encoded + `"}}`, authJSON},
+		{"stringData", "kind: Secret\nstringData:\n  .dockerconfigjson: '" + authJSON + "'\n", authJSON},
+		{"legacy dockercfg", "kind: Secret\ntype: kubernetes.io/dockercfg\ndata:\n  .dockercfg: " + legacyEncoded + "\n", authJSON},
+		{"unrecognized", `{"registry.example.com":{}}`, ""},
+	} {
+		res, err := authFileFromKubernetesSecret([]byte(c.input))
+		require.NoError(t, err, c.name)
+		if c.expected == "" {
+			assert.Nil(t, res, c.name)
+		} else {
+			assert.JSONEq(t, c.expected, string(res), c.name)
+		}
+	}
+
+	_, err := authFileFromKubernetesSecret([]byte("kind: Secret\ndata:\n  other: e30=\n"))
+	assert.Error(t, err)
+	_, err = authFileFromKubernetesSecret([]byte("kind: Secret\ndata:\n  .dockerconfigjson: '!!!'\n"))
+	assert.Error(t, err)
+}
+
+func TestAuthFilePathForKubernetesSecret(t *testing.T) {
+	opts := &globalOptions{}
+	defer opts.cleanUp()
+	dir := t.TempDir()
+
+	// auth.json files, and missing files, are used unchanged
+	authJSON := `{"auths":{"registry.example.com":{"auth":"dXNlcjpwYXNz"}}}`
+	authFile := filepath.Join(dir, "auth.json")
+	err := os.WriteFile(authFile, []byte(authJSON), 0o600)
+	require.NoError(t, err)
+	for _, path := range []string{authFile, filepath.Join(dir, "missing")} {
+		res, err := opts.authFilePathForKubernetesSecret(path)
+		require.NoError(t, err)
+		assert.Equal(t, path, res)
+	}
+
+	secretFile := filepath.Join(dir, "secret")
+	err = os.WriteFile(secretFile, []byte(base64.StdEncoding.EncodeToString([]byte(authJSON))), 0o600)
+	require.NoError(t, err)
+	res, err := opts.authFilePathForKubernetesSecret(secretFile)
+	require.NoError(t, err)
+	assert.NotEqual(t, secretFile, res)
+	contents, err := os.ReadFile(res)
+	require.NoError(t, err)
+	assert.Equal(t, authJSON, string(contents))
+}
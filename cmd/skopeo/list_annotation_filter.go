@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// parseListAnnotationFilters parses KEY=VALUE values of --list-filter-annotation into a KEY → VALUE map.
+func parseListAnnotationFilters(values []string) (map[string]string, error) {
+	res := map[string]string{}
+	for _, value := range values {
+		key, val, ok := strings.Cut(value, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("Invalid --list-filter-annotation %q, expected KEY=VALUE", value)
+		}
+		if existing, ok := res[key]; ok && existing != val {
+			return nil, fmt.Errorf("Conflicting --list-filter-annotation values for %q", key)
+		}
+		res[key] = val
+	}
+	return res, nil
+}
+
+// annotationFilteredListReference is a types.ImageReference wrapper; image sources created from it
+// present the top-level manifest list reduced to the instances with all of the annotations in filters.
+type annotationFilteredListReference struct {
+	types.ImageReference
+	filters map[string]string
+}
+
+// NewImageSource returns a types.ImageSource for this reference.
+// The caller must call .Close() on the returned ImageSource.
+func (ref annotationFilteredListReference) NewImageSource(ctx context.Context, sys *types.SystemContext) (types.ImageSource, error) {
+	src, err := ref.ImageReference.NewImageSource(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	rawManifest, mimeType, err := src.GetManifest(ctx, nil)
+	if err != nil {
+		src.Close()
+		return nil, fmt.Errorf("Error retrieving manifest for image: %w", err)
+	}
+	filtered, err := filterListByAnnotations(rawManifest, mimeType, ref.filters)
+	if err != nil {
+		src.Close()
+		return nil, fmt.Errorf("--list-filter-annotation: %s: %w", ref.StringWithinTransport(), err)
+	}
+	return &annotationFilteredListSource{ImageSource: src, ref: ref, manifest: filtered, mimeType: mimeType}, nil
+}
+
+// annotationFilteredListSource is a types.ImageSource wrapper which replaces the top-level manifest list.
+type annotationFilteredListSource struct {
+	types.ImageSource
+	ref      annotationFilteredListReference
+	manifest []byte
+	mimeType string
+}
+
+// Reference returns the reference used to set up this source.
+func (s *annotationFilteredListSource) Reference() types.ImageReference {
+	return s.ref
+}
+
+// GetManifest returns the image's manifest along with its MIME type, returning the filtered list for the top-level manifest.
+func (s *annotationFilteredListSource) GetManifest(ctx context.Context, instanceDigest *digest.Digest) ([]byte, string, error) {
+	if instanceDigest == nil {
+		return s.manifest, s.mimeType, nil
+	}
+	return s.ImageSource.GetManifest(ctx, instanceDigest)
+}
+
+// GetSignatures returns the image's signatures.
+// Signatures of the original top-level list do not apply to the filtered list, so none are returned for it.
+func (s *annotationFilteredListSource) GetSignatures(ctx context.Context, instanceDigest *digest.Digest) ([][]byte, error) {
+	if instanceDigest == nil {
+		return nil, nil
+	}
+	return s.ImageSource.GetSignatures(ctx, instanceDigest)
+}
+
+// filterListByAnnotations returns the OCI index rawManifest (of type mimeType) reduced to the instances whose
+// descriptor annotations contain all of filters, failing if no instance matches.
+func filterListByAnnotations(rawManifest []byte, mimeType string, filters map[string]string) ([]byte, error) {
+	switch manifest.NormalizedMIMEType(mimeType) {
+	case imgspecv1.MediaTypeImageIndex:
+	case manifest.DockerV2ListMediaType:
+		return nil, fmt.Errorf("%s manifest lists have no instance annotations", mimeType)
+	default:
+		return nil, fmt.Errorf("not a manifest list (%s)", mimeType)
+	}
+	index, err := manifest.OCI1IndexFromManifest(rawManifest)
+	if err != nil {
+		return nil, fmt.Errorf("parsing manifest list: %w", err)
+	}
+	kept := []imgspecv1.Descriptor{}
+	for _, m := range index.Manifests {
+		matches := true
+		for key, value := range filters {
+			if v, ok := m.Annotations[key]; !ok || v != value {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			kept = append(kept, m)
+		}
+	}
+	if len(kept) == 0 {
+		return nil, fmt.Errorf("none of the %d instances of the manifest list match the annotations", len(index.Manifests))
+	}
+	if len(kept) == len(index.Manifests) {
+		return rawManifest, nil
+	}
+	index.Manifests = kept
+	return index.Serialize()
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/containers/image/v5/manifest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseListAnnotationFilters(t *testing.T) {
+	res, err := parseListAnnotationFilters([]string{"a=b", "c=", "a=b"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "b", "c": ""}, res)
+
+	for _, invalid := range [][]string{{"a"}, {"=b"}, {"a=b", "a=c"}} {
+		_, err := parseListAnnotationFilters(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestFilterListByAnnotations(t *testing.T) {
+	amd64 := imgspecv1.Platform{OS: "linux", Architecture: "amd64"}
+	arm64 := imgspecv1.Platform{OS: "linux", Architecture: "arm64"}
+	index, err := manifest.OCI1IndexFromManifest(testIndex(t, amd64, arm64))
+	require.NoError(t, err)
+	index.Manifests[0].Annotations = map[string]string{"variant": "preferred", "other": "x"}
+	index.Manifests[1].Annotations = map[string]string{"variant": "fallback"}
+	rawIndex, err := index.Serialize()
+	require.NoError(t, err)
+
+	res, err := filterListByAnnotations(rawIndex, imgspecv1.MediaTypeImageIndex, map[string]string{"variant": "preferred"})
+	require.NoError(t, err)
+	filtered, err := manifest.OCI1IndexFromManifest(res)
+	require.NoError(t, err)
+	require.Len(t, filtered.Manifests, 1)
+	assert.Equal(t, &amd64, filtered.Manifests[0].Platform)
+
+	// All instances match
+	res, err = filterListByAnnotations(rawIndex, imgspecv1.MediaTypeImageIndex, map[string]string{})
+	require.NoError(t, err)
+	assert.Equal(t, rawIndex, res)
+
+	// No instance matches
+	_, err = filterListByAnnotations(rawIndex, imgspecv1.MediaTypeImageIndex, map[string]string{"variant": "preferred", "other": "y"})
+	assert.Error(t, err)
+
+	// Not an OCI index
+	_, err = filterListByAnnotations(rawIndex, manifest.DockerV2ListMediaType, map[string]string{"variant": "preferred"})
+	assert.Error(t, err)
+	_, err = filterListByAnnotations([]byte("{}"), imgspecv1.MediaTypeImageManifest, map[string]string{"variant": "preferred"})
+	assert.Error(t, err)
+}
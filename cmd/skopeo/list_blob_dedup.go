@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+// dedupBlobsReference is a types.ImageReference wrapper; image destinations created from it remember the blobs written
+// during a copy, and reuse them for all other images of a list, without asking the underlying destination again.
+type dedupBlobsReference struct {
+	types.ImageReference
+}
+
+// NewImageDestination returns a types.ImageDestination for this reference.
+// The caller must call .Close() on the returned ImageDestination.
+func (ref dedupBlobsReference) NewImageDestination(ctx context.Context, sys *types.SystemContext) (types.ImageDestination, error) {
+	dest, err := ref.ImageReference.NewImageDestination(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	return &dedupBlobsDestination{ImageDestination: dest, ref: ref, blobs: map[digest.Digest]types.BlobInfo{}}, nil
+}
+
+// dedupBlobsDestination is a types.ImageDestination wrapper which remembers the blobs written, or found to already exist.
+type dedupBlobsDestination struct {
+	types.ImageDestination
+	ref dedupBlobsReference
+
+	mutex sync.Mutex
+	blobs map[digest.Digest]types.BlobInfo // Blobs known to exist in the destination
+}
+
+// Reference returns the reference used to set up this destination.
+func (d *dedupBlobsDestination) Reference() types.ImageReference {
+	return d.ref
+}
+
+// PutBlob writes contents of stream and returns data representing the result, remembering the blob for later reuse.
+func (d *dedupBlobsDestination) PutBlob(ctx context.Context, stream io.Reader, inputInfo types.BlobInfo, cache types.BlobInfoCache, isConfig bool) (types.BlobInfo, error) {
+	info, err := d.ImageDestination.PutBlob(ctx, stream, inputInfo, cache, isConfig)
+	if err != nil {
+		return types.BlobInfo{}, err
+	}
+	d.remember(info)
+	return info, nil
+}
+
+// TryReusingBlob checks whether the transport already contains, or can efficiently reuse, a blob; blobs written, or found,
+// earlier by this destination are reused without asking the underlying destination.
+func (d *dedupBlobsDestination) TryReusingBlob(ctx context.Context, info types.BlobInfo, cache types.BlobInfoCache, canSubstitute bool) (bool, types.BlobInfo, error) {
+	d.mutex.Lock()
+	known, ok := d.blobs[info.Digest]
+	d.mutex.Unlock()
+	if ok {
+		logrus.Debugf("Reusing blob %s already copied in this run", info.Digest)
+		return true, known, nil
+	}
+	reused, reusedInfo, err := d.ImageDestination.TryReusingBlob(ctx, info, cache, canSubstitute)
+	if err != nil || !reused {
+		return reused, reusedInfo, err
+	}
+	if reusedInfo.Digest == info.Digest {
+		d.remember(reusedInfo)
+	}
+	return true, reusedInfo, nil
+}
+
+// remember records that info exists in the destination.
+func (d *dedupBlobsDestination) remember(info types.BlobInfo) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.blobs[info.Digest] = info
+}
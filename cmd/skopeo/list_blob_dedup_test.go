@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingDestination is a types.ImageDestination which counts TryReusingBlob calls, and which contains only existingBlob.
+type countingDestination struct {
+	types.ImageDestination
+	existingBlob types.BlobInfo
+	reuseChecks  int
+}
+
+func (d *countingDestination) PutBlob(ctx context.Context, stream io.Reader, inputInfo types.BlobInfo, cache types.BlobInfoCache, isConfig bool) (types.BlobInfo, error) {
+	contents, err := io.ReadAll(stream)
+	if err != nil {
+		return types.BlobInfo{}, err
+	}
+	return types.BlobInfo{Digest: digest.FromBytes(contents), Size: int64(len(contents))}, nil
+}
+
+func (d *countingDestination) TryReusingBlob(ctx context.Context, info types.BlobInfo, cache types.BlobInfoCache, canSubstitute bool) (bool, types.BlobInfo, error) {
+	d.reuseChecks++
+	if info.Digest == d.existingBlob.Digest {
+		return true, d.existingBlob, nil
+	}
+	return false, types.BlobInfo{}, nil
+}
+
+func TestDedupBlobsDestination(t *testing.T) {
+	ctx := context.Background()
+	existing := types.BlobInfo{Digest: digest.FromString("existing"), Size: 8}
+	inner := &countingDestination{existingBlob: existing}
+	dest := &dedupBlobsDestination{ImageDestination: inner, blobs: map[digest.Digest]types.BlobInfo{}}
+
+	blob := []byte("blob")
+	blobInfo := types.BlobInfo{Digest: digest.FromBytes(blob), Size: int64(len(blob))}
+	reused, _, err := dest.TryReusingBlob(ctx, blobInfo, none.NoCache, false)
+	require.NoError(t, err)
+	assert.False(t, reused)
+	assert.Equal(t, 1, inner.reuseChecks)
+
+	// Written blobs are reused without asking the destination
+	_, err = dest.PutBlob(ctx, bytes.NewReader(blob), blobInfo, none.NoCache, false)
+	require.NoError(t, err)
+	reused, info, err := dest.TryReusingBlob(ctx, blobInfo, none.NoCache, false)
+	require.NoError(t, err)
+	assert.True(t, reused)
+	assert.Equal(t, blobInfo, info)
+	assert.Equal(t, 1, inner.reuseChecks)
+
+	// Blobs found in the destination are only looked up once
+	for i := 0; i < 2; i++ {
+		reused, info, err = dest.TryReusingBlob(ctx, existing, none.NoCache, false)
+		require.NoError(t, err)
+		assert.True(t, reused)
+		assert.Equal(t, existing, info)
+	}
+	assert.Equal(t, 2, inner.reuseChecks)
+}
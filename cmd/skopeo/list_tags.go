@@ -8,6 +8,7 @@ import (
 	"io"
 	"sort"
 	"strings"
+	"text/tabwriter"
 
 	"github.com/containers/common/pkg/retry"
 	"github.com/containers/image/v5/docker"
@@ -29,6 +30,7 @@ type tagsOptions struct {
 	global    *globalOptions
 	image     *imageOptions
 	retryOpts *retry.Options
+	output    string // Output format: "json", "lines" or "text"
 }
 
 var transportHandlers = map[string]func(ctx context.Context, sys *types.SystemContext, opts *tagsOptions, userInput string) (repositoryName string, tagListing []string, err error){
@@ -69,6 +71,7 @@ See skopeo-list-tags(1) section "REPOSITORY NAMES" for the expected format
 	}
 	adjustUsage(cmd)
 	flags := cmd.Flags()
+	flags.StringVar(&opts.output, "output", "json", "Output `FORMAT`: json, lines (one tag per line), or text (a table)")
 	flags.AddFlagSet(&sharedFlags)
 	flags.AddFlagSet(&imageFlags)
 	flags.AddFlagSet(&retryFlags)
@@ -170,6 +173,11 @@ func (opts *tagsOptions) run(args []string, stdout io.Writer) (retErr error) {
 	if len(args) != 1 {
 		return errorShouldDisplayUsage{errors.New("Exactly one non-option argument expected")}
 	}
+	switch opts.output {
+	case "json", "lines", "text":
+	default:
+		return fmt.Errorf("Invalid --output %q, expected json, lines or text", opts.output)
+	}
 
 	sys, err := opts.image.newSystemContext()
 	if err != nil {
@@ -194,16 +202,42 @@ func (opts *tagsOptions) run(args []string, stdout io.Writer) (retErr error) {
 			transport.Name(), supportedTransports(", "))
 	}
 
-	outputData := tagListOutput{
+	return opts.writeOutput(stdout, tagListOutput{
 		Repository: repositoryName,
 		Tags:       tagListing,
-	}
+	})
+}
 
-	out, err := json.MarshalIndent(outputData, "", "    ")
-	if err != nil {
+// writeOutput writes outputData to stdout, in the format specified by opts.output.
+func (opts *tagsOptions) writeOutput(stdout io.Writer, outputData tagListOutput) error {
+	switch opts.output {
+	case "lines":
+		for _, tag := range outputData.Tags {
+			if _, err := fmt.Fprintln(stdout, tag); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "text":
+		w := tabwriter.NewWriter(stdout, 0, 8, 2, ' ', 0)
+		if outputData.Repository != "" {
+			fmt.Fprintln(w, "REPOSITORY\tTAG")
+			for _, tag := range outputData.Tags {
+				fmt.Fprintf(w, "%s\t%s\n", outputData.Repository, tag)
+			}
+		} else {
+			fmt.Fprintln(w, "TAG")
+			for _, tag := range outputData.Tags {
+				fmt.Fprintln(w, tag)
+			}
+		}
+		return w.Flush()
+	default:
+		out, err := json.MarshalIndent(outputData, "", "    ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(stdout, "%s\n", string(out))
 		return err
 	}
-	_, err = fmt.Fprintf(stdout, "%s\n", string(out))
-
-	return err
 }
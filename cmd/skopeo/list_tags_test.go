@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"testing"
 
 	"github.com/containers/image/v5/transports/alltransports"
@@ -54,3 +55,30 @@ func TestDockerRepositoryReferenceParserDrift(t *testing.T) {
 		}
 	}
 }
+
+func TestTagsWriteOutput(t *testing.T) {
+	data := tagListOutput{Repository: "docker.io/library/busybox", Tags: []string{"1", "latest"}}
+	for _, c := range []struct {
+		output, expected string
+	}{
+		{"json", "{\n    \"Repository\": \"docker.io/library/busybox\",\n    \"Tags\": [\n        \"1\",\n        \"latest\"\n    ]\n}\n"},
+		{"lines", "1\nlatest\n"},
+		{"text", "REPOSITORY                 TAG\ndocker.io/library/busybox  1\ndocker.io/library/busybox  latest\n"},
+	} {
+		opts := tagsOptions{output: c.output}
+		stdout := bytes.Buffer{}
+		err := opts.writeOutput(&stdout, data)
+		require.NoError(t, err)
+		assert.Equal(t, c.expected, stdout.String(), c.output)
+	}
+
+	// docker-archive: has no repository
+	opts := tagsOptions{output: "text"}
+	stdout := bytes.Buffer{}
+	err := opts.writeOutput(&stdout, tagListOutput{Tags: []string{"busybox:latest"}})
+	require.NoError(t, err)
+	assert.Equal(t, "TAG\nbusybox:latest\n", stdout.String())
+
+	out, err := runSkopeo("list-tags", "--output", "yaml", "docker://busybox")
+	assertTestFailed(t, out, err, "Invalid --output")
+}
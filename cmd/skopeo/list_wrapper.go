@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// singleInstanceListReference is a types.ImageReference wrapper; image sources created from it
+// present the top-level manifest list reduced to only the instance chosen for the SystemContext
+// used to create the source.
+type singleInstanceListReference struct {
+	types.ImageReference
+}
+
+// NewImageSource returns a types.ImageSource for this reference.
+// The caller must call .Close() on the returned ImageSource.
+func (ref singleInstanceListReference) NewImageSource(ctx context.Context, sys *types.SystemContext) (types.ImageSource, error) {
+	src, err := ref.ImageReference.NewImageSource(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	rawManifest, mimeType, err := src.GetManifest(ctx, nil)
+	if err != nil {
+		src.Close()
+		return nil, fmt.Errorf("Error retrieving manifest for image: %w", err)
+	}
+	if !manifest.MIMETypeIsMultiImage(manifest.NormalizedMIMEType(mimeType)) {
+		src.Close()
+		return nil, fmt.Errorf("--keep-list-wrapper: %s is not a manifest list", ref.StringWithinTransport())
+	}
+	reduced, err := singleInstanceList(sys, rawManifest, mimeType)
+	if err != nil {
+		src.Close()
+		return nil, err
+	}
+	return &singleInstanceListSource{ImageSource: src, ref: ref, manifest: reduced, mimeType: mimeType}, nil
+}
+
+// singleInstanceListSource is a types.ImageSource wrapper which replaces the top-level manifest list.
+type singleInstanceListSource struct {
+	types.ImageSource
+	ref      singleInstanceListReference
+	manifest []byte
+	mimeType string
+}
+
+// Reference returns the reference used to set up this source.
+func (s *singleInstanceListSource) Reference() types.ImageReference {
+	return s.ref
+}
+
+// GetManifest returns the image's manifest along with its MIME type, returning the reduced list for the top-level manifest.
+func (s *singleInstanceListSource) GetManifest(ctx context.Context, instanceDigest *digest.Digest) ([]byte, string, error) {
+	if instanceDigest == nil {
+		return s.manifest, s.mimeType, nil
+	}
+	return s.ImageSource.GetManifest(ctx, instanceDigest)
+}
+
+// GetSignatures returns the image's signatures.
+// Signatures of the original top-level list do not apply to the reduced list, so none are returned for it.
+func (s *singleInstanceListSource) GetSignatures(ctx context.Context, instanceDigest *digest.Digest) ([][]byte, error) {
+	if instanceDigest == nil {
+		return nil, nil
+	}
+	return s.ImageSource.GetSignatures(ctx, instanceDigest)
+}
+
+// singleInstanceList returns the manifest list rawManifest (of type mimeType) reduced to the single instance
+// chosen for sys.
+func singleInstanceList(sys *types.SystemContext, rawManifest []byte, mimeType string) ([]byte, error) {
+	list, err := manifest.ListFromBlob(rawManifest, mimeType)
+	if err != nil {
+		return nil, fmt.Errorf("parsing manifest list: %w", err)
+	}
+	chosen, err := list.ChooseInstance(sys)
+	if err != nil {
+		return nil, err
+	}
+	switch manifest.NormalizedMIMEType(mimeType) {
+	case imgspecv1.MediaTypeImageIndex:
+		index, err := manifest.OCI1IndexFromManifest(rawManifest)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range index.Manifests {
+			if m.Digest == chosen {
+				index.Manifests = []imgspecv1.Descriptor{m}
+				return index.Serialize()
+			}
+		}
+	case manifest.DockerV2ListMediaType:
+		schema2List, err := manifest.Schema2ListFromManifest(rawManifest)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range schema2List.Manifests {
+			if m.Digest == chosen {
+				schema2List.Manifests = []manifest.Schema2ManifestDescriptor{m}
+				return schema2List.Serialize()
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported manifest list type %q", mimeType)
+	}
+	return nil, fmt.Errorf("internal error: chosen instance %s not found in manifest list", chosen.String())
+}
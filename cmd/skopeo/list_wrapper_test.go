@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/types"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSingleInstanceList(t *testing.T) {
+	armV7 := imgspecv1.Platform{OS: "linux", Architecture: "arm", Variant: "v7"}
+	amd64 := imgspecv1.Platform{OS: "linux", Architecture: "amd64"}
+	index := testIndex(t, amd64, armV7)
+
+	res, err := singleInstanceList(&types.SystemContext{OSChoice: "linux", ArchitectureChoice: "amd64"}, index, imgspecv1.MediaTypeImageIndex)
+	require.NoError(t, err)
+	reduced, err := manifest.OCI1IndexFromManifest(res)
+	require.NoError(t, err)
+	require.Len(t, reduced.Manifests, 1)
+	assert.Equal(t, &amd64, reduced.Manifests[0].Platform)
+
+	// No matching instance
+	_, err = singleInstanceList(&types.SystemContext{OSChoice: "linux", ArchitectureChoice: "s390x"}, index, imgspecv1.MediaTypeImageIndex)
+	assert.Error(t, err)
+}
@@ -1,19 +1,29 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"io"
+	"net/url"
 	"os"
+	"strings"
 
 	"github.com/containers/common/pkg/auth"
 	commonFlag "github.com/containers/common/pkg/flag"
+	"github.com/containers/image/v5/pkg/docker/config"
 	"github.com/containers/image/v5/types"
 	"github.com/spf13/cobra"
 )
 
 type loginOptions struct {
-	global    *globalOptions
-	loginOpts auth.LoginOptions
-	tlsVerify commonFlag.OptionalBool
+	global         *globalOptions
+	loginOpts      auth.LoginOptions
+	tlsVerify      commonFlag.OptionalBool
+	verifyOnly     bool   // Only check that the credentials are valid, do not store them
+	caFile         string // A PEM file with CA certificates to trust when connecting to the registry
+	dockerCompat   bool   // Update the Docker client configuration file, in its format
+	scope          string // A repository within the registry, to store the credentials for only that repository
+	revokePrevious bool   // After replacing stored credentials, revoke the previous token, if supported for the registry
 }
 
 func loginCmd(global *globalOptions) *cobra.Command {
@@ -30,19 +40,104 @@ func loginCmd(global *globalOptions) *cobra.Command {
 	adjustUsage(cmd)
 	flags := cmd.Flags()
 	commonFlag.OptionalBoolFlag(flags, &opts.tlsVerify, "tls-verify", "require HTTPS and verify certificates when accessing the registry")
+	flags.StringVar(&opts.caFile, "ca-file", "", "trust CA certificates in the PEM file at `PATH` when connecting to the registry")
+	flags.BoolVar(&opts.dockerCompat, "docker-compat", false, "update the Docker client configuration file ($DOCKER_CONFIG/config.json or ~/.docker/config.json) in a Docker-compatible format")
+	flags.StringVar(&opts.scope, "scope", "", "store the credentials only for `REPOSITORY` (a namespace or repository path) within REGISTRY, instead of the whole registry")
+	flags.BoolVar(&opts.revokePrevious, "revoke-previous", false, "After replacing stored credentials, revoke the previously stored token, if the registry supports it")
+	flags.BoolVar(&opts.verifyOnly, "verify-only", false, "Check that the credentials are accepted by the registry, without storing them")
 	flags.AddFlagSet(auth.GetLoginFlags(&opts.loginOpts))
 	return cmd
 }
 
 func (opts *loginOptions) run(args []string, stdout io.Writer) error {
+	if opts.verifyOnly && opts.loginOpts.GetLoginSet {
+		return errors.New("--verify-only and --get-login cannot be used together")
+	}
+	if opts.revokePrevious && (opts.verifyOnly || opts.loginOpts.GetLoginSet) {
+		return errors.New("--revoke-previous cannot be used together with --verify-only or --get-login")
+	}
+	if opts.scope != "" {
+		if len(args) != 1 {
+			return errors.New("--scope requires a REGISTRY argument")
+		}
+		if strings.Contains(strings.TrimSuffix(args[0], "/"), "/") {
+			return fmt.Errorf("--scope can not be used with %q, which already contains a repository path", args[0])
+		}
+		args = []string{strings.TrimSuffix(args[0], "/") + "/" + strings.Trim(opts.scope, "/")}
+	}
+	if opts.dockerCompat {
+		if err := setDockerCompatAuthFile(opts.loginOpts.AuthFile, &opts.loginOpts.DockerCompatAuthFile); err != nil {
+			return err
+		}
+	}
 	ctx, cancel := opts.global.commandTimeoutContext()
 	defer cancel()
 	opts.loginOpts.Stdout = stdout
 	opts.loginOpts.Stdin = os.Stdin
 	opts.loginOpts.AcceptRepositories = true
+	opts.loginOpts.NoWriteBack = opts.verifyOnly
+	if opts.caFile != "" {
+		certDir, err := opts.global.certDirWithCAFile(opts.loginOpts.CertDir, opts.caFile)
+		if err != nil {
+			return err
+		}
+		opts.loginOpts.CertDir = certDir
+	}
 	sys := opts.global.newSystemContext()
 	if opts.tlsVerify.Present() {
 		sys.DockerInsecureSkipTLSVerify = types.NewOptionalBool(!opts.tlsVerify.Value())
 	}
-	return auth.Login(ctx, sys, &opts.loginOpts, args)
+	if !opts.loginOpts.NoWriteBack && !opts.loginOpts.GetLoginSet {
+		lock, err := lockAuthFile(authFileWritePath(sys, opts.loginOpts.AuthFile, opts.loginOpts.DockerCompatAuthFile))
+		if err != nil {
+			return err
+		}
+		defer lock.Unlock()
+	}
+	if !opts.revokePrevious || len(args) != 1 {
+		return auth.Login(ctx, sys, &opts.loginOpts, args)
+	}
+
+	credentialsSys, key, registry := opts.storedCredentialsLocation(sys, args[0])
+	previous, err := config.GetCredentials(credentialsSys, key)
+	if err != nil {
+		return fmt.Errorf("reading the previous credentials: %w", err)
+	}
+	if err := auth.Login(ctx, sys, &opts.loginOpts, args); err != nil {
+		return err
+	}
+	if previous.Password == "" {
+		return nil
+	}
+	current, err := config.GetCredentials(credentialsSys, key)
+	if err != nil {
+		return fmt.Errorf("reading the new credentials: %w", err)
+	}
+	if current.Password != previous.Password {
+		revokePreviousToken(ctx, registry, previous.Password)
+	}
+	return nil
+}
+
+// storedCredentialsLocation returns a SystemContext for reading the credentials updated by auth.Login for arg,
+// the key of the credentials, and the registry host.
+func (opts *loginOptions) storedCredentialsLocation(sys *types.SystemContext, arg string) (*types.SystemContext, string, string) {
+	res := *sys
+	switch {
+	case opts.loginOpts.AuthFile != "":
+		res.AuthFilePath = opts.loginOpts.AuthFile
+	case opts.loginOpts.DockerCompatAuthFile != "":
+		res.DockerCompatAuthFilePath = opts.loginOpts.DockerCompatAuthFile
+	default:
+		if authFileVar := os.Getenv("REGISTRY_AUTH_FILE"); authFileVar != "" {
+			res.AuthFilePath = authFileVar
+		}
+	}
+	key := strings.TrimSuffix(arg, "/")
+	registry, _, _ := strings.Cut(key, "/")
+	if u, err := url.Parse(arg); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		// auth.Login uses only the host of URL arguments.
+		key, registry = u.Host, u.Host
+	}
+	return &res, key, registry
 }
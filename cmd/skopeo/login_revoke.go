@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// tokenRevokeTimeout limits the time a single --revoke-previous request may take.
+const tokenRevokeTimeout = 30 * time.Second
+
+// tokenRevoker revokes token, a password previously stored for a registry.
+// It returns (false, nil) if token is not a kind of token it can revoke.
+type tokenRevoker func(ctx context.Context, client *http.Client, token string) (bool, error)
+
+// tokenRevokers maps registry hosts to the revoker used for them by --revoke-previous.
+var tokenRevokers = map[string]tokenRevoker{
+	"ghcr.io": revokeGitHubToken,
+}
+
+// gitHubCredentialsRevokeURL is the GitHub API endpoint used to revoke credentials; a variable so that tests can replace it.
+var gitHubCredentialsRevokeURL = "https://api.github.com/credentials/revoke"
+
+// gitHubTokenPrefixes are the prefixes of GitHub access tokens which gitHubCredentialsRevokeURL accepts.
+var gitHubTokenPrefixes = []string{"ghp_", "gho_", "ghu_", "ghs_", "ghr_", "github_pat_"}
+
+// revokeGitHubToken is a tokenRevoker for GitHub access tokens, used for ghcr.io.
+func revokeGitHubToken(ctx context.Context, client *http.Client, token string) (bool, error) {
+	isToken := false
+	for _, prefix := range gitHubTokenPrefixes {
+		if strings.HasPrefix(token, prefix) {
+			isToken = true
+			break
+		}
+	}
+	if !isToken {
+		return false, nil
+	}
+	body, err := json.Marshal(struct {
+		Credentials []string `json:"credentials"`
+	}{Credentials: []string{token}})
+	if err != nil {
+		return false, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, gitHubCredentialsRevokeURL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/vnd.github+json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("revoking the token: %s", resp.Status)
+	}
+	return true, nil
+}
+
+// revokePreviousToken revokes previousToken, the password previously stored for registry, if a revoker for registry
+// supports it. This is best-effort: failures are only logged, because the new credentials have already been stored.
+func revokePreviousToken(ctx context.Context, registry, previousToken string) {
+	revoker, ok := tokenRevokers[registry]
+	if !ok {
+		logrus.Infof("--revoke-previous: revoking tokens is not supported for %s, skipped", registry)
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, tokenRevokeTimeout)
+	defer cancel()
+	revoked, err := revoker(ctx, &http.Client{}, previousToken)
+	switch {
+	case err != nil:
+		logrus.Warnf("--revoke-previous: failed to revoke the previous token for %s: %v", registry, err)
+	case !revoked:
+		logrus.Infof("--revoke-previous: the previous credentials for %s are not a revocable token, skipped", registry)
+	default:
+		logrus.Infof("--revoke-previous: revoked the previous token for %s", registry)
+	}
+}
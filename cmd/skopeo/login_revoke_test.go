@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/containers/image/v5/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRevokeGitHubToken(t *testing.T) {
+	var revoked []string
+	status := http.StatusAccepted
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var body struct {
+			Credentials []string `json:"credentials"`
+		}
+		err := json.NewDecoder(req.Body).Decode(&body)
+		require.NoError(t, err)
+		assert.Equal(t, http.MethodPost, req.Method)
+		revoked = append(revoked, body.Credentials...)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	defer func(original string) { gitHubCredentialsRevokeURL = original }(gitHubCredentialsRevokeURL)
+	gitHubCredentialsRevokeURL = server.URL
+
+	ok, err := revokeGitHubToken(context.Background(), server.Client(), "ghp_old")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"ghp_old"}, revoked)
+
+	// Passwords which are not GitHub tokens are not sent anywhere.
+	ok, err = revokeGitHubToken(context.Background(), server.Client(), "a password")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, []string{"ghp_old"}, revoked)
+
+	status = http.StatusUnprocessableEntity
+	_, err = revokeGitHubToken(context.Background(), server.Client(), "github_pat_old")
+	assert.Error(t, err)
+}
+
+func TestLoginStoredCredentialsLocation(t *testing.T) {
+	t.Setenv("REGISTRY_AUTH_FILE", "")
+	opts := loginOptions{}
+	opts.loginOpts.AuthFile = "/auth.json"
+	for _, c := range []struct{ arg, key, registry string }{
+		{"example.com", "example.com", "example.com"},
+		{"example.com/team/app/", "example.com/team/app", "example.com"},
+		{"https://example.com:5000/v2/", "example.com:5000", "example.com:5000"},
+	} {
+		sys, key, registry := opts.storedCredentialsLocation(&types.SystemContext{}, c.arg)
+		assert.Equal(t, "/auth.json", sys.AuthFilePath, c.arg)
+		assert.Equal(t, c.key, key, c.arg)
+		assert.Equal(t, c.registry, registry, c.arg)
+	}
+}
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestLogin(t *testing.T) {
@@ -15,4 +19,30 @@ func TestLogin(t *testing.T) {
 	// exist in c/common/pkg/auth, not here.
 	out, err := runSkopeo("login", "--authfile", authFile, "--compat-auth-file", compatAuthFile, "example.com")
 	assertTestFailed(t, out, err, "options for paths to the credential file and to the Docker-compatible credential file can not be set simultaneously")
+
+	out, err = runSkopeo("login", "--verify-only", "--get-login", "example.com")
+	assertTestFailed(t, out, err, "--verify-only and --get-login cannot be used together")
+
+	out, err = runSkopeo("login", "--revoke-previous", "--verify-only", "example.com")
+	assertTestFailed(t, out, err, "--revoke-previous cannot be used together with --verify-only or --get-login")
+}
+
+func TestLoginScope(t *testing.T) {
+	authFile := filepath.Join(t.TempDir(), "auth.json")
+	// user:pass for the registry, user2:pass for example.com/team/app
+	err := os.WriteFile(authFile, []byte(`{"auths":{"example.com":{"auth":"dXNlcjpwYXNz"},"example.com/team/app":{"auth":"dXNlcjI6cGFzcw=="}}}`), 0o600)
+	require.NoError(t, err)
+
+	// The most specific matching credentials are used
+	out, err := runSkopeo("login", "--authfile", authFile, "--get-login", "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "user\n", out)
+	out, err = runSkopeo("login", "--authfile", authFile, "--get-login", "--scope", "team/app", "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "user2\n", out)
+
+	out, err = runSkopeo("login", "--scope", "team/app", "example.com/other")
+	assertTestFailed(t, out, err, "already contains a repository path")
+	out, err = runSkopeo("login", "--scope", "team/app")
+	assertTestFailed(t, out, err, "--scope requires a REGISTRY argument")
 }
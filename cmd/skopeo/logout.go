@@ -10,9 +10,10 @@ import (
 )
 
 type logoutOptions struct {
-	global     *globalOptions
-	logoutOpts auth.LogoutOptions
-	tlsVerify  commonFlag.OptionalBool
+	global       *globalOptions
+	logoutOpts   auth.LogoutOptions
+	tlsVerify    commonFlag.OptionalBool
+	dockerCompat bool // Update the Docker client configuration file, in its format
 }
 
 func logoutCmd(global *globalOptions) *cobra.Command {
@@ -29,16 +30,27 @@ func logoutCmd(global *globalOptions) *cobra.Command {
 	adjustUsage(cmd)
 	flags := cmd.Flags()
 	commonFlag.OptionalBoolFlag(flags, &opts.tlsVerify, "tls-verify", "require HTTPS and verify certificates when accessing the registry")
+	flags.BoolVar(&opts.dockerCompat, "docker-compat", false, "update the Docker client configuration file ($DOCKER_CONFIG/config.json or ~/.docker/config.json) in a Docker-compatible format")
 	flags.AddFlagSet(auth.GetLogoutFlags(&opts.logoutOpts))
 	return cmd
 }
 
 func (opts *logoutOptions) run(args []string, stdout io.Writer) error {
+	if opts.dockerCompat {
+		if err := setDockerCompatAuthFile(opts.logoutOpts.AuthFile, &opts.logoutOpts.DockerCompatAuthFile); err != nil {
+			return err
+		}
+	}
 	opts.logoutOpts.Stdout = stdout
 	opts.logoutOpts.AcceptRepositories = true
 	sys := opts.global.newSystemContext()
 	if opts.tlsVerify.Present() {
 		sys.DockerInsecureSkipTLSVerify = types.NewOptionalBool(!opts.tlsVerify.Value())
 	}
+	lock, err := lockAuthFile(authFileWritePath(sys, opts.logoutOpts.AuthFile, opts.logoutOpts.DockerCompatAuthFile))
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
 	return auth.Logout(sys, &opts.logoutOpts, args)
 }
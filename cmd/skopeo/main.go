@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"fmt"
+	"os"
 	"strings"
 	"time"
 
@@ -33,6 +34,9 @@ type globalOptions struct {
 	commandTimeout     time.Duration           // Timeout for the command execution
 	registriesConfPath string                  // Path to the "registries.conf" file
 	tmpDir             string                  // Path to use for big temporary files
+	temporaryDirs      []string                // Temporary directories to remove when the command exits, see newTemporaryDir
+	errorFormat        string                  // Format used to report a failure of the command: "text" or "json"
+	commandArgs        []string                // Positional arguments of the command being run
 }
 
 // requireSubcommand returns an error if no sub command is provided
@@ -91,9 +95,12 @@ func createApp() (*cobra.Command, *globalOptions) {
 		logrus.Fatal("unable to mark registries-conf flag as hidden")
 	}
 	rootCommand.PersistentFlags().StringVar(&opts.tmpDir, "tmpdir", "", "directory used to store temporary files")
+	rootCommand.PersistentFlags().StringVar(&opts.errorFormat, "error-format", "text", "`FORMAT` (text or json) used to report a failure")
 	flag := commonFlag.OptionalBoolFlag(rootCommand.Flags(), &opts.tlsVerify, "tls-verify", "Require HTTPS and verify certificates when accessing the registry")
 	flag.Hidden = true
 	rootCommand.AddCommand(
+		benchmarkCmd(&opts),
+		blobDigestCmd(),
 		copyCmd(&opts),
 		deleteCmd(&opts),
 		generateSigstoreKeyCmd(),
@@ -101,13 +108,16 @@ func createApp() (*cobra.Command, *globalOptions) {
 		layersCmd(&opts),
 		loginCmd(&opts),
 		logoutCmd(&opts),
+		manifestConvertCmd(),
 		manifestDigestCmd(),
 		proxyCmd(&opts),
 		syncCmd(&opts),
 		standaloneSignCmd(),
 		standaloneVerifyCmd(),
 		tagsCmd(&opts),
+		trustCmd(&opts),
 		untrustedSignatureDumpCmd(),
+		verifyComposefsCmd(),
 	)
 	return rootCommand, &opts
 }
@@ -117,6 +127,12 @@ func (opts *globalOptions) before(cmd *cobra.Command, args []string) error {
 	if opts.debug {
 		logrus.SetLevel(logrus.DebugLevel)
 	}
+	if opts.errorFormat != "text" && opts.errorFormat != "json" {
+		err := fmt.Errorf("Invalid --error-format %q, expected text or json", opts.errorFormat)
+		opts.errorFormat = "text"
+		return err
+	}
+	opts.commandArgs = args
 	if opts.tlsVerify.Present() {
 		logrus.Warn("'--tls-verify' is deprecated, please set this on the specific subcommand")
 	}
@@ -127,18 +143,48 @@ func main() {
 	if reexec.Init() {
 		return
 	}
-	rootCmd, _ := createApp()
-	if err := rootCmd.Execute(); err != nil {
+	rootCmd, opts := createApp()
+	err := rootCmd.Execute()
+	opts.cleanUp()
+	if err != nil {
+		if opts.errorFormat == "json" {
+			os.Exit(opts.reportJSONError(os.Stderr, err))
+		}
 		logrus.Fatal(err)
 	}
 }
 
+// newTemporaryDir creates a new temporary directory, which is removed by opts.cleanUp.
+func (opts *globalOptions) newTemporaryDir(pattern string) (string, error) {
+	dir, err := os.MkdirTemp(opts.tmpDir, pattern)
+	if err != nil {
+		return "", err
+	}
+	opts.temporaryDirs = append(opts.temporaryDirs, dir)
+	return dir, nil
+}
+
+// cleanUp removes any temporary files created while running the command.
+func (opts *globalOptions) cleanUp() {
+	for _, dir := range opts.temporaryDirs {
+		if err := os.RemoveAll(dir); err != nil {
+			logrus.Warnf("Error removing temporary directory %s: %v", dir, err)
+		}
+	}
+	opts.temporaryDirs = nil
+}
+
+// insecureAcceptAnythingPolicy returns a *signature.Policy which accepts any image.
+func insecureAcceptAnythingPolicy() *signature.Policy {
+	return &signature.Policy{Default: []signature.PolicyRequirement{signature.NewPRInsecureAcceptAnything()}}
+}
+
 // getPolicyContext returns a *signature.PolicyContext based on opts.
 func (opts *globalOptions) getPolicyContext() (*signature.PolicyContext, error) {
 	var policy *signature.Policy // This could be cached across calls in opts.
 	var err error
 	if opts.insecurePolicy {
-		policy = &signature.Policy{Default: []signature.PolicyRequirement{signature.NewPRInsecureAcceptAnything()}}
+		policy = insecureAcceptAnythingPolicy()
 	} else if opts.policyPath == "" {
 		policy, err = signature.DefaultPolicy(nil)
 	} else {
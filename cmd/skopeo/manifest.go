@@ -6,7 +6,9 @@ import (
 	"io"
 	"os"
 
+	commonFlag "github.com/containers/common/pkg/flag"
 	"github.com/containers/image/v5/manifest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/spf13/cobra"
 )
 
@@ -42,3 +44,211 @@ func (opts *manifestDigestOptions) run(args []string, stdout io.Writer) error {
 	fmt.Fprintf(stdout, "%s\n", digest)
 	return nil
 }
+
+type manifestConvertOptions struct {
+	from       commonFlag.OptionalString // Expected format of the input manifest
+	to         string                    // Format to convert the manifest to
+	outputPath string                    // Write the converted manifest to this file instead of standard output
+}
+
+func manifestConvertCmd() *cobra.Command {
+	var opts manifestConvertOptions
+	cmd := &cobra.Command{
+		Use:     "manifest-convert [command options] --to FORMAT MANIFEST-FILE",
+		Short:   "Convert a manifest file to a different manifest format",
+		Example: "skopeo manifest-convert --from v2s2 --to oci --output oci-manifest.json manifest.json",
+	}
+	cmd.RunE = commandAction(func(args []string, stdout io.Writer) error {
+		return opts.run(args, stdout, cmd.ErrOrStderr())
+	})
+	adjustUsage(cmd)
+	flags := cmd.Flags()
+	flags.Var(commonFlag.NewOptionalStringValue(&opts.from), "from", "MANIFEST TYPE (oci or v2s2) of MANIFEST-FILE (default is to detect the type)")
+	flags.StringVar(&opts.to, "to", "", "MANIFEST TYPE (oci or v2s2) to convert to")
+	flags.StringVarP(&opts.outputPath, "output", "o", "", "Write the converted manifest to `PATH` (default is to write it to standard output, and its digest to standard error)")
+	return cmd
+}
+
+// run converts the manifest in args, and writes its digest to stdout, or to stderr if the converted manifest is written to stdout.
+func (opts *manifestConvertOptions) run(args []string, stdout, stderr io.Writer) error {
+	if len(args) != 1 {
+		return errors.New("Usage: skopeo manifest-convert --to FORMAT manifest")
+	}
+	if opts.to == "" {
+		return errors.New("--to must be specified")
+	}
+	manifestPath := args[0]
+
+	toMIMEType, err := parseConvertibleManifestFormat(opts.to)
+	if err != nil {
+		return err
+	}
+	man, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return fmt.Errorf("Error reading manifest from %s: %v", manifestPath, err)
+	}
+	fromMIMEType := manifest.NormalizedMIMEType(manifest.GuessMIMEType(man))
+	if opts.from.Present() {
+		expected, err := parseConvertibleManifestFormat(opts.from.Value())
+		if err != nil {
+			return err
+		}
+		if manifest.MIMETypeIsMultiImage(fromMIMEType) {
+			expected = listMIMETypeForManifestMIMEType(expected)
+		}
+		if fromMIMEType != expected {
+			return fmt.Errorf("Manifest %s has type %q, not %q", manifestPath, fromMIMEType, expected)
+		}
+	}
+
+	converted, err := convertManifest(man, fromMIMEType, toMIMEType)
+	if err != nil {
+		return fmt.Errorf("Error converting manifest %s: %w", manifestPath, err)
+	}
+	digest, err := manifest.Digest(converted)
+	if err != nil {
+		return fmt.Errorf("Error computing digest: %v", err)
+	}
+	digestOutput := stdout
+	if opts.outputPath == "" {
+		if _, err := stdout.Write(converted); err != nil {
+			return err
+		}
+		digestOutput = stderr // Keep stdout usable in a pipe
+	} else if err := os.WriteFile(opts.outputPath, converted, 0644); err != nil {
+		return fmt.Errorf("Error writing manifest to %s: %w", opts.outputPath, err)
+	}
+	fmt.Fprintf(digestOutput, "%s\n", digest)
+	return nil
+}
+
+// parseConvertibleManifestFormat is parseManifestFormat, restricted to the formats
+// which can be converted between without modifying any blobs.
+func parseConvertibleManifestFormat(format string) (string, error) {
+	mimeType, err := parseManifestFormat(format)
+	if err != nil {
+		return "", err
+	}
+	if mimeType == manifest.DockerV2Schema1SignedMediaType {
+		// A schema1 manifest embeds a different representation of the config, and the layer list is different.
+		return "", errors.New("conversions to or from v2s1 require modifying the image, use (skopeo copy --format v2s1) instead")
+	}
+	return mimeType, nil
+}
+
+// listMIMETypeForManifestMIMEType returns the multi-image MIME type corresponding to the single-image mimeType.
+func listMIMETypeForManifestMIMEType(mimeType string) string {
+	if mimeType == imgspecv1.MediaTypeImageManifest {
+		return imgspecv1.MediaTypeImageIndex
+	}
+	return manifest.DockerV2ListMediaType
+}
+
+// convertManifest converts man from fromMIMEType to the format of toMIMEType (or the corresponding list format),
+// keeping all referenced blobs unchanged.
+func convertManifest(man []byte, fromMIMEType, toMIMEType string) ([]byte, error) {
+	if manifest.MIMETypeIsMultiImage(fromMIMEType) {
+		list, err := manifest.ListFromBlob(man, fromMIMEType)
+		if err != nil {
+			return nil, err
+		}
+		converted, err := manifest.ConvertListToMIMEType(list, listMIMETypeForManifestMIMEType(toMIMEType))
+		if err != nil {
+			return nil, err
+		}
+		return converted.Serialize()
+	}
+
+	switch {
+	case fromMIMEType == toMIMEType:
+		return man, nil
+	case fromMIMEType == manifest.DockerV2Schema2MediaType && toMIMEType == imgspecv1.MediaTypeImageManifest:
+		return convertSchema2ToOCI1(man)
+	case fromMIMEType == imgspecv1.MediaTypeImageManifest && toMIMEType == manifest.DockerV2Schema2MediaType:
+		return convertOCI1ToSchema2(man)
+	default:
+		return nil, fmt.Errorf("converting %q to %q is not supported", fromMIMEType, toMIMEType)
+	}
+}
+
+// convertSchema2ToOCI1 converts a Docker schema2 manifest to an OCI manifest referring to the same blobs.
+// The config blob is reused as is, the OCI image configuration format is a subset of the Docker one.
+func convertSchema2ToOCI1(man []byte) ([]byte, error) {
+	m, err := manifest.Schema2FromManifest(man)
+	if err != nil {
+		return nil, err
+	}
+	if m.ConfigDescriptor.MediaType != manifest.DockerV2Schema2ConfigMediaType {
+		return nil, fmt.Errorf("unsupported config media type %q", m.ConfigDescriptor.MediaType)
+	}
+	config := imgspecv1.Descriptor{
+		MediaType: imgspecv1.MediaTypeImageConfig,
+		Digest:    m.ConfigDescriptor.Digest,
+		Size:      m.ConfigDescriptor.Size,
+	}
+	layers := make([]imgspecv1.Descriptor, len(m.LayersDescriptors))
+	for i, l := range m.LayersDescriptors {
+		layers[i] = imgspecv1.Descriptor{
+			Digest: l.Digest,
+			Size:   l.Size,
+			URLs:   l.URLs,
+		}
+		switch l.MediaType {
+		case manifest.DockerV2Schema2ForeignLayerMediaType:
+			layers[i].MediaType = imgspecv1.MediaTypeImageLayerNonDistributable //nolint:staticcheck // NonDistributable layers are deprecated, but we want to continue to support manipulating pre-existing images.
+		case manifest.DockerV2Schema2ForeignLayerMediaTypeGzip:
+			layers[i].MediaType = imgspecv1.MediaTypeImageLayerNonDistributableGzip //nolint:staticcheck // NonDistributable layers are deprecated, but we want to continue to support manipulating pre-existing images.
+		case manifest.DockerV2SchemaLayerMediaTypeUncompressed:
+			layers[i].MediaType = imgspecv1.MediaTypeImageLayer
+		case manifest.DockerV2Schema2LayerMediaType:
+			layers[i].MediaType = imgspecv1.MediaTypeImageLayerGzip
+		default:
+			return nil, fmt.Errorf("unknown layer media type %q", l.MediaType)
+		}
+	}
+	return manifest.OCI1FromComponents(config, layers).Serialize()
+}
+
+// convertOCI1ToSchema2 converts an OCI manifest to a Docker schema2 manifest referring to the same blobs.
+func convertOCI1ToSchema2(man []byte) ([]byte, error) {
+	m, err := manifest.OCI1FromManifest(man)
+	if err != nil {
+		return nil, err
+	}
+	if m.Config.MediaType != imgspecv1.MediaTypeImageConfig {
+		return nil, fmt.Errorf("unsupported config media type %q, the manifest does not describe a container image", m.Config.MediaType)
+	}
+	if len(m.Annotations) != 0 || m.Subject != nil {
+		return nil, errors.New("the manifest uses annotations or a subject, which can not be represented in a Docker schema2 manifest")
+	}
+	config := manifest.Schema2Descriptor{
+		MediaType: manifest.DockerV2Schema2ConfigMediaType,
+		Digest:    m.Config.Digest,
+		Size:      m.Config.Size,
+	}
+	layers := make([]manifest.Schema2Descriptor, len(m.Layers))
+	for i, l := range m.Layers {
+		if len(l.Annotations) != 0 {
+			return nil, fmt.Errorf("layer %s uses annotations, which can not be represented in a Docker schema2 manifest", l.Digest)
+		}
+		layers[i] = manifest.Schema2Descriptor{
+			Digest: l.Digest,
+			Size:   l.Size,
+			URLs:   l.URLs,
+		}
+		switch l.MediaType {
+		case imgspecv1.MediaTypeImageLayerNonDistributable: //nolint:staticcheck // NonDistributable layers are deprecated, but we want to continue to support manipulating pre-existing images.
+			layers[i].MediaType = manifest.DockerV2Schema2ForeignLayerMediaType
+		case imgspecv1.MediaTypeImageLayerNonDistributableGzip: //nolint:staticcheck // NonDistributable layers are deprecated, but we want to continue to support manipulating pre-existing images.
+			layers[i].MediaType = manifest.DockerV2Schema2ForeignLayerMediaTypeGzip
+		case imgspecv1.MediaTypeImageLayer:
+			layers[i].MediaType = manifest.DockerV2SchemaLayerMediaTypeUncompressed
+		case imgspecv1.MediaTypeImageLayerGzip:
+			layers[i].MediaType = manifest.DockerV2Schema2LayerMediaType
+		default:
+			// Notably zstd and encrypted layers can not be represented without modifying the layer blobs.
+			return nil, fmt.Errorf("layer media type %q can not be represented in a Docker schema2 manifest", l.MediaType)
+		}
+	}
+	return manifest.Schema2FromComponents(config, layers).Serialize()
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/containers/common/pkg/retry"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
+	"github.com/containers/image/v5/types"
+	"github.com/docker/distribution/registry/api/errcode"
+	v2 "github.com/docker/distribution/registry/api/v2"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+// serverErrorStatusRegexp matches the messages of c/image errors for unexpected 5xx HTTP responses, which are not exported types.
+var serverErrorStatusRegexp = regexp.MustCompile(`(received unexpected HTTP status: |StatusCode: )5\d\d`)
+
+// manifestPutRetryReference is a types.ImageReference wrapper; image destinations created from it
+// retry failed manifest uploads up to retries times, and uploads failed because the registry does not know
+// about a referenced blob up to blobUnknownRetries times, without copying the blobs again.
+type manifestPutRetryReference struct {
+	types.ImageReference
+	retries            int
+	blobUnknownRetries int
+	delay              time.Duration // Passed to retry.Options; 0 means exponential backoff
+}
+
+// NewImageDestination returns a types.ImageDestination for this reference.
+// The caller must call .Close() on the returned ImageDestination.
+func (ref manifestPutRetryReference) NewImageDestination(ctx context.Context, sys *types.SystemContext) (types.ImageDestination, error) {
+	dest, err := ref.ImageReference.NewImageDestination(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	return &manifestPutRetryDestination{ImageDestination: dest, ref: ref}, nil
+}
+
+// manifestPutRetryDestination is a types.ImageDestination wrapper which retries PutManifest according to ref.
+type manifestPutRetryDestination struct {
+	types.ImageDestination
+	ref manifestPutRetryReference
+}
+
+// Reference returns the reference used to set up this destination.
+func (d *manifestPutRetryDestination) Reference() types.ImageReference {
+	return d.ref
+}
+
+// PutManifest writes manifest to the destination.
+// It is only called after all blobs referenced by manifest have been written, so a failure which shows that the
+// destination has accepted the blobs but not the manifest can be retried without repeating the rest of the copy.
+// An eventually-consistent registry may briefly not know about blobs which have just been uploaded,
+// so failures referring to an unknown blob are retried separately, after checking which blobs are missing.
+func (d *manifestPutRetryDestination) PutManifest(ctx context.Context, rawManifest []byte, instanceDigest *digest.Digest) error {
+	retries, blobUnknownRetries := 0, 0
+	checkBlobs := false // The previous attempt failed with an unknown blob error
+	return retry.IfNecessary(ctx, func() error {
+		if checkBlobs {
+			d.logMissingBlobs(ctx, rawManifest)
+			checkBlobs = false
+		}
+		return d.ImageDestination.PutManifest(ctx, rawManifest, instanceDigest)
+	}, &retry.Options{
+		MaxRetry: d.ref.retries + d.ref.blobUnknownRetries,
+		Delay:    d.ref.delay,
+		IsErrorRetryable: func(err error) bool {
+			if isManifestBlobUnknownError(err) {
+				if blobUnknownRetries >= d.ref.blobUnknownRetries {
+					return false
+				}
+				blobUnknownRetries++
+				checkBlobs = true
+				logrus.Infof("Retrying the manifest upload after an unknown blob error (retry %d of %d)", blobUnknownRetries, d.ref.blobUnknownRetries)
+				return true
+			}
+			if retries >= d.ref.retries || !isManifestPutErrorRetryable(err) {
+				return false
+			}
+			retries++
+			logrus.Infof("Retrying the manifest upload (attempt %d of --manifest-put-retries %d)", retries, d.ref.retries)
+			return true
+		},
+	})
+}
+
+// logMissingBlobs logs the config and layer blobs of rawManifest which the destination does not report as present.
+// Manifest lists are not checked.
+func (d *manifestPutRetryDestination) logMissingBlobs(ctx context.Context, rawManifest []byte) {
+	mimeType := manifest.GuessMIMEType(rawManifest)
+	if manifest.MIMETypeIsMultiImage(mimeType) {
+		return
+	}
+	m, err := manifest.FromBlob(rawManifest, mimeType)
+	if err != nil {
+		logrus.Debugf("Error parsing the manifest to check its blobs: %v", err)
+		return
+	}
+	blobs := []types.BlobInfo{m.ConfigInfo()}
+	for _, layer := range m.LayerInfos() {
+		blobs = append(blobs, layer.BlobInfo)
+	}
+	for _, blob := range blobs {
+		if blob.Digest == "" { // No config in schema1 manifests
+			continue
+		}
+		present, _, err := d.ImageDestination.TryReusingBlob(ctx, blob, none.NoCache, false)
+		switch {
+		case err != nil:
+			logrus.Debugf("Error checking blob %s at the destination: %v", blob.Digest, err)
+		case !present:
+			logrus.Infof("Blob %s is not yet reported as present at the destination", blob.Digest)
+		}
+	}
+}
+
+// isManifestBlobUnknownError returns true if err, returned by PutManifest, reports that the registry does not know about a referenced blob.
+func isManifestBlobUnknownError(err error) bool {
+	var ec errcode.ErrorCoder
+	return errors.As(err, &ec) && ec.ErrorCode() == v2.ErrorCodeManifestBlobUnknown
+}
+
+// isManifestPutErrorRetryable returns true if err, returned by PutManifest, is likely to be transient.
+// Errors about the manifest or the blobs it references, e.g. a blob the registry does not know about, are not retried:
+// repeating the same upload would usually fail the same way (but see manifestPutRetryReference.blobUnknownRetries).
+func isManifestPutErrorRetryable(err error) bool {
+	var rejected types.ManifestTypeRejectedError
+	if errors.As(err, &rejected) {
+		return false
+	}
+	var ec errcode.ErrorCoder
+	if errors.As(err, &ec) {
+		status := ec.ErrorCode().Descriptor().HTTPStatusCode
+		return status >= http.StatusInternalServerError || status == http.StatusTooManyRequests
+	}
+	return retry.IsErrorRetryable(err) || serverErrorStatusRegexp.MatchString(err.Error())
+}
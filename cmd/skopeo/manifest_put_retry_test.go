@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/containers/image/v5/transports/alltransports"
+	"github.com/containers/image/v5/types"
+	"github.com/docker/distribution/registry/api/errcode"
+	v2 "github.com/docker/distribution/registry/api/v2"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingManifestDestination is a types.ImageDestination which fails the first len(errs) PutManifest calls with errs,
+// and which reports that it does not contain any blob.
+type failingManifestDestination struct {
+	types.ImageDestination
+	errs         []error
+	calls        int
+	checkedBlobs []digest.Digest
+}
+
+func (d *failingManifestDestination) TryReusingBlob(ctx context.Context, info types.BlobInfo, cache types.BlobInfoCache, canSubstitute bool) (bool, types.BlobInfo, error) {
+	d.checkedBlobs = append(d.checkedBlobs, info.Digest)
+	return false, types.BlobInfo{}, nil
+}
+
+func (d *failingManifestDestination) PutManifest(ctx context.Context, manifest []byte, instanceDigest *digest.Digest) error {
+	d.calls++
+	if d.calls <= len(d.errs) {
+		return d.errs[d.calls-1]
+	}
+	return nil
+}
+
+func TestManifestPutRetryDestination(t *testing.T) {
+	ref, err := alltransports.ParseImageName("dir:" + t.TempDir())
+	require.NoError(t, err)
+	newDestWithBlobUnknownRetries := func(retries, blobUnknownRetries int, errs ...error) (*manifestPutRetryDestination, *failingManifestDestination) {
+		inner := &failingManifestDestination{errs: errs}
+		return &manifestPutRetryDestination{
+			ImageDestination: inner,
+			ref:              manifestPutRetryReference{ImageReference: ref, retries: retries, blobUnknownRetries: blobUnknownRetries, delay: time.Millisecond},
+		}, inner
+	}
+	newDest := func(retries int, errs ...error) (*manifestPutRetryDestination, *failingManifestDestination) {
+		return newDestWithBlobUnknownRetries(retries, 0, errs...)
+	}
+	serverError := errors.New("received unexpected HTTP status: 502 Bad Gateway")
+
+	// Transient failures are retried.
+	dest, inner := newDest(2, serverError, errcode.ErrorCodeUnavailable)
+	err = dest.PutManifest(context.Background(), []byte("{}"), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, inner.calls)
+
+	// … but at most retries times.
+	dest, inner = newDest(1, serverError, serverError)
+	err = dest.PutManifest(context.Background(), []byte("{}"), nil)
+	assert.ErrorIs(t, err, serverError)
+	assert.Equal(t, 2, inner.calls)
+
+	// Errors about the manifest or its blobs are not retried.
+	for _, e := range []error{
+		v2.ErrorCodeManifestBlobUnknown,
+		types.ManifestTypeRejectedError{Err: errors.New("unsupported manifest type")},
+		errors.New("received unexpected HTTP status: 400 Bad Request"),
+	} {
+		dest, inner = newDest(2, e)
+		err = dest.PutManifest(context.Background(), []byte("{}"), nil)
+		assert.Error(t, err, e.Error())
+		assert.Equal(t, 1, inner.calls, e.Error())
+	}
+
+	// Unknown blob errors are retried separately, after checking the blobs.
+	blobUnknown := fmt.Errorf("uploading manifest latest to example.com/test: %w", v2.ErrorCodeManifestBlobUnknown.WithDetail("sha256:0000"))
+	imageManifest := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json",` +
+		`"config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"sha256:0000000000000000000000000000000000000000000000000000000000000000","size":2},` +
+		`"layers":[{"mediaType":"application/vnd.oci.image.layer.v1.tar","digest":"sha256:1111111111111111111111111111111111111111111111111111111111111111","size":1}]}`)
+	dest, inner = newDestWithBlobUnknownRetries(1, 2, blobUnknown, serverError, blobUnknown)
+	err = dest.PutManifest(context.Background(), imageManifest, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, inner.calls)
+	assert.Equal(t, []digest.Digest{
+		"sha256:0000000000000000000000000000000000000000000000000000000000000000", "sha256:1111111111111111111111111111111111111111111111111111111111111111",
+		"sha256:0000000000000000000000000000000000000000000000000000000000000000", "sha256:1111111111111111111111111111111111111111111111111111111111111111",
+	}, inner.checkedBlobs)
+	dest, inner = newDestWithBlobUnknownRetries(2, 1, blobUnknown, blobUnknown)
+	err = dest.PutManifest(context.Background(), imageManifest, nil)
+	assert.Error(t, err)
+	assert.Equal(t, 2, inner.calls)
+}
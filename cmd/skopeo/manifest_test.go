@@ -1,9 +1,15 @@
 package main
 
 import (
+	"bytes"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/containers/image/v5/manifest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestManifestDigest(t *testing.T) {
@@ -29,3 +35,64 @@ func TestManifestDigest(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, fixturesTestImageManifestDigest.String()+"\n", out)
 }
+
+func TestManifestConvert(t *testing.T) {
+	// Invalid command-line arguments
+	for _, args := range [][]string{
+		{},
+		{"a1", "a2"},
+	} {
+		out, err := runSkopeo(append([]string{"manifest-convert", "--to", "oci"}, args...)...)
+		assertTestFailed(t, out, err, "Usage")
+	}
+	out, err := runSkopeo("manifest-convert", "fixtures/image.manifest.json")
+	assertTestFailed(t, out, err, "--to must be specified")
+	out, err = runSkopeo("manifest-convert", "--to", "v2s1", "fixtures/image.manifest.json")
+	assertTestFailed(t, out, err, "v2s1")
+	out, err = runSkopeo("manifest-convert", "--from", "oci", "--to", "v2s2", "fixtures/image.manifest.json")
+	assertTestFailed(t, out, err, "has type")
+
+	// Error reading manifest
+	out, err = runSkopeo("manifest-convert", "--to", "oci", "/this/does/not/exist")
+	assertTestFailed(t, out, err, "/this/does/not/exist")
+
+	// Success, and a round trip back to the original format
+	dir := t.TempDir()
+	ociPath := filepath.Join(dir, "oci.json")
+	out, err = runSkopeo("manifest-convert", "--from", "v2s2", "--to", "oci", "--output", ociPath, "fixtures/image.manifest.json")
+	require.NoError(t, err)
+	ociManifest, err := os.ReadFile(ociPath)
+	require.NoError(t, err)
+	ociDigest, err := manifest.Digest(ociManifest)
+	require.NoError(t, err)
+	assert.Equal(t, ociDigest.String()+"\n", out)
+	assert.Equal(t, imgspecv1.MediaTypeImageManifest, manifest.GuessMIMEType(ociManifest))
+	oci, err := manifest.OCI1FromManifest(ociManifest)
+	require.NoError(t, err)
+	original, err := manifest.Schema2FromManifest(mustReadFile(t, "fixtures/image.manifest.json"))
+	require.NoError(t, err)
+	assert.Equal(t, original.ConfigDescriptor.Digest, oci.Config.Digest)
+	require.Len(t, oci.Layers, len(original.LayersDescriptors))
+	for i := range oci.Layers {
+		assert.Equal(t, original.LayersDescriptors[i].Digest, oci.Layers[i].Digest)
+		assert.Equal(t, imgspecv1.MediaTypeImageLayerGzip, oci.Layers[i].MediaType)
+	}
+
+	// Without --output, the manifest is written to stdout and its digest to stderr
+	var stdout, stderr bytes.Buffer
+	opts := manifestConvertOptions{to: "v2s2"}
+	err = opts.run([]string{ociPath}, &stdout, &stderr)
+	require.NoError(t, err)
+	roundTrip, err := manifest.Schema2FromManifest(stdout.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, original, roundTrip)
+	roundTripDigest, err := manifest.Digest(stdout.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, roundTripDigest.String()+"\n", stderr.String())
+}
+
+func mustReadFile(t *testing.T, path string) []byte {
+	contents, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return contents
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/containers/common/pkg/retry"
+	"github.com/containers/image/v5/copy"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+)
+
+// maxLayerCount returns the largest number of layers of the images which copying srcRef with imageListSelection would copy
+// (choosing an instance from a manifest list based on sys, if only one image is copied), and a description of that image.
+func maxLayerCount(ctx context.Context, sys *types.SystemContext, srcRef types.ImageReference, imageListSelection copy.ImageListSelection,
+	retryOpts *retry.Options) (_ int, _ string, retErr error) {
+	var src types.ImageSource
+	if err := retry.IfNecessary(ctx, func() error {
+		var err error
+		src, err = srcRef.NewImageSource(ctx, sys)
+		return err
+	}, retryOpts); err != nil {
+		return 0, "", err
+	}
+	defer func() {
+		if err := src.Close(); err != nil {
+			retErr = noteCloseFailure(retErr, "closing image", err)
+		}
+	}()
+	getManifest := func(instance *digest.Digest) ([]byte, string, error) {
+		var rawManifest []byte
+		var mimeType string
+		if err := retry.IfNecessary(ctx, func() error {
+			var err error
+			rawManifest, mimeType, err = src.GetManifest(ctx, instance)
+			return err
+		}, retryOpts); err != nil {
+			return nil, "", fmt.Errorf("Error retrieving manifest for image: %w", err)
+		}
+		return rawManifest, mimeType, nil
+	}
+	rawManifest, mimeType, err := getManifest(nil)
+	if err != nil {
+		return 0, "", err
+	}
+	if !manifest.MIMETypeIsMultiImage(manifest.NormalizedMIMEType(mimeType)) {
+		count, err := manifestLayerCount(rawManifest, mimeType)
+		return count, "the image", err
+	}
+	list, err := manifest.ListFromBlob(rawManifest, mimeType)
+	if err != nil {
+		return 0, "", err
+	}
+	var instances []digest.Digest
+	switch imageListSelection {
+	case copy.CopySystemImage:
+		instance, err := list.ChooseInstance(sys)
+		if err != nil {
+			return 0, "", err
+		}
+		instances = []digest.Digest{instance}
+	case copy.CopyAllImages:
+		instances = list.Instances()
+	default: // Only the list itself is copied
+		return 0, "", nil
+	}
+	maxCount, description := 0, ""
+	for _, instance := range instances {
+		rawManifest, mimeType, err := getManifest(&instance)
+		if err != nil {
+			return 0, "", err
+		}
+		count, err := manifestLayerCount(rawManifest, mimeType)
+		if err != nil {
+			return 0, "", err
+		}
+		if count > maxCount || description == "" {
+			maxCount, description = count, fmt.Sprintf("image %s", instance)
+		}
+	}
+	return maxCount, description, nil
+}
+
+// manifestLayerCount returns the number of layers in rawManifest, a single-image manifest of type mimeType.
+func manifestLayerCount(rawManifest []byte, mimeType string) (int, error) {
+	m, err := manifest.FromBlob(rawManifest, manifest.NormalizedMIMEType(mimeType))
+	if err != nil {
+		return 0, fmt.Errorf("Error parsing manifest for image: %w", err)
+	}
+	return len(m.LayerInfos()), nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopyMaxLayers(t *testing.T) {
+	layers := [][]byte{
+		testLayerTar(t, tar.Header{Name: "a", Typeflag: tar.TypeReg, Mode: 0o644}),
+		testLayerTar(t, tar.Header{Name: "b", Typeflag: tar.TypeReg, Mode: 0o644}),
+		testLayerTar(t, tar.Header{Name: "c", Typeflag: tar.TypeReg, Mode: 0o644}),
+	}
+	diffIDs, descriptors := "", ""
+	for i, layer := range layers {
+		if i != 0 {
+			diffIDs += ","
+			descriptors += ","
+		}
+		diffIDs += `"` + digest.FromBytes(layer).String() + `"`
+		descriptors += `{"mediaType":"application/vnd.oci.image.layer.v1.tar","digest":"` + digest.FromBytes(layer).String() + `","size":` + strconv.Itoa(len(layer)) + `}`
+	}
+	config := []byte(`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers","diff_ids":[` + diffIDs + `]},` +
+		`"history":[{"created_by":"a"},{"created_by":"b"},{"created_by":"c"}]}`)
+	configDigest := digest.FromBytes(config)
+	src := testDirImage(t, []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json",`+
+		`"config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"`+configDigest.String()+`","size":`+strconv.Itoa(len(config))+`},`+
+		`"layers":[`+descriptors+`]}`))
+	err := os.WriteFile(filepath.Join(src, configDigest.Encoded()), config, 0o644)
+	require.NoError(t, err)
+	for _, layer := range layers {
+		err := os.WriteFile(filepath.Join(src, digest.FromBytes(layer).Encoded()), layer, 0o644)
+		require.NoError(t, err)
+	}
+
+	dest := t.TempDir()
+	out, err := runSkopeo("--insecure-policy", "copy", "--max-layers", "2", "dir:"+src, "dir:"+dest)
+	assertTestFailed(t, out, err, "the image has 3 layers, more than --max-layers 2")
+	assert.NoFileExists(t, filepath.Join(dest, "manifest.json"))
+
+	_, err = runSkopeo("--insecure-policy", "copy", "--max-layers", "3", "dir:"+src, "dir:"+dest)
+	require.NoError(t, err)
+
+	// --squash-over merges the lowest layers, keeping the top one
+	dest = t.TempDir()
+	_, err = runSkopeo("--insecure-policy", "copy", "--max-layers", "2", "--squash-over", "dir:"+src, "dir:"+dest)
+	require.NoError(t, err)
+	destManifestBlob, err := os.ReadFile(filepath.Join(dest, "manifest.json"))
+	require.NoError(t, err)
+	var destManifest imgspecv1.Manifest
+	err = json.Unmarshal(destManifestBlob, &destManifest)
+	require.NoError(t, err)
+	require.Len(t, destManifest.Layers, 2)
+	assert.Equal(t, digest.FromBytes(layers[2]), destManifest.Layers[1].Digest)
+	squashedLayer, err := os.ReadFile(filepath.Join(dest, destManifest.Layers[0].Digest.Encoded()))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, layerTarNames(t, squashedLayer))
+	destConfigBlob, err := os.ReadFile(filepath.Join(dest, destManifest.Config.Digest.Encoded()))
+	require.NoError(t, err)
+	var destConfig imgspecv1.Image
+	err = json.Unmarshal(destConfigBlob, &destConfig)
+	require.NoError(t, err)
+	assert.Equal(t, []digest.Digest{destManifest.Layers[0].Digest, digest.FromBytes(layers[2])}, destConfig.RootFS.DiffIDs)
+	require.Len(t, destConfig.History, 2)
+	assert.Equal(t, "c", destConfig.History[1].CreatedBy)
+
+	for _, c := range []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"--max-layers", "-1"}, "Invalid --max-layers"},
+		{[]string{"--squash-over"}, "--squash-over requires --max-layers"},
+		{[]string{"--max-layers", "2", "--squash-over", "--all"}, "--squash-over cannot be used together with --all or --multi-arch"},
+	} {
+		args := append(append([]string{"--insecure-policy", "copy"}, c.args...), "dir:"+src, "dir:"+t.TempDir())
+		out, err := runSkopeo(args...)
+		assertTestFailed(t, out, err, c.expected)
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sirupsen/logrus"
+)
+
+// equivalentMediaTypes lists pairs of config and layer media types which label blobs with identical contents,
+// so that a descriptor can be relabeled from one to the other without changing the blob.
+var equivalentMediaTypes = [][2]string{
+	{imgspecv1.MediaTypeImageConfig, manifest.DockerV2Schema2ConfigMediaType},
+	{imgspecv1.MediaTypeImageLayer, manifest.DockerV2SchemaLayerMediaTypeUncompressed},
+	{imgspecv1.MediaTypeImageLayerGzip, manifest.DockerV2Schema2LayerMediaType},
+	{imgspecv1.MediaTypeImageLayerNonDistributableGzip, manifest.DockerV2Schema2ForeignLayerMediaTypeGzip}, //nolint:staticcheck // NonDistributable layers are deprecated, but we want to continue to support manipulating pre-existing images.
+	{imgspecv1.MediaTypeImageLayerNonDistributable, manifest.DockerV2Schema2ForeignLayerMediaType},         //nolint:staticcheck // NonDistributable layers are deprecated, but we want to continue to support manipulating pre-existing images.
+}
+
+// parseMediaTypeRewrites parses FROM=TO values of --rewrite-media-type into a FROM → TO map.
+func parseMediaTypeRewrites(values []string) (map[string]string, error) {
+	res := map[string]string{}
+	for _, value := range values {
+		from, to, ok := strings.Cut(value, "=")
+		if !ok || from == "" || to == "" {
+			return nil, fmt.Errorf("Invalid --rewrite-media-type %q, expected FROM=TO", value)
+		}
+		equivalent := false
+		for _, pair := range equivalentMediaTypes {
+			if (from == pair[0] && to == pair[1]) || (from == pair[1] && to == pair[0]) {
+				equivalent = true
+				break
+			}
+		}
+		if !equivalent {
+			return nil, fmt.Errorf("Invalid --rewrite-media-type %q: blobs labeled %q can not be relabeled %q without changing their contents", value, from, to)
+		}
+		if existing, ok := res[from]; ok && existing != to {
+			return nil, fmt.Errorf("Conflicting --rewrite-media-type values for %q", from)
+		}
+		res[from] = to
+	}
+	return res, nil
+}
+
+// rewriteManifestMediaTypes returns rawManifest, an image manifest, with config and layer media types replaced according to rewrites,
+// and whether anything was changed. If nothing was changed, rawManifest is returned as is.
+func rewriteManifestMediaTypes(rawManifest []byte, rewrites map[string]string) ([]byte, bool, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(rawManifest, &fields); err != nil {
+		return nil, false, fmt.Errorf("parsing manifest: %w", err)
+	}
+	changed := false
+	rewrite := func(descriptor map[string]json.RawMessage) error {
+		var mediaType string
+		if err := json.Unmarshal(descriptor["mediaType"], &mediaType); err != nil {
+			return nil // No media type, nothing to rewrite
+		}
+		if to, ok := rewrites[mediaType]; ok {
+			raw, err := json.Marshal(to)
+			if err != nil {
+				return err
+			}
+			descriptor["mediaType"] = raw
+			changed = true
+		}
+		return nil
+	}
+
+	if rawConfig, ok := fields["config"]; ok {
+		var config map[string]json.RawMessage
+		if err := json.Unmarshal(rawConfig, &config); err != nil {
+			return nil, false, fmt.Errorf("parsing manifest config descriptor: %w", err)
+		}
+		if err := rewrite(config); err != nil {
+			return nil, false, err
+		}
+		var err error
+		if fields["config"], err = json.Marshal(config); err != nil {
+			return nil, false, err
+		}
+	}
+	if rawLayers, ok := fields["layers"]; ok {
+		var layers []map[string]json.RawMessage
+		if err := json.Unmarshal(rawLayers, &layers); err != nil {
+			return nil, false, fmt.Errorf("parsing manifest layer descriptors: %w", err)
+		}
+		for _, layer := range layers {
+			if err := rewrite(layer); err != nil {
+				return nil, false, err
+			}
+		}
+		var err error
+		if fields["layers"], err = json.Marshal(layers); err != nil {
+			return nil, false, err
+		}
+	}
+	if !changed {
+		return rawManifest, false, nil
+	}
+	res, err := json.Marshal(fields)
+	if err != nil {
+		return nil, false, err
+	}
+	return res, true, nil
+}
+
+// mediaTypeRewritingReference is a types.ImageReference wrapper; image sources created from it
+// present manifests with config and layer media types rewritten according to rewrites,
+// or with all manifests converted to OCI if toOCI.
+type mediaTypeRewritingReference struct {
+	types.ImageReference
+	rewrites map[string]string
+	toOCI    bool // Convert manifests to OCI without changing any blobs, ignoring rewrites
+	modified bool // The top-level manifest presented by the source differs from the original
+}
+
+// rewriteImageManifest returns rawManifest, an image manifest with mimeType, rewritten as specified by ref,
+// its MIME type, and whether anything was changed.
+func (ref mediaTypeRewritingReference) rewriteImageManifest(rawManifest []byte, mimeType string) ([]byte, string, bool, error) {
+	if ref.toOCI {
+		return normalizeManifestToOCI(rawManifest, mimeType)
+	}
+	res, changed, err := rewriteManifestMediaTypes(rawManifest, ref.rewrites)
+	return res, mimeType, changed, err
+}
+
+// DockerReference returns a Docker reference associated with this reference.
+// If the top-level manifest was modified, any digest is dropped, because it applies to the original manifest.
+func (ref mediaTypeRewritingReference) DockerReference() reference.Named {
+	res := ref.ImageReference.DockerReference()
+	if res == nil || !ref.modified {
+		return res
+	}
+	if _, ok := res.(reference.Digested); ok {
+		return reference.TrimNamed(res)
+	}
+	return res
+}
+
+// NewImageSource returns a types.ImageSource for this reference.
+// The caller must call .Close() on the returned ImageSource.
+func (ref mediaTypeRewritingReference) NewImageSource(ctx context.Context, sys *types.SystemContext) (types.ImageSource, error) {
+	src, err := ref.ImageReference.NewImageSource(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	res, err := newMediaTypeRewritingSource(ctx, src, ref)
+	if err != nil {
+		src.Close()
+		return nil, err
+	}
+	return res, nil
+}
+
+// rewrittenManifest is a manifest presented by mediaTypeRewritingSource.
+type rewrittenManifest struct {
+	manifest []byte
+	mimeType string
+}
+
+// mediaTypeRewritingSource is a types.ImageSource wrapper which presents rewritten manifests.
+type mediaTypeRewritingSource struct {
+	types.ImageSource
+	ref       mediaTypeRewritingReference
+	topLevel  rewrittenManifest
+	instances map[digest.Digest]rewrittenManifest // Rewritten instances of a manifest list, indexed by their new digest
+}
+
+// newMediaTypeRewritingSource returns a mediaTypeRewritingSource for src, rewriting all manifests upfront,
+// so that a rewritten manifest list can refer to the rewritten instances.
+func newMediaTypeRewritingSource(ctx context.Context, src types.ImageSource, ref mediaTypeRewritingReference) (*mediaTypeRewritingSource, error) {
+	rawManifest, mimeType, err := src.GetManifest(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Error retrieving manifest for image: %w", err)
+	}
+	res := &mediaTypeRewritingSource{
+		ImageSource: src,
+		ref:         ref,
+		topLevel:    rewrittenManifest{manifest: rawManifest, mimeType: mimeType},
+		instances:   map[digest.Digest]rewrittenManifest{},
+	}
+
+	if !manifest.MIMETypeIsMultiImage(manifest.NormalizedMIMEType(mimeType)) {
+		rewritten, rewrittenMIMEType, changed, err := ref.rewriteImageManifest(rawManifest, mimeType)
+		if err != nil {
+			return nil, err
+		}
+		res.topLevel = rewrittenManifest{manifest: rewritten, mimeType: rewrittenMIMEType}
+		res.ref.modified = changed
+		return res, nil
+	}
+
+	list, err := manifest.ListFromBlob(rawManifest, mimeType)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing manifest list: %w", err)
+	}
+	updates := []manifest.ListUpdate{}
+	listChanged := false
+	for _, instanceDigest := range list.Instances() {
+		update, err := list.Instance(instanceDigest)
+		if err != nil {
+			return nil, err
+		}
+		instanceDigest := instanceDigest
+		instanceManifest, instanceMIMEType, err := src.GetManifest(ctx, &instanceDigest)
+		if err != nil {
+			return nil, fmt.Errorf("Error retrieving manifest for image %s: %w", instanceDigest, err)
+		}
+		rewritten, rewrittenMIMEType, changed, err := ref.rewriteImageManifest(instanceManifest, instanceMIMEType)
+		if err != nil {
+			return nil, fmt.Errorf("rewriting media types of image %s: %w", instanceDigest, err)
+		}
+		if changed {
+			newDigest := digest.FromBytes(rewritten)
+			res.instances[newDigest] = rewrittenManifest{manifest: rewritten, mimeType: rewrittenMIMEType}
+			update.Digest = newDigest
+			update.Size = int64(len(rewritten))
+			update.MediaType = rewrittenMIMEType
+			listChanged = true
+		}
+		updates = append(updates, update)
+	}
+	if ref.toOCI && manifest.NormalizedMIMEType(mimeType) != imgspecv1.MediaTypeImageIndex {
+		list, err = list.ConvertToMIMEType(imgspecv1.MediaTypeImageIndex)
+		if err != nil {
+			return nil, err
+		}
+		res.topLevel.mimeType = imgspecv1.MediaTypeImageIndex
+		listChanged = true
+	}
+	if listChanged {
+		if err := list.UpdateInstances(updates); err != nil {
+			return nil, err
+		}
+		rewrittenList, err := list.Serialize()
+		if err != nil {
+			return nil, err
+		}
+		res.topLevel.manifest = rewrittenList
+		res.ref.modified = true
+	}
+	return res, nil
+}
+
+// Reference returns the reference used to set up this source.
+func (s *mediaTypeRewritingSource) Reference() types.ImageReference {
+	return s.ref
+}
+
+// GetManifest returns the image's manifest along with its MIME type, with media types rewritten.
+func (s *mediaTypeRewritingSource) GetManifest(ctx context.Context, instanceDigest *digest.Digest) ([]byte, string, error) {
+	if instanceDigest == nil {
+		return s.topLevel.manifest, s.topLevel.mimeType, nil
+	}
+	if rewritten, ok := s.instances[*instanceDigest]; ok {
+		return rewritten.manifest, rewritten.mimeType, nil
+	}
+	return s.ImageSource.GetManifest(ctx, instanceDigest)
+}
+
+// GetSignatures returns the image's signatures; signatures of rewritten manifests, which no longer apply, are dropped.
+func (s *mediaTypeRewritingSource) GetSignatures(ctx context.Context, instanceDigest *digest.Digest) ([][]byte, error) {
+	if instanceDigest != nil {
+		if _, ok := s.instances[*instanceDigest]; ok {
+			return nil, nil
+		}
+		return s.ImageSource.GetSignatures(ctx, instanceDigest)
+	}
+	sigs, err := s.ImageSource.GetSignatures(ctx, nil)
+	if err != nil || !s.ref.modified {
+		return sigs, err
+	}
+	if len(sigs) != 0 {
+		logrus.Warnf("Not copying %d signature(s) of a manifest with rewritten media types", len(sigs))
+	}
+	return nil, nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/containers/image/v5/manifest"
+	digest "github.com/opencontainers/go-digest"
+	imgspecspecs "github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMediaTypeRewrites(t *testing.T) {
+	res, err := parseMediaTypeRewrites([]string{})
+	require.NoError(t, err)
+	assert.Empty(t, res)
+
+	res, err = parseMediaTypeRewrites([]string{
+		imgspecv1.MediaTypeImageLayerGzip + "=" + manifest.DockerV2Schema2LayerMediaType,
+		manifest.DockerV2Schema2ConfigMediaType + "=" + imgspecv1.MediaTypeImageConfig,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		imgspecv1.MediaTypeImageLayerGzip:       manifest.DockerV2Schema2LayerMediaType,
+		manifest.DockerV2Schema2ConfigMediaType: imgspecv1.MediaTypeImageConfig,
+	}, res)
+
+	for _, c := range [][]string{
+		{"no-equals-sign"},
+		{"=" + manifest.DockerV2Schema2LayerMediaType},
+		{imgspecv1.MediaTypeImageLayerGzip + "="},
+		{imgspecv1.MediaTypeImageLayerGzip + "=" + manifest.DockerV2SchemaLayerMediaTypeUncompressed}, // Would require decompression
+		{imgspecv1.MediaTypeImageLayerZstd + "=" + manifest.DockerV2Schema2LayerMediaType},
+		{
+			imgspecv1.MediaTypeImageLayerGzip + "=" + manifest.DockerV2Schema2LayerMediaType,
+			imgspecv1.MediaTypeImageLayerGzip + "=" + imgspecv1.MediaTypeImageLayerGzip,
+		},
+	} {
+		_, err := parseMediaTypeRewrites(c)
+		assert.Error(t, err, c)
+	}
+}
+
+func TestCopyRewriteMediaType(t *testing.T) {
+	src := testDirImageWithBlobs(t)
+	dest := t.TempDir()
+	_, err := runSkopeo("--insecure-policy", "copy",
+		"--rewrite-media-type", imgspecv1.MediaTypeImageLayer+"="+manifest.DockerV2SchemaLayerMediaTypeUncompressed,
+		"dir:"+src, "dir:"+dest)
+	require.NoError(t, err)
+	destManifest, err := os.ReadFile(filepath.Join(dest, "manifest.json"))
+	require.NoError(t, err)
+	m, err := manifest.OCI1FromManifest(destManifest)
+	require.NoError(t, err)
+	assert.Equal(t, imgspecv1.MediaTypeImageConfig, m.Config.MediaType)
+	require.Len(t, m.Layers, 1)
+	assert.Equal(t, manifest.DockerV2SchemaLayerMediaTypeUncompressed, m.Layers[0].MediaType)
+
+	// Manifest lists refer to the rewritten instances
+	listSrc := testDirImageWithBlobs(t)
+	instanceManifest, err := os.ReadFile(filepath.Join(listSrc, "manifest.json"))
+	require.NoError(t, err)
+	instanceDigest := digest.FromBytes(instanceManifest)
+	err = os.WriteFile(filepath.Join(listSrc, instanceDigest.Encoded()+".manifest.json"), instanceManifest, 0o644)
+	require.NoError(t, err)
+	index, err := json.Marshal(imgspecv1.Index{
+		Versioned: imgspecspecs.Versioned{SchemaVersion: 2},
+		MediaType: imgspecv1.MediaTypeImageIndex,
+		Manifests: []imgspecv1.Descriptor{{MediaType: imgspecv1.MediaTypeImageManifest, Digest: instanceDigest, Size: int64(len(instanceManifest)),
+			Platform: &imgspecv1.Platform{OS: "linux", Architecture: "amd64"}}},
+	})
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(listSrc, "manifest.json"), index, 0o644)
+	require.NoError(t, err)
+	dest = t.TempDir()
+	_, err = runSkopeo("--insecure-policy", "copy", "--all",
+		"--rewrite-media-type", imgspecv1.MediaTypeImageLayer+"="+manifest.DockerV2SchemaLayerMediaTypeUncompressed,
+		"dir:"+listSrc, "dir:"+dest)
+	require.NoError(t, err)
+	destIndex, err := os.ReadFile(filepath.Join(dest, "manifest.json"))
+	require.NoError(t, err)
+	copiedIndex, err := manifest.OCI1IndexFromManifest(destIndex)
+	require.NoError(t, err)
+	require.Len(t, copiedIndex.Manifests, 1)
+	copiedInstanceDigest := copiedIndex.Manifests[0].Digest
+	assert.NotEqual(t, instanceDigest, copiedInstanceDigest)
+	copiedInstance, err := os.ReadFile(filepath.Join(dest, copiedInstanceDigest.Encoded()+".manifest.json"))
+	require.NoError(t, err)
+	assert.Equal(t, copiedInstanceDigest, digest.FromBytes(copiedInstance))
+	assert.Contains(t, string(copiedInstance), manifest.DockerV2SchemaLayerMediaTypeUncompressed)
+
+	out, err := runSkopeo("--insecure-policy", "copy", "--preserve-digests",
+		"--rewrite-media-type", imgspecv1.MediaTypeImageLayer+"="+manifest.DockerV2SchemaLayerMediaTypeUncompressed,
+		"dir:"+src, "dir:"+t.TempDir())
+	assertTestFailed(t, out, err, "cannot be used together with --preserve-digests")
+}
+
+func TestCopyNormalizeToOCI(t *testing.T) {
+	src := testDirImageWithBlobs(t)
+	ociManifest, err := os.ReadFile(filepath.Join(src, "manifest.json"))
+	require.NoError(t, err)
+	dockerManifest := strings.NewReplacer(imgspecv1.MediaTypeImageManifest, manifest.DockerV2Schema2MediaType,
+		imgspecv1.MediaTypeImageConfig, manifest.DockerV2Schema2ConfigMediaType,
+		imgspecv1.MediaTypeImageLayer, manifest.DockerV2SchemaLayerMediaTypeUncompressed).Replace(string(ociManifest))
+	err = os.WriteFile(filepath.Join(src, "manifest.json"), []byte(dockerManifest), 0o644)
+	require.NoError(t, err)
+
+	dest := t.TempDir()
+	_, err = runSkopeo("--insecure-policy", "copy", "--normalize-to-oci", "dir:"+src, "dir:"+dest)
+	require.NoError(t, err)
+	destManifest, err := os.ReadFile(filepath.Join(dest, "manifest.json"))
+	require.NoError(t, err)
+	assert.Equal(t, imgspecv1.MediaTypeImageManifest, manifest.GuessMIMEType(destManifest))
+	m, err := manifest.OCI1FromManifest(destManifest)
+	require.NoError(t, err)
+	assert.Equal(t, imgspecv1.MediaTypeImageConfig, m.Config.MediaType)
+	require.Len(t, m.Layers, 1)
+	assert.Equal(t, imgspecv1.MediaTypeImageLayer, m.Layers[0].MediaType)
+	// The blobs are not modified.
+	srcManifest, err := manifest.Schema2FromManifest([]byte(dockerManifest))
+	require.NoError(t, err)
+	assert.Equal(t, srcManifest.ConfigDescriptor.Digest, m.Config.Digest)
+	assert.Equal(t, srcManifest.LayersDescriptors[0].Digest, m.Layers[0].Digest)
+
+	// Docker manifest lists are converted to OCI indexes referring to the converted instances
+	srcDigest := digest.FromString(dockerManifest)
+	err = os.WriteFile(filepath.Join(src, srcDigest.Encoded()+".manifest.json"), []byte(dockerManifest), 0o644)
+	require.NoError(t, err)
+	list, err := manifest.Schema2ListFromComponents([]manifest.Schema2ManifestDescriptor{{
+		Schema2Descriptor: manifest.Schema2Descriptor{MediaType: manifest.DockerV2Schema2MediaType, Digest: srcDigest, Size: int64(len(dockerManifest))},
+		Platform:          manifest.Schema2PlatformSpec{OS: "linux", Architecture: "amd64"},
+	}}).Serialize()
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(src, "manifest.json"), list, 0o644)
+	require.NoError(t, err)
+	dest = t.TempDir()
+	_, err = runSkopeo("--insecure-policy", "copy", "--all", "--normalize-to-oci", "dir:"+src, "dir:"+dest)
+	require.NoError(t, err)
+	destIndex, err := os.ReadFile(filepath.Join(dest, "manifest.json"))
+	require.NoError(t, err)
+	assert.Equal(t, imgspecv1.MediaTypeImageIndex, manifest.GuessMIMEType(destIndex))
+	index, err := manifest.OCI1IndexFromManifest(destIndex)
+	require.NoError(t, err)
+	require.Len(t, index.Manifests, 1)
+	assert.Equal(t, imgspecv1.MediaTypeImageManifest, index.Manifests[0].MediaType)
+	assert.Equal(t, digest.FromBytes(destManifest), index.Manifests[0].Digest)
+
+	// Schema1 images can't be converted without creating a config
+	schema1Src := testDirImage(t, []byte(`{"schemaVersion":1,"name":"test","tag":"latest","architecture":"amd64","fsLayers":[],"history":[]}`))
+	out, err := runSkopeo("--insecure-policy", "copy", "--normalize-to-oci", "dir:"+schema1Src, "dir:"+t.TempDir())
+	assertTestFailed(t, out, err, "can not be converted to OCI without changing the image contents")
+
+	out, err = runSkopeo("--insecure-policy", "copy", "--normalize-to-oci", "--format", "oci", "dir:"+src, "dir:"+t.TempDir())
+	assertTestFailed(t, out, err, "--normalize-to-oci cannot be used together with --format")
+}
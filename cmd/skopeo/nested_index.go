@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/containers/common/pkg/retry"
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// maxNestedIndexDepth is the maximum number of index levels below the top-level one read by readNestedIndexes.
+const maxNestedIndexDepth = 8
+
+// nestedIndex is an OCI index contained in another index.
+type nestedIndex struct {
+	digest   digest.Digest
+	manifest []byte
+}
+
+// nestedIndexTree is an OCI index which contains other indexes.
+type nestedIndexTree struct {
+	top    []byte        // The top-level index
+	flat   []byte        // An index of all images in the tree, in depth-first order, without the nested indexes
+	nested []nestedIndex // The nested indexes, each one after all indexes it contains
+}
+
+// readNestedIndexes reads the indexes nested in top, the top-level manifest of src, and returns them,
+// or nil if top is not an OCI index containing other indexes.
+// Images in nested indexes without a platform inherit the platform of the closest containing index which has one.
+func readNestedIndexes(ctx context.Context, src types.ImageSource, top []byte, retryOpts *retry.Options) (*nestedIndexTree, error) {
+	if manifest.GuessMIMEType(top) != imgspecv1.MediaTypeImageIndex {
+		return nil, nil
+	}
+	var topIndex imgspecv1.Index
+	if err := json.Unmarshal(top, &topIndex); err != nil {
+		return nil, fmt.Errorf("Error parsing index: %w", err)
+	}
+	res := nestedIndexTree{top: top}
+	images := []imgspecv1.Descriptor{}
+	seen := map[digest.Digest]struct{}{}
+	var walk func(index *imgspecv1.Index, platform *imgspecv1.Platform, depth int) error
+	walk = func(index *imgspecv1.Index, platform *imgspecv1.Platform, depth int) error {
+		for _, d := range index.Manifests {
+			if _, ok := seen[d.Digest]; ok {
+				continue
+			}
+			seen[d.Digest] = struct{}{}
+			if !manifest.MIMETypeIsMultiImage(d.MediaType) {
+				if d.Platform == nil {
+					d.Platform = platform
+				}
+				images = append(images, d)
+				continue
+			}
+			if depth == maxNestedIndexDepth {
+				return fmt.Errorf("index %s is nested more than %d levels deep", d.Digest, maxNestedIndexDepth)
+			}
+			var nested []byte
+			if err := retry.IfNecessary(ctx, func() error {
+				var err error
+				nested, _, err = src.GetManifest(ctx, &d.Digest)
+				return err
+			}, retryOpts); err != nil {
+				return fmt.Errorf("Error retrieving index %s: %w", d.Digest, err)
+			}
+			if matches, err := manifest.MatchesDigest(nested, d.Digest); err != nil || !matches {
+				return fmt.Errorf("index %s does not match its digest", d.Digest)
+			}
+			if mimeType := manifest.GuessMIMEType(nested); mimeType != imgspecv1.MediaTypeImageIndex {
+				return fmt.Errorf("nested manifest list %s is a %s, not an OCI index", d.Digest, mimeType)
+			}
+			var child imgspecv1.Index
+			if err := json.Unmarshal(nested, &child); err != nil {
+				return fmt.Errorf("Error parsing index %s: %w", d.Digest, err)
+			}
+			childPlatform := platform
+			if d.Platform != nil {
+				childPlatform = d.Platform
+			}
+			if err := walk(&child, childPlatform, depth+1); err != nil {
+				return err
+			}
+			res.nested = append(res.nested, nestedIndex{digest: d.Digest, manifest: nested})
+		}
+		return nil
+	}
+	if err := walk(&topIndex, nil, 0); err != nil {
+		return nil, err
+	}
+	if len(res.nested) == 0 {
+		return nil, nil
+	}
+	flat := topIndex
+	flat.Manifests = images
+	var err error
+	res.flat, err = json.Marshal(flat)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// setUpNestedIndexCopy prepares copying all images of srcRef, if its top-level manifest is an OCI index which contains other indexes,
+// which containers/image can't copy directly: it returns a reference presenting an index of all images in the tree instead of srcRef,
+// and, unless flatten, a reference which stores the original indexes instead of the presented one to use instead of destRef,
+// and the top-level index which is stored.
+// If srcRef does not contain nested indexes, it returns srcRef and destRef unchanged, and a nil index.
+func setUpNestedIndexCopy(ctx context.Context, sys *types.SystemContext, srcRef, destRef types.ImageReference, flatten bool,
+	retryOpts *retry.Options) (_, _ types.ImageReference, _ []byte, retErr error) {
+	var src types.ImageSource
+	if err := retry.IfNecessary(ctx, func() error {
+		var err error
+		src, err = srcRef.NewImageSource(ctx, sys)
+		return err
+	}, retryOpts); err != nil {
+		return nil, nil, nil, err
+	}
+	defer func() {
+		if err := src.Close(); err != nil {
+			retErr = noteCloseFailure(retErr, "closing image", err)
+		}
+	}()
+	var top []byte
+	if err := retry.IfNecessary(ctx, func() error {
+		var err error
+		top, _, err = src.GetManifest(ctx, nil)
+		return err
+	}, retryOpts); err != nil {
+		return nil, nil, nil, fmt.Errorf("Error retrieving manifest for image: %w", err)
+	}
+	tree, err := readNestedIndexes(ctx, src, top, retryOpts)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if tree == nil {
+		return srcRef, destRef, nil, nil
+	}
+	// The signatures of the top-level index only remain valid if it is stored unmodified.
+	srcRef = flatIndexReference{ImageReference: srcRef, index: tree.flat, keepSignatures: !flatten}
+	if flatten {
+		return srcRef, destRef, nil, nil
+	}
+	return srcRef, nestedIndexReference{ImageReference: destRef, tree: tree}, tree.top, nil
+}
+
+// flatIndexReference is a types.ImageReference wrapper; image sources created from it present index as the top-level manifest.
+type flatIndexReference struct {
+	types.ImageReference
+	index          []byte // An OCI index
+	keepSignatures bool   // Present the signatures of the original top-level manifest
+}
+
+// DockerReference returns a Docker reference associated with this reference.
+// A digest is removed, because it does not match the presented index.
+func (ref flatIndexReference) DockerReference() reference.Named {
+	res := ref.ImageReference.DockerReference()
+	if _, ok := res.(reference.Digested); ok {
+		return reference.TrimNamed(res)
+	}
+	return res
+}
+
+// NewImageSource returns a types.ImageSource for this reference.
+// The caller must call .Close() on the returned ImageSource.
+func (ref flatIndexReference) NewImageSource(ctx context.Context, sys *types.SystemContext) (types.ImageSource, error) {
+	src, err := ref.ImageReference.NewImageSource(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	return &flatIndexSource{ImageSource: src, ref: ref}, nil
+}
+
+// flatIndexSource is a types.ImageSource wrapper which presents ref.index as the top-level manifest.
+type flatIndexSource struct {
+	types.ImageSource
+	ref flatIndexReference
+}
+
+// Reference returns the reference used to set up this source.
+func (s *flatIndexSource) Reference() types.ImageReference {
+	return s.ref
+}
+
+// GetManifest returns the image's manifest along with its MIME type, returning the presented index for the top-level manifest.
+func (s *flatIndexSource) GetManifest(ctx context.Context, instanceDigest *digest.Digest) ([]byte, string, error) {
+	if instanceDigest == nil {
+		return s.ref.index, imgspecv1.MediaTypeImageIndex, nil
+	}
+	return s.ImageSource.GetManifest(ctx, instanceDigest)
+}
+
+// GetSignatures returns the image's signatures; the top-level manifest has none unless s.ref.keepSignatures.
+func (s *flatIndexSource) GetSignatures(ctx context.Context, instanceDigest *digest.Digest) ([][]byte, error) {
+	if instanceDigest == nil && !s.ref.keepSignatures {
+		return nil, nil
+	}
+	return s.ImageSource.GetSignatures(ctx, instanceDigest)
+}
+
+// nestedIndexReference is a types.ImageReference wrapper; image destinations created from it store tree.top, and the indexes it contains,
+// instead of tree.flat.
+type nestedIndexReference struct {
+	types.ImageReference
+	tree *nestedIndexTree
+}
+
+// NewImageDestination returns a types.ImageDestination for this reference.
+// The caller must call .Close() on the returned ImageDestination.
+func (ref nestedIndexReference) NewImageDestination(ctx context.Context, sys *types.SystemContext) (types.ImageDestination, error) {
+	dest, err := ref.ImageReference.NewImageDestination(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	return &nestedIndexDestination{ImageDestination: dest, tree: ref.tree}, nil
+}
+
+// nestedIndexDestination is a types.ImageDestination wrapper which stores tree.top, and the indexes it contains, instead of tree.flat.
+type nestedIndexDestination struct {
+	types.ImageDestination
+	tree *nestedIndexTree
+}
+
+// PutManifest writes manifest to the destination; the top-level manifest is replaced by the original nested indexes.
+func (d *nestedIndexDestination) PutManifest(ctx context.Context, m []byte, instanceDigest *digest.Digest) error {
+	if instanceDigest != nil {
+		return d.ImageDestination.PutManifest(ctx, m, instanceDigest)
+	}
+	if !bytes.Equal(m, d.tree.flat) {
+		return errors.New("the index was modified while copying, so its nested indexes can not be preserved (consider --flatten-index)")
+	}
+	for _, nested := range d.tree.nested {
+		if err := d.ImageDestination.PutManifest(ctx, nested.manifest, &nested.digest); err != nil {
+			return fmt.Errorf("writing index %s: %w", nested.digest, err)
+		}
+	}
+	return d.ImageDestination.PutManifest(ctx, d.tree.top, nil)
+}
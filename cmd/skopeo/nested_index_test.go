@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+	imgspecspecs "github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testNestedIndexImage returns a dir: image containing a top-level index, which contains an index for linux/amd64,
+// which contains the image created by testDirImageWithBlobs; and the digests of the nested index and of the image.
+func testNestedIndexImage(t *testing.T) (string, digest.Digest, digest.Digest) {
+	imageDir := testDirImageWithBlobs(t)
+	imageManifest, err := os.ReadFile(filepath.Join(imageDir, "manifest.json"))
+	require.NoError(t, err)
+	imageDigest := digest.FromBytes(imageManifest)
+	nested, err := json.Marshal(imgspecv1.Index{
+		Versioned: imgspecspecs.Versioned{SchemaVersion: 2},
+		MediaType: imgspecv1.MediaTypeImageIndex,
+		Manifests: []imgspecv1.Descriptor{{
+			MediaType: imgspecv1.MediaTypeImageManifest,
+			Digest:    imageDigest,
+			Size:      int64(len(imageManifest)),
+		}},
+	})
+	require.NoError(t, err)
+	nestedDigest := digest.FromBytes(nested)
+	top, err := json.Marshal(imgspecv1.Index{
+		Versioned: imgspecspecs.Versioned{SchemaVersion: 2},
+		MediaType: imgspecv1.MediaTypeImageIndex,
+		Manifests: []imgspecv1.Descriptor{{
+			MediaType: imgspecv1.MediaTypeImageIndex,
+			Digest:    nestedDigest,
+			Size:      int64(len(nested)),
+			Platform:  &imgspecv1.Platform{OS: "linux", Architecture: "amd64"},
+		}},
+	})
+	require.NoError(t, err)
+
+	dir := testDirImage(t, top)
+	err = os.WriteFile(filepath.Join(dir, nestedDigest.Encoded()+".manifest.json"), nested, 0o644)
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(dir, imageDigest.Encoded()+".manifest.json"), imageManifest, 0o644)
+	require.NoError(t, err)
+	blobs, err := filepath.Glob(filepath.Join(imageDir, "[0-9a-f]*"))
+	require.NoError(t, err)
+	for _, blob := range blobs {
+		contents, err := os.ReadFile(blob)
+		require.NoError(t, err)
+		err = os.WriteFile(filepath.Join(dir, filepath.Base(blob)), contents, 0o644)
+		require.NoError(t, err)
+	}
+	return dir, nestedDigest, imageDigest
+}
+
+func TestCopyNestedIndex(t *testing.T) {
+	src, nestedDigest, imageDigest := testNestedIndexImage(t)
+	top, err := os.ReadFile(filepath.Join(src, "manifest.json"))
+	require.NoError(t, err)
+
+	// The nested index is preserved.
+	dest := t.TempDir()
+	out, err := runSkopeo("--insecure-policy", "copy", "--all", "dir:"+src, "dir:"+dest)
+	require.NoError(t, err, out)
+	copied, err := os.ReadFile(filepath.Join(dest, "manifest.json"))
+	require.NoError(t, err)
+	assert.Equal(t, top, copied)
+	for _, d := range []digest.Digest{nestedDigest, imageDigest} {
+		source, err := os.ReadFile(filepath.Join(src, d.Encoded()+".manifest.json"))
+		require.NoError(t, err)
+		copied, err := os.ReadFile(filepath.Join(dest, d.Encoded()+".manifest.json"))
+		require.NoError(t, err)
+		assert.Equal(t, source, copied)
+	}
+
+	// With --flatten-index, the image is copied in a single index, with the platform of the nested index.
+	dest = t.TempDir()
+	out, err = runSkopeo("--insecure-policy", "copy", "--all", "--flatten-index", "dir:"+src, "dir:"+dest)
+	require.NoError(t, err, out)
+	copied, err = os.ReadFile(filepath.Join(dest, "manifest.json"))
+	require.NoError(t, err)
+	var index imgspecv1.Index
+	err = json.Unmarshal(copied, &index)
+	require.NoError(t, err)
+	require.Len(t, index.Manifests, 1)
+	assert.Equal(t, imageDigest, index.Manifests[0].Digest)
+	assert.Equal(t, &imgspecv1.Platform{OS: "linux", Architecture: "amd64"}, index.Manifests[0].Platform)
+	assert.NoFileExists(t, filepath.Join(dest, nestedDigest.Encoded()+".manifest.json"))
+	assert.FileExists(t, filepath.Join(dest, imageDigest.Encoded()+".manifest.json"))
+
+	out, err = runSkopeo("--insecure-policy", "copy", "--flatten-index", "dir:"+src, "dir:"+t.TempDir())
+	assertTestFailed(t, out, err, "--flatten-index requires --all")
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+)
+
+// noBlobMountReference is a types.ImageReference wrapper; image destinations created from it
+// don't try to mount blobs from other repositories of the registry.
+type noBlobMountReference struct {
+	types.ImageReference
+}
+
+// withoutBlobMountsForHosts returns destRef, wrapped so that it does not try to mount blobs from other repositories
+// if it is a docker:// reference to one of hosts.
+func withoutBlobMountsForHosts(destRef types.ImageReference, hosts []string) (types.ImageReference, error) {
+	if len(hosts) == 0 || destRef.Transport().Name() != docker.Transport.Name() {
+		return destRef, nil
+	}
+	named := destRef.DockerReference()
+	if named == nil {
+		return nil, fmt.Errorf("internal error: %s reference without a Docker reference", docker.Transport.Name())
+	}
+	domain := reference.Domain(named)
+	for _, host := range hosts {
+		if host == domain {
+			return noBlobMountReference{ImageReference: destRef}, nil
+		}
+	}
+	return destRef, nil
+}
+
+// NewImageDestination returns a types.ImageDestination for this reference.
+// The caller must call .Close() on the returned ImageDestination.
+func (ref noBlobMountReference) NewImageDestination(ctx context.Context, sys *types.SystemContext) (types.ImageDestination, error) {
+	dest, err := ref.ImageReference.NewImageDestination(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	return noBlobMountDestination{ImageDestination: dest, ref: ref}, nil
+}
+
+// noBlobMountDestination is a types.ImageDestination wrapper which hides all blob locations recorded in the BlobInfoCache
+// from the underlying destination, so that it only reuses blobs which already exist in the destination repository.
+type noBlobMountDestination struct {
+	types.ImageDestination
+	ref noBlobMountReference
+}
+
+// Reference returns the reference used to set up this destination.
+func (d noBlobMountDestination) Reference() types.ImageReference {
+	return d.ref
+}
+
+// TryReusingBlob checks whether the transport already contains, or can efficiently reuse, a blob, and if so, applies it to the current destination.
+func (d noBlobMountDestination) TryReusingBlob(ctx context.Context, info types.BlobInfo, cache types.BlobInfoCache, canSubstitute bool) (bool, types.BlobInfo, error) {
+	return d.ImageDestination.TryReusingBlob(ctx, info, noCandidatesBlobInfoCache{BlobInfoCache: cache}, canSubstitute)
+}
+
+// noCandidatesBlobInfoCache is a types.BlobInfoCache wrapper which records all data as usual, but never returns any candidate locations.
+// Note that it only implements the public types.BlobInfoCache interface, so consumers also don't see the recorded compression of blobs.
+type noCandidatesBlobInfoCache struct {
+	types.BlobInfoCache
+}
+
+// CandidateLocations returns a prioritized, limited, number of blobs and their locations that could possibly be reused.
+func (bic noCandidatesBlobInfoCache) CandidateLocations(transport types.ImageTransport, scope types.BICTransportScope, digest digest.Digest, canSubstitute bool) []types.BICReplacementCandidate {
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/containers/image/v5/pkg/blobinfocache/memory"
+	"github.com/containers/image/v5/transports/alltransports"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// candidateRecordingDestination is a types.ImageDestination which records the candidate locations available to TryReusingBlob.
+type candidateRecordingDestination struct {
+	types.ImageDestination
+	ref        types.ImageReference
+	candidates []types.BICReplacementCandidate
+}
+
+func (d *candidateRecordingDestination) TryReusingBlob(ctx context.Context, info types.BlobInfo, cache types.BlobInfoCache, canSubstitute bool) (bool, types.BlobInfo, error) {
+	d.candidates = cache.CandidateLocations(d.ref.Transport(), types.BICTransportScope{Opaque: "registry.example"}, info.Digest, canSubstitute)
+	return false, types.BlobInfo{}, nil
+}
+
+func TestWithoutBlobMountsForHosts(t *testing.T) {
+	for _, c := range []struct {
+		ref     string
+		hosts   []string
+		wrapped bool
+	}{
+		{"docker://registry.example/repo:tag", nil, false},
+		{"docker://registry.example/repo:tag", []string{"registry.example"}, true},
+		{"docker://registry.example/repo:tag", []string{"other.example", "registry.example"}, true},
+		{"docker://registry.example:5000/repo:tag", []string{"registry.example"}, false},
+		{"docker://registry.example:5000/repo:tag", []string{"registry.example:5000"}, true},
+		{"docker://busybox", []string{"docker.io"}, true},
+		{"docker://registry.example/repo:tag", []string{"other.example"}, false},
+		{"dir:" + t.TempDir(), []string{"registry.example"}, false},
+	} {
+		ref, err := alltransports.ParseImageName(c.ref)
+		require.NoError(t, err)
+		res, err := withoutBlobMountsForHosts(ref, c.hosts)
+		require.NoError(t, err)
+		_, wrapped := res.(noBlobMountReference)
+		assert.Equal(t, c.wrapped, wrapped, c.ref, c.hosts)
+	}
+}
+
+func TestNoBlobMountDestination(t *testing.T) {
+	ref, err := alltransports.ParseImageName("docker://registry.example/repo:tag")
+	require.NoError(t, err)
+	blobDigest := digest.FromString("blob")
+	cache := memory.New()
+	cache.RecordKnownLocation(ref.Transport(), types.BICTransportScope{Opaque: "registry.example"}, blobDigest, types.BICLocationReference{Opaque: "registry.example/other"})
+
+	inner := &candidateRecordingDestination{ref: ref}
+	_, _, err = inner.TryReusingBlob(context.Background(), types.BlobInfo{Digest: blobDigest}, cache, true)
+	require.NoError(t, err)
+	assert.Len(t, inner.candidates, 1)
+
+	dest := noBlobMountDestination{ImageDestination: inner, ref: noBlobMountReference{ImageReference: ref}}
+	_, _, err = dest.TryReusingBlob(context.Background(), types.BlobInfo{Digest: blobDigest}, cache, true)
+	require.NoError(t, err)
+	assert.Empty(t, inner.candidates)
+	assert.Equal(t, dest.ref, dest.Reference())
+}
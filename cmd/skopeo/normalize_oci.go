@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/containers/image/v5/manifest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// dockerMediaTypePrefix is the common prefix of Docker media types, none of which may remain in an image normalized to OCI.
+const dockerMediaTypePrefix = "application/vnd.docker."
+
+// ociMediaTypeRewrites returns the rewrites of Docker config and layer media types to their OCI equivalents, for --normalize-to-oci.
+func ociMediaTypeRewrites() map[string]string {
+	res := map[string]string{}
+	for _, pair := range equivalentMediaTypes {
+		res[pair[1]] = pair[0]
+	}
+	return res
+}
+
+// normalizeManifestToOCI returns rawManifest, an image manifest with mimeType, as an OCI manifest with the same config and layer blobs,
+// its MIME type, and whether anything was changed. It fails if that is not possible without changing the contents of any blob.
+func normalizeManifestToOCI(rawManifest []byte, mimeType string) ([]byte, string, bool, error) {
+	mimeType = manifest.NormalizedMIMEType(mimeType)
+	if mimeType != imgspecv1.MediaTypeImageManifest && mimeType != manifest.DockerV2Schema2MediaType {
+		// Notably schema1 manifests, which don't have a config blob: converting them would create one.
+		return nil, "", false, fmt.Errorf("--normalize-to-oci: %s manifests can not be converted to OCI without changing the image contents", mimeType)
+	}
+	res, changed, err := rewriteManifestMediaTypes(rawManifest, ociMediaTypeRewrites())
+	if err != nil {
+		return nil, "", false, err
+	}
+	if mimeType == manifest.DockerV2Schema2MediaType {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(res, &fields); err != nil {
+			return nil, "", false, fmt.Errorf("parsing manifest: %w", err)
+		}
+		if fields["mediaType"], err = json.Marshal(imgspecv1.MediaTypeImageManifest); err != nil {
+			return nil, "", false, err
+		}
+		if res, err = json.Marshal(fields); err != nil {
+			return nil, "", false, err
+		}
+		changed = true
+	}
+
+	m, err := manifest.OCI1FromManifest(res)
+	if err != nil {
+		return nil, "", false, err
+	}
+	if strings.HasPrefix(m.Config.MediaType, dockerMediaTypePrefix) {
+		return nil, "", false, fmt.Errorf("--normalize-to-oci: config media type %q has no OCI equivalent with identical contents", m.Config.MediaType)
+	}
+	for _, layer := range m.Layers {
+		if strings.HasPrefix(layer.MediaType, dockerMediaTypePrefix) {
+			return nil, "", false, fmt.Errorf("--normalize-to-oci: layer %s media type %q has no OCI equivalent with identical contents", layer.Digest, layer.MediaType)
+		}
+	}
+	return res, imgspecv1.MediaTypeImageManifest, changed, nil
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	ociarchive "github.com/containers/image/v5/oci/archive"
+	"github.com/containers/image/v5/oci/layout"
+	"github.com/containers/image/v5/pkg/compression"
+	"github.com/containers/image/v5/transports/alltransports"
+	"github.com/containers/image/v5/types"
+	storagearchive "github.com/containers/storage/pkg/archive"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// parseSourceImageName converts an image URL-like string to a source reference.
+//
+// In addition to the syntax accepted by alltransports.ParseImageName, this accepts oci-archive:path:@index,
+// which refers to the image with that index (starting at 0) in the index.json of the archive.
+// For other oci-archive: references, failures to find the image report the image names in the archive.
+func parseSourceImageName(name string) (types.ImageReference, error) {
+	if prefix := ociarchive.Transport.Name() + ":"; strings.HasPrefix(name, prefix) {
+		file, image, _ := strings.Cut(strings.TrimPrefix(name, prefix), ":")
+		if strings.HasPrefix(image, "@") {
+			index, err := strconv.Atoi(strings.TrimPrefix(image, "@"))
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("invalid image index %q in %s", image, name)
+			}
+			ref, err := ociarchive.NewReference(file, "")
+			if err != nil {
+				return nil, err
+			}
+			return ociArchiveIndexReference{ImageReference: ref, file: file, index: index}, nil
+		}
+		ref, err := alltransports.ParseImageName(name)
+		if err != nil {
+			return nil, err
+		}
+		return ociArchiveNamesReference{ImageReference: ref, file: file}, nil
+	}
+	return alltransports.ParseImageName(name)
+}
+
+// ociArchiveNamesReference is a types.ImageReference wrapper for oci-archive: sources; if the image is not found,
+// the error lists the image names available in the archive.
+type ociArchiveNamesReference struct {
+	types.ImageReference
+	file string
+}
+
+// NewImageSource returns a types.ImageSource for this reference.
+// The caller must call .Close() on the returned ImageSource.
+func (ref ociArchiveNamesReference) NewImageSource(ctx context.Context, sys *types.SystemContext) (types.ImageSource, error) {
+	src, err := ref.ImageReference.NewImageSource(ctx, sys)
+	if err != nil {
+		var notFound ociarchive.ImageNotFoundError
+		if errors.As(err, &notFound) {
+			return nil, fmt.Errorf("%w; %s", err, describeOCIArchiveImages(ref.file))
+		}
+		return nil, err
+	}
+	return src, nil
+}
+
+// ociArchiveIndexReference is a types.ImageReference wrapper for oci-archive: sources, which refers to the image
+// at index in the index.json of the archive.
+type ociArchiveIndexReference struct {
+	types.ImageReference // oci-archive:file, used for policy decisions
+	file                 string
+	index                int
+}
+
+// StringWithinTransport returns a string representation of the reference, which MUST be such that
+// reference.Transport().ParseReference(reference.StringWithinTransport()) returns an equivalent reference.
+//
+// This is an exception: the returned string is only accepted by parseSourceImageName.
+func (ref ociArchiveIndexReference) StringWithinTransport() string {
+	return fmt.Sprintf("%s:@%d", ref.file, ref.index)
+}
+
+// NewImageSource returns a types.ImageSource for this reference.
+// The caller must call .Close() on the returned ImageSource.
+func (ref ociArchiveIndexReference) NewImageSource(ctx context.Context, sys *types.SystemContext) (types.ImageSource, error) {
+	tmpDir := ""
+	if sys != nil {
+		tmpDir = sys.BigFilesTemporaryDir
+	}
+	dir, err := os.MkdirTemp(tmpDir, "skopeo-oci-archive")
+	if err != nil {
+		return nil, err
+	}
+	succeeded := false
+	defer func() {
+		if !succeeded {
+			os.RemoveAll(dir)
+		}
+	}()
+	if err := extractOCIArchive(ref.file, dir); err != nil {
+		return nil, err
+	}
+
+	// Rewrite index.json to contain only the selected image, so that the layout transport chooses it.
+	indexPath := filepath.Join(dir, "index.json")
+	indexBytes, err := os.ReadFile(indexPath)
+	if err != nil {
+		return nil, err
+	}
+	var index imgspecv1.Index
+	if err := json.Unmarshal(indexBytes, &index); err != nil {
+		return nil, fmt.Errorf("parsing index.json of %s: %w", ref.file, err)
+	}
+	if ref.index >= len(index.Manifests) {
+		return nil, fmt.Errorf("image index @%d out of range, %s contains %d images", ref.index, ref.file, len(index.Manifests))
+	}
+	index.Manifests = index.Manifests[ref.index : ref.index+1]
+	indexBytes, err = json.Marshal(index)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(indexPath, indexBytes, 0o644); err != nil {
+		return nil, err
+	}
+
+	layoutRef, err := layout.NewReference(dir, "")
+	if err != nil {
+		return nil, err
+	}
+	src, err := layoutRef.NewImageSource(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	succeeded = true
+	return &ociArchiveIndexSource{ImageSource: src, ref: ref, dir: dir}, nil
+}
+
+// ociArchiveIndexSource is a types.ImageSource wrapper for an image extracted from an OCI archive into dir.
+type ociArchiveIndexSource struct {
+	types.ImageSource
+	ref ociArchiveIndexReference
+	dir string
+}
+
+// Reference returns the reference used to set up this source.
+func (s *ociArchiveIndexSource) Reference() types.ImageReference {
+	return s.ref
+}
+
+// Close removes resources associated with an initialized ImageSource, if any.
+func (s *ociArchiveIndexSource) Close() error {
+	err := s.ImageSource.Close()
+	if removeErr := os.RemoveAll(s.dir); err == nil {
+		err = removeErr
+	}
+	return err
+}
+
+// extractOCIArchive extracts the OCI archive at file into dir.
+func extractOCIArchive(file, dir string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := storagearchive.NewDefaultArchiver().Untar(f, dir, &storagearchive.TarOptions{NoLchown: true}); err != nil {
+		return fmt.Errorf("extracting %s: %w", file, err)
+	}
+	return nil
+}
+
+// describeOCIArchiveImages returns a description of the images in the OCI archive at file, for use in error messages.
+func describeOCIArchiveImages(file string) string {
+	index, err := readOCIArchiveIndex(file)
+	if err != nil {
+		return fmt.Sprintf("error reading the index of %s: %v", file, err)
+	}
+	names := []string{}
+	for _, desc := range index.Manifests {
+		if name, ok := desc.Annotations[imgspecv1.AnnotationRefName]; ok {
+			names = append(names, strconv.Quote(name))
+		}
+	}
+	switch {
+	case len(index.Manifests) == 0:
+		return fmt.Sprintf("%s contains no images", file)
+	case len(names) == 0:
+		return fmt.Sprintf("%s contains %d images without names, use @0 to @%d to choose one", file, len(index.Manifests), len(index.Manifests)-1)
+	default:
+		return fmt.Sprintf("%s contains images named %s (or use @0 to @%d to choose one by index)", file, strings.Join(names, ", "), len(index.Manifests)-1)
+	}
+}
+
+// readOCIArchiveIndex returns the index.json of the OCI archive at file, without extracting the rest of the archive.
+func readOCIArchiveIndex(file string) (*imgspecv1.Index, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	stream, _, err := compression.AutoDecompress(f)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+	tr := tar.NewReader(stream)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, errors.New("index.json not found")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if filepath.Clean(hdr.Name) != "index.json" {
+			continue
+		}
+		var index imgspecv1.Index
+		if err := json.NewDecoder(tr).Decode(&index); err != nil {
+			return nil, fmt.Errorf("parsing index.json: %w", err)
+		}
+		return &index, nil
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"archive/tar"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tarDirectory creates a tar archive at path with the contents of dir.
+func tarDirectory(t *testing.T, dir, path string) {
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	defer f.Close()
+	tw := tar.NewWriter(f)
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		contents, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		_, err = tw.Write(contents)
+		return err
+	})
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+}
+
+func TestCopyOCIArchiveSource(t *testing.T) {
+	src := testDirImageWithBlobs(t)
+	layoutDir := t.TempDir()
+	for _, name := range []string{"first", "second"} {
+		_, err := runSkopeo("--insecure-policy", "copy", "dir:"+src, "oci:"+layoutDir+":"+name)
+		require.NoError(t, err)
+	}
+	archivePath := filepath.Join(t.TempDir(), "archive.tar")
+	tarDirectory(t, layoutDir, archivePath)
+
+	// Selecting by name and by index works.
+	for _, image := range []string{"second", "@1", "@0"} {
+		dest := t.TempDir()
+		_, err := runSkopeo("--insecure-policy", "copy", "oci-archive:"+archivePath+":"+image, "dir:"+dest)
+		require.NoError(t, err, image)
+		assert.FileExists(t, filepath.Join(dest, "manifest.json"))
+	}
+
+	out, err := runSkopeo("--insecure-policy", "copy", "oci-archive:"+archivePath+":third", "dir:"+t.TempDir())
+	assertTestFailed(t, out, err, `contains images named "first", "second" (or use @0 to @1 to choose one by index)`)
+	out, err = runSkopeo("--insecure-policy", "copy", "oci-archive:"+archivePath+":@2", "dir:"+t.TempDir())
+	assertTestFailed(t, out, err, "image index @2 out of range")
+	out, err = runSkopeo("--insecure-policy", "copy", "oci-archive:"+archivePath+":@x", "dir:"+t.TempDir())
+	assertTestFailed(t, out, err, `invalid image index "@x"`)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+
+	"github.com/containers/common/pkg/retry"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sirupsen/logrus"
+)
+
+// checkOSVersion validates the use of --os-version together with global: os.version is only used to choose Windows images.
+func checkOSVersion(global *globalOptions) error {
+	if global.overrideOS != "windows" {
+		return errors.New("--os-version requires --override-os windows")
+	}
+	return nil
+}
+
+// osVersionMatches returns true if version, an os.version value, matches prefix: if it is equal to prefix,
+// or starts with prefix followed by further dot-separated components (so "10.0.17763" matches "10.0.17763.1234", but not "10.0.177630").
+func osVersionMatches(version, prefix string) bool {
+	return version == prefix || strings.HasPrefix(version, prefix+".")
+}
+
+// selectOSVersionInstance returns the digest and platform of the first image in the manifest list rawManifest (with mimeType)
+// for the OS chosen by sys, and the architecture (and variant, if specified) chosen by sys or the one skopeo is running on,
+// whose os.version matches osVersion.
+// It returns an empty digest if rawManifest is not a list.
+func selectOSVersionInstance(sys *types.SystemContext, rawManifest []byte, mimeType string, osVersion string) (digest.Digest, string, error) {
+	if !manifest.MIMETypeIsMultiImage(manifest.NormalizedMIMEType(mimeType)) {
+		return "", "", nil
+	}
+	list, err := manifest.ListFromBlob(rawManifest, mimeType)
+	if err != nil {
+		return "", "", fmt.Errorf("Error parsing manifest list: %w", err)
+	}
+	wanted := v1.Platform{OS: runtime.GOOS, Architecture: runtime.GOARCH}
+	if sys != nil {
+		if sys.OSChoice != "" {
+			wanted.OS = sys.OSChoice
+		}
+		if sys.ArchitectureChoice != "" {
+			wanted.Architecture = sys.ArchitectureChoice
+			wanted.Variant = sys.VariantChoice
+		}
+	}
+	wanted = normalizePlatform(wanted)
+	for _, instanceDigest := range list.Instances() {
+		instance, err := list.Instance(instanceDigest)
+		if err != nil {
+			return "", "", err
+		}
+		if instance.ReadOnly.Platform == nil {
+			continue
+		}
+		platform := normalizePlatform(*instance.ReadOnly.Platform)
+		if platform.OS != wanted.OS || platform.Architecture != wanted.Architecture ||
+			(wanted.Variant != "" && platform.Variant != wanted.Variant) || !osVersionMatches(platform.OSVersion, osVersion) {
+			continue
+		}
+		logrus.Debugf("Selected image %s with os.version %s", instanceDigest, platform.OSVersion)
+		return instanceDigest, platformString(&platform), nil
+	}
+	return "", "", fmt.Errorf("no image found in manifest list for %s/%s with os.version %s", wanted.OS, wanted.Architecture, osVersion)
+}
+
+// selectOSVersionInstanceForReference is selectOSVersionInstance for the top-level manifest of ref.
+func selectOSVersionInstanceForReference(ctx context.Context, sys *types.SystemContext, ref types.ImageReference, osVersion string,
+	retryOpts *retry.Options) (_ digest.Digest, _ string, retErr error) {
+	var src types.ImageSource
+	if err := retry.IfNecessary(ctx, func() error {
+		var err error
+		src, err = ref.NewImageSource(ctx, sys)
+		return err
+	}, retryOpts); err != nil {
+		return "", "", err
+	}
+	defer func() {
+		if err := src.Close(); err != nil {
+			retErr = noteCloseFailure(retErr, "closing image", err)
+		}
+	}()
+	var rawManifest []byte
+	var mimeType string
+	if err := retry.IfNecessary(ctx, func() error {
+		var err error
+		rawManifest, mimeType, err = src.GetManifest(ctx, nil)
+		return err
+	}, retryOpts); err != nil {
+		return "", "", fmt.Errorf("Error retrieving manifest for image: %w", err)
+	}
+	return selectOSVersionInstance(sys, rawManifest, mimeType, osVersion)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecspecs "github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOSVersionMatches(t *testing.T) {
+	for _, c := range []struct {
+		version, prefix string
+		expected        bool
+	}{
+		{"10.0.17763.1234", "10.0.17763.1234", true},
+		{"10.0.17763.1234", "10.0.17763", true},
+		{"10.0.17763.1234", "10", true},
+		{"10.0.177630.1", "10.0.17763", false},
+		{"10.0.17763", "10.0.17763.1234", false},
+		{"", "10.0", false},
+	} {
+		assert.Equal(t, c.expected, osVersionMatches(c.version, c.prefix), "%q %q", c.version, c.prefix)
+	}
+}
+
+func TestSelectOSVersionInstance(t *testing.T) {
+	platforms := []imgspecv1.Platform{
+		{OS: "linux", Architecture: "amd64"},
+		{OS: "windows", Architecture: "amd64", OSVersion: "10.0.17763.5329"},
+		{OS: "windows", Architecture: "amd64", OSVersion: "10.0.20348.2227"},
+		{OS: "windows", Architecture: "amd64", OSVersion: "10.0.20348.2322"},
+		{OS: "windows", Architecture: "arm64", OSVersion: "10.0.26100.1"},
+	}
+	index := imgspecv1.Index{Versioned: imgspecspecs.Versioned{SchemaVersion: 2}, MediaType: imgspecv1.MediaTypeImageIndex}
+	digests := []digest.Digest{}
+	for i := range platforms {
+		d := digest.FromString(platforms[i].Architecture + platforms[i].OSVersion)
+		digests = append(digests, d)
+		index.Manifests = append(index.Manifests, imgspecv1.Descriptor{
+			MediaType: imgspecv1.MediaTypeImageManifest,
+			Digest:    d,
+			Size:      1,
+			Platform:  &platforms[i],
+		})
+	}
+	rawIndex, err := json.Marshal(index)
+	require.NoError(t, err)
+
+	for _, c := range []struct {
+		arch, osVersion string
+		expected        int
+	}{
+		{"amd64", "10.0.17763", 1},
+		{"amd64", "10.0.20348", 2}, // The first match in list order
+		{"amd64", "10.0.20348.2322", 3},
+		{"arm64", "10.0", 4},
+		{"amd64", "10.0.26100", -1},
+		{"arm64", "10.0.17763", -1},
+	} {
+		sys := &types.SystemContext{OSChoice: "windows", ArchitectureChoice: c.arch}
+		instance, platform, err := selectOSVersionInstance(sys, rawIndex, imgspecv1.MediaTypeImageIndex, c.osVersion)
+		if c.expected == -1 {
+			assert.ErrorContains(t, err, "no image found in manifest list", c.osVersion)
+			continue
+		}
+		require.NoError(t, err, c.osVersion)
+		assert.Equal(t, digests[c.expected], instance, c.osVersion)
+		assert.Regexp(t, "^windows/"+c.arch+"(/|$)", platform, c.osVersion)
+	}
+
+	// Single images are not affected.
+	instance, _, err := selectOSVersionInstance(&types.SystemContext{OSChoice: "windows"}, []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json"}`),
+		imgspecv1.MediaTypeImageManifest, "10.0")
+	require.NoError(t, err)
+	assert.Equal(t, digest.Digest(""), instance)
+}
+
+func TestOSVersionOptions(t *testing.T) {
+	src := testDirImageWithBlobs(t)
+	out, err := runSkopeo("--insecure-policy", "copy", "--os-version", "10.0", "dir:"+src, "dir:"+t.TempDir())
+	assertTestFailed(t, out, err, "--os-version requires --override-os windows")
+	out, err = runSkopeo("--insecure-policy", "--override-os", "windows", "copy", "--os-version", "10.0", "--all", "dir:"+src, "dir:"+t.TempDir())
+	assertTestFailed(t, out, err, "--os-version can only be used when copying a single image from a list")
+	out, err = runSkopeo("inspect", "--os-version", "10.0", "dir:"+src)
+	assertTestFailed(t, out, err, "--os-version requires --override-os windows")
+	out, err = runSkopeo("--override-os", "windows", "inspect", "--os-version", "10.0", "--arch-list", "dir:"+src)
+	assertTestFailed(t, out, err, "--os-version can not be used together with")
+
+	// A single image is inspected regardless of --os-version.
+	out, err = runSkopeo("--override-os", "windows", "inspect", "--os-version", "10.0", "--format", "{{.Os}}", "dir:"+src)
+	require.NoError(t, err)
+	assert.Equal(t, "linux\n", out)
+}
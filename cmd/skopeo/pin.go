@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/containers/common/pkg/retry"
+	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/transports/alltransports"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+)
+
+// sourceManifestDigest returns the digest of the top-level manifest of ref, i.e. what a tag refers to.
+// This does not wrap the image source used by copy.Image, which would lose signatures in formats other than simple signing;
+// for registries, it uses a HEAD request, which does not count against pull rate limits.
+func sourceManifestDigest(ctx context.Context, sys *types.SystemContext, ref types.ImageReference, retryOpts *retry.Options) (digest.Digest, error) {
+	if ref.Transport().Name() == docker.Transport.Name() {
+		if digested, ok := ref.DockerReference().(reference.Digested); ok {
+			return digested.Digest(), nil
+		}
+		var res digest.Digest
+		if err := retry.IfNecessary(ctx, func() error {
+			var err error
+			res, err = docker.GetDigest(ctx, sys, ref)
+			return err
+		}, retryOpts); err != nil {
+			return "", err
+		}
+		return res, nil
+	}
+	rawManifest, err := topLevelManifest(ctx, sys, ref, retryOpts)
+	if err != nil {
+		return "", err
+	}
+	return manifest.Digest(rawManifest)
+}
+
+// appendPin appends a "source_ref source_digest dest_digest" line to the file at path, creating it if necessary.
+func appendPin(path, sourceRef string, sourceDigest, destDigest digest.Digest) (retErr error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("Failed to open pin file %q: %w", path, err)
+	}
+	defer func() {
+		if err := f.Close(); err != nil && retErr == nil {
+			retErr = fmt.Errorf("Failed to write pin to file %q: %w", path, err)
+		}
+	}()
+	if _, err := fmt.Fprintf(f, "%s %s %s\n", sourceRef, sourceDigest, destDigest); err != nil {
+		return fmt.Errorf("Failed to write pin to file %q: %w", path, err)
+	}
+	return nil
+}
+
+// readPins reads a file in the format written by appendPin, and returns the recorded source digest for each source image name,
+// normalized by transports.ImageName. If an image is recorded more than once, the last record is used.
+// The destination digest is optional.
+func readPins(path string) (map[string]digest.Digest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read pin file %q: %w", path, err)
+	}
+	defer f.Close()
+	res := map[string]digest.Digest{}
+	scanner := bufio.NewScanner(f)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) != 2 && len(fields) != 3 {
+			return nil, fmt.Errorf("Invalid pin file %q, line %d: expected SOURCE-IMAGE SOURCE-DIGEST [DESTINATION-DIGEST]", path, lineNumber)
+		}
+		ref, err := alltransports.ParseImageName(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid pin file %q, line %d: %w", path, lineNumber, err)
+		}
+		d, err := digest.Parse(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid pin file %q, line %d: %w", path, lineNumber, err)
+		}
+		res[transports.ImageName(ref)] = d
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Failed to read pin file %q: %w", path, err)
+	}
+	return res, nil
+}
+
+// resolveTagFromPins returns a reference to the image pinned for ref in pins, as returned by readPins, or nil
+// if ref is not included in pins.
+func resolveTagFromPins(ref types.ImageReference, pins map[string]digest.Digest) (types.ImageReference, error) {
+	d, ok := pins[transports.ImageName(ref)]
+	if !ok {
+		return nil, nil
+	}
+	if ref.Transport().Name() != docker.Transport.Name() {
+		return nil, fmt.Errorf("--resolve-tags-from: %s is not a %s: reference and can not be pinned by digest", transports.ImageName(ref), docker.Transport.Name())
+	}
+	// The docker transport does not support references with both a tag and a digest.
+	pinned, err := reference.WithDigest(reference.TrimNamed(ref.DockerReference()), d)
+	if err != nil {
+		return nil, err
+	}
+	return docker.NewReference(pinned)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/transports/alltransports"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testDirImageWithBlobs returns a path to a dir: image with a manifest referring to a config and a layer, including the blobs.
+func testDirImageWithBlobs(t *testing.T) string {
+	config := []byte(`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers","diff_ids":[]}}`)
+	layer := []byte("not really a layer")
+	configDigest := digest.FromBytes(config)
+	layerDigest := digest.FromBytes(layer)
+	manifest := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json",` +
+		`"config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"` + configDigest.String() + `","size":` + strconv.Itoa(len(config)) + `},` +
+		`"layers":[{"mediaType":"application/vnd.oci.image.layer.v1.tar","digest":"` + layerDigest.String() + `","size":` + strconv.Itoa(len(layer)) + `}]}`)
+	dir := testDirImage(t, manifest)
+	err := os.WriteFile(filepath.Join(dir, configDigest.Encoded()), config, 0o644)
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(dir, layerDigest.Encoded()), layer, 0o644)
+	require.NoError(t, err)
+	return dir
+}
+
+func TestCopyEmitPin(t *testing.T) {
+	src := testDirImageWithBlobs(t)
+	srcManifest, err := os.ReadFile(filepath.Join(src, "manifest.json"))
+	require.NoError(t, err)
+	srcDigest := digest.FromBytes(srcManifest)
+	pinFile := filepath.Join(t.TempDir(), "pins")
+
+	dest1 := t.TempDir()
+	_, err = runSkopeo("--insecure-policy", "copy", "--emit-pin", pinFile, "dir:"+src, "dir:"+dest1)
+	require.NoError(t, err)
+	dest2 := t.TempDir()
+	_, err = runSkopeo("--insecure-policy", "copy", "--emit-pin", pinFile, "--format", "v2s2", "dir:"+src, "dir:"+dest2)
+	require.NoError(t, err)
+
+	dest2Manifest, err := os.ReadFile(filepath.Join(dest2, "manifest.json"))
+	require.NoError(t, err)
+	pins, err := os.ReadFile(pinFile)
+	require.NoError(t, err)
+	assert.Equal(t, "dir:"+src+" "+srcDigest.String()+" "+srcDigest.String()+"\n"+
+		"dir:"+src+" "+srcDigest.String()+" "+digest.FromBytes(dest2Manifest).String()+"\n", string(pins))
+}
+
+func TestResolveTagsFrom(t *testing.T) {
+	d1 := digest.FromString("1")
+	d2 := digest.FromString("2")
+	dir := t.TempDir()
+	pinFile := filepath.Join(dir, "pins")
+	err := os.WriteFile(pinFile, []byte("# Comment\n"+
+		"docker://busybox "+d1.String()+" "+d1.String()+"\n"+
+		"\n"+
+		"docker://quay.io/skopeo/stable:latest "+d1.String()+"\n"+
+		"docker://docker.io/library/busybox:latest "+d2.String()+" "+d1.String()+"\n"+
+		"dir:"+dir+" "+d1.String()+"\n"), 0o644)
+	require.NoError(t, err)
+	pins, err := readPins(pinFile)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]digest.Digest{
+		"docker://busybox:latest":               d2,
+		"docker://quay.io/skopeo/stable:latest": d1,
+		"dir:" + dir:                            d1,
+	}, pins)
+
+	for _, c := range []struct{ input, expected string }{
+		{"docker://docker.io/busybox", "docker://busybox@" + d2.String()},
+		{"docker://quay.io/skopeo/stable", "docker://quay.io/skopeo/stable@" + d1.String()},
+		{"docker://quay.io/skopeo/stable:v1", ""},
+	} {
+		ref, err := alltransports.ParseImageName(c.input)
+		require.NoError(t, err)
+		res, err := resolveTagFromPins(ref, pins)
+		require.NoError(t, err, c.input)
+		if c.expected == "" {
+			assert.Nil(t, res, c.input)
+		} else {
+			require.NotNil(t, res, c.input)
+			assert.Equal(t, c.expected, transports.ImageName(res), c.input)
+		}
+	}
+	ref, err := alltransports.ParseImageName("dir:" + dir)
+	require.NoError(t, err)
+	_, err = resolveTagFromPins(ref, pins)
+	assert.Error(t, err)
+
+	for _, contents := range []string{
+		"docker://busybox\n",
+		"docker://busybox " + d1.String() + " " + d1.String() + " extra\n",
+		"busybox " + d1.String() + "\n",
+		"docker://busybox sha256:invalid\n",
+	} {
+		err := os.WriteFile(pinFile, []byte(contents), 0o644)
+		require.NoError(t, err)
+		_, err = readPins(pinFile)
+		assert.Error(t, err, contents)
+	}
+	_, err = readPins(filepath.Join(dir, "does-not-exist"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/containers/common/pkg/retry"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/types"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/exp/slices"
+)
+
+// preferredVariants contains, for architectures where the variant matters when choosing an image from a list,
+// the known variants from the most preferred to the least preferred one.
+// This follows the OCI / containerd platform matching rules, where "arm" without a variant means "arm/v7",
+// which can also run v6 and v5 images.
+var preferredVariants = map[string][]string{
+	"arm": {"v7", "v6", "v5"},
+}
+
+// normalizePlatform returns p with the OS, architecture and variant normalized to the values used by the OCI / containerd
+// platform matching rules, e.g. "aarch64" to "arm64", and with the implied variant of ARM architectures filled in,
+// e.g. "arm64" to "arm64/v8". Unknown values are only converted to lower case.
+func normalizePlatform(p v1.Platform) v1.Platform {
+	p.OS = strings.ToLower(p.OS)
+	if p.OS == "macos" {
+		p.OS = "darwin"
+	}
+	p.Architecture = strings.ToLower(p.Architecture)
+	p.Variant = strings.ToLower(p.Variant)
+	switch p.Architecture {
+	case "i386":
+		p.Architecture = "386"
+	case "x86_64", "x86-64", "amd64":
+		p.Architecture = "amd64"
+		if p.Variant == "v1" { // The baseline, which is implied
+			p.Variant = ""
+		}
+	case "aarch64", "arm64":
+		p.Architecture = "arm64"
+		switch p.Variant {
+		case "", "8", "v8.0":
+			p.Variant = "v8"
+		}
+	case "armhf":
+		p.Architecture = "arm"
+		p.Variant = "v7"
+	case "armel":
+		p.Architecture = "arm"
+		p.Variant = "v6"
+	case "arm":
+		switch p.Variant {
+		case "":
+			p.Variant = "v7"
+		case "5", "6", "7", "8":
+			p.Variant = "v" + p.Variant
+		}
+	}
+	return p
+}
+
+// adjustVariantChoice updates sys.VariantChoice, if necessary, to ensure that the right instance is chosen from a
+// manifest list in rawManifest (with MIME type mimeType) when the user has specified sys.ArchitectureChoice:
+//   - if no variant was specified, the best available variant in preferredVariants is chosen;
+//   - if a variant was specified, the list must contain an image for exactly that variant.
+//
+// It does nothing if rawManifest is not a list, or if the architecture does not have variants we care about.
+func adjustVariantChoice(sys *types.SystemContext, rawManifest []byte, mimeType string) error {
+	variants, ok := preferredVariants[sys.ArchitectureChoice]
+	if !ok || !manifest.MIMETypeIsMultiImage(mimeType) {
+		return nil
+	}
+	list, err := manifest.ListFromBlob(rawManifest, mimeType)
+	if err != nil {
+		return fmt.Errorf("parsing manifest list: %w", err)
+	}
+	wantedOS := runtime.GOOS
+	if sys.OSChoice != "" {
+		wantedOS = sys.OSChoice
+	}
+	available := []string{}
+	for _, d := range list.Instances() {
+		instance, err := list.Instance(d)
+		if err != nil {
+			return err
+		}
+		if p := instance.ReadOnly.Platform; p != nil && p.OS == wantedOS && p.Architecture == sys.ArchitectureChoice {
+			available = append(available, p.Variant)
+		}
+	}
+
+	if sys.VariantChoice != "" {
+		if !slices.Contains(available, sys.VariantChoice) {
+			return fmt.Errorf("no image found in manifest list for exactly %s/%s/%s", wantedOS, sys.ArchitectureChoice, sys.VariantChoice)
+		}
+		return nil
+	}
+	for _, v := range variants {
+		if slices.Contains(available, v) {
+			logrus.Debugf("Using variant %q for architecture %q", v, sys.ArchitectureChoice)
+			sys.VariantChoice = v
+			return nil
+		}
+	}
+	return nil // Let the usual matching rules choose, or report that there is no match.
+}
+
+// adjustVariantChoiceForReference is adjustVariantChoice for the top-level manifest of ref.
+// It only accesses ref if adjustVariantChoice might need to make changes.
+func adjustVariantChoiceForReference(ctx context.Context, sys *types.SystemContext, ref types.ImageReference, retryOpts *retry.Options) (retErr error) {
+	if _, ok := preferredVariants[sys.ArchitectureChoice]; !ok {
+		return nil
+	}
+	var src types.ImageSource
+	if err := retry.IfNecessary(ctx, func() error {
+		var err error
+		src, err = ref.NewImageSource(ctx, sys)
+		return err
+	}, retryOpts); err != nil {
+		return err
+	}
+	defer func() {
+		if err := src.Close(); err != nil {
+			retErr = noteCloseFailure(retErr, "closing image", err)
+		}
+	}()
+	var rawManifest []byte
+	var mimeType string
+	if err := retry.IfNecessary(ctx, func() error {
+		var err error
+		rawManifest, mimeType, err = src.GetManifest(ctx, nil)
+		return err
+	}, retryOpts); err != nil {
+		return fmt.Errorf("Error retrieving manifest for image: %w", err)
+	}
+	return adjustVariantChoice(sys, rawManifest, mimeType)
+}
+
+// checkLocalPlatform validates the use of --local-platform together with global.
+func checkLocalPlatform(global *globalOptions) error {
+	if global.overrideOS != "" || global.overrideArch != "" || global.overrideVariant != "" {
+		return errors.New("--local-platform can not be used together with --override-os, --override-arch or --override-variant")
+	}
+	return nil
+}
+
+// setLocalPlatform sets the OS, architecture and variant choices in sys to those of the machine skopeo is running on, for --local-platform.
+func setLocalPlatform(sys *types.SystemContext) {
+	sys.OSChoice = runtime.GOOS
+	sys.ArchitectureChoice = runtime.GOARCH
+	// c/image only detects the variant if ArchitectureChoice is not set, so do the same detection here.
+	sys.VariantChoice = localVariant()
+	logrus.Debugf("Choosing images for the local platform %s/%s/%s", sys.OSChoice, sys.ArchitectureChoice, sys.VariantChoice)
+}
+
+// localVariant returns the CPU variant of the machine skopeo is running on, or "" if the variant does not matter or can't be detected.
+// This follows the detection done by c/image, which is not exported.
+func localVariant() string {
+	switch {
+	case runtime.GOOS == "windows" && runtime.GOARCH == "arm64":
+		return "v8"
+	case runtime.GOOS == "windows" && runtime.GOARCH == "arm":
+		return "v7"
+	case runtime.GOOS == "linux" && (runtime.GOARCH == "arm64" || runtime.GOARCH == "arm"):
+		cpuinfo, err := os.Open("/proc/cpuinfo")
+		if err != nil {
+			logrus.Debugf("Error detecting the CPU variant: %v", err)
+			return ""
+		}
+		defer cpuinfo.Close()
+		return armVariantFromCPUInfo(cpuinfo)
+	default:
+		return ""
+	}
+}
+
+// armVariantFromCPUInfo returns the variant of an ARM CPU described by cpuinfo, the contents of /proc/cpuinfo, or "" if it is not known.
+func armVariantFromCPUInfo(cpuinfo io.Reader) string {
+	fields := map[string]string{} // Only the first value of each field, describing the first core, is used
+	scanner := bufio.NewScanner(cpuinfo)
+	for scanner.Scan() {
+		name, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := fields[name]; !ok {
+			fields[name] = strings.TrimSpace(value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		logrus.Debugf("Error detecting the CPU variant: %v", err)
+		return ""
+	}
+	switch strings.ToLower(fields["cpu architecture"]) {
+	case "8", "aarch64":
+		return "v8"
+	case "7m", "?(12)", "?(13)", "?(14)", "?(15)", "?(16)", "?(17)":
+		return "v7"
+	case "7":
+		// Some ARMv6 CPUs, e.g. in the Raspberry Pi Zero, are reported as architecture 7; Linux names them "ARMv6-compatible".
+		if strings.HasPrefix(strings.ToLower(fields["model name"]), "armv6-compatible") {
+			return "v6"
+		}
+		return "v7"
+	case "6", "6tej":
+		return "v6"
+	case "5", "5t", "5te", "5tej":
+		return "v5"
+	default:
+		return ""
+	}
+}
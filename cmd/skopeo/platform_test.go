@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecspecs "github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testIndex returns an OCI index containing images for the specified linux platforms.
+func testIndex(t *testing.T, platforms ...imgspecv1.Platform) []byte {
+	index := imgspecv1.Index{
+		MediaType: imgspecv1.MediaTypeImageIndex,
+	}
+	index.SchemaVersion = 2
+	for i := range platforms {
+		index.Manifests = append(index.Manifests, imgspecv1.Descriptor{
+			MediaType: imgspecv1.MediaTypeImageManifest,
+			Digest:    digest.FromString(platforms[i].Architecture + platforms[i].Variant),
+			Size:      1,
+			Platform:  &platforms[i],
+		})
+	}
+	res, err := json.Marshal(index)
+	require.NoError(t, err)
+	return res
+}
+
+func TestNormalizePlatform(t *testing.T) {
+	for _, c := range []struct{ input, expected imgspecv1.Platform }{
+		{imgspecv1.Platform{OS: "linux", Architecture: "amd64"}, imgspecv1.Platform{OS: "linux", Architecture: "amd64"}},
+		{imgspecv1.Platform{OS: "Linux", Architecture: "x86_64", Variant: "v1"}, imgspecv1.Platform{OS: "linux", Architecture: "amd64"}},
+		{imgspecv1.Platform{OS: "linux", Architecture: "amd64", Variant: "v3"}, imgspecv1.Platform{OS: "linux", Architecture: "amd64", Variant: "v3"}},
+		{imgspecv1.Platform{OS: "linux", Architecture: "i386"}, imgspecv1.Platform{OS: "linux", Architecture: "386"}},
+		{imgspecv1.Platform{OS: "linux", Architecture: "arm64"}, imgspecv1.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}},
+		{imgspecv1.Platform{OS: "linux", Architecture: "aarch64", Variant: "8"}, imgspecv1.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}},
+		{imgspecv1.Platform{OS: "linux", Architecture: "arm64", Variant: "v9"}, imgspecv1.Platform{OS: "linux", Architecture: "arm64", Variant: "v9"}},
+		{imgspecv1.Platform{OS: "linux", Architecture: "arm"}, imgspecv1.Platform{OS: "linux", Architecture: "arm", Variant: "v7"}},
+		{imgspecv1.Platform{OS: "linux", Architecture: "arm", Variant: "6"}, imgspecv1.Platform{OS: "linux", Architecture: "arm", Variant: "v6"}},
+		{imgspecv1.Platform{OS: "linux", Architecture: "armhf"}, imgspecv1.Platform{OS: "linux", Architecture: "arm", Variant: "v7"}},
+		{imgspecv1.Platform{OS: "linux", Architecture: "armel"}, imgspecv1.Platform{OS: "linux", Architecture: "arm", Variant: "v6"}},
+		{imgspecv1.Platform{OS: "macOS", Architecture: "arm64"}, imgspecv1.Platform{OS: "darwin", Architecture: "arm64", Variant: "v8"}},
+		{imgspecv1.Platform{OS: "linux", Architecture: "S390X"}, imgspecv1.Platform{OS: "linux", Architecture: "s390x"}},
+	} {
+		assert.Equal(t, c.expected, normalizePlatform(c.input), c.input)
+	}
+}
+
+func TestAdjustVariantChoice(t *testing.T) {
+	armV6 := imgspecv1.Platform{OS: "linux", Architecture: "arm", Variant: "v6"}
+	armV7 := imgspecv1.Platform{OS: "linux", Architecture: "arm", Variant: "v7"}
+	arm64 := imgspecv1.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}
+	amd64 := imgspecv1.Platform{OS: "linux", Architecture: "amd64"}
+	v6v7 := testIndex(t, amd64, armV6, armV7, arm64)
+	v6Only := testIndex(t, amd64, armV6)
+
+	for _, c := range []struct {
+		arch, variant string
+		index         []byte
+		expected      string // Ignored if fails
+		fails         bool
+	}{
+		{"arm", "", v6v7, "v7", false},
+		{"arm", "", v6Only, "v6", false},
+		{"arm", "v6", v6v7, "v6", false},
+		{"arm", "v7", v6Only, "", true},
+		{"arm64", "", v6v7, "", false}, // Not handled, VariantChoice is not modified
+	} {
+		sys := &types.SystemContext{OSChoice: "linux", ArchitectureChoice: c.arch, VariantChoice: c.variant}
+		err := adjustVariantChoice(sys, c.index, imgspecv1.MediaTypeImageIndex)
+		if c.fails {
+			assert.Error(t, err, c)
+		} else {
+			require.NoError(t, err, c)
+			assert.Equal(t, c.expected, sys.VariantChoice, c)
+		}
+	}
+
+	// Single-image manifests are not modified.
+	sys := &types.SystemContext{OSChoice: "linux", ArchitectureChoice: "arm"}
+	err := adjustVariantChoice(sys, []byte("{}"), imgspecv1.MediaTypeImageManifest)
+	require.NoError(t, err)
+	assert.Equal(t, "", sys.VariantChoice)
+}
+
+func TestArmVariantFromCPUInfo(t *testing.T) {
+	for _, c := range []struct {
+		cpuinfo, expected string
+	}{
+		{"processor\t: 0\nBogoMIPS\t: 48.00\nCPU architecture: 8\n\nprocessor\t: 1\nCPU architecture: 7\n", "v8"},
+		{"processor\t: 0\nmodel name\t: ARMv7 Processor rev 4 (v7l)\nCPU architecture: 7\n", "v7"},
+		{"processor\t: 0\nmodel name\t: ARMv6-compatible processor rev 7 (v6l)\nCPU architecture: 7\n", "v6"},
+		{"processor\t: 0\nCPU architecture: 5TEJ\n", "v5"},
+		{"processor\t: 0\nCPU architecture: 4T\n", ""},
+		{"processor\t: 0\n", ""},
+	} {
+		assert.Equal(t, c.expected, armVariantFromCPUInfo(strings.NewReader(c.cpuinfo)), c.cpuinfo)
+	}
+}
+
+func TestLocalPlatform(t *testing.T) {
+	imageDir := testDirImageWithBlobs(t)
+	imageManifest, err := os.ReadFile(filepath.Join(imageDir, "manifest.json"))
+	require.NoError(t, err)
+	imageDigest := digest.FromBytes(imageManifest)
+	otherArch := "s390x"
+	if runtime.GOARCH == otherArch {
+		otherArch = "ppc64le"
+	}
+	index, err := json.Marshal(imgspecv1.Index{
+		Versioned: imgspecspecs.Versioned{SchemaVersion: 2},
+		MediaType: imgspecv1.MediaTypeImageIndex,
+		Manifests: []imgspecv1.Descriptor{
+			{
+				MediaType: imgspecv1.MediaTypeImageManifest,
+				Digest:    digest.FromString(otherArch),
+				Size:      1,
+				Platform:  &imgspecv1.Platform{OS: runtime.GOOS, Architecture: otherArch},
+			},
+			{
+				MediaType: imgspecv1.MediaTypeImageManifest,
+				Digest:    imageDigest,
+				Size:      int64(len(imageManifest)),
+				Platform:  &imgspecv1.Platform{OS: runtime.GOOS, Architecture: runtime.GOARCH},
+			},
+		},
+	})
+	require.NoError(t, err)
+	// Turn imageDir, which contains the blobs, into a list.
+	listDir := imageDir
+	err = os.WriteFile(filepath.Join(listDir, imageDigest.Encoded()+".manifest.json"), imageManifest, 0o644)
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(listDir, "manifest.json"), index, 0o644)
+	require.NoError(t, err)
+
+	dest := t.TempDir()
+	_, err = runSkopeo("--insecure-policy", "copy", "--local-platform", "dir:"+listDir, "dir:"+dest)
+	require.NoError(t, err)
+	destManifest, err := os.ReadFile(filepath.Join(dest, "manifest.json"))
+	require.NoError(t, err)
+	assert.Equal(t, imageManifest, destManifest)
+
+	out, err := runSkopeo("--insecure-policy", "--override-arch", otherArch, "copy", "--local-platform", "dir:"+listDir, "dir:"+t.TempDir())
+	assertTestFailed(t, out, err, "--local-platform can not be used together with --override-os, --override-arch or --override-variant")
+	out, err = runSkopeo("--insecure-policy", "copy", "--local-platform", "--all", "dir:"+listDir, "dir:"+t.TempDir())
+	assertTestFailed(t, out, err, "--local-platform can only be used when copying a single image")
+
+	_, err = runSkopeo("inspect", "--local-platform", "dir:"+listDir)
+	require.NoError(t, err)
+	out, err = runSkopeo("--override-os", "windows", "inspect", "--local-platform", "dir:"+listDir)
+	assertTestFailed(t, out, err, "--local-platform can not be used together with --override-os, --override-arch or --override-variant")
+}
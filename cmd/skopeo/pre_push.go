@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+
+	"github.com/containers/common/pkg/retry"
+	"github.com/containers/image/v5/copy"
+	"github.com/containers/image/v5/directory"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/signature"
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/types"
+)
+
+// setUpPrePushCmd copies the image at srcRef, verified against policyContext, into a temporary directory created using global,
+// runs command on the staged image, and returns a reference to the staged image if command succeeds.
+// options are the options of the copy to the destination; the image is staged using the same source and list selection options.
+func setUpPrePushCmd(ctx context.Context, policyContext *signature.PolicyContext, srcRef types.ImageReference, command string,
+	options *copy.Options, global *globalOptions, retryOpts *retry.Options, stdout io.Writer) (types.ImageReference, error) {
+	dir, err := global.newTemporaryDir("skopeo-pre-push")
+	if err != nil {
+		return nil, err
+	}
+	stagedRef, err := directory.NewReference(dir)
+	if err != nil {
+		return nil, err
+	}
+	var manifestBytes []byte
+	if err := retry.IfNecessary(ctx, func() error {
+		var err error
+		manifestBytes, err = copy.Image(ctx, policyContext, stagedRef, srcRef, &copy.Options{
+			ReportWriter:        stdout,
+			SourceCtx:           options.SourceCtx,
+			ImageListSelection:  options.ImageListSelection,
+			PreferGzipInstances: options.PreferGzipInstances,
+			PreserveDigests:     true,
+		})
+		return err
+	}, retryOpts); err != nil {
+		return nil, fmt.Errorf("staging the image for --pre-push-cmd: %w", err)
+	}
+	manifestDigest, err := manifest.Digest(manifestBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Env = append(os.Environ(),
+		"SKOPEO_IMAGE_DIGEST="+manifestDigest.String(),
+		"SKOPEO_IMAGE_PATH="+dir,
+		"SKOPEO_IMAGE_REF="+transports.ImageName(stagedRef),
+	)
+	cmd.Stdout = stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("--pre-push-cmd rejected image %s (%v), not copying it", manifestDigest, exitErr)
+		}
+		return nil, fmt.Errorf("running --pre-push-cmd: %w", err)
+	}
+	return stagedRef, nil
+}
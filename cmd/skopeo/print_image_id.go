@@ -0,0 +1,18 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/containers/image/v5/storage"
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/types"
+)
+
+// storageImageID returns the ID of the image stored at ref, a containers-storage: reference.
+func storageImageID(ref types.ImageReference) (string, error) {
+	_, img, err := storage.ResolveReference(ref)
+	if err != nil {
+		return "", fmt.Errorf("Error looking up the ID of %s: %w", transports.ImageName(ref), err)
+	}
+	return img.ID, nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/containers/image/v5/types"
+	"github.com/sirupsen/logrus"
+)
+
+// progressWebhookInterval is the minimum time between progress updates of a single blob sent to --progress-webhook.
+const progressWebhookInterval = time.Second
+
+// progressWebhookTimeout limits the time a single POST to --progress-webhook may take.
+const progressWebhookTimeout = 10 * time.Second
+
+// progressWebhook sends copy progress events to a webhook, without ever blocking the copy.
+type progressWebhook struct {
+	url    string
+	client *http.Client
+	// progress receives events from c/image/copy.Image
+	progress chan types.ProgressProperties
+	// events holds the events waiting to be sent; if the webhook does not keep up, further events are dropped.
+	events chan blobProgressEvent
+	// done is closed when the sender goroutine exits
+	done chan struct{}
+}
+
+// parseProgressWebhookURL validates the value of --progress-webhook.
+func parseProgressWebhookURL(value string) (*url.URL, error) {
+	u, err := url.Parse(value)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid --progress-webhook value %q: %w", value, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("Invalid --progress-webhook value %q: must be an http:// or https:// URL", value)
+	}
+	return u, nil
+}
+
+// newProgressWebhook returns a progressWebhook sending events to u, and starts its goroutines.
+// The caller must set up copy.Options.Progress using the progress field, and call .close() after all copies have finished.
+func newProgressWebhook(u *url.URL) *progressWebhook {
+	w := &progressWebhook{
+		url:      u.String(),
+		client:   &http.Client{Timeout: progressWebhookTimeout},
+		progress: make(chan types.ProgressProperties),
+		events:   make(chan blobProgressEvent, maxQueuedEvents),
+		done:     make(chan struct{}),
+	}
+	go func() {
+		defer close(w.events)
+		for p := range w.progress {
+			switch p.Event {
+			case types.ProgressEventNewArtifact, types.ProgressEventRead, types.ProgressEventDone:
+			default: // Notably types.ProgressEventSkipped: nothing is transferred.
+				continue
+			}
+			select {
+			case w.events <- blobProgressEvent{Digest: p.Artifact.Digest, BytesRead: int64(p.Offset), Total: p.Artifact.Size}:
+			default:
+				logrus.Debugf("Dropping a progress event for %s, the webhook is not keeping up", p.Artifact.Digest)
+			}
+		}
+	}()
+	go func() {
+		defer close(w.done)
+		for event := range w.events {
+			w.send(event)
+		}
+	}()
+	return w
+}
+
+// send POSTs event to the webhook. Failures are only logged; they don't abort the copy.
+func (w *progressWebhook) send(event blobProgressEvent) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		logrus.Warnf("Error encoding a progress event: %v", err)
+		return
+	}
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		logrus.Warnf("Error sending progress to %s: %v", w.url, err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := w.client.Do(req)
+	if err != nil {
+		logrus.Warnf("Error sending progress to %s: %v", w.url, err)
+		return
+	}
+	res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		logrus.Warnf("Error sending progress to %s: %s", w.url, res.Status)
+	}
+}
+
+// close sends any queued events, and stops the goroutines.
+// If the webhook is not responding, it gives up after progressWebhookTimeout.
+func (w *progressWebhook) close() {
+	close(w.progress)
+	select {
+	case <-w.done:
+	case <-time.After(progressWebhookTimeout):
+		logrus.Warnf("Giving up sending progress to %s", w.url)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopyProgressWebhook(t *testing.T) {
+	src := testDirImageWithBlobs(t)
+	layerDigest := digest.FromString("not really a layer")
+
+	var lock sync.Mutex
+	events := []blobProgressEvent{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		var event blobProgressEvent
+		err := json.NewDecoder(r.Body).Decode(&event)
+		assert.NoError(t, err)
+		lock.Lock()
+		events = append(events, event)
+		lock.Unlock()
+	}))
+	defer server.Close()
+
+	_, err := runSkopeo("--insecure-policy", "copy", "--progress-webhook", server.URL, "dir:"+src, "dir:"+t.TempDir())
+	require.NoError(t, err)
+	lock.Lock()
+	defer lock.Unlock()
+	assert.Contains(t, events, blobProgressEvent{Digest: layerDigest, BytesRead: 0, Total: int64(len("not really a layer"))})
+	assert.Contains(t, events, blobProgressEvent{Digest: layerDigest, BytesRead: int64(len("not really a layer")), Total: int64(len("not really a layer"))})
+
+	// Failures to send progress don't abort the copy.
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "failing", http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	dest := t.TempDir()
+	_, err = runSkopeo("--insecure-policy", "copy", "--progress-webhook", failing.URL, "dir:"+src, "dir:"+dest)
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(dest, "manifest.json"))
+
+	out, err := runSkopeo("--insecure-policy", "copy", "--progress-webhook", "file:///tmp/progress", "dir:"+src, "dir:"+t.TempDir())
+	assertTestFailed(t, out, err, "must be an http:// or https:// URL")
+}
@@ -57,6 +57,16 @@ package main
  that the client checks for errors.  For example, `GetBlob`
  performs digest (e.g. sha256) verification and this must
  be checked after all data has been written.
+
+ Optionally, a client may invoke `OpenEventStream` to receive
+ the read half of another pipe, on which the server writes
+ newline-delimited JSON events while `GetBlob` requests are
+ streaming data, e.g.
+   {"digest":"sha256:...","bytesRead":1048576,"total":4194304}
+ Events are sent periodically, and once the whole blob has been read.
+ Events are dropped if the client does not read them fast enough;
+ they are only intended to show progress.  Invoking `FinishPipe` with
+ the returned <pipeid> closes the event stream.
 */
 
 import (
@@ -70,6 +80,7 @@ import (
 	"os"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/containers/image/v5/image"
 	"github.com/containers/image/v5/manifest"
@@ -96,7 +107,8 @@ import (
 // 0.2.4: Added OpenImageOptional
 // 0.2.5: Added LayerInfoJSON
 // 0.2.6: Policy Verification before pulling OCI
-const protocolVersion = "0.2.6"
+// 0.2.7: Added OpenEventStream
+const protocolVersion = "0.2.7"
 
 // maxMsgSize is the current limit on a packet size.
 // Note that all non-metadata (i.e. payload data) is sent over a pipe.
@@ -111,6 +123,9 @@ const maxJSONFloat = float64(uint64(1)<<53 - 1)
 // sentinelImageID represents "image not found" on the wire
 const sentinelImageID = 0
 
+// blobProgressInterval is the minimum time between progress events for a single blob.
+const blobProgressInterval = 200 * time.Millisecond
+
 // request is the JSON serialization of a function call
 type request struct {
 	// Method is the name of the function
@@ -175,6 +190,8 @@ type proxyHandler struct {
 	images map[uint64]*openImage
 	// activePipes maps from "pipeid" to a pipe + goroutine pair
 	activePipes map[uint32]*activePipe
+	// events is the event stream opened by OpenEventStream, if any
+	events *eventStream
 }
 
 // convertedLayerInfo is the reduced form of the OCI type BlobInfo
@@ -185,6 +202,89 @@ type convertedLayerInfo struct {
 	MediaType string        `json:"media_type"`
 }
 
+// eventStream writes events to a pipe to the client, without ever blocking the sender.
+type eventStream struct {
+	// w is the write half of the pipe
+	w *os.File
+	// lock protects closed, and serializes sends with close()
+	lock   sync.Mutex
+	closed bool
+	events chan blobProgressEvent
+	// done is closed when the writer goroutine exits
+	done chan struct{}
+}
+
+// newEventStream returns an eventStream writing to w, and starts its writer goroutine.
+func newEventStream(w *os.File) *eventStream {
+	s := &eventStream{
+		w:      w,
+		events: make(chan blobProgressEvent, maxQueuedEvents),
+		done:   make(chan struct{}),
+	}
+	go func() {
+		defer close(s.done)
+		encoder := json.NewEncoder(s.w)
+		for event := range s.events {
+			if err := encoder.Encode(event); err != nil {
+				logrus.Debugf("Error writing to the event stream: %v", err)
+				// Keep draining the channel so that send() and close() never block.
+				for range s.events {
+				}
+				return
+			}
+		}
+	}()
+	return s
+}
+
+// send queues event to be written, dropping it if the client is not keeping up.
+func (s *eventStream) send(event blobProgressEvent) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.events <- event:
+	default:
+	}
+}
+
+// close writes any queued events and closes the pipe.
+func (s *eventStream) close() {
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		return
+	}
+	s.closed = true
+	close(s.events)
+	s.lock.Unlock()
+	<-s.done
+	s.w.Close()
+}
+
+// progressReader is an io.Reader which reports the progress of reading a blob to an eventStream.
+type progressReader struct {
+	r         io.Reader
+	events    *eventStream
+	digest    digest.Digest
+	total     int64
+	bytesRead int64
+	lastEvent time.Time
+}
+
+// Read implements io.Reader.
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.bytesRead += int64(n)
+	if err != nil || time.Since(p.lastEvent) >= blobProgressInterval {
+		p.events.send(blobProgressEvent{Digest: p.digest, BytesRead: p.bytesRead, Total: p.total})
+		p.lastEvent = time.Now()
+	}
+	return n, err
+}
+
 // Initialize performs one-time initialization, and returns the protocol version
 func (h *proxyHandler) Initialize(args []any) (replyBuf, error) {
 	h.lock.Lock()
@@ -614,12 +714,16 @@ func (h *proxyHandler) GetBlob(args []any) (replyBuf, error) {
 		blobr.Close()
 		return ret, err
 	}
+	var blobStream io.Reader = blobr
+	if h.events != nil {
+		blobStream = &progressReader{r: blobr, events: h.events, digest: d, total: int64(size)}
+	}
 	go func() {
 		// Signal completion when we return
 		defer blobr.Close()
 		defer f.wg.Done()
 		verifier := d.Verifier()
-		tr := io.TeeReader(blobr, verifier)
+		tr := io.TeeReader(blobStream, verifier)
 		n, err := io.Copy(f.w, tr)
 		if err != nil {
 			f.err = err
@@ -639,6 +743,35 @@ func (h *proxyHandler) GetBlob(args []any) (replyBuf, error) {
 	return ret, nil
 }
 
+// OpenEventStream returns the read half of a pipe, on which progress events of GetBlob are written.
+// Invoking FinishPipe on the returned pipe closes the event stream.
+func (h *proxyHandler) OpenEventStream(args []any) (replyBuf, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	var ret replyBuf
+
+	if h.sysctx == nil {
+		return ret, fmt.Errorf("client error: must invoke Initialize")
+	}
+	if len(args) != 0 {
+		return ret, fmt.Errorf("invalid request, expecting zero arguments")
+	}
+	if h.events != nil {
+		return ret, fmt.Errorf("event stream already open")
+	}
+
+	piper, pipew, err := os.Pipe()
+	if err != nil {
+		return ret, err
+	}
+	h.events = newEventStream(pipew)
+
+	ret.fd = piper
+	ret.pipeid = uint32(pipew.Fd())
+	return ret, nil
+}
+
 // GetLayerInfo returns data about the layers of an image, useful for reading the layer contents.
 //
 // This needs to be called since the data returned by GetManifest() does not allow to correctly
@@ -702,6 +835,12 @@ func (h *proxyHandler) FinishPipe(args []any) (replyBuf, error) {
 	}
 	pipeid := uint32(pipeidv)
 
+	if h.events != nil && pipeid == uint32(h.events.w.Fd()) {
+		h.events.close()
+		h.events = nil
+		return ret, nil
+	}
+
 	f, ok := h.activePipes[pipeid]
 	if !ok {
 		return ret, fmt.Errorf("finishpipe: no active pipe %d", pipeid)
@@ -719,6 +858,9 @@ func (h *proxyHandler) FinishPipe(args []any) (replyBuf, error) {
 
 // close releases all resources associated with this proxy backend
 func (h *proxyHandler) close() {
+	if h.events != nil {
+		h.events.close()
+	}
 	for _, image := range h.images {
 		err := image.src.Close()
 		if err != nil {
@@ -824,6 +966,8 @@ func (h *proxyHandler) processRequest(readBytes []byte) (rb replyBuf, terminate
 		rb, err = h.GetBlob(req.Args)
 	case "GetLayerInfo":
 		rb, err = h.GetLayerInfo(req.Args)
+	case "OpenEventStream":
+		rb, err = h.OpenEventStream(req.Args)
 	case "FinishPipe":
 		rb, err = h.FinishPipe(req.Args)
 	case "Shutdown":
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+// pushStateContents is the format of a copy --push-state-file file.
+type pushStateContents struct {
+	Destination string          `json:"destination"` // The name of the destination image, including the transport
+	Blobs       []pushStateBlob `json:"blobs"`       // The blobs the destination has confirmed to contain, in order of confirmation
+}
+
+// pushStateBlob is a blob recorded in a pushStateContents.
+type pushStateBlob struct {
+	Digest digest.Digest `json:"digest"`
+	Size   int64         `json:"size"`
+}
+
+// pushState tracks the blobs the destination of a copy has confirmed to contain, persisted in a file
+// so that a copy restarted after a failure only needs to re-check them, and pushes only the other blobs.
+type pushState struct {
+	path        string
+	destination string
+
+	mutex    sync.Mutex
+	blobs    []pushStateBlob            // Recorded blobs, in order of confirmation
+	recorded map[digest.Digest]struct{} // The digests of blobs
+}
+
+// loadPushState returns a pushState for a copy to destination, persisted at path.
+// If path exists, it must record a copy to the same destination; its blobs are treated as confirmed, but are re-checked before being used.
+func loadPushState(path string, destination string) (*pushState, error) {
+	res := &pushState{
+		path:        path,
+		destination: destination,
+		blobs:       []pushStateBlob{},
+		recorded:    map[digest.Digest]struct{}{},
+	}
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return res, nil
+		}
+		return nil, err
+	}
+	var parsed pushStateContents
+	if err := json.Unmarshal(contents, &parsed); err != nil {
+		return nil, fmt.Errorf("parsing the push state file %s: %w", path, err)
+	}
+	if parsed.Destination != destination {
+		return nil, fmt.Errorf("the push state file %s records a copy to %s, not %s", path, parsed.Destination, destination)
+	}
+	for _, blob := range parsed.Blobs {
+		if err := blob.Digest.Validate(); err != nil {
+			return nil, fmt.Errorf("parsing the push state file %s: %w", path, err)
+		}
+		if _, ok := res.recorded[blob.Digest]; !ok {
+			res.blobs = append(res.blobs, blob)
+			res.recorded[blob.Digest] = struct{}{}
+		}
+	}
+	logrus.Debugf("Resuming a copy to %s with %d blobs recorded in %s", destination, len(res.blobs), path)
+	return res, nil
+}
+
+// isRecorded returns true if blobDigest is recorded in s.
+func (s *pushState) isRecorded(blobDigest digest.Digest) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, ok := s.recorded[blobDigest]
+	return ok
+}
+
+// record adds blob to s, and persists the state.
+func (s *pushState) record(blob types.BlobInfo) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.recorded[blob.Digest]; ok {
+		return nil
+	}
+	s.blobs = append(s.blobs, pushStateBlob{Digest: blob.Digest, Size: blob.Size})
+	s.recorded[blob.Digest] = struct{}{}
+	contents, err := json.Marshal(pushStateContents{Destination: s.destination, Blobs: s.blobs})
+	if err != nil {
+		return err
+	}
+	// Replace the file atomically, so that an interrupted copy never leaves a truncated state behind.
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".tmp-"+filepath.Base(s.path)+"-")
+	if err != nil {
+		return fmt.Errorf("writing the push state file %s: %w", s.path, err)
+	}
+	tmpPath := tmp.Name()
+	_, err = tmp.Write(contents)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, s.path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("writing the push state file %s: %w", s.path, err)
+	}
+	return nil
+}
+
+// remove deletes the file of s, after the copy has succeeded.
+func (s *pushState) remove() error {
+	if err := os.Remove(s.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("removing the push state file %s: %w", s.path, err)
+	}
+	return nil
+}
+
+// pushStateReference is a types.ImageReference wrapper; image destinations created from it record the blobs they confirm in state.
+type pushStateReference struct {
+	types.ImageReference
+	state *pushState
+}
+
+// NewImageDestination returns a types.ImageDestination for this reference.
+// The caller must call .Close() on the returned ImageDestination.
+func (ref pushStateReference) NewImageDestination(ctx context.Context, sys *types.SystemContext) (types.ImageDestination, error) {
+	dest, err := ref.ImageReference.NewImageDestination(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	return pushStateDestination{ImageDestination: dest, ref: ref}, nil
+}
+
+// pushStateDestination is a types.ImageDestination wrapper which records the blobs written to, or reused at, the destination in a pushState,
+// and checks recorded blobs only for their existence at the destination.
+type pushStateDestination struct {
+	types.ImageDestination
+	ref pushStateReference
+}
+
+// Reference returns the reference used to set up this destination.
+func (d pushStateDestination) Reference() types.ImageReference {
+	return d.ref
+}
+
+// PutBlob writes contents of stream and returns data representing the result.
+func (d pushStateDestination) PutBlob(ctx context.Context, stream io.Reader, inputInfo types.BlobInfo, cache types.BlobInfoCache, isConfig bool) (types.BlobInfo, error) {
+	res, err := d.ImageDestination.PutBlob(ctx, stream, inputInfo, cache, isConfig)
+	if err != nil {
+		return res, err
+	}
+	if err := d.ref.state.record(res); err != nil {
+		return types.BlobInfo{}, err
+	}
+	return res, nil
+}
+
+// TryReusingBlob checks whether the transport already contains, or can efficiently reuse, a blob, and if so, applies it to the current destination.
+// Blobs recorded by an earlier attempt are only checked for their existence, without consulting cache or looking for substitutes;
+// if they no longer exist, they are handled like any other blob.
+func (d pushStateDestination) TryReusingBlob(ctx context.Context, info types.BlobInfo, cache types.BlobInfoCache, canSubstitute bool) (bool, types.BlobInfo, error) {
+	if info.Digest != "" && d.ref.state.isRecorded(info.Digest) {
+		reused, res, err := d.ImageDestination.TryReusingBlob(ctx, info, none.NoCache, false)
+		if err != nil {
+			return false, types.BlobInfo{}, err
+		}
+		if reused {
+			return true, res, nil
+		}
+		logrus.Debugf("Blob %s recorded in %s no longer exists at the destination", info.Digest, d.ref.state.path)
+	}
+	reused, res, err := d.ImageDestination.TryReusingBlob(ctx, info, cache, canSubstitute)
+	if err != nil || !reused {
+		return reused, res, err
+	}
+	if err := d.ref.state.record(res); err != nil {
+		return false, types.BlobInfo{}, err
+	}
+	return true, res, nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/directory"
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPushStateDestination(t *testing.T) {
+	ctx := context.Background()
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	destRef, err := directory.NewReference(t.TempDir())
+	require.NoError(t, err)
+	state, err := loadPushState(statePath, "dir:dest")
+	require.NoError(t, err)
+	dest, err := pushStateReference{ImageReference: destRef, state: state}.NewImageDestination(ctx, nil)
+	require.NoError(t, err)
+	defer dest.Close()
+
+	blob := []byte("not really a layer")
+	blobDigest := digest.FromBytes(blob)
+	_, err = dest.PutBlob(ctx, bytes.NewReader(blob), types.BlobInfo{Digest: blobDigest, Size: int64(len(blob))}, none.NoCache, false)
+	require.NoError(t, err)
+	contents, err := os.ReadFile(statePath)
+	require.NoError(t, err)
+	var parsed pushStateContents
+	require.NoError(t, json.Unmarshal(contents, &parsed))
+	assert.Equal(t, pushStateContents{
+		Destination: "dir:dest",
+		Blobs:       []pushStateBlob{{Digest: blobDigest, Size: int64(len(blob))}},
+	}, parsed)
+
+	resumed, err := loadPushState(statePath, "dir:dest")
+	require.NoError(t, err)
+	assert.True(t, resumed.isRecorded(blobDigest))
+	// Creating a new dir: destination would remove the blob, so reuse the underlying destination.
+	dest2 := pushStateDestination{ImageDestination: dest.(pushStateDestination).ImageDestination, ref: pushStateReference{ImageReference: destRef, state: resumed}}
+	reused, info, err := dest2.TryReusingBlob(ctx, types.BlobInfo{Digest: blobDigest, Size: -1}, none.NoCache, true)
+	require.NoError(t, err)
+	assert.True(t, reused)
+	assert.Equal(t, blobDigest, info.Digest)
+	// A recorded blob which no longer exists is not reused.
+	missing := digest.FromString("missing")
+	resumed.recorded[missing] = struct{}{}
+	reused, _, err = dest2.TryReusingBlob(ctx, types.BlobInfo{Digest: missing, Size: -1}, none.NoCache, true)
+	require.NoError(t, err)
+	assert.False(t, reused)
+
+	_, err = loadPushState(statePath, "dir:other")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "records a copy to dir:dest, not dir:other")
+
+	require.NoError(t, resumed.remove())
+	_, err = os.Stat(statePath)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	require.NoError(t, resumed.remove())
+}
+
+func TestCopyPushStateFile(t *testing.T) {
+	src := testDirImageWithBlobs(t)
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	require.NoError(t, os.WriteFile(statePath, []byte(`{"destination":"dir:/somewhere/else","blobs":[]}`), 0o600))
+	dest := t.TempDir()
+	out, err := runSkopeo("--insecure-policy", "copy", "--push-state-file", statePath, "dir:"+src, "dir:"+dest)
+	assertTestFailed(t, out, err, "records a copy to dir:/somewhere/else")
+
+	require.NoError(t, os.Remove(statePath))
+	_, err = runSkopeo("--insecure-policy", "copy", "--push-state-file", statePath, "dir:"+src, "dir:"+dest)
+	require.NoError(t, err)
+	_, err = os.Stat(statePath)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	srcManifest, err := os.ReadFile(filepath.Join(src, "manifest.json"))
+	require.NoError(t, err)
+	destManifest, err := os.ReadFile(filepath.Join(dest, "manifest.json"))
+	require.NoError(t, err)
+	assert.Equal(t, srcManifest, destManifest)
+
+	out, err = runSkopeo("--insecure-policy", "copy", "--push-state-file", statePath, "--dry-run", "dir:"+src, "dir:"+t.TempDir())
+	assertTestFailed(t, out, err, "--push-state-file cannot be used together with --dry-run")
+}
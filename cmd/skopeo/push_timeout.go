@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+)
+
+// pushTimeoutReference is a types.ImageReference wrapper; image destinations created from it
+// cancel all writes which are not finished within timeout of the first write to the destination.
+type pushTimeoutReference struct {
+	types.ImageReference
+	timeout time.Duration
+}
+
+// NewImageDestination returns a types.ImageDestination for this reference.
+// The caller must call .Close() on the returned ImageDestination.
+func (ref pushTimeoutReference) NewImageDestination(ctx context.Context, sys *types.SystemContext) (types.ImageDestination, error) {
+	dest, err := ref.ImageReference.NewImageDestination(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	return &pushTimeoutDestination{ImageDestination: dest, ref: ref}, nil
+}
+
+// pushTimeoutDestination is a types.ImageDestination wrapper which enforces ref.timeout.
+type pushTimeoutDestination struct {
+	types.ImageDestination
+	ref pushTimeoutReference
+
+	startOnce sync.Once
+	deadline  time.Time // Set on the first write
+}
+
+// Reference returns the reference used to set up this destination.
+func (d *pushTimeoutDestination) Reference() types.ImageReference {
+	return d.ref
+}
+
+// writeContext returns a context to use for a write to the destination, derived from ctx, and a cancellation callback.
+func (d *pushTimeoutDestination) writeContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	d.startOnce.Do(func() {
+		d.deadline = time.Now().Add(d.ref.timeout)
+	})
+	return context.WithDeadline(ctx, d.deadline)
+}
+
+// pushError returns err, with a clearer message if it was caused by the push timeout expiring, i.e. writeCtx, but not ctx, is done.
+func (d *pushTimeoutDestination) pushError(ctx, writeCtx context.Context, err error) error {
+	if err != nil && ctx.Err() == nil && errors.Is(writeCtx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("pushing to %s did not finish within --dest-push-timeout %s: %w", transports.ImageName(d.ref), d.ref.timeout, err)
+	}
+	return err
+}
+
+// PutBlob writes contents of stream and returns data representing the result.
+func (d *pushTimeoutDestination) PutBlob(ctx context.Context, stream io.Reader, inputInfo types.BlobInfo, cache types.BlobInfoCache, isConfig bool) (types.BlobInfo, error) {
+	writeCtx, cancel := d.writeContext(ctx)
+	defer cancel()
+	res, err := d.ImageDestination.PutBlob(writeCtx, stream, inputInfo, cache, isConfig)
+	return res, d.pushError(ctx, writeCtx, err)
+}
+
+// TryReusingBlob checks whether the transport already contains, or can efficiently reuse, a blob, and if so, applies it to the current destination.
+func (d *pushTimeoutDestination) TryReusingBlob(ctx context.Context, info types.BlobInfo, cache types.BlobInfoCache, canSubstitute bool) (bool, types.BlobInfo, error) {
+	writeCtx, cancel := d.writeContext(ctx)
+	defer cancel()
+	reused, res, err := d.ImageDestination.TryReusingBlob(writeCtx, info, cache, canSubstitute)
+	return reused, res, d.pushError(ctx, writeCtx, err)
+}
+
+// PutManifest writes manifest to the destination.
+func (d *pushTimeoutDestination) PutManifest(ctx context.Context, manifest []byte, instanceDigest *digest.Digest) error {
+	writeCtx, cancel := d.writeContext(ctx)
+	defer cancel()
+	return d.pushError(ctx, writeCtx, d.ImageDestination.PutManifest(writeCtx, manifest, instanceDigest))
+}
+
+// PutSignatures writes a set of signatures to the destination.
+func (d *pushTimeoutDestination) PutSignatures(ctx context.Context, signatures [][]byte, instanceDigest *digest.Digest) error {
+	writeCtx, cancel := d.writeContext(ctx)
+	defer cancel()
+	return d.pushError(ctx, writeCtx, d.ImageDestination.PutSignatures(writeCtx, signatures, instanceDigest))
+}
+
+// Commit marks the process of storing the image as successful and asks for the image to be persisted.
+func (d *pushTimeoutDestination) Commit(ctx context.Context, unparsedToplevel types.UnparsedImage) error {
+	writeCtx, cancel := d.writeContext(ctx)
+	defer cancel()
+	return d.pushError(ctx, writeCtx, d.ImageDestination.Commit(writeCtx, unparsedToplevel))
+}
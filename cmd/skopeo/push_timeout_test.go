@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
+	"github.com/containers/image/v5/transports/alltransports"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// hangingDestination is a types.ImageDestination which never finishes a PutBlob until its context is done.
+type hangingDestination struct {
+	types.ImageDestination
+}
+
+func (d *hangingDestination) PutBlob(ctx context.Context, stream io.Reader, inputInfo types.BlobInfo, cache types.BlobInfoCache, isConfig bool) (types.BlobInfo, error) {
+	<-ctx.Done()
+	return types.BlobInfo{}, ctx.Err()
+}
+
+func (d *hangingDestination) PutManifest(ctx context.Context, manifest []byte, instanceDigest *digest.Digest) error {
+	return ctx.Err()
+}
+
+func TestPushTimeoutDestination(t *testing.T) {
+	ref, err := alltransports.ParseImageName("dir:" + t.TempDir())
+	require.NoError(t, err)
+	dest := &pushTimeoutDestination{
+		ImageDestination: &hangingDestination{},
+		ref:              pushTimeoutReference{ImageReference: ref, timeout: 10 * time.Millisecond},
+	}
+
+	blob := []byte("blob")
+	_, err = dest.PutBlob(context.Background(), bytes.NewReader(blob), types.BlobInfo{Digest: digest.FromBytes(blob), Size: int64(len(blob))}, none.NoCache, false)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Contains(t, err.Error(), "did not finish within --dest-push-timeout 10ms")
+
+	// The deadline is shared by all writes.
+	err = dest.PutManifest(context.Background(), []byte("{}"), nil)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// Cancellation by the caller is reported unchanged.
+	dest = &pushTimeoutDestination{
+		ImageDestination: &hangingDestination{},
+		ref:              pushTimeoutReference{ImageReference: ref, timeout: time.Hour},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = dest.PutBlob(ctx, bytes.NewReader(blob), types.BlobInfo{Digest: digest.FromBytes(blob), Size: int64(len(blob))}, none.NoCache, false)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.NotContains(t, err.Error(), "--dest-push-timeout")
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+)
+
+// requestRateLimiter spaces out requests so that at most a fixed number of them start per second.
+type requestRateLimiter struct {
+	interval time.Duration
+
+	mutex sync.Mutex
+	next  time.Time // The earliest time the next request may start
+}
+
+// newRequestRateLimiter returns a requestRateLimiter allowing requestsPerSecond, which must be positive.
+func newRequestRateLimiter(requestsPerSecond float64) *requestRateLimiter {
+	return &requestRateLimiter{interval: time.Duration(float64(time.Second) / requestsPerSecond)}
+}
+
+// wait blocks until a request may start, or until ctx is done.
+func (l *requestRateLimiter) wait(ctx context.Context) error {
+	l.mutex.Lock()
+	now := time.Now()
+	start := l.next
+	if start.Before(now) {
+		start = now
+	}
+	l.next = start.Add(l.interval)
+	l.mutex.Unlock()
+
+	delay := time.Until(start)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// rateLimitedReference is a types.ImageReference wrapper; image sources and destinations created from it
+// wait for limiter before every manifest, blob and signature request.
+type rateLimitedReference struct {
+	types.ImageReference
+	limiter *requestRateLimiter
+}
+
+// NewImageSource returns a types.ImageSource for this reference.
+// The caller must call .Close() on the returned ImageSource.
+func (ref rateLimitedReference) NewImageSource(ctx context.Context, sys *types.SystemContext) (types.ImageSource, error) {
+	src, err := ref.ImageReference.NewImageSource(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	return &rateLimitedSource{ImageSource: src, ref: ref}, nil
+}
+
+// NewImageDestination returns a types.ImageDestination for this reference.
+// The caller must call .Close() on the returned ImageDestination.
+func (ref rateLimitedReference) NewImageDestination(ctx context.Context, sys *types.SystemContext) (types.ImageDestination, error) {
+	dest, err := ref.ImageReference.NewImageDestination(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	return &rateLimitedDestination{ImageDestination: dest, ref: ref}, nil
+}
+
+// rateLimitedSource is a types.ImageSource wrapper which waits for ref.limiter before every request.
+type rateLimitedSource struct {
+	types.ImageSource
+	ref rateLimitedReference
+}
+
+// Reference returns the reference used to set up this source.
+func (s *rateLimitedSource) Reference() types.ImageReference {
+	return s.ref
+}
+
+// GetManifest returns the image's manifest along with its MIME type.
+func (s *rateLimitedSource) GetManifest(ctx context.Context, instanceDigest *digest.Digest) ([]byte, string, error) {
+	if err := s.ref.limiter.wait(ctx); err != nil {
+		return nil, "", err
+	}
+	return s.ImageSource.GetManifest(ctx, instanceDigest)
+}
+
+// GetBlob returns a stream for the specified blob, and the blob’s size (or -1 if unknown).
+func (s *rateLimitedSource) GetBlob(ctx context.Context, info types.BlobInfo, cache types.BlobInfoCache) (io.ReadCloser, int64, error) {
+	if err := s.ref.limiter.wait(ctx); err != nil {
+		return nil, 0, err
+	}
+	return s.ImageSource.GetBlob(ctx, info, cache)
+}
+
+// GetSignatures returns the image's signatures.
+func (s *rateLimitedSource) GetSignatures(ctx context.Context, instanceDigest *digest.Digest) ([][]byte, error) {
+	if err := s.ref.limiter.wait(ctx); err != nil {
+		return nil, err
+	}
+	return s.ImageSource.GetSignatures(ctx, instanceDigest)
+}
+
+// rateLimitedDestination is a types.ImageDestination wrapper which waits for ref.limiter before every request.
+type rateLimitedDestination struct {
+	types.ImageDestination
+	ref rateLimitedReference
+}
+
+// Reference returns the reference used to set up this destination.
+func (d *rateLimitedDestination) Reference() types.ImageReference {
+	return d.ref
+}
+
+// PutBlob writes contents of stream and returns data representing the result.
+func (d *rateLimitedDestination) PutBlob(ctx context.Context, stream io.Reader, inputInfo types.BlobInfo, cache types.BlobInfoCache, isConfig bool) (types.BlobInfo, error) {
+	if err := d.ref.limiter.wait(ctx); err != nil {
+		return types.BlobInfo{}, err
+	}
+	return d.ImageDestination.PutBlob(ctx, stream, inputInfo, cache, isConfig)
+}
+
+// TryReusingBlob checks whether the transport already contains, or can efficiently reuse, a blob, and if so, applies it to the current destination.
+func (d *rateLimitedDestination) TryReusingBlob(ctx context.Context, info types.BlobInfo, cache types.BlobInfoCache, canSubstitute bool) (bool, types.BlobInfo, error) {
+	if err := d.ref.limiter.wait(ctx); err != nil {
+		return false, types.BlobInfo{}, err
+	}
+	return d.ImageDestination.TryReusingBlob(ctx, info, cache, canSubstitute)
+}
+
+// PutManifest writes manifest to the destination.
+func (d *rateLimitedDestination) PutManifest(ctx context.Context, manifest []byte, instanceDigest *digest.Digest) error {
+	if err := d.ref.limiter.wait(ctx); err != nil {
+		return err
+	}
+	return d.ImageDestination.PutManifest(ctx, manifest, instanceDigest)
+}
+
+// PutSignatures writes a set of signatures to the destination.
+func (d *rateLimitedDestination) PutSignatures(ctx context.Context, signatures [][]byte, instanceDigest *digest.Digest) error {
+	if err := d.ref.limiter.wait(ctx); err != nil {
+		return err
+	}
+	return d.ImageDestination.PutSignatures(ctx, signatures, instanceDigest)
+}
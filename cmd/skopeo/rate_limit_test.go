@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestRateLimiter(t *testing.T) {
+	ctx := context.Background()
+	limiter := newRequestRateLimiter(100)
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		err := limiter.wait(ctx)
+		require.NoError(t, err)
+	}
+	// The first request starts immediately, the others 10 ms apart.
+	assert.GreaterOrEqual(t, time.Since(start), 40*time.Millisecond)
+
+	limiter = newRequestRateLimiter(0.001)
+	err := limiter.wait(ctx)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	err = limiter.wait(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestSyncRequestsPerSecond(t *testing.T) {
+	out, err := runSkopeo("--insecure-policy", "sync", "--src", "dir", "--dest", "docker", "--requests-per-second", "-1", "/dev/null", "example.com/repo")
+	assertTestFailed(t, out, err, "Invalid --requests-per-second")
+	out, err = runSkopeo("--insecure-policy", "sync", "--src", "dir", "--dest", "docker", "--requests-per-second", "1", "--sign-by-sigstore", "/dev/null",
+		"/dev/null", "example.com/repo")
+	assertTestFailed(t, out, err, "--requests-per-second cannot be used together with --sign-by-sigstore")
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/containers/common/pkg/retry"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/exp/slices"
+)
+
+// defaultSelectPreferences are the --select-prefer rules used by default.
+var defaultSelectPreferences = []string{"host", "variant", "size"}
+
+// validateSelectPreferences checks that preferences only contains known --select-prefer rules, each at most once.
+func validateSelectPreferences(preferences []string) error {
+	for i, p := range preferences {
+		if !slices.Contains(defaultSelectPreferences, p) {
+			return fmt.Errorf("Invalid --select-prefer value %q, expected host, variant or size", p)
+		}
+		if slices.Contains(preferences[:i], p) {
+			return fmt.Errorf("--select-prefer value %q specified more than once", p)
+		}
+	}
+	return nil
+}
+
+// selectCandidate is an image of a manifest list considered by selectBestInstance.
+type selectCandidate struct {
+	digest   digest.Digest
+	platform v1.Platform // Normalized
+	size     int64       // Total size of the config and layers, or -1 if unknown or not needed
+	newer    int         // The number of newer variants of the same architecture among the candidates
+}
+
+// variantRank returns a number ordering variants of the same architecture, higher for newer ones, e.g. 8 for "v8".
+func variantRank(variant string) float64 {
+	rank, err := strconv.ParseFloat(strings.TrimPrefix(variant, "v"), 64)
+	if err != nil {
+		return 0
+	}
+	return rank
+}
+
+// selectBestInstance returns the digest and platform of the image in the manifest list rawManifest (with mimeType) read from src
+// which is best according to preferences, considering all images for the OS chosen by sys
+// (and for the architecture and variant, if sys chooses them); ties are resolved by the order in the list.
+// The preferences are applied in order:
+//   - "host": prefer the architecture chosen by sys, or the architecture skopeo is running on;
+//   - "variant": prefer the newest (highest) variant available for the architecture of the image;
+//   - "size": prefer the image with the smallest total size of its config and layers.
+//
+// It returns an empty digest if rawManifest is not a list.
+func selectBestInstance(ctx context.Context, sys *types.SystemContext, src types.ImageSource, rawManifest []byte, mimeType string,
+	preferences []string, retryOpts *retry.Options) (digest.Digest, string, error) {
+	if !manifest.MIMETypeIsMultiImage(manifest.NormalizedMIMEType(mimeType)) {
+		return "", "", nil
+	}
+	list, err := manifest.ListFromBlob(rawManifest, mimeType)
+	if err != nil {
+		return "", "", fmt.Errorf("Error parsing manifest list: %w", err)
+	}
+	wanted := v1.Platform{OS: runtime.GOOS, Architecture: runtime.GOARCH}
+	restrictArch, restrictVariant := false, false
+	if sys != nil {
+		if sys.OSChoice != "" {
+			wanted.OS = sys.OSChoice
+		}
+		if sys.ArchitectureChoice != "" {
+			wanted.Architecture = sys.ArchitectureChoice
+			wanted.Variant = sys.VariantChoice
+			restrictArch, restrictVariant = true, sys.VariantChoice != ""
+		}
+	}
+	wanted = normalizePlatform(wanted)
+
+	candidates := []selectCandidate{}
+	for _, instanceDigest := range list.Instances() {
+		instance, err := list.Instance(instanceDigest)
+		if err != nil {
+			return "", "", err
+		}
+		if instance.ReadOnly.Platform == nil {
+			continue
+		}
+		platform := normalizePlatform(*instance.ReadOnly.Platform)
+		if platform.OS != wanted.OS || (restrictArch && platform.Architecture != wanted.Architecture) ||
+			(restrictVariant && platform.Variant != wanted.Variant) {
+			continue
+		}
+		candidates = append(candidates, selectCandidate{digest: instanceDigest, platform: platform, size: -1})
+	}
+	if len(candidates) == 0 {
+		return "", "", fmt.Errorf("no image found in manifest list for OS %s", wanted.OS)
+	}
+
+	for i := range candidates {
+		newerVariants := map[string]struct{}{}
+		for _, other := range candidates {
+			if other.platform.Architecture == candidates[i].platform.Architecture &&
+				variantRank(other.platform.Variant) > variantRank(candidates[i].platform.Variant) {
+				newerVariants[other.platform.Variant] = struct{}{}
+			}
+		}
+		candidates[i].newer = len(newerVariants)
+	}
+	if slices.Contains(preferences, "size") {
+		for i := range candidates {
+			var instanceManifest []byte
+			var instanceMIMEType string
+			if err := retry.IfNecessary(ctx, func() error {
+				instanceManifest, instanceMIMEType, err = src.GetManifest(ctx, &candidates[i].digest)
+				return err
+			}, retryOpts); err != nil {
+				return "", "", fmt.Errorf("Error retrieving manifest for image %s: %w", candidates[i].digest, err)
+			}
+			candidates[i].size, err = manifestBlobsSize(instanceManifest, instanceMIMEType)
+			if err != nil {
+				return "", "", fmt.Errorf("Error parsing manifest for image %s: %w", candidates[i].digest, err)
+			}
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		for _, preference := range preferences {
+			switch preference {
+			case "host":
+				if aHost, bHost := a.platform.Architecture == wanted.Architecture, b.platform.Architecture == wanted.Architecture; aHost != bHost {
+					return aHost
+				}
+			case "variant":
+				// Comparing the variants of different architectures directly is meaningless, so compare how close
+				// each is to the newest variant of its architecture.
+				if a.newer != b.newer {
+					return a.newer < b.newer
+				}
+			case "size":
+				if a.size != b.size {
+					// Unknown sizes are ordered last.
+					return b.size == -1 || (a.size != -1 && a.size < b.size)
+				}
+			}
+		}
+		return false
+	})
+	best := candidates[0]
+	platform := platformString(&best.platform)
+	logrus.Debugf("Selected %s image %s out of %d candidates", platform, best.digest, len(candidates))
+	return best.digest, platform, nil
+}
+
+// selectBestInstanceForReference is selectBestInstance for the top-level manifest of ref.
+func selectBestInstanceForReference(ctx context.Context, sys *types.SystemContext, ref types.ImageReference, preferences []string,
+	retryOpts *retry.Options) (_ digest.Digest, _ string, retErr error) {
+	var src types.ImageSource
+	if err := retry.IfNecessary(ctx, func() error {
+		var err error
+		src, err = ref.NewImageSource(ctx, sys)
+		return err
+	}, retryOpts); err != nil {
+		return "", "", err
+	}
+	defer func() {
+		if err := src.Close(); err != nil {
+			retErr = noteCloseFailure(retErr, "closing image", err)
+		}
+	}()
+	var rawManifest []byte
+	var mimeType string
+	if err := retry.IfNecessary(ctx, func() error {
+		var err error
+		rawManifest, mimeType, err = src.GetManifest(ctx, nil)
+		return err
+	}, retryOpts); err != nil {
+		return "", "", fmt.Errorf("Error retrieving manifest for image: %w", err)
+	}
+	return selectBestInstance(ctx, sys, src, rawManifest, mimeType, preferences, retryOpts)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/containers/common/pkg/retry"
+	"github.com/containers/image/v5/transports/alltransports"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecspecs "github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateSelectPreferences(t *testing.T) {
+	for _, c := range [][]string{{}, defaultSelectPreferences, {"size"}, {"size", "host"}} {
+		assert.NoError(t, validateSelectPreferences(c), c)
+	}
+	for _, c := range [][]string{{"fastest"}, {"size", "size"}} {
+		assert.Error(t, validateSelectPreferences(c), c)
+	}
+}
+
+func TestSelectBestInstance(t *testing.T) {
+	otherArch := "s390x"
+	if runtime.GOARCH == otherArch {
+		otherArch = "ppc64le"
+	}
+	// Instances in list order; the layer size makes the manifests, and their total blob sizes, differ.
+	instances := []struct {
+		platform  imgspecv1.Platform
+		layerSize int64
+	}{
+		{imgspecv1.Platform{OS: "linux", Architecture: otherArch}, 1},
+		{imgspecv1.Platform{OS: "linux", Architecture: runtime.GOARCH, Variant: "v2"}, 300},
+		{imgspecv1.Platform{OS: "linux", Architecture: runtime.GOARCH, Variant: "v3"}, 200},
+		{imgspecv1.Platform{OS: "linux", Architecture: runtime.GOARCH, Variant: "v3"}, 100},
+		{imgspecv1.Platform{OS: "windows", Architecture: runtime.GOARCH, Variant: "v4"}, 1},
+	}
+	dir := t.TempDir()
+	index := imgspecv1.Index{Versioned: imgspecspecs.Versioned{SchemaVersion: 2}, MediaType: imgspecv1.MediaTypeImageIndex}
+	digests := []digest.Digest{}
+	for i := range instances {
+		m := fmt.Sprintf(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json",`+
+			`"config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"sha256:%064d","size":2},`+
+			`"layers":[{"mediaType":"application/vnd.oci.image.layer.v1.tar","digest":"sha256:%064d","size":%d}]}`, i, i, instances[i].layerSize)
+		d := digest.FromString(m)
+		err := os.WriteFile(filepath.Join(dir, d.Encoded()+".manifest.json"), []byte(m), 0o644)
+		require.NoError(t, err)
+		index.Manifests = append(index.Manifests, imgspecv1.Descriptor{
+			MediaType: imgspecv1.MediaTypeImageManifest,
+			Digest:    d,
+			Size:      int64(len(m)),
+			Platform:  &instances[i].platform,
+		})
+		digests = append(digests, d)
+	}
+	rawIndex, err := json.Marshal(index)
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(dir, "manifest.json"), rawIndex, 0o644)
+	require.NoError(t, err)
+	ref, err := alltransports.ParseImageName("dir:" + dir)
+	require.NoError(t, err)
+	src, err := ref.NewImageSource(context.Background(), nil)
+	require.NoError(t, err)
+	defer src.Close()
+
+	sys := &types.SystemContext{OSChoice: "linux"}
+	for _, c := range []struct {
+		sys         *types.SystemContext
+		preferences []string
+		expected    int
+	}{
+		{sys, defaultSelectPreferences, 3},
+		{sys, []string{"host", "variant"}, 2},
+		{sys, []string{"variant", "host"}, 2},
+		{sys, []string{"size"}, 0},
+		{sys, []string{"host", "size"}, 3},
+		{sys, []string{}, 0},
+		{&types.SystemContext{OSChoice: "linux", ArchitectureChoice: otherArch}, defaultSelectPreferences, 0},
+		{&types.SystemContext{OSChoice: "linux", ArchitectureChoice: runtime.GOARCH, VariantChoice: "v2"}, defaultSelectPreferences, 1},
+		{&types.SystemContext{OSChoice: "windows"}, defaultSelectPreferences, 4},
+	} {
+		d, _, err := selectBestInstance(context.Background(), c.sys, src, rawIndex, imgspecv1.MediaTypeImageIndex, c.preferences, &retry.Options{})
+		require.NoError(t, err)
+		assert.Equal(t, digests[c.expected], d, "%#v %v", c.sys, c.preferences)
+	}
+
+	_, _, err = selectBestInstance(context.Background(), &types.SystemContext{OSChoice: "freebsd"}, src, rawIndex, imgspecv1.MediaTypeImageIndex,
+		defaultSelectPreferences, &retry.Options{})
+	assert.ErrorContains(t, err, "no image found in manifest list for OS freebsd")
+
+	// Single images are not affected.
+	d, _, err := selectBestInstance(context.Background(), sys, src, []byte(`{"schemaVersion":2}`), imgspecv1.MediaTypeImageManifest, defaultSelectPreferences, &retry.Options{})
+	require.NoError(t, err)
+	assert.Equal(t, digest.Digest(""), d)
+}
+
+func TestSelectBestFlags(t *testing.T) {
+	src := testDirImageWithBlobs(t)
+	out, err := runSkopeo("--insecure-policy", "copy", "--select-best", "--all", "dir:"+src, "dir:"+t.TempDir())
+	assertTestFailed(t, out, err, "--select-best can only be used when copying a single image from a list")
+	out, err = runSkopeo("--insecure-policy", "copy", "--select-best", "--select-prefer", "fastest", "dir:"+src, "dir:"+t.TempDir())
+	assertTestFailed(t, out, err, "Invalid --select-prefer value")
+	out, err = runSkopeo("inspect", "--select-best", "--raw", "dir:"+src)
+	assertTestFailed(t, out, err, "--select-best can not be used together with")
+
+	// A single image is copied and inspected as usual.
+	_, err = runSkopeo("--insecure-policy", "copy", "--select-best", "--select-prefer", "size", "dir:"+src, "dir:"+t.TempDir())
+	require.NoError(t, err)
+	out, err = runSkopeo("inspect", "--select-best", "--format", "{{.Architecture}}", "dir:"+src)
+	require.NoError(t, err)
+	assert.Equal(t, "amd64\n", out)
+}
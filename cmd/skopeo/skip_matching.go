@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+
+	"github.com/containers/common/pkg/retry"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/types"
+	"github.com/sirupsen/logrus"
+)
+
+// matchingDestinationManifest returns the top-level manifest of srcRef if destRef already contains a manifest with the same digest,
+// or nil if the destination does not match, or can't be read.
+func matchingDestinationManifest(ctx context.Context, sourceCtx, destinationCtx *types.SystemContext, srcRef, destRef types.ImageReference,
+	retryOpts *retry.Options) ([]byte, error) {
+	srcManifest, err := topLevelManifest(ctx, sourceCtx, srcRef, retryOpts)
+	if err != nil {
+		return nil, err
+	}
+	srcDigest, err := manifest.Digest(srcManifest)
+	if err != nil {
+		return nil, err
+	}
+	destManifest, err := topLevelManifest(ctx, destinationCtx, destRef, retryOpts)
+	if err != nil {
+		// Most likely, the destination does not exist yet.
+		logrus.Debugf("Not skipping the copy, error reading the destination manifest: %v", err)
+		return nil, nil
+	}
+	matches, err := manifest.MatchesDigest(destManifest, srcDigest)
+	if err != nil {
+		return nil, err
+	}
+	if !matches {
+		return nil, nil
+	}
+	return srcManifest, nil
+}
+
+// topLevelManifest returns the top-level manifest of ref.
+func topLevelManifest(ctx context.Context, sys *types.SystemContext, ref types.ImageReference, retryOpts *retry.Options) (res []byte, retErr error) {
+	var src types.ImageSource
+	if err := retry.IfNecessary(ctx, func() error {
+		var err error
+		src, err = ref.NewImageSource(ctx, sys)
+		return err
+	}, retryOpts); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := src.Close(); err != nil {
+			retErr = noteCloseFailure(retErr, "closing image", err)
+		}
+	}()
+	if err := retry.IfNecessary(ctx, func() error {
+		var err error
+		res, _, err = src.GetManifest(ctx, nil)
+		return err
+	}, retryOpts); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
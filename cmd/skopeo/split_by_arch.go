@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/containers/common/pkg/retry"
+	"github.com/containers/image/v5/copy"
+	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/signature"
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+)
+
+// listInstanceReference is a types.ImageReference wrapper; image sources created from it
+// present a single instance of the top-level manifest list as the top-level image.
+type listInstanceReference struct {
+	types.ImageReference
+	instance digest.Digest
+}
+
+// DockerReference returns a Docker reference associated with this reference.
+// A digest of the list is replaced by the digest of the instance, which is presented as the top-level manifest.
+func (ref listInstanceReference) DockerReference() reference.Named {
+	res := ref.ImageReference.DockerReference()
+	if _, ok := res.(reference.Digested); ok {
+		if withDigest, err := reference.WithDigest(reference.TrimNamed(res), ref.instance); err == nil {
+			return withDigest
+		}
+	}
+	return res
+}
+
+// NewImageSource returns a types.ImageSource for this reference.
+// The caller must call .Close() on the returned ImageSource.
+func (ref listInstanceReference) NewImageSource(ctx context.Context, sys *types.SystemContext) (types.ImageSource, error) {
+	src, err := ref.ImageReference.NewImageSource(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	return &listInstanceSource{ImageSource: src, ref: ref}, nil
+}
+
+// listInstanceSource is a types.ImageSource wrapper which presents ref.instance as the top-level image.
+type listInstanceSource struct {
+	types.ImageSource
+	ref listInstanceReference
+}
+
+// Reference returns the reference used to set up this source.
+func (s *listInstanceSource) Reference() types.ImageReference {
+	return s.ref
+}
+
+// GetManifest returns the image's manifest along with its MIME type, returning the instance manifest for the top-level manifest.
+func (s *listInstanceSource) GetManifest(ctx context.Context, instanceDigest *digest.Digest) ([]byte, string, error) {
+	if instanceDigest == nil {
+		instanceDigest = &s.ref.instance
+	}
+	return s.ImageSource.GetManifest(ctx, instanceDigest)
+}
+
+// GetSignatures returns the image's signatures, returning the signatures of the instance for the top-level manifest.
+func (s *listInstanceSource) GetSignatures(ctx context.Context, instanceDigest *digest.Digest) ([][]byte, error) {
+	if instanceDigest == nil {
+		instanceDigest = &s.ref.instance
+	}
+	return s.ImageSource.GetSignatures(ctx, instanceDigest)
+}
+
+// listInstanceImageReference returns a reference to the instance of the top-level manifest list of ref.
+// For registries, this is a reference by digest, so that the image is copied with all of its signatures;
+// other transports use a listInstanceReference, which only copies simple signing signatures.
+func listInstanceImageReference(ref types.ImageReference, instance digest.Digest) (types.ImageReference, error) {
+	if ref.Transport().Name() != docker.Transport.Name() {
+		return listInstanceReference{ImageReference: ref, instance: instance}, nil
+	}
+	named := ref.DockerReference()
+	if named == nil {
+		return nil, fmt.Errorf("internal error: %s reference without a Docker reference", docker.Transport.Name())
+	}
+	// The docker transport does not support references with both a tag and a digest.
+	withDigest, err := reference.WithDigest(reference.TrimNamed(named), instance)
+	if err != nil {
+		return nil, err
+	}
+	return docker.NewReference(withDigest)
+}
+
+// splitByArchImage is a single image of a manifest list, and its destination with --split-by-arch.
+type splitByArchImage struct {
+	instance digest.Digest
+	platform string
+	dest     types.ImageReference
+}
+
+// splitByArchImages returns, for each image in the manifest list rawManifest (of type mimeType) with a known platform,
+// the destination obtained by adding a suffix, expanded from suffixPattern, to the repository name of destRef.
+func splitByArchImages(rawManifest []byte, mimeType string, destRef types.ImageReference, suffixPattern string) ([]splitByArchImage, error) {
+	if destRef.Transport().Name() != docker.Transport.Name() {
+		return nil, fmt.Errorf("--split-by-arch requires a %s: destination, not %s:", docker.Transport.Name(), destRef.Transport().Name())
+	}
+	named := destRef.DockerReference()
+	tagged, ok := named.(reference.NamedTagged)
+	if !ok {
+		return nil, fmt.Errorf("--split-by-arch requires a destination with a tag, not %s", reference.FamiliarString(named))
+	}
+	if !manifest.MIMETypeIsMultiImage(manifest.NormalizedMIMEType(mimeType)) {
+		return nil, fmt.Errorf("--split-by-arch requires the source to be a manifest list")
+	}
+	list, err := manifest.ListFromBlob(rawManifest, mimeType)
+	if err != nil {
+		return nil, fmt.Errorf("parsing manifest list: %w", err)
+	}
+
+	res := []splitByArchImage{}
+	destinations := map[string]string{} // Destination name -> platform
+	for _, d := range list.Instances() {
+		instance, err := list.Instance(d)
+		if err != nil {
+			return nil, err
+		}
+		p := instance.ReadOnly.Platform
+		// Non-image instances, like attestation manifests, use an "unknown" platform.
+		if p == nil || p.OS == "" || p.OS == "unknown" || p.Architecture == "" || p.Architecture == "unknown" {
+			continue
+		}
+		platform := p.OS + "/" + p.Architecture
+		if p.Variant != "" {
+			platform += "/" + p.Variant
+		}
+		suffix := strings.NewReplacer("{os}", p.OS, "{arch}", p.Architecture, "{variant}", p.Variant).Replace(suffixPattern)
+		name, err := reference.WithName(tagged.Name() + suffix)
+		if err != nil {
+			return nil, fmt.Errorf("invalid destination repository for %s: %w", platform, err)
+		}
+		if other, ok := destinations[name.Name()]; ok {
+			return nil, fmt.Errorf("images for %s and %s would both be copied to %s, use a different --split-by-arch-suffix", other, platform, name.Name())
+		}
+		destinations[name.Name()] = platform
+		nameTagged, err := reference.WithTag(name, tagged.Tag())
+		if err != nil {
+			return nil, err
+		}
+		dest, err := docker.NewReference(nameTagged)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, splitByArchImage{instance: d, platform: platform, dest: dest})
+	}
+	if len(res) == 0 {
+		return nil, fmt.Errorf("the source manifest list contains no images with a known platform")
+	}
+	return res, nil
+}
+
+// copySplitByArch copies each image of the manifest list srcRef to a separate repository derived from destRef and suffixPattern,
+// without copying the list itself.
+// Each image is read through the reference returned by wrapSource.
+func copySplitByArch(ctx context.Context, policyContext *signature.PolicyContext, srcRef, destRef types.ImageReference, suffixPattern string,
+	wrapSource func(types.ImageReference) types.ImageReference, options *copy.Options, retryOpts *retry.Options, stdout io.Writer) error {
+	rawManifest, err := topLevelManifest(ctx, options.SourceCtx, srcRef, retryOpts)
+	if err != nil {
+		return err
+	}
+	images, err := splitByArchImages(rawManifest, manifest.GuessMIMEType(rawManifest), destRef, suffixPattern)
+	if err != nil {
+		return err
+	}
+	for _, image := range images {
+		if stdout != nil {
+			fmt.Fprintf(stdout, "Copying %s image %s to %s\n", image.platform, image.instance, transports.ImageName(image.dest))
+		}
+		instanceOptions := *options
+		instanceOptions.ImageListSelection = copy.CopySystemImage
+		instanceRef, err := listInstanceImageReference(srcRef, image.instance)
+		if err != nil {
+			return err
+		}
+		instanceRef = wrapSource(instanceRef)
+		if err := retry.IfNecessary(ctx, func() error {
+			_, err := copy.Image(ctx, policyContext, image.dest, instanceRef, &instanceOptions)
+			return err
+		}, retryOpts); err != nil {
+			return fmt.Errorf("copying %s image %s: %w", image.platform, image.instance, err)
+		}
+	}
+	return nil
+}
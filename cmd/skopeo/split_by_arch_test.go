@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/transports/alltransports"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// instanceRecordingSource is a types.ImageSource which records the instance digests it is asked for.
+type instanceRecordingSource struct {
+	types.ImageSource
+	requested []*digest.Digest
+}
+
+func (s *instanceRecordingSource) GetManifest(ctx context.Context, instanceDigest *digest.Digest) ([]byte, string, error) {
+	s.requested = append(s.requested, instanceDigest)
+	return []byte("{}"), imgspecv1.MediaTypeImageManifest, nil
+}
+
+func (s *instanceRecordingSource) GetSignatures(ctx context.Context, instanceDigest *digest.Digest) ([][]byte, error) {
+	s.requested = append(s.requested, instanceDigest)
+	return nil, nil
+}
+
+func TestListInstanceSource(t *testing.T) {
+	ctx := context.Background()
+	instance := digest.FromString("instance")
+	other := digest.FromString("other")
+	inner := &instanceRecordingSource{}
+	src := &listInstanceSource{ImageSource: inner, ref: listInstanceReference{instance: instance}}
+
+	_, _, err := src.GetManifest(ctx, nil)
+	require.NoError(t, err)
+	_, err = src.GetSignatures(ctx, nil)
+	require.NoError(t, err)
+	_, _, err = src.GetManifest(ctx, &other)
+	require.NoError(t, err)
+	assert.Equal(t, []*digest.Digest{&instance, &instance, &other}, inner.requested)
+}
+
+func TestListInstanceImageReference(t *testing.T) {
+	instance := digest.FromString("instance")
+
+	for _, name := range []string{
+		"docker://registry.example.com/ns/repo:v1",
+		"docker://registry.example.com/ns/repo@" + digest.FromString("list").String(),
+	} {
+		ref, err := alltransports.ParseImageName(name)
+		require.NoError(t, err)
+		res, err := listInstanceImageReference(ref, instance)
+		require.NoError(t, err, name)
+		assert.Equal(t, "docker://registry.example.com/ns/repo@"+instance.String(), transports.ImageName(res), name)
+		_, isWrapper := res.(listInstanceReference)
+		assert.False(t, isWrapper, name)
+	}
+
+	ref, err := alltransports.ParseImageName("oci:/tmp/layout:v1")
+	require.NoError(t, err)
+	res, err := listInstanceImageReference(ref, instance)
+	require.NoError(t, err)
+	assert.Equal(t, listInstanceReference{ImageReference: ref, instance: instance}, res)
+}
+
+func TestSplitByArchImages(t *testing.T) {
+	amd64 := imgspecv1.Platform{OS: "linux", Architecture: "amd64"}
+	arm64 := imgspecv1.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}
+	armV7 := imgspecv1.Platform{OS: "linux", Architecture: "arm", Variant: "v7"}
+	armV6 := imgspecv1.Platform{OS: "linux", Architecture: "arm", Variant: "v6"}
+	attestation := imgspecv1.Platform{OS: "unknown", Architecture: "unknown"}
+	index := testIndex(t, amd64, arm64, armV7, attestation)
+	destRef, err := alltransports.ParseImageName("docker://registry.example.com/ns/repo:v1")
+	require.NoError(t, err)
+
+	images, err := splitByArchImages(index, imgspecv1.MediaTypeImageIndex, destRef, "-{arch}")
+	require.NoError(t, err)
+	res := map[string]string{}
+	for _, image := range images {
+		res[image.platform] = transports.ImageName(image.dest)
+	}
+	assert.Equal(t, map[string]string{
+		"linux/amd64":    "docker://registry.example.com/ns/repo-amd64:v1",
+		"linux/arm64/v8": "docker://registry.example.com/ns/repo-arm64:v1",
+		"linux/arm/v7":   "docker://registry.example.com/ns/repo-arm:v1",
+	}, res)
+	assert.Equal(t, digest.FromString("amd64"), images[0].instance)
+
+	images, err = splitByArchImages(index, imgspecv1.MediaTypeImageIndex, destRef, "_{os}_{arch}{variant}")
+	require.NoError(t, err)
+	assert.Equal(t, "docker://registry.example.com/ns/repo_linux_armv7:v1", transports.ImageName(images[2].dest))
+
+	// Two images using the same destination
+	_, err = splitByArchImages(testIndex(t, armV6, armV7), imgspecv1.MediaTypeImageIndex, destRef, "-{arch}")
+	assert.ErrorContains(t, err, "would both be copied to registry.example.com/ns/repo-arm")
+	// Invalid repository names
+	_, err = splitByArchImages(index, imgspecv1.MediaTypeImageIndex, destRef, "-{arch}:x")
+	assert.Error(t, err)
+	// No images
+	_, err = splitByArchImages(testIndex(t, attestation), imgspecv1.MediaTypeImageIndex, destRef, "-{arch}")
+	assert.Error(t, err)
+	// Not a list
+	_, err = splitByArchImages([]byte(`{}`), imgspecv1.MediaTypeImageManifest, destRef, "-{arch}")
+	assert.Error(t, err)
+	// Unsupported destinations
+	for _, dest := range []string{"dir:/dest", "docker://registry.example.com/ns/repo@sha256:0000000000000000000000000000000000000000000000000000000000000000"} {
+		ref, err := alltransports.ParseImageName(dest)
+		require.NoError(t, err, dest)
+		_, err = splitByArchImages(index, imgspecv1.MediaTypeImageIndex, ref, "-{arch}")
+		assert.Error(t, err, dest)
+	}
+}
+
+func TestCopySplitByArchOptions(t *testing.T) {
+	out, err := runSkopeo("--insecure-policy", "copy", "--split-by-arch", "--digestfile", "/dev/null",
+		"dir:"+t.TempDir(), "docker://registry.example.com/ns/repo:v1")
+	assertTestFailed(t, out, err, "--split-by-arch cannot be used together with --digestfile")
+}
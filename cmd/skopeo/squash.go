@@ -0,0 +1,331 @@
+package main
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/containers/common/pkg/retry"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/signature"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sirupsen/logrus"
+)
+
+// squashEntryPosition identifies an entry of one of the layers being squashed.
+type squashEntryPosition struct {
+	layer int // Index of the layer, from the bottom
+	entry int // Index of the entry within the layer tar
+}
+
+// pathIsHidden returns true if name, a path relative to the root directory, is removed by deleted or hidden by opaque,
+// as collected by squashVisibleEntries.
+func pathIsHidden(name string, deleted, opaque map[string]bool) bool {
+	if deleted[name] {
+		return true
+	}
+	for p := path.Dir(name); p != "." && p != "/" && p != ""; p = path.Dir(p) {
+		if deleted[p] || opaque[p] {
+			return true
+		}
+	}
+	return opaque["."] // An opaque whiteout at the root directory
+}
+
+// squashVisibleEntries reads the uncompressed layer tar files at layerPaths, bottom layer first, and returns
+// the positions of the entries which are visible after applying all layers in order.
+// Whiteout entries are never visible; they only hide entries of lower layers.
+func squashVisibleEntries(layerPaths []string) (map[squashEntryPosition]bool, error) {
+	winners := map[string]squashEntryPosition{}
+	deleted := map[string]bool{} // Paths, and their descendants, removed by higher layers
+	opaque := map[string]bool{}  // Directories whose descendants in lower layers are hidden by higher layers
+	for i := len(layerPaths) - 1; i >= 0; i-- {
+		// Whiteouts, and entries replacing directories, only affect lower layers.
+		layerDeleted, layerOpaque := map[string]bool{}, map[string]bool{}
+		err := forEachLayerEntry(layerPaths[i], func(index int, hdr *tar.Header, _ io.Reader) error {
+			name := tarEntryPath(hdr.Name)
+			if base := path.Base(name); base == whiteoutOpaqueDir {
+				layerOpaque[path.Dir(name)] = true
+				return nil
+			}
+			if target := whiteoutTarget(name); target != "" {
+				layerDeleted[target] = true
+				return nil
+			}
+			if pathIsHidden(name, deleted, opaque) {
+				return nil
+			}
+			if winner, ok := winners[name]; ok && winner.layer != i {
+				return nil
+			}
+			winners[name] = squashEntryPosition{layer: i, entry: index} // A later entry in the same layer replaces an earlier one
+			if hdr.Typeflag != tar.TypeDir {
+				layerDeleted[name] = true // Hides lower directory contents
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		for p := range layerDeleted {
+			deleted[p] = true
+		}
+		for p := range layerOpaque {
+			opaque[p] = true
+		}
+	}
+	res := map[squashEntryPosition]bool{}
+	for _, pos := range winners {
+		res[pos] = true
+	}
+	return res, nil
+}
+
+// forEachLayerEntry calls fn for every entry of the uncompressed layer tar file at layerPath, in order.
+func forEachLayerEntry(layerPath string, fn func(index int, hdr *tar.Header, contents io.Reader) error) error {
+	f, err := os.Open(layerPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	tr := tar.NewReader(f)
+	for i := 0; ; i++ {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading layer: %w", err)
+		}
+		if err := fn(i, hdr, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// squashLayers writes a single uncompressed layer tar stream to dest, containing the result of applying the uncompressed
+// layer tar files at layerPaths, bottom layer first, in order. It returns the number of entries written.
+func squashLayers(dest io.Writer, layerPaths []string) (int, error) {
+	visible, err := squashVisibleEntries(layerPaths)
+	if err != nil {
+		return 0, err
+	}
+	tw := tar.NewWriter(dest)
+	written := map[string]bool{}
+	for i, layerPath := range layerPaths {
+		err := forEachLayerEntry(layerPath, func(index int, hdr *tar.Header, contents io.Reader) error {
+			if !visible[squashEntryPosition{layer: i, entry: index}] {
+				return nil
+			}
+			if hdr.Typeflag == tar.TypeLink && !written[tarEntryPath(hdr.Linkname)] {
+				return fmt.Errorf("%q is a hard link to %q, which is not a part of the squashed layer", hdr.Name, hdr.Linkname)
+			}
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			if _, err := io.Copy(tw, contents); err != nil {
+				return fmt.Errorf("reading layer: %w", err)
+			}
+			written[tarEntryPath(hdr.Name)] = true
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return 0, err
+	}
+	return len(written), nil
+}
+
+// squashConfig returns config, an image config blob, with the first squashedLayers entries of rootfs.diff_ids replaced by diffID,
+// and the history entries of those layers replaced by a single entry describing the squashed layer, created by optionName.
+// If all layers are squashed, the whole history is replaced. Other members of config are preserved.
+func squashConfig(config []byte, diffID digest.Digest, squashedLayers int, optionName string) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(config, &fields); err != nil {
+		return nil, fmt.Errorf("parsing image config: %w", err)
+	}
+	rootFS := map[string]json.RawMessage{}
+	if raw, ok := fields["rootfs"]; ok {
+		if err := json.Unmarshal(raw, &rootFS); err != nil {
+			return nil, fmt.Errorf("parsing image config rootfs: %w", err)
+		}
+	}
+	var diffIDs []digest.Digest
+	if raw, ok := rootFS["diff_ids"]; ok {
+		if err := json.Unmarshal(raw, &diffIDs); err != nil {
+			return nil, fmt.Errorf("parsing image config diff_ids: %w", err)
+		}
+	}
+	partial := squashedLayers < len(diffIDs)
+	newDiffIDs := []digest.Digest{diffID}
+	if partial {
+		newDiffIDs = append(newDiffIDs, diffIDs[squashedLayers:]...)
+	}
+	rootFS["type"] = json.RawMessage(`"layers"`)
+	rawDiffIDs, err := json.Marshal(newDiffIDs)
+	if err != nil {
+		return nil, err
+	}
+	rootFS["diff_ids"] = rawDiffIDs
+	rawRootFS, err := json.Marshal(rootFS)
+	if err != nil {
+		return nil, err
+	}
+	fields["rootfs"] = rawRootFS
+
+	var history []map[string]json.RawMessage
+	if raw, ok := fields["history"]; ok {
+		if err := json.Unmarshal(raw, &history); err != nil {
+			return nil, fmt.Errorf("parsing image config history: %w", err)
+		}
+	}
+	if partial && len(history) == 0 {
+		return json.Marshal(fields) // A single entry would not match the remaining layers
+	}
+	var remainingHistory []map[string]json.RawMessage
+	created, hasCreated := fields["created"]
+	if partial {
+		// Find the entry which created the last of the squashed layers.
+		layers, i := 0, 0
+		for ; i < len(history) && layers < squashedLayers; i++ {
+			var emptyLayer bool
+			if raw, ok := history[i]["empty_layer"]; ok {
+				if err := json.Unmarshal(raw, &emptyLayer); err != nil {
+					return nil, fmt.Errorf("parsing image config history: %w", err)
+				}
+			}
+			if !emptyLayer {
+				layers++
+			}
+		}
+		if layers < squashedLayers {
+			return nil, fmt.Errorf("the image config history describes %d layers, but the image has %d", layers, len(diffIDs))
+		}
+		created, hasCreated = history[i-1]["created"]
+		remainingHistory = history[i:]
+	}
+	entry := map[string]json.RawMessage{}
+	if hasCreated {
+		entry["created"] = created
+	}
+	rawComment, err := json.Marshal(fmt.Sprintf("skopeo copy %s of %d layers", optionName, squashedLayers))
+	if err != nil {
+		return nil, err
+	}
+	entry["comment"] = rawComment
+	rawHistory, err := json.Marshal(append([]map[string]json.RawMessage{entry}, remainingHistory...))
+	if err != nil {
+		return nil, err
+	}
+	fields["history"] = rawHistory
+	return json.Marshal(fields)
+}
+
+// setUpSquash verifies the image at srcRef (choosing an instance from a manifest list based on sys) against policyContext,
+// and returns a reference to a version of that image with the lowest layers merged into a single uncompressed layer,
+// so that it has at most maxLayers layers; with maxLayers == 1, all layers are merged.
+// The layers are written into a temporary directory created using global. optionName is used in messages.
+func setUpSquash(ctx context.Context, sys *types.SystemContext, policyContext *signature.PolicyContext, srcRef types.ImageReference,
+	maxLayers int, optionName string, global *globalOptions, retryOpts *retry.Options) (_ types.ImageReference, retErr error) {
+	var src types.ImageSource
+	if err := retry.IfNecessary(ctx, func() error {
+		var err error
+		src, err = srcRef.NewImageSource(ctx, sys)
+		return err
+	}, retryOpts); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := src.Close(); err != nil {
+			retErr = noteCloseFailure(retErr, "closing image", err)
+		}
+	}()
+
+	img, err := policyVerifiedImage(ctx, sys, policyContext, src, retryOpts)
+	if err != nil {
+		return nil, err
+	}
+	rawManifest, mimeType, err := img.Manifest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if img.ConfigInfo().Digest == "" {
+		return nil, fmt.Errorf("%s does not support %s images", optionName, mimeType)
+	}
+	config, err := img.ConfigBlob(ctx)
+	if err != nil {
+		return nil, err
+	}
+	m, err := manifest.FromBlob(rawManifest, mimeType)
+	if err != nil {
+		return nil, err
+	}
+
+	logrus.Warnf("%s changes the digests of the image and its layers, drops the history of the squashed layers, and invalidates any signatures; "+
+		"the squashed layer can't be shared with other images", optionName)
+	dir, err := global.newTemporaryDir("skopeo-squash")
+	if err != nil {
+		return nil, err
+	}
+	layerInfos := m.LayerInfos()
+	squashed := len(layerInfos) - maxLayers + 1 // The number of layers to merge
+	if maxLayers == 1 || squashed > len(layerInfos) {
+		squashed = len(layerInfos)
+	}
+	layerPaths := make([]string, 0, squashed)
+	for i, layer := range layerInfos[:squashed] {
+		if layer.CryptoOperation != types.PreserveOriginalCrypto || strings.Contains(layer.MediaType, "encrypted") {
+			return nil, fmt.Errorf("%s does not support encrypted layer %s", optionName, layer.Digest)
+		}
+		layerPath := filepath.Join(dir, fmt.Sprintf("layer-%d", i))
+		if _, _, err := filterLayerBlob(ctx, src, layer.BlobInfo, layerPath, nil, retryOpts); err != nil {
+			return nil, fmt.Errorf("reading layer %s: %w", layer.Digest, err)
+		}
+		layerPaths = append(layerPaths, layerPath)
+	}
+
+	squashedPath := filepath.Join(dir, "squashed")
+	f, err := os.Create(squashedPath)
+	if err != nil {
+		return nil, err
+	}
+	digester := digest.Canonical.Digester()
+	counter := &byteCounter{}
+	entries, err := squashLayers(io.MultiWriter(f, digester.Hash(), counter), layerPaths)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("squashing layers: %w", err)
+	}
+	squashedDigest := digester.Digest()
+	logrus.Debugf("Squashed %d layers into %s, with %d entries", squashed, squashedDigest, entries)
+
+	switch m := m.(type) {
+	case *manifest.OCI1:
+		m.Layers = append([]imgspecv1.Descriptor{{MediaType: imgspecv1.MediaTypeImageLayer, Digest: squashedDigest, Size: counter.count}},
+			m.Layers[squashed:]...)
+	case *manifest.Schema2:
+		m.LayersDescriptors = append([]manifest.Schema2Descriptor{{MediaType: manifest.DockerV2SchemaLayerMediaTypeUncompressed, Digest: squashedDigest, Size: counter.count}},
+			m.LayersDescriptors[squashed:]...)
+	default:
+		return nil, fmt.Errorf("%s does not support %s images", optionName, mimeType)
+	}
+	updatedConfig, err := squashConfig(config, squashedDigest, squashed, optionName)
+	if err != nil {
+		return nil, err
+	}
+	layers := map[digest.Digest]rewrittenLayer{squashedDigest: {path: squashedPath, size: counter.count}}
+	return newRewrittenImageReference(srcRef, m, mimeType, updatedConfig, layers, optionName)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestLayers writes layers to files in a temporary directory, and returns their paths.
+func writeTestLayers(t *testing.T, layers ...[]byte) []string {
+	dir := t.TempDir()
+	res := []string{}
+	for i, layer := range layers {
+		p := filepath.Join(dir, strconv.Itoa(i))
+		err := os.WriteFile(p, layer, 0o644)
+		require.NoError(t, err)
+		res = append(res, p)
+	}
+	return res
+}
+
+func TestSquashLayers(t *testing.T) {
+	layers := writeTestLayers(t,
+		testLayerTar(t,
+			tar.Header{Name: "etc/", Typeflag: tar.TypeDir, Mode: 0o755},
+			tar.Header{Name: "etc/config", Typeflag: tar.TypeReg, Mode: 0o644},
+			tar.Header{Name: "etc/removed", Typeflag: tar.TypeReg, Mode: 0o644},
+			tar.Header{Name: "opt/", Typeflag: tar.TypeDir, Mode: 0o755},
+			tar.Header{Name: "opt/old", Typeflag: tar.TypeReg, Mode: 0o644},
+			tar.Header{Name: "var/", Typeflag: tar.TypeDir, Mode: 0o755},
+			tar.Header{Name: "var/lib", Typeflag: tar.TypeReg, Mode: 0o644},
+		),
+		testLayerTar(t,
+			tar.Header{Name: "etc/config", Typeflag: tar.TypeReg, Mode: 0o600},
+			tar.Header{Name: "etc/.wh.removed", Typeflag: tar.TypeReg},
+			tar.Header{Name: "opt/", Typeflag: tar.TypeDir, Mode: 0o755},
+			tar.Header{Name: "opt/.wh..wh..opq", Typeflag: tar.TypeReg},
+			tar.Header{Name: "opt/new", Typeflag: tar.TypeReg, Mode: 0o644},
+			tar.Header{Name: "var", Typeflag: tar.TypeSymlink, Linkname: "/tmp"},
+		),
+	)
+	var buf bytes.Buffer
+	entries, err := squashLayers(&buf, layers)
+	require.NoError(t, err)
+	assert.Equal(t, 5, entries)
+	assert.Equal(t, []string{"etc/", "etc/config", "opt/", "opt/new", "var"}, layerTarNames(t, buf.Bytes()))
+	tr := tar.NewReader(&buf)
+	for {
+		hdr, err := tr.Next()
+		require.NoError(t, err)
+		if hdr.Name == "etc/config" {
+			assert.Equal(t, int64(0o600), hdr.Mode)
+			break
+		}
+	}
+
+	// A hard link to a file which is removed
+	layers = writeTestLayers(t,
+		testLayerTar(t,
+			tar.Header{Name: "a", Typeflag: tar.TypeReg, Mode: 0o644},
+			tar.Header{Name: "b", Typeflag: tar.TypeLink, Linkname: "a"},
+		),
+		testLayerTar(t, tar.Header{Name: ".wh.a", Typeflag: tar.TypeReg}),
+	)
+	_, err = squashLayers(&bytes.Buffer{}, layers)
+	assert.Error(t, err)
+}
+
+func TestSquashConfig(t *testing.T) {
+	d1, d2 := digest.FromString("1"), digest.FromString("2")
+	res, err := squashConfig([]byte(`{"architecture":"amd64","created":"2024-01-01T00:00:00Z",`+
+		`"rootfs":{"type":"layers","diff_ids":["`+d1.String()+`","`+d2.String()+`"]},`+
+		`"history":[{"created_by":"a"},{"created_by":"b"},{"created_by":"c","empty_layer":true}],"unknown":{"a":1}}`), d2, 2, "--squash")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"architecture":"amd64","created":"2024-01-01T00:00:00Z","rootfs":{"type":"layers","diff_ids":["`+d2.String()+`"]},`+
+		`"history":[{"created":"2024-01-01T00:00:00Z","comment":"skopeo copy --squash of 2 layers"}],"unknown":{"a":1}}`, string(res))
+
+	// Squashing only the lowest layers keeps the history of the others
+	d3 := digest.FromString("3")
+	res, err = squashConfig([]byte(`{"created":"2024-01-01T00:00:00Z","rootfs":{"type":"layers","diff_ids":["`+d1.String()+`","`+d2.String()+`","`+d3.String()+`"]},`+
+		`"history":[{"created":"2023-01-01T00:00:00Z","created_by":"a"},{"created_by":"env","empty_layer":true},`+
+		`{"created":"2023-02-01T00:00:00Z","created_by":"b"},{"created_by":"c"}]}`), d2, 2, "--squash-over")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"created":"2024-01-01T00:00:00Z","rootfs":{"type":"layers","diff_ids":["`+d2.String()+`","`+d3.String()+`"]},`+
+		`"history":[{"created":"2023-02-01T00:00:00Z","comment":"skopeo copy --squash-over of 2 layers"},{"created_by":"c"}]}`, string(res))
+	_, err = squashConfig([]byte(`{"rootfs":{"type":"layers","diff_ids":["`+d1.String()+`","`+d2.String()+`","`+d3.String()+`"]},`+
+		`"history":[{"created_by":"a"},{"created_by":"env","empty_layer":true}]}`), d2, 2, "--squash-over")
+	assert.Error(t, err)
+
+	_, err = squashConfig([]byte(`not JSON`), d1, 1, "--squash")
+	assert.Error(t, err)
+}
+
+func TestCopySquash(t *testing.T) {
+	layer1 := testLayerTar(t,
+		tar.Header{Name: "usr/", Typeflag: tar.TypeDir, Mode: 0o755},
+		tar.Header{Name: "usr/bin/tool", Typeflag: tar.TypeReg, Mode: 0o755},
+	)
+	layer2 := testLayerTar(t,
+		tar.Header{Name: "usr/bin/.wh.tool", Typeflag: tar.TypeReg},
+		tar.Header{Name: "usr/bin/other", Typeflag: tar.TypeReg, Mode: 0o755},
+	)
+	layer1Digest, layer2Digest := digest.FromBytes(layer1), digest.FromBytes(layer2)
+	config := []byte(`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers","diff_ids":["` + layer1Digest.String() + `","` + layer2Digest.String() + `"]}}`)
+	configDigest := digest.FromBytes(config)
+	src := testDirImage(t, []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json",`+
+		`"config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"`+configDigest.String()+`","size":`+strconv.Itoa(len(config))+`},`+
+		`"layers":[{"mediaType":"application/vnd.oci.image.layer.v1.tar","digest":"`+layer1Digest.String()+`","size":`+strconv.Itoa(len(layer1))+`},`+
+		`{"mediaType":"application/vnd.oci.image.layer.v1.tar","digest":"`+layer2Digest.String()+`","size":`+strconv.Itoa(len(layer2))+`}]}`))
+	for d, contents := range map[digest.Digest][]byte{configDigest: config, layer1Digest: layer1, layer2Digest: layer2} {
+		err := os.WriteFile(filepath.Join(src, d.Encoded()), contents, 0o644)
+		require.NoError(t, err)
+	}
+
+	dest := t.TempDir()
+	_, err := runSkopeo("--insecure-policy", "copy", "--squash", "dir:"+src, "dir:"+dest)
+	require.NoError(t, err)
+
+	destManifestBlob, err := os.ReadFile(filepath.Join(dest, "manifest.json"))
+	require.NoError(t, err)
+	var destManifest imgspecv1.Manifest
+	err = json.Unmarshal(destManifestBlob, &destManifest)
+	require.NoError(t, err)
+	require.Len(t, destManifest.Layers, 1)
+	destLayer, err := os.ReadFile(filepath.Join(dest, destManifest.Layers[0].Digest.Encoded()))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"usr/", "usr/bin/other"}, layerTarNames(t, destLayer))
+
+	destConfigBlob, err := os.ReadFile(filepath.Join(dest, destManifest.Config.Digest.Encoded()))
+	require.NoError(t, err)
+	var destConfig imgspecv1.Image
+	err = json.Unmarshal(destConfigBlob, &destConfig)
+	require.NoError(t, err)
+	assert.Equal(t, []digest.Digest{destManifest.Layers[0].Digest}, destConfig.RootFS.DiffIDs)
+	assert.Len(t, destConfig.History, 1)
+
+	out, err := runSkopeo("--insecure-policy", "copy", "--squash", "--all", "dir:"+src, "dir:"+t.TempDir())
+	assertTestFailed(t, out, err, "--squash cannot be used together with --all or --multi-arch")
+}
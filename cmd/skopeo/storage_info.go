@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/containers/image/v5/storage"
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/skopeo/cmd/skopeo/inspect"
+	"github.com/containers/storage/pkg/directory"
+)
+
+// validateDefaultStoreImageName returns an error if imageName can not be used with option, which only supports
+// containers-storage: images in the default store, like (skopeo inspect --storage-info).
+func validateDefaultStoreImageName(option, imageName string) error {
+	transport, within, _ := strings.Cut(imageName, ":")
+	if transport != storage.Transport.Name() {
+		return fmt.Errorf("%s requires a %s: image, not %s", option, storage.Transport.Name(), imageName)
+	}
+	if strings.HasPrefix(within, "[") {
+		return fmt.Errorf("%s can not be used with a store specification in %s", option, imageName)
+	}
+	return nil
+}
+
+// composefsBlobPath returns the path where the overlay driver stores the composefs blob of a layer with files in layerDir.
+func composefsBlobPath(layerDir string) string {
+	return filepath.Join(filepath.Dir(layerDir), "composefs-data", "composefs.blob")
+}
+
+// storageInfo returns a description of how the image imageName, which has been validated by validateDefaultStoreImageName,
+// is stored in the default containers-storage: store.
+func storageInfo(imageName string) (*inspect.StorageInfo, error) {
+	ref, err := storage.Transport.ParseReference(strings.TrimPrefix(imageName, storage.Transport.Name()+":"))
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing image name %q: %w", imageName, err)
+	}
+	_, img, err := storage.ResolveReference(ref)
+	if err != nil {
+		return nil, fmt.Errorf("Error looking up %s: %w", transports.ImageName(ref), err)
+	}
+	store := storage.Transport.GetStoreIfSet() // --storage-info does not allow a store specification, so ref uses the default store
+	if store == nil {
+		return nil, errors.New("internal error: the containers-storage: store is not initialized")
+	}
+	res := inspect.StorageInfo{
+		Driver:  store.GraphDriverName(),
+		ImageID: img.ID,
+		Layers:  []inspect.StorageLayerInfo{},
+	}
+	for layerID := img.TopLayer; layerID != ""; {
+		layer, err := store.Layer(layerID)
+		if err != nil {
+			return nil, fmt.Errorf("Error looking up layer %s: %w", layerID, err)
+		}
+		info := inspect.StorageLayerInfo{
+			ID:     layer.ID,
+			Digest: layer.UncompressedDigest,
+		}
+		if dir, err := store.DifferTarget(layer.ID); err == nil {
+			info.DiskSize, err = directory.Size(dir)
+			if err != nil {
+				return nil, fmt.Errorf("Error computing the disk usage of layer %s: %w", layer.ID, err)
+			}
+			if fi, err := os.Stat(composefsBlobPath(dir)); err == nil {
+				info.Composefs = true
+				info.DiskSize += fi.Size()
+			}
+		} else {
+			// The driver does not expose the layer directory; use the size recorded by containers/storage instead.
+			info.DiskSize, err = store.LayerSize(layer.ID)
+			if err != nil {
+				return nil, fmt.Errorf("Error computing the size of layer %s: %w", layer.ID, err)
+			}
+		}
+		res.Composefs = res.Composefs || info.Composefs
+		res.DiskSize += info.DiskSize
+		res.Layers = append(res.Layers, info)
+		layerID = layer.Parent
+	}
+	// Report the layers in the order of the image, base layer first.
+	for i, j := 0, len(res.Layers)-1; i < j; i, j = i+1, j-1 {
+		res.Layers[i], res.Layers[j] = res.Layers[j], res.Layers[i]
+	}
+	res.LayerCount = len(res.Layers)
+	return &res, nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	"golang.org/x/sync/semaphore"
+)
+
+// setUpStrictLayerOrder returns a reference wrapping destRef, and a semaphore to use for copying blobs,
+// which make sure that blobs are written to the destination one at a time, in manifest order,
+// and that a manifest is only written after the destination has confirmed all blobs it references.
+func setUpStrictLayerOrder(destRef types.ImageReference) (types.ImageReference, *semaphore.Weighted) {
+	// containers/image starts copying the layers of an image in manifest order, each one after acquiring the semaphore;
+	// with a single slot, a layer is only started after the previous one has finished.
+	return strictLayerOrderReference{ImageReference: destRef}, semaphore.NewWeighted(1)
+}
+
+// strictLayerOrderReference is a types.ImageReference wrapper; image destinations created from it
+// refuse to write manifests referencing blobs which have not been confirmed by the destination.
+type strictLayerOrderReference struct {
+	types.ImageReference
+}
+
+// NewImageDestination returns a types.ImageDestination for this reference.
+// The caller must call .Close() on the returned ImageDestination.
+func (ref strictLayerOrderReference) NewImageDestination(ctx context.Context, sys *types.SystemContext) (types.ImageDestination, error) {
+	dest, err := ref.ImageReference.NewImageDestination(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	return &strictLayerOrderDestination{ImageDestination: dest, ref: ref, confirmed: map[digest.Digest]struct{}{}}, nil
+}
+
+// strictLayerOrderDestination is a types.ImageDestination wrapper which records the blobs written to, or reused at, the destination,
+// and checks that all blobs referenced by a per-image manifest have been recorded before writing it.
+type strictLayerOrderDestination struct {
+	types.ImageDestination
+	ref strictLayerOrderReference
+
+	mutex     sync.Mutex
+	confirmed map[digest.Digest]struct{} // Blobs which the destination has confirmed to contain
+}
+
+// Reference returns the reference used to set up this destination.
+func (d *strictLayerOrderDestination) Reference() types.ImageReference {
+	return d.ref
+}
+
+// confirm records that the destination contains blobDigest.
+func (d *strictLayerOrderDestination) confirm(blobDigest digest.Digest) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.confirmed[blobDigest] = struct{}{}
+}
+
+// PutBlob writes contents of stream and returns data representing the result.
+func (d *strictLayerOrderDestination) PutBlob(ctx context.Context, stream io.Reader, inputInfo types.BlobInfo, cache types.BlobInfoCache, isConfig bool) (types.BlobInfo, error) {
+	res, err := d.ImageDestination.PutBlob(ctx, stream, inputInfo, cache, isConfig)
+	if err == nil {
+		d.confirm(res.Digest)
+	}
+	return res, err
+}
+
+// TryReusingBlob checks whether the transport already contains, or can efficiently reuse, a blob, and if so, applies it to the current destination.
+func (d *strictLayerOrderDestination) TryReusingBlob(ctx context.Context, info types.BlobInfo, cache types.BlobInfoCache, canSubstitute bool) (bool, types.BlobInfo, error) {
+	reused, res, err := d.ImageDestination.TryReusingBlob(ctx, info, cache, canSubstitute)
+	if err == nil && reused {
+		d.confirm(res.Digest)
+	}
+	return reused, res, err
+}
+
+// unconfirmed returns the first of blobs which the destination has not confirmed to contain, ignoring foreign layers, or "".
+func (d *strictLayerOrderDestination) unconfirmed(blobs []types.BlobInfo) digest.Digest {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for _, blob := range blobs {
+		if len(blob.URLs) != 0 {
+			continue // A foreign layer, which is not copied
+		}
+		if _, ok := d.confirmed[blob.Digest]; !ok {
+			return blob.Digest
+		}
+	}
+	return ""
+}
+
+// PutManifest writes manifest to the destination, after checking that the destination has confirmed all blobs referenced by it.
+// Manifest lists are not checked: they only reference manifests, and may reference instances which were not copied.
+func (d *strictLayerOrderDestination) PutManifest(ctx context.Context, m []byte, instanceDigest *digest.Digest) error {
+	if mimeType := manifest.GuessMIMEType(m); !manifest.MIMETypeIsMultiImage(mimeType) {
+		parsed, err := manifest.FromBlob(m, mimeType)
+		if err != nil {
+			return fmt.Errorf("parsing the manifest to write: %w", err)
+		}
+		blobs := []types.BlobInfo{}
+		if config := parsed.ConfigInfo(); config.Digest != "" {
+			blobs = append(blobs, config)
+		}
+		for _, layer := range parsed.LayerInfos() {
+			blobs = append(blobs, layer.BlobInfo)
+		}
+		if blobDigest := d.unconfirmed(blobs); blobDigest != "" {
+			return fmt.Errorf("refusing to write a manifest referencing blob %s, which has not been confirmed by the destination", blobDigest)
+		}
+	}
+	return d.ImageDestination.PutManifest(ctx, m, instanceDigest)
+}
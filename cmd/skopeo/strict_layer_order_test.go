@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/directory"
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStrictLayerOrderDestination(t *testing.T) {
+	ctx := context.Background()
+	src := testDirImageWithBlobs(t)
+	manifestBlob, err := os.ReadFile(filepath.Join(src, "manifest.json"))
+	require.NoError(t, err)
+	config := []byte(`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers","diff_ids":[]}}`) // As created by testDirImageWithBlobs
+	layer := []byte("not really a layer")
+
+	destRef, err := directory.NewReference(t.TempDir())
+	require.NoError(t, err)
+	ref, sem := setUpStrictLayerOrder(destRef)
+	assert.True(t, sem.TryAcquire(1))
+	assert.False(t, sem.TryAcquire(1)) // Blobs are copied one at a time
+	dest, err := ref.NewImageDestination(ctx, nil)
+	require.NoError(t, err)
+	defer dest.Close()
+
+	_, err = dest.PutBlob(ctx, bytes.NewReader(config), types.BlobInfo{Digest: digest.FromBytes(config), Size: int64(len(config))}, none.NoCache, true)
+	require.NoError(t, err)
+	err = dest.PutManifest(ctx, manifestBlob, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "refusing to write a manifest referencing blob "+digest.FromBytes(layer).String())
+
+	_, err = dest.PutBlob(ctx, bytes.NewReader(layer), types.BlobInfo{Digest: digest.FromBytes(layer), Size: int64(len(layer))}, none.NoCache, false)
+	require.NoError(t, err)
+	err = dest.PutManifest(ctx, manifestBlob, nil)
+	require.NoError(t, err)
+}
+
+func TestCopyStrictLayerOrder(t *testing.T) {
+	src := testDirImageWithBlobs(t)
+	dest := t.TempDir()
+	_, err := runSkopeo("--insecure-policy", "copy", "--strict-layer-order", "dir:"+src, "dir:"+dest)
+	require.NoError(t, err)
+	srcManifest, err := os.ReadFile(filepath.Join(src, "manifest.json"))
+	require.NoError(t, err)
+	destManifest, err := os.ReadFile(filepath.Join(dest, "manifest.json"))
+	require.NoError(t, err)
+	assert.Equal(t, srcManifest, destManifest)
+
+	out, err := runSkopeo("--insecure-policy", "copy", "--strict-layer-order", "--compression-workers", "2", "dir:"+src, "dir:"+t.TempDir())
+	assertTestFailed(t, out, err, "--strict-layer-order cannot be used together with --compression-workers")
+	out, err = runSkopeo("--insecure-policy", "copy", "--strict-layer-order", "--dest-blob-concurrency-per-host", "2", "dir:"+src, "dir:"+t.TempDir())
+	assertTestFailed(t, out, err, "--strict-layer-order cannot be used together with --dest-blob-concurrency-per-host")
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// summaryProgressInterval is the copy.Options.ProgressInterval used for copy --summary if nothing else needs progress events.
+// The summary only uses the events reported at the end of each blob, so this only needs to be positive.
+const summaryProgressInterval = time.Minute
+
+// copySummary collects the statistics printed by copy --summary.
+type copySummary struct {
+	layersCopied int64
+	layersReused int64
+	bytes        int64 // Bytes of all blobs written to the destination, including configs
+}
+
+// format returns the summary line for a copy from sourceDigest to destDigest which took duration.
+func (s *copySummary) format(sourceDigest, destDigest digest.Digest, duration time.Duration) string {
+	return fmt.Sprintf("Copied %s to %s: %d layers copied, %d reused, %d bytes in %s\n", sourceDigest, destDigest,
+		s.layersCopied, s.layersReused, s.bytes, duration.Round(time.Millisecond))
+}
+
+// record updates s with a progress event reported by c/image/copy.Image.
+func (s *copySummary) record(p types.ProgressProperties) {
+	switch p.Event {
+	case types.ProgressEventDone:
+		s.bytes += int64(p.Offset)
+		// Configs are copied like layers; they can only be recognized by their MIME type.
+		if p.Artifact.MediaType != manifest.DockerV2Schema2ConfigMediaType && p.Artifact.MediaType != imgspecv1.MediaTypeImageConfig {
+			s.layersCopied++
+		}
+	case types.ProgressEventSkipped:
+		s.layersReused++
+	}
+}
+
+// watchProgress resets s, and returns a channel for copy.Options.Progress which records the events in s,
+// and forwards them to next, if it is not nil.
+// The caller must call the returned function after copy.Image returns, before using s.
+func (s *copySummary) watchProgress(next chan<- types.ProgressProperties) (chan types.ProgressProperties, func()) {
+	*s = copySummary{}
+	progress := make(chan types.ProgressProperties)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for p := range progress {
+			s.record(p)
+			if next != nil {
+				next <- p
+			}
+		}
+	}()
+	return progress, func() {
+		close(progress)
+		<-done
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopySummaryFormat(t *testing.T) {
+	s := copySummary{layersCopied: 3, layersReused: 2, bytes: 1234}
+	src := digest.FromString("source")
+	dest := digest.FromString("destination")
+	assert.Equal(t, "Copied "+src.String()+" to "+dest.String()+": 3 layers copied, 2 reused, 1234 bytes in 1.235s\n",
+		s.format(src, dest, 1234567*time.Microsecond))
+}
+
+func TestCopySummaryWatchProgress(t *testing.T) {
+	s := copySummary{layersCopied: 1}
+	next := make(chan types.ProgressProperties, 10)
+	progress, stop := s.watchProgress(next)
+	events := []types.ProgressProperties{
+		{Event: types.ProgressEventNewArtifact, Artifact: types.BlobInfo{MediaType: imgspecv1.MediaTypeImageConfig}},
+		{Event: types.ProgressEventDone, Artifact: types.BlobInfo{MediaType: imgspecv1.MediaTypeImageConfig}, Offset: 10},
+		{Event: types.ProgressEventNewArtifact, Artifact: types.BlobInfo{MediaType: imgspecv1.MediaTypeImageLayerGzip}},
+		{Event: types.ProgressEventRead, Artifact: types.BlobInfo{MediaType: imgspecv1.MediaTypeImageLayerGzip}, Offset: 50},
+		{Event: types.ProgressEventDone, Artifact: types.BlobInfo{MediaType: imgspecv1.MediaTypeImageLayerGzip}, Offset: 100},
+		{Event: types.ProgressEventSkipped, Artifact: types.BlobInfo{MediaType: imgspecv1.MediaTypeImageLayerGzip}},
+	}
+	for _, e := range events {
+		progress <- e
+	}
+	stop()
+	assert.Equal(t, copySummary{layersCopied: 1, layersReused: 1, bytes: 110}, s)
+	close(next)
+	forwarded := []types.ProgressProperties{}
+	for e := range next {
+		forwarded = append(forwarded, e)
+	}
+	assert.Equal(t, events, forwarded)
+}
+
+func TestCopySummary(t *testing.T) {
+	src := testDirImageWithBlobs(t)
+	manifestBytes, err := os.ReadFile(filepath.Join(src, "manifest.json"))
+	require.NoError(t, err)
+	manifestDigest, err := manifest.Digest(manifestBytes)
+	require.NoError(t, err)
+
+	dest := t.TempDir()
+	out, err := runSkopeo("--insecure-policy", "copy", "--summary", "dir:"+src, "dir:"+dest)
+	require.NoError(t, err)
+	configSize := len(`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers","diff_ids":[]}}`)
+	layerSize := len("not really a layer")
+	assert.Regexp(t, "(?m)^"+regexp.QuoteMeta("Copied "+manifestDigest.String()+" to "+manifestDigest.String()+": 1 layers copied, 0 reused, ")+
+		regexp.QuoteMeta(strconv.Itoa(configSize+layerSize))+" bytes in [0-9.]+[mµn]?s$", out)
+
+	// --quiet suppresses the summary.
+	dest = t.TempDir()
+	out, err = runSkopeo("--insecure-policy", "copy", "--quiet", "--summary", "dir:"+src, "dir:"+dest)
+	require.NoError(t, err)
+	assert.Empty(t, out)
+}
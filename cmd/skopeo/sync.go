@@ -6,11 +6,13 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
+	"math"
 	"os"
 	"path"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/Masterminds/semver/v3"
 	commonFlag "github.com/containers/common/pkg/flag"
@@ -19,6 +21,8 @@ import (
 	"github.com/containers/image/v5/directory"
 	"github.com/containers/image/v5/docker"
 	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/image"
+	"github.com/containers/image/v5/manifest"
 	"github.com/containers/image/v5/pkg/cli"
 	"github.com/containers/image/v5/pkg/cli/sigstore"
 	"github.com/containers/image/v5/signature/signer"
@@ -28,6 +32,7 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"golang.org/x/exp/slices"
+	"golang.org/x/sync/errgroup"
 	"gopkg.in/yaml.v3"
 )
 
@@ -38,6 +43,7 @@ type syncOptions struct {
 	srcImage                 *imageOptions     // Source image options
 	destImage                *imageDestOptions // Destination image options
 	retryOpts                *retry.Options
+	blobCopyLimiter          *hostBlobCopyLimiter
 	removeSignatures         bool                      // Do not copy signatures from the source image
 	signByFingerprint        string                    // Sign the image using a GPG key with the specified fingerprint
 	signBySigstoreParamFile  string                    // Sign the image using a sigstore signature per configuration in a param file
@@ -52,6 +58,13 @@ type syncOptions struct {
 	preserveDigests          bool                      // Preserve digests during sync
 	keepGoing                bool                      // Whether or not to abort the sync if there are any errors during syncing the images
 	appendSuffix             string                    // Suffix to append to destination image tag
+	minAge                   time.Duration             // Skip images created less than this long ago
+	maxAge                   time.Duration             // Skip images created more than this long ago
+	requestsPerSecond        float64                   // Limit the rate of manifest, blob and signature requests across the whole sync
+	writeThrough             string                    // Also copy every image to this DESTINATION-like location
+	repoFilters              []string                  // Sync the repositories in the catalog of a docker SOURCE registry matching one of these patterns
+	repoExcludes             []string                  // Don't sync repositories in the catalog of a docker SOURCE registry matching one of these patterns
+	writeIndex               string                    // Write a JSON index of the copied images, and failures, to this file
 }
 
 // repoDescriptor contains information of a single repository used as a sync source.
@@ -70,12 +83,40 @@ type tlsVerifyConfig struct {
 // registrySyncConfig contains information about a single registry, read from
 // the source YAML file
 type registrySyncConfig struct {
-	Images           map[string][]string    // Images map images name to slices with the images' references (tags, digests)
-	ImagesByTagRegex map[string]string      `yaml:"images-by-tag-regex"` // Images map images name to regular expression with the images' tags
-	ImagesBySemver   map[string]string      `yaml:"images-by-semver"`    // ImagesBySemver maps a repository to a semver constraint (e.g. '>=3.14') to match images' tags to
-	Credentials      types.DockerAuthConfig // Username and password used to authenticate with the registry
-	TLSVerify        tlsVerifyConfig        `yaml:"tls-verify"` // TLS verification mode (enabled by default)
-	CertDir          string                 `yaml:"cert-dir"`   // Path to the TLS certificates of the registry
+	Images           map[string][]string // Images map images name to slices with the images' references (tags, digests)
+	ImagesByTagRegex map[string]string   `yaml:"images-by-tag-regex"` // Images map images name to regular expression with the images' tags
+	ImagesBySemver   map[string]string   `yaml:"images-by-semver"`    // ImagesBySemver maps a repository to a semver constraint (e.g. '>=3.14') to match images' tags to
+	Credentials      registryCredentials // Credentials used to authenticate with the registry
+	TLSVerify        tlsVerifyConfig     `yaml:"tls-verify"` // TLS verification mode (enabled by default)
+	CertDir          string              `yaml:"cert-dir"`   // Path to the TLS certificates of the registry
+}
+
+// registryCredentials contains the credentials used for a single registry, read from the source YAML file:
+// either a username and password (or an identity token), or the path of an authentication file containing them.
+type registryCredentials struct {
+	types.DockerAuthConfig `yaml:",inline"`
+	Authfile               string // Path of an authentication file to read the credentials of the registry from
+}
+
+// validate returns an error if the credentials for registryName are not usable.
+// The error never contains the secrets.
+func (creds *registryCredentials) validate(registryName string) error {
+	if creds.Authfile != "" {
+		if creds.DockerAuthConfig != (types.DockerAuthConfig{}) {
+			return fmt.Errorf("Invalid credentials for registry %q: authfile can not be used together with username, password or identitytoken", registryName)
+		}
+		if _, err := os.Stat(creds.Authfile); err != nil {
+			return fmt.Errorf("Invalid credentials for registry %q: %w", registryName, err)
+		}
+		return nil
+	}
+	if (creds.Username == "") != (creds.Password == "") {
+		return fmt.Errorf("Invalid credentials for registry %q: both username and password must be specified", registryName)
+	}
+	if creds.IdentityToken != "" && creds.Username != "" {
+		return fmt.Errorf("Invalid credentials for registry %q: identitytoken can not be used together with username and password", registryName)
+	}
+	return nil
 }
 
 // sourceConfig contains all registries information read from the source YAML file
@@ -87,6 +128,7 @@ func syncCmd(global *globalOptions) *cobra.Command {
 	srcFlags, srcOpts := dockerImageFlags(global, sharedOpts, deprecatedTLSVerifyOpt, "src-", "screds")
 	destFlags, destOpts := dockerImageFlags(global, sharedOpts, deprecatedTLSVerifyOpt, "dest-", "dcreds")
 	retryFlags, retryOpts := retryFlags()
+	blobCopyLimiterFlags, blobCopyLimiter := hostBlobCopyLimiterFlags()
 
 	opts := syncOptions{
 		global:              global,
@@ -94,6 +136,7 @@ func syncCmd(global *globalOptions) *cobra.Command {
 		srcImage:            srcOpts,
 		destImage:           &imageDestOptions{imageOptions: destOpts},
 		retryOpts:           retryOpts,
+		blobCopyLimiter:     blobCopyLimiter,
 	}
 
 	cmd := &cobra.Command{
@@ -125,11 +168,19 @@ See skopeo-sync(1) for details.
 	flags.BoolVar(&opts.dryRun, "dry-run", false, "Run without actually copying data")
 	flags.BoolVar(&opts.preserveDigests, "preserve-digests", false, "Preserve digests of images and lists")
 	flags.BoolVarP(&opts.keepGoing, "keep-going", "", false, "Do not abort the sync if any image copy fails")
+	flags.DurationVar(&opts.minAge, "min-age", 0, "Skip images created less than `DURATION` ago")
+	flags.DurationVar(&opts.maxAge, "max-age", 0, "Skip images created more than `DURATION` ago")
+	flags.StringVar(&opts.writeThrough, "dest-write-through", "", "Also copy every image to `MIRROR`, a location using the same format and --dest transport as DESTINATION")
+	flags.StringArrayVar(&opts.repoFilters, "repo-filter", []string{}, "With --src docker, treat SOURCE as a registry, and sync the repositories in its catalog matching `GLOB` (can be repeated)")
+	flags.StringArrayVar(&opts.repoExcludes, "repo-exclude", []string{}, "With --src docker, treat SOURCE as a registry, and don't sync the repositories in its catalog matching `GLOB` (can be repeated)")
+	flags.StringVar(&opts.writeIndex, "write-index", "", "After the sync, write a JSON index of every copied image, with digests and sizes, and of failed copies, to `FILE`")
+	flags.Float64Var(&opts.requestsPerSecond, "requests-per-second", 0, "Start at most `N` manifest, blob and signature requests per second, across all images (default is no limit)")
 	flags.AddFlagSet(&sharedFlags)
 	flags.AddFlagSet(&deprecatedTLSVerifyFlags)
 	flags.AddFlagSet(&srcFlags)
 	flags.AddFlagSet(&destFlags)
 	flags.AddFlagSet(&retryFlags)
+	flags.AddFlagSet(&blobCopyLimiterFlags)
 	return cmd
 }
 
@@ -159,6 +210,11 @@ func newSourceConfig(yamlFile string) (sourceConfig, error) {
 	if err != nil {
 		return cfg, fmt.Errorf("Failed to unmarshal %q: %w", yamlFile, err)
 	}
+	for registryName, registryConfig := range cfg {
+		if err := registryConfig.Credentials.validate(registryName); err != nil {
+			return cfg, fmt.Errorf("Invalid %q: %w", yamlFile, err)
+		}
+	}
 	return cfg, nil
 }
 
@@ -260,6 +316,87 @@ func imagesToCopyFromRepo(sys *types.SystemContext, repoRef reference.Named) ([]
 	return sourceReferences, nil
 }
 
+// catalogLimit is the maximum number of repositories read from the catalog of a registry.
+const catalogLimit = math.MaxInt32
+
+// validateRepoPatterns returns an error if any of patterns, values of flagName, is not a valid pattern.
+func validateRepoPatterns(flagName string, patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("Invalid %s %q: %w", flagName, pattern, err)
+		}
+	}
+	return nil
+}
+
+// repoNameMatches returns true if repoName matches one of includes, or includes is empty, and does not match any of excludes.
+// The patterns were validated by validateRepoPatterns.
+func repoNameMatches(repoName string, includes, excludes []string) bool {
+	included := len(includes) == 0
+	for _, pattern := range includes {
+		if matched, _ := path.Match(pattern, repoName); matched {
+			included = true
+			break
+		}
+	}
+	if !included {
+		return false
+	}
+	for _, pattern := range excludes {
+		if matched, _ := path.Match(pattern, repoName); matched {
+			return false
+		}
+	}
+	return true
+}
+
+// imagesToCopyFromCatalog builds a list of repository descriptors from the tagged images of the repositories
+// in the catalog of registryName which are selected by includes and excludes.
+// It returns a repository descriptors slice with an element for each selected repository, and any error encountered.
+func imagesToCopyFromCatalog(registryName string, includes, excludes []string, sourceCtx *types.SystemContext) ([]repoDescriptor, error) {
+	registryName = strings.TrimSuffix(registryName, "/")
+	if registryName == "" || strings.ContainsAny(registryName, "/@") {
+		return nil, fmt.Errorf("With --repo-filter or --repo-exclude, SOURCE must be a registry, not %q", registryName)
+	}
+	results, err := docker.SearchRegistry(context.Background(), sourceCtx, registryName, "", catalogLimit)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading catalog of registry %q: %w", registryName, err)
+	}
+	var descriptors []repoDescriptor
+	for _, result := range results {
+		logger := logrus.WithFields(logrus.Fields{
+			"registry": registryName,
+			"repo":     result.Name,
+		})
+		if !repoNameMatches(result.Name, includes, excludes) {
+			logger.Debug("Repository not selected by --repo-filter and --repo-exclude, skipping")
+			continue
+		}
+		repoRef, err := parseRepositoryReference(fmt.Sprintf("%s/%s", registryName, result.Name))
+		if err != nil {
+			logger.Error("Error parsing repository name, skipping")
+			logrus.Error(err)
+			continue
+		}
+		logger.Info("Querying registry for image tags")
+		imageRefs, err := imagesToCopyFromRepo(sourceCtx, repoRef)
+		if err != nil {
+			logger.Error("Error processing repo, skipping")
+			logrus.Error(err)
+			continue
+		}
+		if len(imageRefs) == 0 {
+			logger.Warn("No refs to sync found")
+			continue
+		}
+		descriptors = append(descriptors, repoDescriptor{ImageRefs: imageRefs, Context: sourceCtx})
+	}
+	if len(descriptors) == 0 {
+		return nil, fmt.Errorf("No repositories to sync found in the catalog of registry %q", registryName)
+	}
+	return descriptors, nil
+}
+
 // imagesToCopyFromDir builds a list of image references from the images found
 // in the source directory.
 // It returns an image reference slice with as many elements as the images found
@@ -302,8 +439,11 @@ func imagesToCopyFromRegistry(registryName string, cfg registrySyncConfig, sourc
 	serverCtx.DockerDaemonCertPath = cfg.CertDir
 	serverCtx.DockerDaemonInsecureSkipTLSVerify = (cfg.TLSVerify.skip == types.OptionalBoolTrue)
 	serverCtx.DockerInsecureSkipTLSVerify = cfg.TLSVerify.skip
-	if cfg.Credentials != (types.DockerAuthConfig{}) {
-		serverCtx.DockerAuthConfig = &cfg.Credentials
+	if cfg.Credentials.Authfile != "" {
+		serverCtx.AuthFilePath = cfg.Credentials.Authfile
+		serverCtx.DockerAuthConfig = nil
+	} else if cfg.Credentials.DockerAuthConfig != (types.DockerAuthConfig{}) {
+		serverCtx.DockerAuthConfig = &cfg.Credentials.DockerAuthConfig
 	}
 	var repoDescList []repoDescriptor
 
@@ -593,6 +733,100 @@ func imagesToCopy(source string, transport string, sourceCtx *types.SystemContex
 	return descriptors, nil
 }
 
+// imageCreationFilterConcurrency is the number of images whose configs are fetched in parallel for --min-age and --max-age.
+const imageCreationFilterConcurrency = 4
+
+// imageCreated returns the creation time recorded in the config of the image at ref, or nil if not recorded;
+// if ref is a manifest list, the instance matching sys is used.
+func imageCreated(ctx context.Context, sys *types.SystemContext, ref types.ImageReference) (created *time.Time, retErr error) {
+	src, err := ref.NewImageSource(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := src.Close(); err != nil {
+			retErr = noteCloseFailure(retErr, "closing image", err)
+		}
+	}()
+	rawManifest, mimeType, err := src.GetManifest(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	var instance *digest.Digest
+	if manifest.MIMETypeIsMultiImage(manifest.NormalizedMIMEType(mimeType)) {
+		list, err := manifest.ListFromBlob(rawManifest, mimeType)
+		if err != nil {
+			return nil, err
+		}
+		d, err := list.ChooseInstance(sys)
+		if err != nil {
+			return nil, err
+		}
+		instance = &d
+	}
+	img, err := image.FromUnparsedImage(ctx, sys, image.UnparsedInstance(src, instance))
+	if err != nil {
+		return nil, err
+	}
+	config, err := img.OCIConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return config.Created, nil
+}
+
+// filterImagesByCreation returns repos, containing only the images created between opts.maxAge and opts.minAge before now.
+// Images without a recorded creation time are skipped.
+func (opts *syncOptions) filterImagesByCreation(ctx context.Context, repos []repoDescriptor, now time.Time) ([]repoDescriptor, error) {
+	res := []repoDescriptor{}
+	for _, repo := range repos {
+		keep := make([]bool, len(repo.ImageRefs))
+		group, groupCtx := errgroup.WithContext(ctx)
+		group.SetLimit(imageCreationFilterConcurrency)
+		for i, ref := range repo.ImageRefs {
+			i, ref := i, ref
+			group.Go(func() error {
+				logger := logrus.WithField("ref", transports.ImageName(ref))
+				var created *time.Time
+				if err := retry.IfNecessary(groupCtx, func() error {
+					var err error
+					created, err = imageCreated(groupCtx, repo.Context, ref)
+					return err
+				}, opts.retryOpts); err != nil {
+					if !opts.keepGoing {
+						return fmt.Errorf("Error reading creation time of %q: %w", transports.ImageName(ref), err)
+					}
+					logger.WithError(err).Error("Error reading creation time, skipping")
+					return nil
+				}
+				switch {
+				case created == nil:
+					logger.Info("Skipping image without a creation time")
+				case opts.minAge != 0 && created.After(now.Add(-opts.minAge)):
+					logger.Infof("Skipping image created at %s, more recently than --min-age", created.Format(time.RFC3339))
+				case opts.maxAge != 0 && created.Before(now.Add(-opts.maxAge)):
+					logger.Infof("Skipping image created at %s, earlier than --max-age", created.Format(time.RFC3339))
+				default:
+					keep[i] = true
+				}
+				return nil
+			})
+		}
+		if err := group.Wait(); err != nil {
+			return nil, err
+		}
+		filtered := repo
+		filtered.ImageRefs = []types.ImageReference{}
+		for i, ref := range repo.ImageRefs {
+			if keep[i] {
+				filtered.ImageRefs = append(filtered.ImageRefs, ref)
+			}
+		}
+		res = append(res, filtered)
+	}
+	return res, nil
+}
+
 func (opts *syncOptions) run(args []string, stdout io.Writer) (retErr error) {
 	if len(args) != 2 {
 		return errorShouldDisplayUsage{errors.New("Exactly two arguments expected")}
@@ -630,6 +864,43 @@ func (opts *syncOptions) run(args []string, stdout io.Writer) (retErr error) {
 
 	opts.destImage.warnAboutIneffectiveOptions(transports.Get(opts.destination))
 
+	if opts.minAge < 0 || opts.maxAge < 0 {
+		return errors.New("--min-age and --max-age must not be negative")
+	}
+	if opts.minAge != 0 && opts.maxAge != 0 && opts.minAge > opts.maxAge {
+		return fmt.Errorf("--min-age %s is larger than --max-age %s", opts.minAge, opts.maxAge)
+	}
+
+	useCatalog := len(opts.repoFilters) != 0 || len(opts.repoExcludes) != 0
+	if useCatalog {
+		if opts.source != docker.Transport.Name() {
+			return fmt.Errorf("--repo-filter and --repo-exclude require --src %s", docker.Transport.Name())
+		}
+		if err := validateRepoPatterns("--repo-filter", opts.repoFilters); err != nil {
+			return err
+		}
+		if err := validateRepoPatterns("--repo-exclude", opts.repoExcludes); err != nil {
+			return err
+		}
+	}
+
+	if opts.requestsPerSecond < 0 {
+		return fmt.Errorf("Invalid --requests-per-second %g, must not be negative", opts.requestsPerSecond)
+	}
+	if opts.requestsPerSecond > 0 {
+		// The rate limiting wrappers hide support for sigstore signatures of the sources and destinations from c/image.
+		if opts.signBySigstoreParamFile != "" || opts.signBySigstorePrivateKey != "" {
+			return errors.New("--requests-per-second cannot be used together with --sign-by-sigstore or --sign-by-sigstore-private-key")
+		}
+		if !opts.removeSignatures {
+			logrus.Warn("With --requests-per-second, sigstore signatures of the source images are not copied")
+		}
+	}
+
+	if opts.writeIndex != "" && opts.dryRun {
+		return errors.New("--write-index can not be used together with --dry-run")
+	}
+
 	imageListSelection := copy.CopySystemImage
 	if opts.all {
 		imageListSelection = copy.CopyAllImages
@@ -654,13 +925,39 @@ func (opts *syncOptions) run(args []string, stdout io.Writer) (retErr error) {
 	sourceArg := args[0]
 	var srcRepoList []repoDescriptor
 	if err = retry.IfNecessary(ctx, func() error {
-		srcRepoList, err = imagesToCopy(sourceArg, opts.source, sourceCtx)
+		if useCatalog {
+			srcRepoList, err = imagesToCopyFromCatalog(sourceArg, opts.repoFilters, opts.repoExcludes, sourceCtx)
+		} else {
+			srcRepoList, err = imagesToCopy(sourceArg, opts.source, sourceCtx)
+		}
 		return err
 	}, opts.retryOpts); err != nil {
 		return err
 	}
+	var limiter *requestRateLimiter
+	if opts.requestsPerSecond > 0 {
+		limiter = newRequestRateLimiter(opts.requestsPerSecond)
+		for _, srcRepo := range srcRepoList {
+			for i, ref := range srcRepo.ImageRefs {
+				srcRepo.ImageRefs[i] = rateLimitedReference{ImageReference: ref, limiter: limiter}
+			}
+		}
+	}
+	if opts.minAge != 0 || opts.maxAge != 0 {
+		srcRepoList, err = opts.filterImagesByCreation(ctx, srcRepoList, time.Now())
+		if err != nil {
+			return err
+		}
+	}
 
 	destination := args[1]
+	destinations := []string{destination}
+	if opts.writeThrough != "" {
+		if opts.writeThrough == destination {
+			return errors.New("--dest-write-through must differ from DESTINATION")
+		}
+		destinations = append(destinations, opts.writeThrough)
+	}
 	destinationCtx, err := opts.destImage.newSystemContext()
 	if err != nil {
 		return err
@@ -722,6 +1019,20 @@ func (opts *syncOptions) run(args []string, stdout io.Writer) (retErr error) {
 	if opts.dryRun {
 		logrus.Warn("Running in dry-run mode")
 	}
+	var index *syncIndex
+	if opts.writeIndex != "" {
+		index = &syncIndex{Images: []syncIndexEntry{}}
+		// Written even if the sync fails, so that it records the images copied so far, and the failures.
+		defer func() {
+			if err := index.write(opts.writeIndex); err != nil {
+				if retErr == nil {
+					retErr = err
+				} else {
+					retErr = noteCloseFailure(retErr, "writing --write-index", err)
+				}
+			}
+		}()
+	}
 
 	for _, srcRepo := range srcRepoList {
 		options.SourceCtx = srcRepo.Context
@@ -744,32 +1055,82 @@ func (opts *syncOptions) run(args []string, stdout io.Writer) (retErr error) {
 				destSuffix = path.Base(destSuffix)
 			}
 
-			destRef, err := destinationReference(path.Join(destination, destSuffix)+opts.appendSuffix, opts.destination)
-			if err != nil {
-				return err
-			}
+			// With --dest-write-through, copy to all destinations even if one of them fails, and report failures per destination.
+			var copyErrors []error
+			var firstDestRef types.ImageReference
+			var firstDigest digest.Digest
+			for _, dest := range destinations {
+				destRef, err := destinationReference(path.Join(dest, destSuffix)+opts.appendSuffix, opts.destination)
+				if err != nil {
+					return err
+				}
 
-			fromToFields := logrus.Fields{
-				"from": transports.ImageName(ref),
-				"to":   transports.ImageName(destRef),
-			}
-			if opts.dryRun {
-				logrus.WithFields(fromToFields).Infof("Would have copied image ref %d/%d", counter+1, len(srcRepo.ImageRefs))
-			} else {
+				options.ConcurrentBlobCopiesSemaphore, err = opts.blobCopyLimiter.semaphoreFor(destRef)
+				if err != nil {
+					return err
+				}
+				if limiter != nil {
+					destRef = rateLimitedReference{ImageReference: destRef, limiter: limiter}
+				}
+
+				fromToFields := logrus.Fields{
+					"from": transports.ImageName(ref),
+					"to":   transports.ImageName(destRef),
+				}
+				if opts.dryRun {
+					logrus.WithFields(fromToFields).Infof("Would have copied image ref %d/%d", counter+1, len(srcRepo.ImageRefs))
+					continue
+				}
 				logrus.WithFields(fromToFields).Infof("Copying image ref %d/%d", counter+1, len(srcRepo.ImageRefs))
+				var manifestBytes []byte
 				if err = retry.IfNecessary(ctx, func() error {
-					_, err = copy.Image(ctx, policyContext, destRef, ref, &options)
+					manifestBytes, err = copy.Image(ctx, policyContext, destRef, ref, &options)
 					return err
 				}, opts.retryOpts); err != nil {
-					if !opts.keepGoing {
-						return fmt.Errorf("Error copying ref %q: %w", transports.ImageName(ref), err)
+					copyErr := fmt.Errorf("Error copying ref %q to %q: %w", transports.ImageName(ref), transports.ImageName(destRef), err)
+					copyErrors = append(copyErrors, copyErr)
+					if index != nil {
+						index.addFailed(transports.ImageName(ref), transports.ImageName(destRef), copyErr)
 					}
-					// log the error, keep a note that there was a failure and move on to the next
-					// image ref
-					errorsPresent = true
-					logrus.WithError(err).Errorf("Error copying ref %q", transports.ImageName(ref))
 					continue
 				}
+				manifestDigest, err := manifest.Digest(manifestBytes)
+				if err != nil {
+					return err
+				}
+				if index != nil {
+					if err := index.addCopied(transports.ImageName(ref), transports.ImageName(destRef), manifestBytes); err != nil {
+						return err
+					}
+				}
+				if firstDestRef == nil {
+					firstDestRef, firstDigest = destRef, manifestDigest
+				} else if manifestDigest != firstDigest {
+					mismatchErr := fmt.Errorf("Error copying ref %q: %q has digest %s, but %q has digest %s",
+						transports.ImageName(ref), transports.ImageName(destRef), manifestDigest, transports.ImageName(firstDestRef), firstDigest)
+					copyErrors = append(copyErrors, mismatchErr)
+					if index != nil {
+						index.Images[len(index.Images)-1].Error = mismatchErr.Error()
+					}
+				}
+			}
+			if len(copyErrors) != 0 {
+				if !opts.keepGoing {
+					if len(copyErrors) == 1 {
+						return copyErrors[0]
+					}
+					for _, err := range copyErrors[:len(copyErrors)-1] {
+						logrus.Error(err)
+					}
+					return copyErrors[len(copyErrors)-1]
+				}
+				// log the error, keep a note that there was a failure and move on to the next
+				// image ref
+				errorsPresent = true
+				for _, err := range copyErrors {
+					logrus.Error(err)
+				}
+				continue
 			}
 			imagesNumber++
 		}
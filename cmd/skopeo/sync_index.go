@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/containers/image/v5/manifest"
+	digest "github.com/opencontainers/go-digest"
+)
+
+// syncIndexEntry describes a single image copy attempted by sync, in the --write-index file.
+type syncIndexEntry struct {
+	Source       string        `json:"source"`
+	Destination  string        `json:"destination"`
+	Digest       digest.Digest `json:"digest,omitempty"`       // Digest of the copied manifest
+	ManifestSize int64         `json:"manifestSize,omitempty"` // Size of the copied manifest
+	Size         *int64        `json:"size,omitempty"`         // Total size of the config and layer blobs; not set for manifest lists, or if unknown
+	Error        string        `json:"error,omitempty"`        // Set if the copy failed
+}
+
+// syncIndex is the contents of the --write-index file.
+type syncIndex struct {
+	Images []syncIndexEntry `json:"images"`
+}
+
+// addCopied records a successful copy of source to destination, resulting in manifestBytes.
+func (index *syncIndex) addCopied(source, destination string, manifestBytes []byte) error {
+	manifestDigest, err := manifest.Digest(manifestBytes)
+	if err != nil {
+		return err
+	}
+	entry := syncIndexEntry{
+		Source:       source,
+		Destination:  destination,
+		Digest:       manifestDigest,
+		ManifestSize: int64(len(manifestBytes)),
+	}
+	mimeType := manifest.GuessMIMEType(manifestBytes)
+	if !manifest.MIMETypeIsMultiImage(mimeType) {
+		if size, err := manifestBlobsSize(manifestBytes, mimeType); err == nil && size != -1 {
+			entry.Size = &size
+		}
+	}
+	index.Images = append(index.Images, entry)
+	return nil
+}
+
+// addFailed records a failed copy of source to destination.
+func (index *syncIndex) addFailed(source, destination string, copyErr error) {
+	index.Images = append(index.Images, syncIndexEntry{
+		Source:      source,
+		Destination: destination,
+		Error:       copyErr.Error(),
+	})
+}
+
+// write writes index to path, replacing any previous contents.
+func (index *syncIndex) write(path string) error {
+	res, err := json.MarshalIndent(index, "", "    ")
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file and rename it, so that a failure doesn't leave a truncated index.
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, append(res, '\n'), 0o644); err != nil {
+		return fmt.Errorf("writing sync index %q: %w", path, err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("writing sync index %q: %w", path, err)
+	}
+	return nil
+}
@@ -1,9 +1,26 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/containers/common/pkg/retry"
+	"github.com/containers/image/v5/directory"
 	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"gopkg.in/yaml.v3"
@@ -44,3 +61,200 @@ func TestTLSVerifyConfig(t *testing.T) {
 	err := yaml.Unmarshal([]byte(`tls-verify: "not a valid bool"`), &config)
 	assert.Error(t, err)
 }
+
+func TestNewSourceConfigCredentials(t *testing.T) {
+	authfile := filepath.Join(t.TempDir(), "auth.json")
+	err := os.WriteFile(authfile, []byte(`{"auths":{}}`), 0o600)
+	require.NoError(t, err)
+	yamlFile := filepath.Join(t.TempDir(), "sync.yaml")
+	err = os.WriteFile(yamlFile, []byte(`
+registry.example.com:
+    credentials:
+        username: john
+        password: this is a secret
+quay.io:
+    credentials:
+        authfile: `+authfile+`
+`), 0o600)
+	require.NoError(t, err)
+	cfg, err := newSourceConfig(yamlFile)
+	require.NoError(t, err)
+	assert.Equal(t, registryCredentials{DockerAuthConfig: types.DockerAuthConfig{Username: "john", Password: "this is a secret"}},
+		cfg["registry.example.com"].Credentials)
+	assert.Equal(t, registryCredentials{Authfile: authfile}, cfg["quay.io"].Credentials)
+
+	for _, c := range []struct {
+		credentials, expected string
+	}{
+		{"{username: john}", "both username and password must be specified"},
+		{"{password: this is a secret}", "both username and password must be specified"},
+		{"{username: john, password: this is a secret, authfile: " + authfile + "}", "authfile can not be used together with"},
+		{"{username: john, password: this is a secret, identitytoken: token}", "identitytoken can not be used together with"},
+		{"{authfile: " + filepath.Join(t.TempDir(), "missing.json") + "}", "missing.json"},
+	} {
+		err := os.WriteFile(yamlFile, []byte("registry.example.com:\n    credentials: "+c.credentials+"\n"), 0o600)
+		require.NoError(t, err)
+		_, err = newSourceConfig(yamlFile)
+		assert.ErrorContains(t, err, c.expected, c.credentials)
+		assert.NotContains(t, err.Error(), "this is a secret", c.credentials)
+	}
+}
+
+// testDirImageCreatedAt creates a dir: image with a config recording created, and returns a reference to it.
+func testDirImageCreatedAt(t *testing.T, created string) types.ImageReference {
+	config := []byte(`{"architecture":"amd64","os":"linux","created":"` + created + `","rootfs":{"type":"layers","diff_ids":[]}}`)
+	configDigest := digest.FromBytes(config)
+	manifest := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json",` +
+		`"config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"` + configDigest.String() + `","size":` + strconv.Itoa(len(config)) + `},` +
+		`"layers":[]}`)
+	dir := testDirImage(t, manifest)
+	err := os.WriteFile(filepath.Join(dir, configDigest.Encoded()), config, 0o644)
+	require.NoError(t, err)
+	ref, err := directory.NewReference(dir)
+	require.NoError(t, err)
+	return ref
+}
+
+func TestSyncFilterImagesByCreation(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	recent := testDirImageCreatedAt(t, "2024-02-28T00:00:00Z") // 1 day old
+	older := testDirImageCreatedAt(t, "2024-02-10T00:00:00Z")  // 20 days old
+	oldest := testDirImageCreatedAt(t, "2023-12-01T00:00:00Z") // 91 days old
+	repos := []repoDescriptor{{ImageRefs: []types.ImageReference{recent, older, oldest}, Context: &types.SystemContext{}}}
+
+	for _, c := range []struct {
+		minAge, maxAge time.Duration
+		expected       []types.ImageReference
+	}{
+		{0, 30 * 24 * time.Hour, []types.ImageReference{recent, older}},
+		{7 * 24 * time.Hour, 0, []types.ImageReference{older, oldest}},
+		{7 * 24 * time.Hour, 30 * 24 * time.Hour, []types.ImageReference{older}},
+		{0, time.Hour, []types.ImageReference{}},
+	} {
+		opts := syncOptions{minAge: c.minAge, maxAge: c.maxAge, retryOpts: &retry.Options{}}
+		res, err := opts.filterImagesByCreation(ctx, repos, now)
+		require.NoError(t, err)
+		require.Len(t, res, 1)
+		assert.Equal(t, c.expected, res[0].ImageRefs, "%s-%s", c.minAge, c.maxAge)
+	}
+
+	out, err := runSkopeo("--insecure-policy", "sync", "--src", "dir", "--dest", "docker", "--min-age", "48h", "--max-age", "24h", "/dev/null", "example.com/repo")
+	assertTestFailed(t, out, err, "is larger than --max-age")
+}
+
+func TestSyncDestWriteThrough(t *testing.T) {
+	src := testDirImageWithBlobs(t)
+	var logs bytes.Buffer
+	logrus.SetOutput(&logs)
+	defer logrus.SetOutput(os.Stderr)
+
+	_, err := runSkopeo("--insecure-policy", "sync", "--src", "dir", "--dest", "docker", "--dry-run",
+		"--dest-write-through", "example.com/mirror", src, "example.com/primary")
+	require.NoError(t, err)
+	assert.Contains(t, logs.String(), `to="docker://example.com/primary/`)
+	assert.Contains(t, logs.String(), `to="docker://example.com/mirror/`)
+
+	// Both destinations are tried, and failures are reported for each of them.
+	logs.Reset()
+	_, err = runSkopeo("--insecure-policy", "sync", "--src", "dir", "--dest", "docker", "--keep-going",
+		"--dest-write-through", "127.0.0.1:1/mirror", src, "127.0.0.1:1/primary")
+	assert.ErrorContains(t, err, "Sync failed")
+	assert.Contains(t, logs.String(), `to \"docker://127.0.0.1:1/primary/`)
+	assert.Contains(t, logs.String(), `to \"docker://127.0.0.1:1/mirror/`)
+
+	out, err := runSkopeo("--insecure-policy", "sync", "--src", "dir", "--dest", "docker",
+		"--dest-write-through", "example.com/primary", src, "example.com/primary")
+	assertTestFailed(t, out, err, "--dest-write-through must differ from DESTINATION")
+}
+
+func TestSyncRepoFilter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch {
+		case req.URL.Path == "/v2/":
+			w.Header().Set("Docker-Distribution-API-Version", "registry/2.0")
+		case req.URL.Path == "/v2/_catalog":
+			_, _ = w.Write([]byte(`{"repositories":["team/app","team/old-app","other/app"]}`))
+		case strings.HasSuffix(req.URL.Path, "/tags/list"):
+			name := strings.TrimSuffix(strings.TrimPrefix(req.URL.Path, "/v2/"), "/tags/list")
+			_, _ = fmt.Fprintf(w, `{"name":%q,"tags":["latest"]}`, name)
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer server.Close()
+	registry := strings.TrimPrefix(server.URL, "http://")
+	var logs bytes.Buffer
+	logrus.SetOutput(&logs)
+	defer logrus.SetOutput(os.Stderr)
+
+	_, err := runSkopeo("--insecure-policy", "sync", "--src", "docker", "--dest", "dir", "--dry-run", "--src-tls-verify=false",
+		"--repo-filter", "team/*", "--repo-exclude", "*/old-*", registry, t.TempDir())
+	require.NoError(t, err)
+	assert.Contains(t, logs.String(), `from="docker://`+registry+`/team/app:latest"`)
+	assert.NotContains(t, logs.String(), `from="docker://`+registry+`/team/old-app:latest"`)
+	assert.NotContains(t, logs.String(), `from="docker://`+registry+`/other/app:latest"`)
+
+	// Without --repo-filter, all repositories not excluded are synced.
+	logs.Reset()
+	_, err = runSkopeo("--insecure-policy", "sync", "--src", "docker", "--dest", "dir", "--dry-run", "--src-tls-verify=false",
+		"--repo-exclude", "team/*", registry, t.TempDir())
+	require.NoError(t, err)
+	assert.Contains(t, logs.String(), `from="docker://`+registry+`/other/app:latest"`)
+	assert.NotContains(t, logs.String(), `from="docker://`+registry+`/team/app:latest"`)
+
+	_, err = runSkopeo("--insecure-policy", "sync", "--src", "docker", "--dest", "dir", "--dry-run", "--src-tls-verify=false",
+		"--repo-filter", "nothing/*", registry, t.TempDir())
+	assert.ErrorContains(t, err, "No repositories to sync found")
+	_, err = runSkopeo("--insecure-policy", "sync", "--src", "docker", "--dest", "dir", "--repo-filter", "team/*", registry+"/team/app", t.TempDir())
+	assert.ErrorContains(t, err, "SOURCE must be a registry")
+	_, err = runSkopeo("--insecure-policy", "sync", "--src", "dir", "--dest", "docker", "--repo-filter", "team/*", t.TempDir(), registry)
+	assert.ErrorContains(t, err, "--repo-filter and --repo-exclude require --src docker")
+	_, err = runSkopeo("--insecure-policy", "sync", "--src", "docker", "--dest", "dir", "--repo-exclude", "[", registry, t.TempDir())
+	assert.ErrorContains(t, err, `Invalid --repo-exclude "["`)
+}
+
+func TestSyncWriteIndex(t *testing.T) {
+	src := testDirImageWithBlobs(t)
+	indexFile := filepath.Join(t.TempDir(), "index.json")
+	logrus.SetOutput(io.Discard)
+	defer logrus.SetOutput(os.Stderr)
+
+	// Failures are recorded with --keep-going.
+	_, err := runSkopeo("--insecure-policy", "sync", "--src", "dir", "--dest", "docker", "--keep-going",
+		"--write-index", indexFile, src, "127.0.0.1:1/primary")
+	assert.ErrorContains(t, err, "Sync failed")
+	contents, err := os.ReadFile(indexFile)
+	require.NoError(t, err)
+	var index syncIndex
+	err = json.Unmarshal(contents, &index)
+	require.NoError(t, err)
+	require.Len(t, index.Images, 1)
+	assert.Equal(t, "dir:"+src, index.Images[0].Source)
+	assert.True(t, strings.HasPrefix(index.Images[0].Destination, "docker://127.0.0.1:1/primary/"))
+	assert.Empty(t, index.Images[0].Digest)
+	assert.NotEmpty(t, index.Images[0].Error)
+
+	out, err := runSkopeo("--insecure-policy", "sync", "--src", "dir", "--dest", "docker", "--dry-run",
+		"--write-index", indexFile, src, "example.com/primary")
+	assertTestFailed(t, out, err, "--write-index can not be used together with --dry-run")
+}
+
+func TestSyncIndexAddCopied(t *testing.T) {
+	src := testDirImageWithBlobs(t)
+	manifestBytes, err := os.ReadFile(filepath.Join(src, "manifest.json"))
+	require.NoError(t, err)
+	index := syncIndex{}
+	err = index.addCopied("dir:/src", "docker://example.com/dest:latest", manifestBytes)
+	require.NoError(t, err)
+	require.Len(t, index.Images, 1)
+	assert.Equal(t, digest.FromBytes(manifestBytes), index.Images[0].Digest)
+	assert.Equal(t, int64(len(manifestBytes)), index.Images[0].ManifestSize)
+	require.NotNil(t, index.Images[0].Size)
+	assert.Equal(t, int64(len(`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers","diff_ids":[]}}`)+len("not really a layer")), *index.Images[0].Size)
+
+	// Manifest lists have no total size.
+	err = index.addCopied("dir:/src", "docker://example.com/dest:latest", testIndex(t, imgspecv1.Platform{OS: "linux", Architecture: "amd64"}))
+	require.NoError(t, err)
+	assert.Nil(t, index.Images[1].Size)
+}
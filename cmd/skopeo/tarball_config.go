@@ -0,0 +1,30 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/containers/image/v5/tarball"
+	"github.com/containers/image/v5/types"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// applyTarballConfig sets the OCI image config in the file at path as the base of the config of the image created from ref,
+// which must be a tarball: reference. The tarball: transport fills in the created time, architecture and OS if the file does not set them,
+// and always replaces the rootfs and history, using the comment of the first history entry of the file, if any, for all layers.
+func applyTarballConfig(ref types.ImageReference, path string) error {
+	updater, ok := ref.(tarball.ConfigUpdater)
+	if !ok || ref.Transport() != tarball.Transport {
+		return fmt.Errorf("--tarball-config requires a %s: image, not %s:", tarball.Transport.Name(), ref.Transport().Name())
+	}
+	configJSON, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var config imgspecv1.Image
+	if err := json.Unmarshal(configJSON, &config); err != nil {
+		return fmt.Errorf("parsing the image config in %s: %w", path, err)
+	}
+	return updater.ConfigUpdate(config, nil)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/types"
+)
+
+// transportOptionSetter applies the value of a single --src-transport-opt or --dest-transport-opt to a types.SystemContext.
+type transportOptionSetter func(sys *types.SystemContext, value string) error
+
+// boolTransportOption returns a transportOptionSetter which parses a boolean value and passes it to set.
+func boolTransportOption(set func(sys *types.SystemContext, value bool)) transportOptionSetter {
+	return func(sys *types.SystemContext, value string) error {
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("expected a boolean value, got %q", value)
+		}
+		set(sys, v)
+		return nil
+	}
+}
+
+// transportOptions lists, for each transport name, the options accepted by --src-transport-opt and --dest-transport-opt.
+var transportOptions = map[string]map[string]transportOptionSetter{
+	"docker": {
+		"cert-dir": func(sys *types.SystemContext, value string) error {
+			sys.DockerCertPath = value
+			return nil
+		},
+		"tls-verify": boolTransportOption(func(sys *types.SystemContext, value bool) {
+			sys.DockerInsecureSkipTLSVerify = types.NewOptionalBool(!value)
+		}),
+		"user-agent": func(sys *types.SystemContext, value string) error {
+			sys.DockerRegistryUserAgent = value
+			return nil
+		},
+		"disable-v1-ping": boolTransportOption(func(sys *types.SystemContext, value bool) {
+			sys.DockerDisableV1Ping = value
+		}),
+		"log-mirror-choice": boolTransportOption(func(sys *types.SystemContext, value bool) {
+			sys.DockerLogMirrorChoice = value
+		}),
+		"precompute-digests": boolTransportOption(func(sys *types.SystemContext, value bool) {
+			sys.DockerRegistryPushPrecomputeDigests = value
+		}),
+	},
+	"docker-daemon": {
+		"host": func(sys *types.SystemContext, value string) error {
+			sys.DockerDaemonHost = value
+			return nil
+		},
+		"cert-dir": func(sys *types.SystemContext, value string) error {
+			sys.DockerDaemonCertPath = value
+			return nil
+		},
+		"tls-verify": boolTransportOption(func(sys *types.SystemContext, value bool) {
+			sys.DockerDaemonInsecureSkipTLSVerify = !value
+		}),
+	},
+	"docker-archive": {
+		"additional-tag": func(sys *types.SystemContext, value string) error {
+			ref, err := reference.ParseNormalizedNamed(value)
+			if err != nil {
+				return err
+			}
+			namedTagged, ok := ref.(reference.NamedTagged)
+			if !ok {
+				return fmt.Errorf("%q must be a tagged reference", value)
+			}
+			sys.DockerArchiveAdditionalTags = append(sys.DockerArchiveAdditionalTags, namedTagged)
+			return nil
+		},
+	},
+	"dir": {
+		"force-compress": boolTransportOption(func(sys *types.SystemContext, value bool) {
+			sys.DirForceCompress = value
+		}),
+		"force-decompress": boolTransportOption(func(sys *types.SystemContext, value bool) {
+			sys.DirForceDecompress = value
+		}),
+	},
+	"oci": {
+		"shared-blob-dir": func(sys *types.SystemContext, value string) error {
+			sys.OCISharedBlobDirPath = value
+			return nil
+		},
+		"accept-uncompressed-layers": boolTransportOption(func(sys *types.SystemContext, value bool) {
+			sys.OCIAcceptUncompressedLayers = value
+		}),
+	},
+	"oci-archive": {
+		"accept-uncompressed-layers": boolTransportOption(func(sys *types.SystemContext, value bool) {
+			sys.OCIAcceptUncompressedLayers = value
+		}),
+		"tmp-dir": func(sys *types.SystemContext, value string) error {
+			sys.BigFilesTemporaryDir = value
+			return nil
+		},
+	},
+}
+
+// applyTransportOptions applies options, in the KEY=VALUE format, which must be accepted by the transport named transportName, to sys.
+func applyTransportOptions(sys *types.SystemContext, transportName string, options []string) error {
+	if len(options) == 0 {
+		return nil
+	}
+	accepted, ok := transportOptions[transportName]
+	if !ok {
+		return fmt.Errorf("transport %q does not accept any transport options", transportName)
+	}
+	for _, option := range options {
+		key, value, ok := strings.Cut(option, "=")
+		if !ok {
+			return fmt.Errorf("invalid transport option %q, expected KEY=VALUE", option)
+		}
+		set, ok := accepted[key]
+		if !ok {
+			keys := make([]string, 0, len(accepted))
+			for k := range accepted {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			return fmt.Errorf("unknown option %q for transport %q, accepted options: %s", key, transportName, strings.Join(keys, ", "))
+		}
+		if err := set(sys, value); err != nil {
+			return fmt.Errorf("invalid value of transport option %q: %w", key, err)
+		}
+	}
+	return nil
+}
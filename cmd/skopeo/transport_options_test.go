@@ -0,0 +1,55 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyTransportOptions(t *testing.T) {
+	sys := &types.SystemContext{}
+	err := applyTransportOptions(sys, "docker", []string{"tls-verify=false", "user-agent=test/1.0"})
+	require.NoError(t, err)
+	assert.Equal(t, types.OptionalBoolTrue, sys.DockerInsecureSkipTLSVerify)
+	assert.Equal(t, "test/1.0", sys.DockerRegistryUserAgent)
+
+	sys = &types.SystemContext{}
+	err = applyTransportOptions(sys, "docker-archive", []string{"additional-tag=example.com/a:1", "additional-tag=example.com/b:2"})
+	require.NoError(t, err)
+	require.Len(t, sys.DockerArchiveAdditionalTags, 2)
+	assert.Equal(t, "example.com/b:2", sys.DockerArchiveAdditionalTags[1].String())
+
+	// No options are always accepted
+	err = applyTransportOptions(&types.SystemContext{}, "containers-storage", nil)
+	assert.NoError(t, err)
+
+	for _, c := range []struct {
+		transport string
+		options   []string
+		expected  string
+	}{
+		{"docker", []string{"tls-verify"}, "expected KEY=VALUE"},
+		{"docker", []string{"tls-verify=maybe"}, "expected a boolean value"},
+		{"oci", []string{"compress=true"}, "accepted options: accept-uncompressed-layers, shared-blob-dir"},
+		{"docker-archive", []string{"additional-tag=example.com/a"}, "must be a tagged reference"},
+		{"containers-storage", []string{"a=b"}, "does not accept any transport options"},
+	} {
+		err := applyTransportOptions(&types.SystemContext{}, c.transport, c.options)
+		assert.ErrorContains(t, err, c.expected, c.options)
+	}
+}
+
+func TestCopyTransportOptions(t *testing.T) {
+	src := testDirImageWithBlobs(t)
+	dest := t.TempDir()
+	_, err := runSkopeo("--insecure-policy", "copy", "--dest-transport-opt", "force-compress=true", "dir:"+src, "dir:"+dest)
+	require.NoError(t, err)
+	assert.NoFileExists(t, filepath.Join(dest, digest.FromString("not really a layer").Encoded())) // The layer created by testDirImageWithBlobs was compressed
+
+	out, err := runSkopeo("--insecure-policy", "copy", "--src-transport-opt", "unknown=1", "dir:"+src, "dir:"+t.TempDir())
+	assertTestFailed(t, out, err, "Invalid --src-transport-opt")
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/containers/image/v5/signature"
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/storage/pkg/homedir"
+	"github.com/containers/storage/pkg/ioutils"
+	"github.com/spf13/cobra"
+)
+
+// trustDefaultScope is the scope name used by the trust subcommands to refer to the policy-wide default requirements.
+const trustDefaultScope = "default"
+
+// trustPolicyContent is the raw content of a trust policy file.
+// Individual requirements are kept as raw JSON, so that entries not touched by the trust subcommands are preserved as is.
+type trustPolicyContent struct {
+	Default    json.RawMessage                       `json:"default"`
+	Transports map[string]map[string]json.RawMessage `json:"transports,omitempty"`
+}
+
+// trustRequirement contains the fields of a policy requirement shown by (skopeo trust show).
+type trustRequirement struct {
+	Type     string   `json:"type"`
+	KeyPath  string   `json:"keyPath,omitempty"`
+	KeyPaths []string `json:"keyPaths,omitempty"`
+	KeyData  string   `json:"keyData,omitempty"`
+}
+
+func trustCmd(global *globalOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "trust",
+		Short: "Manage the trust policy used for signature verification",
+		Long: `Manage the trust policy file (policy.json) used for signature verification.
+
+The file set by the global --policy option is used if specified;
+otherwise, the same file which would be used for signature verification.`,
+		Example: `skopeo trust set --scope registry.example.com/repo --key /path/to/key.gpg signed
+skopeo trust show
+skopeo trust remove --scope registry.example.com/repo`,
+	}
+	cmd.AddCommand(
+		trustSetCmd(global),
+		trustShowCmd(global),
+		trustRemoveCmd(global),
+	)
+	return cmd
+}
+
+type trustSetOptions struct {
+	global    *globalOptions
+	transport string
+	scope     string
+	keys      []string
+}
+
+func trustSetCmd(global *globalOptions) *cobra.Command {
+	opts := trustSetOptions{global: global}
+	cmd := &cobra.Command{
+		Use:   "set [command options] --scope SCOPE accept|reject|signed|sigstore",
+		Short: "Set the trust requirement for a scope",
+		Long: `Set the trust requirement for a scope, replacing any existing requirements for that scope.
+
+accept:   accept any image
+reject:   reject any image
+signed:   require a simple signing signature made by one of the GPG keys specified using --key
+sigstore: require a sigstore signature made by the public key specified using --key`,
+		RunE:    commandAction(opts.run),
+		Example: `skopeo trust set --scope registry.example.com/repo --key /path/to/key.gpg signed`,
+	}
+	adjustUsage(cmd)
+	flags := cmd.Flags()
+	flags.StringVar(&opts.transport, "transport", "docker", "Transport `NAME` the scope applies to")
+	flags.StringVar(&opts.scope, "scope", "", "Policy `SCOPE` to set (e.g. a registry or repository), or \"default\" for the policy-wide default")
+	flags.StringSliceVar(&opts.keys, "key", []string{}, "Path to a public key `FILE` used to verify signatures")
+	return cmd
+}
+
+func (opts *trustSetOptions) run(args []string, stdout io.Writer) error {
+	if len(args) != 1 || opts.scope == "" {
+		return errors.New("Usage: skopeo trust set --scope SCOPE accept|reject|signed|sigstore")
+	}
+	requirement, err := newTrustRequirement(args[0], opts.keys)
+	if err != nil {
+		return err
+	}
+	rawRequirements, err := json.Marshal(signature.PolicyRequirements{requirement})
+	if err != nil {
+		return err
+	}
+
+	path := opts.global.trustPolicyPath()
+	policy, err := loadTrustPolicy(path)
+	if err != nil {
+		return err
+	}
+	if opts.scope == trustDefaultScope {
+		policy.Default = rawRequirements
+	} else {
+		if err := validateTrustScope(opts.transport, opts.scope); err != nil {
+			return err
+		}
+		if policy.Transports == nil {
+			policy.Transports = map[string]map[string]json.RawMessage{}
+		}
+		if policy.Transports[opts.transport] == nil {
+			policy.Transports[opts.transport] = map[string]json.RawMessage{}
+		}
+		policy.Transports[opts.transport][opts.scope] = rawRequirements
+	}
+	return writeTrustPolicy(path, policy)
+}
+
+// newTrustRequirement returns a policy requirement of the user-specified typeName, using keys.
+func newTrustRequirement(typeName string, keys []string) (signature.PolicyRequirement, error) {
+	switch typeName {
+	case "accept", "reject":
+		if len(keys) != 0 {
+			return nil, fmt.Errorf("--key can not be used with %q", typeName)
+		}
+		if typeName == "accept" {
+			return signature.NewPRInsecureAcceptAnything(), nil
+		}
+		return signature.NewPRReject(), nil
+	case "signed":
+		if len(keys) == 0 {
+			return nil, errors.New(`At least one --key is required for "signed"`)
+		}
+		return signature.NewPRSignedByKeyPaths(signature.SBKeyTypeGPGKeys, absoluteKeyPaths(keys), signature.NewPRMMatchRepoDigestOrExact())
+	case "sigstore":
+		if len(keys) != 1 {
+			return nil, errors.New(`Exactly one --key is required for "sigstore"`)
+		}
+		return signature.NewPRSigstoreSignedKeyPath(absoluteKeyPaths(keys)[0], signature.NewPRMMatchRepoDigestOrExact())
+	default:
+		return nil, fmt.Errorf("Unknown trust type %q, expected accept, reject, signed or sigstore", typeName)
+	}
+}
+
+// absoluteKeyPaths returns keys converted to absolute paths, so that the policy does not depend on the current directory.
+func absoluteKeyPaths(keys []string) []string {
+	res := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if abs, err := filepath.Abs(key); err == nil {
+			key = abs
+		}
+		res = append(res, key)
+	}
+	return res
+}
+
+// validateTrustScope returns an error if scope is not a valid policy configuration scope for transportName.
+func validateTrustScope(transportName, scope string) error {
+	transport := transports.Get(transportName)
+	if transport == nil {
+		return fmt.Errorf("Unknown transport %q", transportName)
+	}
+	if err := transport.ValidatePolicyConfigurationScope(scope); err != nil {
+		return fmt.Errorf("Invalid scope %q for transport %q: %w", scope, transportName, err)
+	}
+	return nil
+}
+
+type trustShowOptions struct {
+	global *globalOptions
+}
+
+func trustShowCmd(global *globalOptions) *cobra.Command {
+	opts := trustShowOptions{global: global}
+	cmd := &cobra.Command{
+		Use:     "show",
+		Short:   "Show the trust policy",
+		RunE:    commandAction(opts.run),
+		Example: `skopeo trust show`,
+	}
+	adjustUsage(cmd)
+	return cmd
+}
+
+func (opts *trustShowOptions) run(args []string, stdout io.Writer) error {
+	if len(args) != 0 {
+		return errors.New("Usage: skopeo trust show")
+	}
+	policy, err := loadTrustPolicy(opts.global.trustPolicyPath())
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "TRANSPORT\tSCOPE\tTYPE\tKEYS")
+	typeName, keys, err := describeTrustRequirements(policy.Default)
+	if err != nil {
+		return fmt.Errorf("Invalid default requirements: %w", err)
+	}
+	fmt.Fprintf(w, "\t%s\t%s\t%s\n", trustDefaultScope, typeName, keys)
+	transportNames := make([]string, 0, len(policy.Transports))
+	for transportName := range policy.Transports {
+		transportNames = append(transportNames, transportName)
+	}
+	sort.Strings(transportNames)
+	for _, transportName := range transportNames {
+		scopes := make([]string, 0, len(policy.Transports[transportName]))
+		for scope := range policy.Transports[transportName] {
+			scopes = append(scopes, scope)
+		}
+		sort.Strings(scopes)
+		for _, scope := range scopes {
+			typeName, keys, err := describeTrustRequirements(policy.Transports[transportName][scope])
+			if err != nil {
+				return fmt.Errorf("Invalid requirements for %s scope %q: %w", transportName, scope, err)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", transportName, scope, typeName, keys)
+		}
+	}
+	return w.Flush()
+}
+
+// describeTrustRequirements returns a human-readable description of the types and keys of requirements in rawRequirements.
+func describeTrustRequirements(rawRequirements json.RawMessage) (string, string, error) {
+	var requirements []trustRequirement
+	if err := json.Unmarshal(rawRequirements, &requirements); err != nil {
+		return "", "", err
+	}
+	typeNames := []string{}
+	keys := []string{}
+	for _, r := range requirements {
+		typeNames = append(typeNames, r.Type)
+		if r.KeyPath != "" {
+			keys = append(keys, r.KeyPath)
+		}
+		keys = append(keys, r.KeyPaths...)
+		if r.KeyData != "" {
+			keys = append(keys, "(inline key data)")
+		}
+	}
+	return strings.Join(typeNames, ","), strings.Join(keys, ","), nil
+}
+
+type trustRemoveOptions struct {
+	global    *globalOptions
+	transport string
+	scope     string
+}
+
+func trustRemoveCmd(global *globalOptions) *cobra.Command {
+	opts := trustRemoveOptions{global: global}
+	cmd := &cobra.Command{
+		Use:     "remove [command options] --scope SCOPE",
+		Short:   "Remove the trust requirements for a scope",
+		RunE:    commandAction(opts.run),
+		Example: `skopeo trust remove --scope registry.example.com/repo`,
+	}
+	adjustUsage(cmd)
+	flags := cmd.Flags()
+	flags.StringVar(&opts.transport, "transport", "docker", "Transport `NAME` the scope applies to")
+	flags.StringVar(&opts.scope, "scope", "", "Policy `SCOPE` to remove")
+	return cmd
+}
+
+func (opts *trustRemoveOptions) run(args []string, stdout io.Writer) error {
+	if len(args) != 0 || opts.scope == "" {
+		return errors.New("Usage: skopeo trust remove --scope SCOPE")
+	}
+	if opts.scope == trustDefaultScope {
+		return errors.New("The policy-wide default requirements can not be removed, only replaced using (skopeo trust set)")
+	}
+
+	path := opts.global.trustPolicyPath()
+	policy, err := loadTrustPolicy(path)
+	if err != nil {
+		return err
+	}
+	if _, ok := policy.Transports[opts.transport][opts.scope]; !ok {
+		return fmt.Errorf("No requirements for %s scope %q in %q", opts.transport, opts.scope, path)
+	}
+	delete(policy.Transports[opts.transport], opts.scope)
+	if len(policy.Transports[opts.transport]) == 0 {
+		delete(policy.Transports, opts.transport)
+	}
+	return writeTrustPolicy(path, policy)
+}
+
+// trustPolicyPath returns the path of the trust policy file managed by the trust subcommands.
+// Without --policy, this follows the lookup used by signature.DefaultPolicy.
+func (opts *globalOptions) trustPolicyPath() string {
+	if opts.policyPath != "" {
+		return opts.policyPath
+	}
+	userPolicyPath := filepath.Join(homedir.Get(), ".config", "containers", "policy.json")
+	if _, err := os.Stat(userPolicyPath); err == nil {
+		return userPolicyPath
+	}
+	return "/etc/containers/policy.json"
+}
+
+// loadTrustPolicy reads the trust policy at path.
+func loadTrustPolicy(path string) (*trustPolicyContent, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	// Parse using the verification code first, to report invalid policies the same way signature verification would.
+	if _, err := signature.NewPolicyFromBytes(contents); err != nil {
+		return nil, fmt.Errorf("invalid policy in %q: %w", path, err)
+	}
+	var policy trustPolicyContent
+	if err := json.Unmarshal(contents, &policy); err != nil {
+		return nil, fmt.Errorf("invalid policy in %q: %w", path, err)
+	}
+	return &policy, nil
+}
+
+// writeTrustPolicy validates policy and atomically replaces the trust policy at path.
+func writeTrustPolicy(path string, policy *trustPolicyContent) error {
+	contents, err := json.MarshalIndent(policy, "", "    ")
+	if err != nil {
+		return err
+	}
+	contents = append(contents, '\n')
+	if _, err := signature.NewPolicyFromBytes(contents); err != nil {
+		return fmt.Errorf("internal error: generated an invalid policy: %w", err)
+	}
+	perm := os.FileMode(0644)
+	if fi, err := os.Stat(path); err == nil {
+		perm = fi.Mode().Perm()
+	}
+	if err := ioutils.AtomicWriteFile(path, contents, perm); err != nil {
+		return fmt.Errorf("writing %q: %w", path, err)
+	}
+	return nil
+}
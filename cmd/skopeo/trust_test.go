@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/signature"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrust(t *testing.T) {
+	dir := t.TempDir()
+	policyPath := filepath.Join(dir, "policy.json")
+	err := os.WriteFile(policyPath, []byte(`{"default":[{"type":"reject"}],"transports":{"docker-daemon":{"":[{"type":"insecureAcceptAnything"}]}}}`), 0o600)
+	require.NoError(t, err)
+	keyPath := filepath.Join(dir, "key.gpg")
+
+	out, err := runSkopeo("--policy", policyPath, "trust", "set", "--scope", "registry.example.com/repo", "--key", keyPath, "signed")
+	require.NoError(t, err)
+	assert.Empty(t, out)
+	_, err = runSkopeo("--policy", policyPath, "trust", "set", "--scope", "default", "accept")
+	require.NoError(t, err)
+	policy, err := signature.NewPolicyFromFile(policyPath)
+	require.NoError(t, err)
+	expectedSigned, err := signature.NewPRSignedByKeyPaths(signature.SBKeyTypeGPGKeys, []string{keyPath}, signature.NewPRMMatchRepoDigestOrExact())
+	require.NoError(t, err)
+	assert.Equal(t, &signature.Policy{
+		Default: signature.PolicyRequirements{signature.NewPRInsecureAcceptAnything()},
+		Transports: map[string]signature.PolicyTransportScopes{
+			"docker":        {"registry.example.com/repo": signature.PolicyRequirements{expectedSigned}},
+			"docker-daemon": {"": signature.PolicyRequirements{signature.NewPRInsecureAcceptAnything()}},
+		},
+	}, policy)
+	fi, err := os.Stat(policyPath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), fi.Mode().Perm())
+
+	out, err = runSkopeo("--policy", policyPath, "trust", "show")
+	require.NoError(t, err)
+	assert.Equal(t, "TRANSPORT      SCOPE                      TYPE                    KEYS\n"+
+		"               default                    insecureAcceptAnything  \n"+
+		"docker         registry.example.com/repo  signedBy                "+keyPath+"\n"+
+		"docker-daemon                             insecureAcceptAnything  \n", out)
+
+	_, err = runSkopeo("--policy", policyPath, "trust", "remove", "--scope", "registry.example.com/repo")
+	require.NoError(t, err)
+	policy, err = signature.NewPolicyFromFile(policyPath)
+	require.NoError(t, err)
+	assert.NotContains(t, policy.Transports, "docker")
+
+	for _, c := range []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"set", "accept"}, "Usage"},
+		{[]string{"set", "--scope", "registry.example.com", "signed"}, "At least one --key"},
+		{[]string{"set", "--scope", "registry.example.com", "--key", "a", "--key", "b", "sigstore"}, "Exactly one --key"},
+		{[]string{"set", "--scope", "registry.example.com", "--key", keyPath, "accept"}, "--key can not be used"},
+		{[]string{"set", "--scope", "registry.example.com", "unknown"}, "Unknown trust type"},
+		{[]string{"set", "--scope", "registry.example.com", "--transport", "unknown", "accept"}, "Unknown transport"},
+		{[]string{"set", "--transport", "oci", "--scope", "relative/path", "accept"}, "Invalid scope"},
+		{[]string{"remove", "--scope", "default"}, "can not be removed"},
+		{[]string{"remove", "--scope", "registry.example.com/repo"}, "No requirements"},
+	} {
+		out, err := runSkopeo(append([]string{"--policy", policyPath, "trust"}, c.args...)...)
+		assertTestFailed(t, out, err, c.expected)
+	}
+
+	out, err = runSkopeo("--policy", filepath.Join(dir, "does-not-exist.json"), "trust", "show")
+	assertTestFailed(t, out, err, "no such file or directory")
+}
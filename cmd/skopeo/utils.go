@@ -6,11 +6,15 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
 
 	commonFlag "github.com/containers/common/pkg/flag"
 	"github.com/containers/common/pkg/retry"
 	"github.com/containers/image/v5/directory"
+	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/docker/archive"
+	"github.com/containers/image/v5/docker/reference"
 	"github.com/containers/image/v5/manifest"
 	"github.com/containers/image/v5/pkg/compression"
 	"github.com/containers/image/v5/transports/alltransports"
@@ -19,6 +23,7 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
+	"golang.org/x/sync/semaphore"
 	"golang.org/x/term"
 )
 
@@ -120,6 +125,7 @@ type dockerImageOptions struct {
 	password            commonFlag.OptionalString  // password for accessing a registry
 	registryToken       commonFlag.OptionalString  // token to be used directly as a Bearer token when accessing the registry
 	dockerCertPath      string                     // A directory using Docker-like *.{crt,cert,key} files for connecting to a registry or a daemon
+	caFile              string                     // A PEM file with CA certificates to trust when connecting to a registry, in addition to dockerCertPath
 	tlsVerify           commonFlag.OptionalBool    // Require HTTPS and verify certificates (for docker: and docker-daemon:)
 	noCreds             bool                       // Access the registry anonymously
 }
@@ -159,6 +165,7 @@ func dockerImageFlags(global *globalOptions, shared *sharedImageOptions, depreca
 	}
 	fs.Var(commonFlag.NewOptionalStringValue(&flags.registryToken), flagPrefix+"registry-token", "Provide a Bearer token for accessing the registry")
 	fs.StringVar(&flags.dockerCertPath, flagPrefix+"cert-dir", "", "use certificates at `PATH` (*.crt, *.cert, *.key) to connect to the registry or daemon")
+	fs.StringVar(&flags.caFile, flagPrefix+"ca-file", "", "trust CA certificates in the PEM file at `PATH` when connecting to the registry")
 	commonFlag.OptionalBoolFlag(&fs, &flags.tlsVerify, flagPrefix+"tls-verify", "require HTTPS and verify certificates when talking to the container registry or daemon")
 	fs.BoolVar(&flags.noCreds, flagPrefix+"no-creds", false, "Access the registry anonymously")
 	return fs, &flags
@@ -175,6 +182,42 @@ func imageFlags(global *globalOptions, shared *sharedImageOptions, deprecatedTLS
 	return fs, opts
 }
 
+// hostBlobCopyLimiter limits the number of concurrent blob copies to each destination host,
+// across all copy operations using the same hostBlobCopyLimiter.
+type hostBlobCopyLimiter struct {
+	maxPerHost int64                          // Maximum number of concurrent blob copies to a single host, 0 for no limit
+	semaphores map[string]*semaphore.Weighted // Keyed by host
+}
+
+// hostBlobCopyLimiterFlags prepares the CLI flag writing into hostBlobCopyLimiter, and the managed hostBlobCopyLimiter structure.
+func hostBlobCopyLimiterFlags() (pflag.FlagSet, *hostBlobCopyLimiter) {
+	limiter := hostBlobCopyLimiter{semaphores: map[string]*semaphore.Weighted{}}
+	fs := pflag.FlagSet{}
+	fs.Int64Var(&limiter.maxPerHost, "dest-blob-concurrency-per-host", 0, "Limit concurrent blob copies to a single destination host to `N`; this does not limit HTTP connections (default is no limit)")
+	return fs, &limiter
+}
+
+// semaphoreFor returns a semaphore to use as copy.Options.ConcurrentBlobCopiesSemaphore when copying to destRef,
+// or nil if there is no limit.
+func (l *hostBlobCopyLimiter) semaphoreFor(destRef types.ImageReference) (*semaphore.Weighted, error) {
+	if l.maxPerHost < 0 {
+		return nil, fmt.Errorf("invalid --dest-blob-concurrency-per-host value %d", l.maxPerHost)
+	}
+	if l.maxPerHost == 0 {
+		return nil, nil
+	}
+	host := destRef.Transport().Name() + ":" // Local destinations are all keyed by the transport.
+	if dockerRef := destRef.DockerReference(); dockerRef != nil && destRef.Transport().Name() == docker.Transport.Name() {
+		host = reference.Domain(dockerRef)
+	}
+	sem, ok := l.semaphores[host]
+	if !ok {
+		sem = semaphore.NewWeighted(l.maxPerHost)
+		l.semaphores[host] = sem
+	}
+	return sem, nil
+}
+
 func retryFlags() (pflag.FlagSet, *retry.Options) {
 	opts := retry.Options{}
 	fs := pflag.FlagSet{}
@@ -189,6 +232,13 @@ func (opts *imageOptions) newSystemContext() (*types.SystemContext, error) {
 	//  imageOptions option overrides the instance if both are present.
 	ctx := opts.global.newSystemContext()
 	ctx.DockerCertPath = opts.dockerCertPath
+	if opts.caFile != "" {
+		certDir, err := opts.global.certDirWithCAFile(opts.dockerCertPath, opts.caFile)
+		if err != nil {
+			return nil, err
+		}
+		ctx.DockerCertPath = certDir
+	}
 	ctx.OCISharedBlobDirPath = opts.sharedBlobDir
 	ctx.AuthFilePath = opts.shared.authFilePath
 	ctx.DockerDaemonHost = opts.dockerDaemonHost
@@ -196,6 +246,13 @@ func (opts *imageOptions) newSystemContext() (*types.SystemContext, error) {
 	if opts.dockerImageOptions.authFilePath.Present() {
 		ctx.AuthFilePath = opts.dockerImageOptions.authFilePath.Value()
 	}
+	if ctx.AuthFilePath != "" {
+		authFilePath, err := opts.global.authFilePathForKubernetesSecret(ctx.AuthFilePath)
+		if err != nil {
+			return nil, err
+		}
+		ctx.AuthFilePath = authFilePath
+	}
 	if opts.deprecatedTLSVerify != nil && opts.deprecatedTLSVerify.tlsVerify.Present() {
 		// If both this deprecated option and a non-deprecated option is present, we use the latter value.
 		ctx.DockerInsecureSkipTLSVerify = types.NewOptionalBool(!opts.deprecatedTLSVerify.tlsVerify.Value())
@@ -244,6 +301,17 @@ func (opts *imageOptions) newSystemContext() (*types.SystemContext, error) {
 	return ctx, nil
 }
 
+// createSharedBlobDir creates opts.sharedBlobDir, including any missing parents, if it was set and does not exist yet.
+func (opts *imageOptions) createSharedBlobDir() error {
+	if opts.sharedBlobDir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(opts.sharedBlobDir, 0o755); err != nil {
+		return fmt.Errorf("creating shared blob directory: %w", err)
+	}
+	return nil
+}
+
 // imageDestOptions is a superset of imageOptions specialized for image destinations.
 // Every user should call imageDestOptions.warnAboutIneffectiveOptions() as part of handling the CLI
 type imageDestOptions struct {
@@ -263,7 +331,7 @@ func imageDestFlags(global *globalOptions, shared *sharedImageOptions, deprecate
 	opts := imageDestOptions{imageOptions: genericOptions, imageDestFlagPrefix: flagPrefix}
 	fs := pflag.FlagSet{}
 	fs.AddFlagSet(&genericFlags)
-	fs.BoolVar(&opts.dirForceCompression, flagPrefix+"compress", false, "Compress tarball image layers when saving to directory using the 'dir' transport. (default is same compression type as source)")
+	fs.BoolVar(&opts.dirForceCompression, flagPrefix+"compress", false, "Compress tarball image layers when saving to directory using the 'dir' transport, or to a 'docker-archive' file. (default is same compression type as source, or uncompressed for 'docker-archive')")
 	fs.BoolVar(&opts.dirForceDecompression, flagPrefix+"decompress", false, "Decompress tarball image layers when saving to directory using the 'dir' transport. (default is same compression type as source)")
 	fs.BoolVar(&opts.ociAcceptUncompressedLayers, flagPrefix+"oci-accept-uncompressed-layers", false, "Allow uncompressed image layers when saving to an OCI image using the 'oci' transport. (default is to compress things that aren't compressed)")
 	fs.StringVar(&opts.compressionFormat, flagPrefix+"compress-format", "", "`FORMAT` to use for the compression")
@@ -301,16 +369,52 @@ func (opts *imageDestOptions) newSystemContext() (*types.SystemContext, error) {
 // warnAboutIneffectiveOptions warns if any ineffective option was set by the user
 // Every user should call this as part of handling the CLI
 func (opts *imageDestOptions) warnAboutIneffectiveOptions(destTransport types.ImageTransport) {
+	if opts.dirForceCompression && destTransport.Name() != directory.Transport.Name() && destTransport.Name() != archive.Transport.Name() {
+		logrus.Warnf("--%s can only be used if the destination transport is 'dir' or 'docker-archive'", opts.imageDestFlagPrefix+"compress")
+	}
 	if destTransport.Name() != directory.Transport.Name() {
-		if opts.dirForceCompression {
-			logrus.Warnf("--%s can only be used if the destination transport is 'dir'", opts.imageDestFlagPrefix+"compress")
-		}
 		if opts.dirForceDecompression {
 			logrus.Warnf("--%s can only be used if the destination transport is 'dir'", opts.imageDestFlagPrefix+"decompress")
 		}
 	}
 }
 
+// certDirWithCAFile returns a path to a directory usable as types.SystemContext.DockerCertPath,
+// containing the certificates and keys in certDir (if not ""), and the CA certificates in caFile.
+func (opts *globalOptions) certDirWithCAFile(certDir, caFile string) (string, error) {
+	caCerts, err := os.ReadFile(caFile)
+	if err != nil {
+		return "", fmt.Errorf("reading CA file: %w", err)
+	}
+	dir, err := opts.newTemporaryDir("skopeo-certs")
+	if err != nil {
+		return "", err
+	}
+	if certDir != "" {
+		entries, err := os.ReadDir(certDir)
+		if err != nil {
+			return "", fmt.Errorf("reading certificate directory: %w", err)
+		}
+		for _, e := range entries {
+			if e.IsDir() {
+				continue
+			}
+			src, err := filepath.Abs(filepath.Join(certDir, e.Name()))
+			if err != nil {
+				return "", err
+			}
+			if err := os.Symlink(src, filepath.Join(dir, e.Name())); err != nil {
+				return "", err
+			}
+		}
+	}
+	// The name is unlikely to collide with any file name in certDir; it must end with .crt
+	if err := os.WriteFile(filepath.Join(dir, "skopeo-ca-file.crt"), caCerts, 0o600); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
 func parseCreds(creds string) (string, string, error) {
 	if creds == "" {
 		return "", "", errors.New("credentials can't be empty")
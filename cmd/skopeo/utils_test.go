@@ -2,9 +2,12 @@ package main
 
 import (
 	"errors"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/transports/alltransports"
 	"github.com/containers/image/v5/types"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/spf13/cobra"
@@ -425,3 +428,84 @@ func TestImageOptionsAuthfileOverride(t *testing.T) {
 		}, res)
 	}
 }
+
+func TestHostBlobCopyLimiter(t *testing.T) {
+	parse := func(t *testing.T, args ...string) *hostBlobCopyLimiter {
+		_, cmd := fakeGlobalOptions(t, []string{})
+		flags, limiter := hostBlobCopyLimiterFlags()
+		cmd.Flags().AddFlagSet(&flags)
+		err := cmd.ParseFlags(args)
+		require.NoError(t, err)
+		return limiter
+	}
+	ref1, err := alltransports.ParseImageName("docker://registry1.example.com/a:latest")
+	require.NoError(t, err)
+	ref2, err := alltransports.ParseImageName("docker://registry1.example.com/b:latest")
+	require.NoError(t, err)
+	ref3, err := alltransports.ParseImageName("docker://registry2.example.com/a:latest")
+	require.NoError(t, err)
+
+	// No limit by default
+	limiter := parse(t)
+	sem, err := limiter.semaphoreFor(ref1)
+	require.NoError(t, err)
+	assert.Nil(t, sem)
+
+	// Semaphores are shared per host
+	limiter = parse(t, "--dest-blob-concurrency-per-host", "2")
+	sem1, err := limiter.semaphoreFor(ref1)
+	require.NoError(t, err)
+	require.NotNil(t, sem1)
+	sem2, err := limiter.semaphoreFor(ref2)
+	require.NoError(t, err)
+	assert.Same(t, sem1, sem2)
+	sem3, err := limiter.semaphoreFor(ref3)
+	require.NoError(t, err)
+	assert.NotSame(t, sem1, sem3)
+	assert.True(t, sem1.TryAcquire(2))
+	assert.False(t, sem2.TryAcquire(1))
+
+	// Invalid value
+	limiter = parse(t, "--dest-blob-concurrency-per-host", "-1")
+	_, err = limiter.semaphoreFor(ref1)
+	assert.Error(t, err)
+}
+
+func TestCertDirWithCAFile(t *testing.T) {
+	opts, _ := fakeGlobalOptions(t, []string{})
+	certDir := t.TempDir()
+	err := os.WriteFile(filepath.Join(certDir, "client.cert"), []byte("client cert"), 0o600)
+	require.NoError(t, err)
+	caFile := filepath.Join(t.TempDir(), "bundle.pem")
+	err = os.WriteFile(caFile, []byte("CA certs"), 0o600)
+	require.NoError(t, err)
+
+	// Only a CA file
+	dir, err := opts.certDirWithCAFile("", caFile)
+	require.NoError(t, err)
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	contents, err := os.ReadFile(filepath.Join(dir, entries[0].Name()))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("CA certs"), contents)
+	assert.Equal(t, ".crt", filepath.Ext(entries[0].Name()))
+
+	// Combined with a certificate directory
+	dir, err = opts.certDirWithCAFile(certDir, caFile)
+	require.NoError(t, err)
+	contents, err = os.ReadFile(filepath.Join(dir, "client.cert"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("client cert"), contents)
+
+	// Errors
+	_, err = opts.certDirWithCAFile("", "/this/does/not/exist")
+	assert.Error(t, err)
+	_, err = opts.certDirWithCAFile("/this/does/not/exist", caFile)
+	assert.Error(t, err)
+
+	// The temporary directories are removed on exit
+	opts.cleanUp()
+	_, err = os.Stat(dir)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// composefsHasACLFlag is LCFS_EROFS_FLAGS_HAS_ACL, in the flags of the composefs EROFS header.
+const composefsHasACLFlag = 1 << 0
+
+type verifyComposefsOptions struct {
+	expected string // The expected fs-verity digest of the blob, in hexadecimal; not checked if empty
+}
+
+func verifyComposefsCmd() *cobra.Command {
+	var opts verifyComposefsOptions
+	cmd := &cobra.Command{
+		Use:     "verify-composefs [command options] FILE",
+		Short:   "Measure the fs-verity digest of a composefs blob, and compare it with the expected value",
+		RunE:    commandAction(opts.run),
+		Example: "skopeo verify-composefs --expected 1f1b7bd3b0bc3bbd1c2f7ed6f3d6cbb2e2b5b2d17e6e5f3a6bb1e7e3b4c9d8a7 /var/lib/containers/storage/overlay/LAYER/composefs-data/composefs.blob",
+	}
+	adjustUsage(cmd)
+	flags := cmd.Flags()
+	flags.StringVar(&opts.expected, "expected", "", "Fail unless the fs-verity digest of FILE is `DIGEST` (hexadecimal, optionally prefixed with the algorithm, e.g. sha256:)")
+	return cmd
+}
+
+// composefsHasACL returns true if the composefs EROFS blob at path has ACLs enabled.
+// Like the composefs support in containers/storage, this does not validate the blob.
+func composefsHasACL(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	// struct lcfs_erofs_header_s { uint32_t magic; uint32_t version; uint32_t flags; … }
+	flags := make([]byte, 4)
+	if _, err := f.ReadAt(flags, 8); err != nil {
+		if errors.Is(err, io.EOF) {
+			return false, fmt.Errorf("%s is too small to be a composefs blob", path)
+		}
+		return false, err
+	}
+	return binary.LittleEndian.Uint32(flags)&composefsHasACLFlag != 0, nil
+}
+
+func (opts *verifyComposefsOptions) run(args []string, stdout io.Writer) error {
+	if len(args) != 1 {
+		return errors.New("Usage: skopeo verify-composefs [--expected DIGEST] file")
+	}
+	blobPath := args[0]
+
+	hasACL, err := composefsHasACL(blobPath)
+	if err != nil {
+		return fmt.Errorf("Error reading composefs blob %s: %w", blobPath, err)
+	}
+	algorithm, measured, err := measureVerity(blobPath)
+	if err != nil {
+		return fmt.Errorf("Error measuring the fs-verity digest of %s: %w", blobPath, err)
+	}
+	acls := "disabled"
+	if hasACL {
+		acls = "enabled"
+	}
+	fmt.Fprintf(stdout, "fs-verity digest: %s:%s\nACLs: %s\n", algorithm, measured, acls)
+
+	if opts.expected != "" {
+		expected := strings.ToLower(opts.expected)
+		if expectedAlgorithm, hex, ok := strings.Cut(expected, ":"); ok {
+			if expectedAlgorithm != algorithm {
+				return fmt.Errorf("fs-verity digest of %s uses %s, expected %s", blobPath, algorithm, expectedAlgorithm)
+			}
+			expected = hex
+		}
+		if expected != measured {
+			return fmt.Errorf("fs-verity digest of %s is %s, expected %s", blobPath, measured, expected)
+		}
+		fmt.Fprintln(stdout, "fs-verity digest matches")
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// fsVerityBlockSize is the fs-verity block size used by enableVerity.
+const fsVerityBlockSize = 4096
+
+// measureVerity returns the name of the fs-verity digest algorithm of the file at path, and its digest in hexadecimal.
+func measureVerity(path string) (string, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+	var digest struct {
+		unix.FsverityDigest
+		Buf [64]byte
+	}
+	digest.Size = uint16(len(digest.Buf))
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, f.Fd(), uintptr(unix.FS_IOC_MEASURE_VERITY), uintptr(unsafe.Pointer(&digest))); errno != 0 {
+		if errno == unix.ENODATA {
+			return "", "", fmt.Errorf("fs-verity is not enabled for the file")
+		}
+		return "", "", fmt.Errorf("fs-verity is not supported: %w", errno)
+	}
+	var algorithm string
+	switch digest.Algorithm {
+	case unix.FS_VERITY_HASH_ALG_SHA256:
+		algorithm = "sha256"
+	case unix.FS_VERITY_HASH_ALG_SHA512:
+		algorithm = "sha512"
+	default:
+		return "", "", fmt.Errorf("unknown fs-verity algorithm %d", digest.Algorithm)
+	}
+	return algorithm, fmt.Sprintf("%x", digest.Buf[:digest.Size]), nil
+}
+
+// enableVerity enables fs-verity, using SHA-256 and 4096-byte blocks, for the file at path, unless it is already enabled.
+func enableVerity(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	arg := unix.FsverityEnableArg{
+		Version:        1,
+		Hash_algorithm: unix.FS_VERITY_HASH_ALG_SHA256,
+		Block_size:     fsVerityBlockSize,
+	}
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, f.Fd(), uintptr(unix.FS_IOC_ENABLE_VERITY), uintptr(unsafe.Pointer(&arg))); errno != 0 && errno != unix.EEXIST {
+		return fmt.Errorf("fs-verity is not supported: %w", errno)
+	}
+	return nil
+}
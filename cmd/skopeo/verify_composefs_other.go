@@ -0,0 +1,16 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import "errors"
+
+// measureVerity returns the name of the fs-verity digest algorithm of the file at path, and its digest in hexadecimal.
+func measureVerity(path string) (string, string, error) {
+	return "", "", errors.New("fs-verity is only supported on Linux")
+}
+
+// enableVerity enables fs-verity, using SHA-256 and 4096-byte blocks, for the file at path, unless it is already enabled.
+func enableVerity(path string) error {
+	return errors.New("fs-verity is only supported on Linux")
+}
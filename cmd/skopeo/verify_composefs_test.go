@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComposefsHasACL(t *testing.T) {
+	dir := t.TempDir()
+	for _, c := range []struct {
+		flags    byte
+		expected bool
+	}{
+		{0, false},
+		{composefsHasACLFlag, true},
+		{0x02, false},
+	} {
+		path := filepath.Join(dir, "blob")
+		header := make([]byte, 32)
+		header[8] = c.flags
+		err := os.WriteFile(path, header, 0o644)
+		require.NoError(t, err)
+		res, err := composefsHasACL(path)
+		require.NoError(t, err)
+		assert.Equal(t, c.expected, res)
+	}
+
+	path := filepath.Join(dir, "short")
+	err := os.WriteFile(path, []byte("short"), 0o644)
+	require.NoError(t, err)
+	_, err = composefsHasACL(path)
+	assert.ErrorContains(t, err, "too small")
+}
+
+func TestVerifyComposefs(t *testing.T) {
+	for _, args := range [][]string{
+		{},
+		{"a1", "a2"},
+	} {
+		out, err := runSkopeo(append([]string{"verify-composefs"}, args...)...)
+		assertTestFailed(t, out, err, "Usage")
+	}
+
+	out, err := runSkopeo("verify-composefs", "/this/does/not/exist")
+	assertTestFailed(t, out, err, "Error reading composefs blob")
+
+	// fs-verity is not enabled for files created by tests
+	path := filepath.Join(t.TempDir(), "composefs.blob")
+	err = os.WriteFile(path, make([]byte, 32), 0o644)
+	require.NoError(t, err)
+	out, err = runSkopeo("verify-composefs", "--expected", "sha256:0000", path)
+	assertTestFailed(t, out, err, "Error measuring the fs-verity digest")
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"time"
+
+	"github.com/containers/common/pkg/retry"
+	"github.com/containers/image/v5/copy"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+)
+
+// verifyAfterPush reads back the manifest of destRef, and checks that it matches pushedManifest, the manifest written by an
+// image copy; it also checks the manifests of the copied instances of a list, and the digests and sizes of up to sampleBlobs
+// randomly chosen blobs.
+func verifyAfterPush(ctx context.Context, sys *types.SystemContext, destRef types.ImageReference, pushedManifest []byte,
+	imageListSelection copy.ImageListSelection, sampleBlobs int, retryOpts *retry.Options, stdout io.Writer) (retErr error) {
+	var src types.ImageSource
+	if err := retry.IfNecessary(ctx, func() error {
+		var err error
+		src, err = destRef.NewImageSource(ctx, sys)
+		return err
+	}, retryOpts); err != nil {
+		return fmt.Errorf("reading back the destination image: %w", err)
+	}
+	defer func() {
+		if err := src.Close(); err != nil {
+			retErr = noteCloseFailure(retErr, "closing image", err)
+		}
+	}()
+
+	pushedDigest, err := manifest.Digest(pushedManifest)
+	if err != nil {
+		return err
+	}
+	if _, err := verifyPushedManifest(ctx, src, nil, pushedDigest, retryOpts); err != nil {
+		return err
+	}
+
+	manifests := [][]byte{pushedManifest}
+	mimeType := manifest.GuessMIMEType(pushedManifest)
+	if manifest.MIMETypeIsMultiImage(mimeType) {
+		manifests = [][]byte{}
+		// Otherwise, the instances were not copied, so there is nothing more to check.
+		if imageListSelection == copy.CopyAllImages {
+			list, err := manifest.ListFromBlob(pushedManifest, mimeType)
+			if err != nil {
+				return fmt.Errorf("parsing manifest list: %w", err)
+			}
+			for _, instance := range list.Instances() {
+				instance := instance
+				instanceManifest, err := verifyPushedManifest(ctx, src, &instance, instance, retryOpts)
+				if err != nil {
+					return err
+				}
+				manifests = append(manifests, instanceManifest)
+			}
+		}
+	}
+	if stdout != nil {
+		fmt.Fprintf(stdout, "Verified destination manifest %s\n", pushedDigest)
+	}
+
+	if sampleBlobs == 0 {
+		return nil
+	}
+	blobs := []types.BlobInfo{}
+	seen := map[digest.Digest]struct{}{}
+	for _, m := range manifests {
+		parsed, err := manifest.FromBlob(m, manifest.GuessMIMEType(m))
+		if err != nil {
+			return err
+		}
+		candidates := []types.BlobInfo{parsed.ConfigInfo()}
+		for _, layer := range parsed.LayerInfos() {
+			candidates = append(candidates, layer.BlobInfo)
+		}
+		for _, blob := range candidates {
+			if _, ok := seen[blob.Digest]; ok || blob.Digest == "" {
+				continue
+			}
+			seen[blob.Digest] = struct{}{}
+			blobs = append(blobs, blob)
+		}
+	}
+	rand.New(rand.NewSource(time.Now().UnixNano())).Shuffle(len(blobs), func(i, j int) {
+		blobs[i], blobs[j] = blobs[j], blobs[i]
+	})
+	if len(blobs) > sampleBlobs {
+		blobs = blobs[:sampleBlobs]
+	}
+	for _, blob := range blobs {
+		if err := retry.IfNecessary(ctx, func() error {
+			return verifyPushedBlob(ctx, src, blob)
+		}, retryOpts); err != nil {
+			return err
+		}
+		if stdout != nil {
+			fmt.Fprintf(stdout, "Verified destination blob %s\n", blob.Digest)
+		}
+	}
+	return nil
+}
+
+// verifyPushedManifest checks that the manifest of instanceDigest (or the top-level manifest, if nil) in src has expectedDigest,
+// and returns it.
+func verifyPushedManifest(ctx context.Context, src types.ImageSource, instanceDigest *digest.Digest, expectedDigest digest.Digest,
+	retryOpts *retry.Options) ([]byte, error) {
+	var m []byte
+	if err := retry.IfNecessary(ctx, func() error {
+		var err error
+		m, _, err = src.GetManifest(ctx, instanceDigest)
+		return err
+	}, retryOpts); err != nil {
+		return nil, fmt.Errorf("reading back manifest %s: %w", expectedDigest, err)
+	}
+	matches, err := manifest.MatchesDigest(m, expectedDigest)
+	if err != nil {
+		return nil, err
+	}
+	if !matches {
+		actualDigest, err := manifest.Digest(m)
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("verification after push failed: the destination manifest has digest %s, but %s was pushed", actualDigest, expectedDigest)
+	}
+	return m, nil
+}
+
+// verifyPushedBlob checks that the contents of blob in src match its digest and size.
+func verifyPushedBlob(ctx context.Context, src types.ImageSource, blob types.BlobInfo) error {
+	reader, _, err := src.GetBlob(ctx, blob, none.NoCache)
+	if err != nil {
+		return fmt.Errorf("reading back blob %s: %w", blob.Digest, err)
+	}
+	defer reader.Close()
+	verifier := blob.Digest.Verifier()
+	size, err := io.Copy(verifier, reader)
+	if err != nil {
+		return fmt.Errorf("reading back blob %s: %w", blob.Digest, err)
+	}
+	if !verifier.Verified() {
+		return fmt.Errorf("verification after push failed: the contents of destination blob %s don't match its digest", blob.Digest)
+	}
+	if blob.Size != -1 && size != blob.Size {
+		return fmt.Errorf("verification after push failed: destination blob %s has %d bytes, expected %d", blob.Digest, size, blob.Size)
+	}
+	return nil
+}
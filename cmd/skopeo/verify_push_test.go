@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/common/pkg/retry"
+	"github.com/containers/image/v5/copy"
+	"github.com/containers/image/v5/directory"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopyVerifyAfterPush(t *testing.T) {
+	src := testDirImageWithBlobs(t)
+	dest := t.TempDir()
+	out, err := runSkopeo("--insecure-policy", "copy", "--verify-after-push", "--verify-sample-blobs", "5", "dir:"+src, "dir:"+dest)
+	require.NoError(t, err)
+	assert.Regexp(t, "\nVerified destination manifest sha256:[0-9a-f]{64}\n"+
+		"Verified destination blob sha256:[0-9a-f]{64}\nVerified destination blob sha256:[0-9a-f]{64}\n$", out)
+
+	out, err = runSkopeo("--insecure-policy", "copy", "--verify-sample-blobs", "5", "dir:"+src, "dir:"+t.TempDir())
+	assertTestFailed(t, out, err, "can only be used together with --verify-after-push")
+	out, err = runSkopeo("--insecure-policy", "copy", "--verify-after-push", "--verify-sample-blobs", "-1", "dir:"+src, "dir:"+t.TempDir())
+	assertTestFailed(t, out, err, "must not be negative")
+}
+
+func TestVerifyAfterPush(t *testing.T) {
+	ctx := context.Background()
+	src := testDirImageWithBlobs(t)
+	pushedManifest, err := os.ReadFile(filepath.Join(src, "manifest.json"))
+	require.NoError(t, err)
+	ref, err := directory.NewReference(src)
+	require.NoError(t, err)
+	retryOpts := &retry.Options{}
+
+	err = verifyAfterPush(ctx, nil, ref, pushedManifest, copy.CopySystemImage, 5, retryOpts, nil)
+	assert.NoError(t, err)
+
+	// A modified manifest is detected
+	err = verifyAfterPush(ctx, nil, ref, []byte(string(pushedManifest)+"\n"), copy.CopySystemImage, 0, retryOpts, nil)
+	assert.ErrorContains(t, err, "verification after push failed")
+
+	// A modified blob is detected
+	layerPath := filepath.Join(src, digest.FromBytes([]byte("not really a layer")).Encoded()) // As created by testDirImageWithBlobs
+	err = os.WriteFile(layerPath, []byte("not the original layer"), 0o644)
+	require.NoError(t, err)
+	err = verifyAfterPush(ctx, nil, ref, pushedManifest, copy.CopySystemImage, 0, retryOpts, nil)
+	assert.NoError(t, err) // Blobs are not checked unless requested
+	err = verifyAfterPush(ctx, nil, ref, pushedManifest, copy.CopySystemImage, 5, retryOpts, nil)
+	assert.ErrorContains(t, err, "verification after push failed")
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/storage"
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/types"
+	cstorage "github.com/containers/storage"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sirupsen/logrus"
+)
+
+// composefsVerityAnnotation is set on layer descriptors by --embed-verity-annotations to the fs-verity digest of the composefs blob
+// containers/storage has generated for the layer, in the ALGORITHM:HEX form.
+const composefsVerityAnnotation = "containers.composefs.verity"
+
+// embedVerityAnnotations enables fs-verity for the composefs blobs of the layers of the image stored at ref, a containers-storage: reference
+// using the default store, records their fs-verity digests in composefsVerityAnnotation annotations of the layers in the manifest of the image,
+// stores the updated manifest, and returns it.
+// Layers which are not stored using composefs are not annotated.
+func embedVerityAnnotations(ref types.ImageReference) ([]byte, error) {
+	_, img, err := storage.ResolveReference(ref)
+	if err != nil {
+		return nil, fmt.Errorf("Error looking up %s: %w", transports.ImageName(ref), err)
+	}
+	store := storage.Transport.GetStoreIfSet() // --dest-enable-verity does not allow a store specification, so ref uses the default store
+	if store == nil {
+		return nil, errors.New("internal error: the containers-storage: store is not initialized")
+	}
+	manifestBlob, err := store.ImageBigData(img.ID, cstorage.ImageDigestBigDataKey)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading the manifest of %s: %w", transports.ImageName(ref), err)
+	}
+	if mimeType := manifest.GuessMIMEType(manifestBlob); mimeType != imgspecv1.MediaTypeImageManifest {
+		return nil, fmt.Errorf("--embed-verity-annotations requires an OCI image manifest, not %s (consider --format oci)", mimeType)
+	}
+	m, err := manifest.OCI1FromManifest(manifestBlob)
+	if err != nil {
+		return nil, err
+	}
+
+	layerIDs := []string{}
+	for layerID := img.TopLayer; layerID != ""; {
+		layer, err := store.Layer(layerID)
+		if err != nil {
+			return nil, fmt.Errorf("Error looking up layer %s: %w", layerID, err)
+		}
+		layerIDs = append([]string{layer.ID}, layerIDs...)
+		layerID = layer.Parent
+	}
+	if len(layerIDs) != len(m.Layers) {
+		return nil, fmt.Errorf("internal error: the image has %d layers in the store, but %d in its manifest", len(layerIDs), len(m.Layers))
+	}
+	annotated := 0
+	for i, layerID := range layerIDs {
+		dir, err := store.DifferTarget(layerID)
+		if err != nil {
+			return nil, fmt.Errorf("Error looking up the directory of layer %s: %w", layerID, err)
+		}
+		blobPath := composefsBlobPath(dir)
+		if _, err := os.Stat(blobPath); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		if err := enableVerity(blobPath); err != nil {
+			return nil, fmt.Errorf("enabling fs-verity for the composefs blob of layer %s: %w", layerID, err)
+		}
+		algorithm, digest, err := measureVerity(blobPath)
+		if err != nil {
+			return nil, fmt.Errorf("measuring the fs-verity digest of the composefs blob of layer %s: %w", layerID, err)
+		}
+		if m.Layers[i].Annotations == nil {
+			m.Layers[i].Annotations = map[string]string{}
+		}
+		m.Layers[i].Annotations[composefsVerityAnnotation] = algorithm + ":" + digest
+		annotated++
+	}
+	if annotated == 0 {
+		logrus.Warnf("No layer of %s is stored using composefs; the manifest is not annotated", transports.ImageName(ref))
+		return manifestBlob, nil
+	}
+	if annotated != len(layerIDs) {
+		logrus.Warnf("Only %d of %d layers of %s are stored using composefs, and annotated", annotated, len(layerIDs), transports.ImageName(ref))
+	}
+
+	updated, err := m.Serialize()
+	if err != nil {
+		return nil, err
+	}
+	updatedDigest, err := manifest.Digest(updated)
+	if err != nil {
+		return nil, err
+	}
+	// Record the manifest like the containers-storage: transport does, so that it is found both by digest and as the default manifest.
+	for _, key := range []string{cstorage.ImageDigestManifestBigDataNamePrefix + "-" + updatedDigest.String(), cstorage.ImageDigestBigDataKey} {
+		if err := store.SetImageBigData(img.ID, key, updated, manifest.Digest); err != nil {
+			return nil, fmt.Errorf("Error storing the annotated manifest of %s: %w", transports.ImageName(ref), err)
+		}
+	}
+	return updated, nil
+}
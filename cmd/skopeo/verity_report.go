@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/containers/image/v5/storage"
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/types"
+	"golang.org/x/sync/errgroup"
+)
+
+// layerVerityDigests enables fs-verity for the regular files of every layer of the image stored at ref, a containers-storage: reference,
+// like containers/storage does for layers stored using composefs, and returns their fs-verity digests in the ALGORITHM:HEX form,
+// indexed by the uncompressed digest of the layer (or its ID, if that is not known) and by the path relative to the layer directory.
+// Up to workers files are processed concurrently.
+func layerVerityDigests(ref types.ImageReference, workers int) (map[string]map[string]string, error) {
+	_, img, err := storage.ResolveReference(ref)
+	if err != nil {
+		return nil, fmt.Errorf("Error looking up %s: %w", transports.ImageName(ref), err)
+	}
+	store := storage.Transport.GetStoreIfSet() // --dest-enable-verity does not allow a store specification, so ref uses the default store
+	if store == nil {
+		return nil, errors.New("internal error: the containers-storage: store is not initialized")
+	}
+	res := map[string]map[string]string{}
+	for layerID := img.TopLayer; layerID != ""; {
+		layer, err := store.Layer(layerID)
+		if err != nil {
+			return nil, fmt.Errorf("Error looking up layer %s: %w", layerID, err)
+		}
+		dir, err := store.DifferTarget(layer.ID)
+		if err != nil {
+			return nil, fmt.Errorf("Error looking up the directory of layer %s: %w", layer.ID, err)
+		}
+		digests, err := layerDirVerityDigests(dir, workers)
+		if err != nil {
+			return nil, fmt.Errorf("layer %s: %w", layer.ID, err)
+		}
+		key := layer.ID
+		if layer.UncompressedDigest != "" {
+			key = layer.UncompressedDigest.String()
+		}
+		res[key] = digests
+		layerID = layer.Parent
+	}
+	return res, nil
+}
+
+// layerDirVerityDigests enables fs-verity for the regular files in dir, and returns their fs-verity digests in the ALGORITHM:HEX form,
+// indexed by the path relative to dir. Up to workers files are processed concurrently; if processing several files fails,
+// the error for the first one in the order of filepath.WalkDir is returned.
+func layerDirVerityDigests(dir string, workers int) (map[string]string, error) {
+	paths := []string{}
+	if err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			paths = append(paths, rel)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	results := make([]string, len(paths))
+	errs := make([]error, len(paths))
+	var group errgroup.Group
+	group.SetLimit(workers)
+	for i, rel := range paths {
+		i, rel := i, rel
+		group.Go(func() error {
+			path := filepath.Join(dir, rel)
+			if err := enableVerity(path); err != nil {
+				errs[i] = fmt.Errorf("enabling fs-verity for %s: %w", rel, err)
+				return nil
+			}
+			algorithm, digest, err := measureVerity(path)
+			if err != nil {
+				errs[i] = fmt.Errorf("measuring the fs-verity digest of %s: %w", rel, err)
+				return nil
+			}
+			results[i] = algorithm + ":" + digest
+			return nil
+		})
+	}
+	_ = group.Wait() // Errors are recorded in errs, so that the reported one does not depend on scheduling.
+	digests := map[string]string{}
+	for i, rel := range paths {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		digests[rel] = results[i]
+	}
+	return digests, nil
+}
+
+// writeVerityReport writes the layerVerityDigests of the image stored at ref, computed using up to workers concurrent workers, to path, as JSON.
+func writeVerityReport(ref types.ImageReference, workers int, path string) error {
+	digests, err := layerVerityDigests(ref, workers)
+	if err != nil {
+		return err
+	}
+	report, err := json.MarshalIndent(digests, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(report, '\n'), 0o644); err != nil {
+		return fmt.Errorf("Failed to write the fs-verity report to %q: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLayerDirVerityDigests(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a", "b", "c/d", "c/e"} {
+		err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755)
+		require.NoError(t, err)
+		err = os.WriteFile(filepath.Join(dir, name), []byte(name), 0o644)
+		require.NoError(t, err)
+	}
+	err := os.Symlink("a", filepath.Join(dir, "link"))
+	require.NoError(t, err)
+
+	for _, workers := range []int{1, 4} {
+		digests, err := layerDirVerityDigests(dir, workers)
+		if err != nil {
+			// fs-verity is not supported by the filesystem; the error is reported for the first file, regardless of the number of workers.
+			assert.ErrorContains(t, err, "enabling fs-verity for a:")
+			continue
+		}
+		assert.Len(t, digests, 4) // Symbolic links are not included
+		for _, name := range []string{"a", "b", "c/d", "c/e"} {
+			assert.Contains(t, digests, name)
+		}
+	}
+}
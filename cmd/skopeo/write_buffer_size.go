@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"io"
+
+	"github.com/containers/image/v5/types"
+)
+
+// writeBufferSizeReference is a types.ImageReference wrapper; image destinations created from it
+// write blobs to the underlying file-based destination in chunks of up to size bytes.
+type writeBufferSizeReference struct {
+	types.ImageReference
+	size int
+}
+
+// NewImageDestination returns a types.ImageDestination for this reference.
+// The caller must call .Close() on the returned ImageDestination.
+func (ref writeBufferSizeReference) NewImageDestination(ctx context.Context, sys *types.SystemContext) (types.ImageDestination, error) {
+	dest, err := ref.ImageReference.NewImageDestination(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	return writeBufferSizeDestination{ImageDestination: dest, ref: ref}, nil
+}
+
+// writeBufferSizeDestination is a types.ImageDestination wrapper which streams blobs in chunks of ref.size.
+type writeBufferSizeDestination struct {
+	types.ImageDestination
+	ref writeBufferSizeReference
+}
+
+// Reference returns the reference used to set up this destination.
+func (d writeBufferSizeDestination) Reference() types.ImageReference {
+	return d.ref
+}
+
+// PutBlob writes contents of stream and returns data representing the result.
+func (d writeBufferSizeDestination) PutBlob(ctx context.Context, stream io.Reader, inputInfo types.BlobInfo, cache types.BlobInfoCache, isConfig bool) (types.BlobInfo, error) {
+	return d.ImageDestination.PutBlob(ctx, &chunkedReader{reader: stream, size: d.ref.size}, inputInfo, cache, isConfig)
+}
+
+// chunkedReader is an io.Reader which returns at most size bytes from a single Read.
+// When it is the source of io.Copy, it writes the data in chunks of exactly size bytes (except for the last one),
+// instead of the 32 kB chunks used by io.Copy, or the single large write used by some file systems for os.File.ReadFrom.
+//
+// The underlying destination may wrap the stream in another reader (e.g. to compute a digest if it is unknown);
+// then size only limits the length of the writes, while io.Copy may write less than size at a time.
+type chunkedReader struct {
+	reader io.Reader
+	size   int
+}
+
+// Read implements io.Reader.
+func (r *chunkedReader) Read(p []byte) (int, error) {
+	if len(p) > r.size {
+		p = p[:r.size]
+	}
+	return r.reader.Read(p)
+}
+
+// WriteTo implements io.WriterTo.
+func (r *chunkedReader) WriteTo(w io.Writer) (int64, error) {
+	buf := make([]byte, r.size)
+	total := int64(0)
+	for {
+		n, err := io.ReadFull(r.reader, buf)
+		if n > 0 {
+			written, writeErr := w.Write(buf[:n])
+			total += int64(written)
+			if writeErr != nil {
+				return total, writeErr
+			}
+			if written != n {
+				return total, io.ErrShortWrite
+			}
+		}
+		switch err {
+		case nil:
+		case io.EOF, io.ErrUnexpectedEOF:
+			return total, nil
+		default:
+			return total, err
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeSizeRecorder is an io.Writer which records the lengths of individual writes.
+type writeSizeRecorder struct {
+	bytes.Buffer
+	sizes []int
+}
+
+func (w *writeSizeRecorder) Write(p []byte) (int, error) {
+	w.sizes = append(w.sizes, len(p))
+	return w.Buffer.Write(p)
+}
+
+func TestChunkedReader(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 10)
+
+	w := &writeSizeRecorder{}
+	n, err := io.Copy(w, &chunkedReader{reader: bytes.NewReader(data), size: 30})
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(data)), n)
+	assert.Equal(t, data, w.Bytes())
+	assert.Equal(t, []int{30, 30, 30, 10}, w.sizes)
+
+	w = &writeSizeRecorder{}
+	n, err = io.Copy(w, &chunkedReader{reader: bytes.NewReader(data), size: 50})
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(data)), n)
+	assert.Equal(t, []int{50, 50}, w.sizes)
+
+	// Reads through another reader are limited to size.
+	buf := make([]byte, 100)
+	n2, err := io.TeeReader(&chunkedReader{reader: bytes.NewReader(data), size: 30}, io.Discard).Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, 30, n2)
+}
+
+func TestCopyWriteBufferSize(t *testing.T) {
+	src := testDirImageWithBlobs(t)
+	dest := t.TempDir()
+	_, err := runSkopeo("--insecure-policy", "copy", "--write-buffer-size", "4", "dir:"+src, "dir:"+dest)
+	require.NoError(t, err)
+	for _, name := range []string{"manifest.json", digest.FromString("not really a layer").Encoded()} {
+		expected, err := os.ReadFile(filepath.Join(src, name))
+		require.NoError(t, err)
+		actual, err := os.ReadFile(filepath.Join(dest, name))
+		require.NoError(t, err)
+		assert.Equal(t, expected, actual, name)
+	}
+
+	out, err := runSkopeo("--insecure-policy", "copy", "--write-buffer-size", "-1", "dir:"+src, "dir:"+t.TempDir())
+	assertTestFailed(t, out, err, "must not be negative")
+	out, err = runSkopeo("--insecure-policy", "copy", "--write-buffer-size", "4", "dir:"+src, "docker-archive:"+filepath.Join(t.TempDir(), "archive.tar"))
+	assertTestFailed(t, out, err, "only supported for dir: and oci: destinations")
+}
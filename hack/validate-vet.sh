@@ -1,6 +1,10 @@
 #!/bin/bash
 
 errors=$(go vet -tags="${BUILDTAGS}" ./... 2>&1)
+# Platform-specific files only build for some targets; check the ones built by "make local-cross" as well.
+for goos in darwin windows; do
+	errors+=$(GOOS=$goos go vet -tags="containers_image_openpgp ${BUILDTAGS}" ./cmd/skopeo 2>&1)
+done
 
 if [ -z "$errors" ]; then
 	echo 'Congratulations!  All Go source files have been vetted.'
@@ -332,6 +332,79 @@ func runTestOpenImageOptionalNotFound(p *proxy, img string) error {
 	return nil
 }
 
+func runTestGetBlobEvents(p *proxy, img string) error {
+	v, err := p.callNoFd("OpenImage", []any{img})
+	if err != nil {
+		return err
+	}
+	imgidv, ok := v.(float64)
+	if !ok {
+		return fmt.Errorf("OpenImage return value is %T", v)
+	}
+	imgid := uint64(imgidv)
+
+	_, events, err := p.call("OpenEventStream", nil)
+	if err != nil {
+		return err
+	}
+	if events == nil {
+		return fmt.Errorf("Expected fd from method OpenEventStream")
+	}
+	defer events.fd.Close()
+	eventchan := make(chan byteFetch)
+	go func() {
+		eventBytes, err := io.ReadAll(events.fd)
+		eventchan <- byteFetch{
+			content: eventBytes,
+			err:     err,
+		}
+	}()
+
+	_, manifestBytes, err := p.callReadAllBytes("GetManifest", []any{imgid})
+	if err != nil {
+		return err
+	}
+	mfest, err := manifest.OCI1FromManifest(manifestBytes)
+	if err != nil {
+		return err
+	}
+	if len(mfest.Layers) == 0 {
+		return fmt.Errorf("No layers found")
+	}
+	layer := mfest.Layers[0]
+	_, blobBytes, err := p.callReadAllBytes("GetBlob", []any{imgid, layer.Digest.String(), layer.Size})
+	if err != nil {
+		return err
+	}
+	if int64(len(blobBytes)) != layer.Size {
+		return fmt.Errorf("Unexpected blob size %d, expected %d", len(blobBytes), layer.Size)
+	}
+
+	_, err = p.callNoFd("FinishPipe", []any{events.id})
+	if err != nil {
+		return err
+	}
+	fetchRes := <-eventchan
+	if fetchRes.err != nil {
+		return fetchRes.err
+	}
+	lines := strings.Split(strings.TrimSuffix(string(fetchRes.content), "\n"), "\n")
+	var lastEvent struct {
+		Digest    string `json:"digest"`
+		BytesRead int64  `json:"bytesRead"`
+		Total     int64  `json:"total"`
+	}
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &lastEvent); err != nil {
+		return fmt.Errorf("parsing event %q: %w", lines[len(lines)-1], err)
+	}
+	if lastEvent.Digest != layer.Digest.String() || lastEvent.BytesRead != layer.Size || lastEvent.Total != layer.Size {
+		return fmt.Errorf("Unexpected final event %#v", lastEvent)
+	}
+
+	_, err = p.callNoFd("CloseImage", []any{imgid})
+	return err
+}
+
 func (s *proxySuite) TestProxy() {
 	t := s.T()
 	p, err := newProxy()
@@ -349,6 +422,12 @@ func (s *proxySuite) TestProxy() {
 	}
 	assert.NoError(t, err)
 
+	err = runTestGetBlobEvents(p, knownNotManifestListedImageX8664)
+	if err != nil {
+		err = fmt.Errorf("Testing blob events for %s: %v", knownNotManifestListedImageX8664, err)
+	}
+	assert.NoError(t, err)
+
 	err = runTestOpenImageOptionalNotFound(p, knownNotExtantImage)
 	if err != nil {
 		err = fmt.Errorf("Testing optional image %s: %v", knownNotExtantImage, err)